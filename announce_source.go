@@ -0,0 +1,206 @@
+package varroa
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"gitlab.com/catastrophic/assistance/logthis"
+	"gitlab.com/catastrophic/assistance/strslice"
+	"gitlab.com/passelecasque/obstruction/tracker"
+)
+
+// AnnounceSource follows what a tracker announces, and sends the releases to the filters with analyzeRelease.
+type AnnounceSource interface {
+	// Start following announces in the background.
+	Start()
+	// Stop following announces, waiting until it is done.
+	Stop()
+	// String describes the state of the source.
+	String() string
+}
+
+// analyzeRelease checks an announced release against the filters, and queues it for snatching if one of them accepts it.
+// The announce and the verdicts are kept, whatever happens.
+func analyzeRelease(release *Release, e *Environment, t *tracker.Gazelle) error {
+	announces, err := NewAnnouncesDB(e.paths.AnnouncesDB())
+	if err != nil {
+		return errors.Wrap(err, "could not access the announces database")
+	}
+	err = filterRelease(release, e, e.Config(), t)
+	keepAnnounce(announces, release)
+	return err
+}
+
+// keepAnnounce adds the release and its verdicts to the announces database.
+func keepAnnounce(announces *AnnouncesDB, release *Release) {
+	if err := announces.Add(release); err != nil {
+		logthis.Error(errors.Wrap(err, errorAddingToAnnounces), logthis.NORMAL)
+	}
+}
+
+// filterRelease checks a release against the filters, keeping their verdicts, and queues it for snatching if one of
+// them accepts it. The whole analysis uses the same configuration, even if it is reloaded meanwhile.
+func filterRelease(release *Release, e *Environment, conf *Config, t *tracker.Gazelle) error {
+	autosnatchConfig, err := conf.GetAutosnatch(t.Name)
+	if err != nil {
+		return errors.Wrap(err, "autosnatching is not configured for tracker "+t.Name)
+	}
+	stats, err := NewStatsDB(e.paths.StatsDir(), conf)
+	if err != nil {
+		return errors.Wrap(err, "could not access the stats database")
+	}
+	queue, err := NewSnatchQueue(e.paths.SnatchQueueDB())
+	if err != nil {
+		return errors.Wrap(err, "could not access the snatch queue")
+	}
+
+	logthis.Info(release.String(), logthis.VERBOSEST)
+
+	// if satisfies a filter, queue for snatching
+	var downloadedInfo bool
+	var queuedTorrent bool
+	info := &TrackerMetadata{}
+	var torrentGroupInfo *tracker.GazelleTorrentGroup
+	for _, filter := range conf.Filters {
+		// checking if filter is specifically set for this tracker (if nothing is indicated, all trackers match)
+		if len(filter.Tracker) != 0 && !strslice.Contains(filter.Tracker, t.Name) {
+			logthis.Info(fmt.Sprintf(infoFilterIgnoredForTracker, filter.Name, t.Name), logthis.VERBOSE)
+			continue
+		}
+		// checking if the filter is active right now
+		if reason := filter.inactiveReason(time.Now()); reason != "" {
+			logthis.Info(fmt.Sprintf(infoFilterInactive, filter.Name, reason), logthis.VERBOSE)
+			continue
+		}
+		// checking if a filter is triggered
+		verdict := release.Satisfies(filter)
+		if verdict.Accepted() {
+			// getting torrent info
+			if !downloadedInfo {
+				if err := info.LoadFromID(t, release.TorrentID); err != nil {
+					return errors.Wrap(err, errorCouldNotGetTorrentInfo)
+				}
+				downloadedInfo = true
+				logthis.Info(info.TextDescription(false), logthis.VERBOSE)
+			}
+			// else check other criteria
+			verdict = release.HasCompatibleTrackerInfo(filter, autosnatchConfig.BlacklistedUploaders, info)
+		}
+		if !verdict.Accepted() {
+			release.Verdicts = append(release.Verdicts, *verdict)
+			continue
+		}
+		release.Filter = filter.Name
+
+		// checking if duplicate, including releases waiting to be snatched or snatched from another tracker
+		if rejectDuplicate(conf.General, stats, queue, filter, release, verdict) {
+			continue
+		}
+		// checking if the filter has reached one of its quotas, which cross-seeds do not count against
+		if !release.CrossSeed {
+			verdict, err = stats.CheckQuotas(filter, release, queue.PendingForFilter(filter.Name), verdict)
+			if err != nil {
+				logthis.Error(errors.Wrap(err, errorCheckingQuotas), logthis.NORMAL)
+				continue
+			}
+		}
+		if !verdict.Accepted() {
+			logthis.Info(verdict.String(), logthis.NORMAL)
+			release.Verdicts = append(release.Verdicts, *verdict)
+			if e.setQuotaReached(filter.Name, true) {
+				if err := Notify(verdict.String(), t.Name, "info", e); err != nil {
+					logthis.Error(err, logthis.NORMAL)
+				}
+			}
+			continue
+		}
+		e.setQuotaReached(filter.Name, false)
+		// checking if a torrent from the same group has already been downloaded
+		if rejectSameGroup(t, stats, queue, filter, release, info, verdict, &torrentGroupInfo) {
+			continue
+		}
+		// move to relevant watch directory
+		destination := conf.General.WatchDir
+		if filter.WatchDir != "" {
+			destination = filter.WatchDir
+		}
+		release.Verdicts = append(release.Verdicts, *verdict)
+		// the queue downloads the torrent, adds it to the history and sends the notification
+		added, err := queue.Add(release, filter.Name, destination, time.Duration(autosnatchConfig.SnatchDelaySeconds)*time.Second)
+		if err != nil {
+			return err
+		}
+		queuedTorrent = true
+		if !added {
+			logthis.Info(filter.Name+": "+infoAlreadyQueued, logthis.NORMAL)
+			release.Verdicts[len(release.Verdicts)-1] = *verdict.reject(CriterionDuplicate, infoAlreadyQueued, "not queued", "queued")
+			break
+		}
+		if release.CrossSeed {
+			logthis.Info(" -> "+release.ShortString()+" triggered filter "+filter.Name+", already snatched from another tracker, cross-seeding.", logthis.NORMAL)
+		} else {
+			logthis.Info(" -> "+release.ShortString()+" triggered filter "+filter.Name+", snatching.", logthis.NORMAL)
+		}
+		// no need to consider other filters
+		break
+	}
+	if !queuedTorrent {
+		logthis.Info(fmt.Sprintf(infoNotInteresting, release.ShortString()), logthis.VERBOSE)
+	}
+	return nil
+}
+
+// rejectDuplicate adds a rejection to the verdicts of the release if it, or the same release from another tracker,
+// has already been snatched or is waiting to be snatched, unless the filter allows duplicates.
+// release.CrossSeed is set if the release can be cross-seeded instead.
+func rejectDuplicate(conf *ConfigGeneral, stats *StatsDB, queue *SnatchQueue, filter *ConfigFilter, release *Release, verdict *FilterVerdict) bool {
+	release.CrossSeed = false
+	if filter.AllowDuplicates {
+		return false
+	}
+	if stats.AlreadySnatchedDuplicate(release) || queue.QueuedDuplicate(release) {
+		logthis.Info(filter.Name+": "+infoNotSnatchingDuplicate, logthis.VERBOSE)
+		release.Verdicts = append(release.Verdicts, *verdict.reject(CriterionDuplicate, infoNotSnatchingDuplicate, "not snatched", "snatched"))
+		return true
+	}
+	// checking if the same release has been snatched from another tracker
+	if original := crossTrackerDuplicate(conf, stats, queue, release); original != nil {
+		if reason := crossSeedRefusal(conf, release, original); reason != "" {
+			logthis.Info(filter.Name+": "+infoNotSnatchingDuplicate+" ("+reason+")", logthis.VERBOSE)
+			release.Verdicts = append(release.Verdicts, *verdict.reject(CriterionDuplicate, infoNotSnatchingDuplicate, "not snatched", "snatched on "+original.Tracker))
+			return true
+		}
+		release.CrossSeed = true
+	}
+	return false
+}
+
+// rejectSameGroup adds a rejection to the verdicts of the release if the filter only allows one torrent per group,
+// and one has already been snatched, by varroa or on the tracker. groupInfo keeps the torrent group between calls.
+func rejectSameGroup(t *tracker.Gazelle, stats *StatsDB, queue *SnatchQueue, filter *ConfigFilter, release *Release, info *TrackerMetadata, verdict *FilterVerdict, groupInfo **tracker.GazelleTorrentGroup) bool {
+	if !filter.UniqueInGroup {
+		return false
+	}
+	// if varroa knows about the group, rejecting
+	if stats.AlreadySnatchedFromGroup(release) || queue.QueuedFromGroup(release) {
+		logthis.Info(filter.Name+": "+infoNotSnatchingUniqueInGroup, logthis.VERBOSE)
+		release.Verdicts = append(release.Verdicts, *verdict.reject(CriterionUniqueInGroup, infoNotSnatchingUniqueInGroup, "nothing snatched from group", "snatched with varroa"))
+		return true
+	}
+	// else, getting the torrentgroup to check if the site itself know about past snatches
+	if *groupInfo == nil {
+		group, err := t.GetTorrentGroup(info.GroupID)
+		if err != nil {
+			logthis.Error(errors.Wrap(err, "error retrieving torrent group info"), logthis.NORMAL)
+			return false
+		}
+		*groupInfo = group
+	}
+	if (*groupInfo).AlreadySnatched() {
+		logthis.Info(filter.Name+": "+infoNotSnatchingUniqueInGroup, logthis.VERBOSE)
+		release.Verdicts = append(release.Verdicts, *verdict.reject(CriterionUniqueInGroup, infoNotSnatchingUniqueInGroup, "nothing snatched from group", "snatched on tracker"))
+		return true
+	}
+	return false
+}
@@ -0,0 +1,214 @@
+package varroa
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/asdine/storm"
+	"github.com/asdine/storm/q"
+	"github.com/pkg/errors"
+	"gitlab.com/catastrophic/assistance/logthis"
+)
+
+var announcesDB *AnnouncesDB
+var onceAnnouncesDB sync.Once
+
+// AnnouncesDB keeps all parsed announces, with the verdicts of all filters, for a limited time.
+type AnnouncesDB struct {
+	db *Database
+}
+
+func NewAnnouncesDB(path string) (*AnnouncesDB, error) {
+	var returnErr error
+	onceAnnouncesDB.Do(func() {
+		db, err := NewDatabase(path)
+		if err != nil {
+			returnErr = errors.Wrap(err, "Error opening announces database")
+			return
+		}
+		announcesDB = &AnnouncesDB{db: db}
+		returnErr = announcesDB.init()
+	})
+	return announcesDB, returnErr
+}
+
+// useAnnouncesDB makes NewAnnouncesDB return adb instead of opening the database, and returns the database it replaces.
+func useAnnouncesDB(adb *AnnouncesDB) *AnnouncesDB {
+	onceAnnouncesDB.Do(func() {})
+	previous := announcesDB
+	announcesDB = adb
+	return previous
+}
+
+func (adb *AnnouncesDB) init() error {
+	if err := adb.db.DB.Init(&Announce{}); err != nil {
+		return err
+	}
+	return adb.db.DB.Init(&FeedItemSeen{})
+}
+
+func (adb *AnnouncesDB) Close() error {
+	return adb.db.Close()
+}
+
+// Announce is a parsed announce, along with the verdicts of all filters.
+type Announce struct {
+	ID              uint32    `storm:"id,increment"`
+	Timestamp       time.Time `storm:"index"`
+	Tracker         string    `storm:"index"`
+	Artists         []string
+	Tags            []string
+	Filter          string
+	NearMiss        bool
+	NearMissFilters []string
+	Release         Release
+}
+
+// NewAnnounce from a release that has been checked against the filters.
+func NewAnnounce(release *Release) *Announce {
+	a := &Announce{Timestamp: release.Timestamp, Tracker: release.Tracker, Artists: release.Artists, Tags: release.Tags, Release: *release}
+	for _, v := range release.Verdicts {
+		if v.Accepted() {
+			a.Filter = v.Filter
+		} else if v.NearMiss() {
+			a.NearMissFilters = append(a.NearMissFilters, v.Filter)
+		}
+	}
+	a.NearMiss = len(a.NearMissFilters) != 0
+	return a
+}
+
+// Snatched returns true if the announce triggered a filter.
+func (a *Announce) Snatched() bool {
+	return a.Filter != ""
+}
+
+func (a *Announce) String() string {
+	txt := fmt.Sprintf("%s [%s] %s", a.Timestamp.Format("2006.01.02 15h04"), a.Tracker, a.Release.ShortString())
+	if a.Snatched() {
+		txt += ", snatched by filter " + a.Filter
+	}
+	for _, v := range a.Release.Verdicts {
+		if !v.Accepted() {
+			txt += "\n\t" + v.String()
+		}
+	}
+	return txt
+}
+
+func (adb *AnnouncesDB) Add(release *Release) error {
+	return adb.db.DB.Save(NewAnnounce(release))
+}
+
+// AnnounceQuery describes which announces to look for. Empty fields match all announces.
+type AnnounceQuery struct {
+	Artist   string
+	Tag      string
+	Filter   string
+	NearMiss bool
+	Limit    int
+}
+
+// Args encodes the query to send it to the daemon.
+func (aq AnnounceQuery) Args() []string {
+	return []string{aq.Artist, aq.Tag, aq.Filter, strconv.FormatBool(aq.NearMiss), strconv.Itoa(aq.Limit)}
+}
+
+// NewAnnounceQueryFromArgs decodes a query sent to the daemon.
+func NewAnnounceQueryFromArgs(args []string) AnnounceQuery {
+	var aq AnnounceQuery
+	if len(args) != 5 {
+		return aq
+	}
+	aq.Artist, aq.Tag, aq.Filter = args[0], args[1], args[2]
+	aq.NearMiss, _ = strconv.ParseBool(args[3])
+	aq.Limit, _ = strconv.Atoi(args[4])
+	return aq
+}
+
+// FeedItemSeen remembers an item of a feed, so that it is only considered once.
+// Failures counts the failed attempts at analyzing an item that will be tried again.
+type FeedItemSeen struct {
+	Key       string    `storm:"id"`
+	Timestamp time.Time `storm:"index"`
+	Failures  int
+}
+
+func feedItemKey(tracker, guid string) string {
+	return tracker + "|" + guid
+}
+
+// SeenFeedItem returns true if the item of the tracker's feed has already been considered.
+func (adb *AnnouncesDB) SeenFeedItem(tracker, guid string) bool {
+	var seen FeedItemSeen
+	if err := adb.db.DB.One("Key", feedItemKey(tracker, guid), &seen); err != nil {
+		if err != storm.ErrNotFound {
+			logthis.Error(errors.Wrap(err, "error looking for feed items"), logthis.NORMAL)
+		}
+		return false
+	}
+	return seen.Failures == 0
+}
+
+// AddSeenFeedItem so that it is not considered again.
+func (adb *AnnouncesDB) AddSeenFeedItem(tracker, guid string) error {
+	return adb.db.DB.Save(&FeedItemSeen{Key: feedItemKey(tracker, guid), Timestamp: time.Now()})
+}
+
+// AddFeedItemFailure counts a failed attempt at analyzing an item of the tracker's feed, and returns how many there were.
+func (adb *AnnouncesDB) AddFeedItemFailure(tracker, guid string) (int, error) {
+	item := FeedItemSeen{Key: feedItemKey(tracker, guid)}
+	if err := adb.db.DB.One("Key", item.Key, &item); err != nil && err != storm.ErrNotFound {
+		return 0, err
+	}
+	item.Failures++
+	item.Timestamp = time.Now()
+	return item.Failures, adb.db.DB.Save(&item)
+}
+
+// Search the announces matching the query, most recent first.
+// If a filter is given, only the announces it snatched or nearly snatched are returned.
+func (adb *AnnouncesDB) Search(query AnnounceQuery) ([]Announce, error) {
+	matchers := []q.Matcher{q.True()}
+	if query.Artist != "" {
+		matchers = append(matchers, InSlice("Artists", query.Artist))
+	}
+	if query.Tag != "" {
+		matchers = append(matchers, InSlice("Tags", query.Tag))
+	}
+	if query.NearMiss {
+		matchers = append(matchers, q.Eq("NearMiss", true))
+		if query.Filter != "" {
+			matchers = append(matchers, InSlice("NearMissFilters", query.Filter))
+		}
+	} else if query.Filter != "" {
+		matchers = append(matchers, q.Or(q.Eq("Filter", query.Filter), InSlice("NearMissFilters", query.Filter)))
+	}
+	var hits []Announce
+	if err := adb.db.DB.Select(matchers...).Find(&hits); err != nil && err != storm.ErrNotFound {
+		return nil, errors.Wrap(err, "could not search announces")
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		return hits[i].Timestamp.After(hits[j].Timestamp)
+	})
+	if query.Limit > 0 && len(hits) > query.Limit {
+		hits = hits[:query.Limit]
+	}
+	return hits, nil
+}
+
+// Purge the announces older than the retention period.
+func (adb *AnnouncesDB) Purge(retentionDays int) error {
+	oldest := time.Now().AddDate(0, 0, -retentionDays)
+	if err := adb.db.DB.Select(q.Lt("Timestamp", oldest)).Delete(&Announce{}); err != nil && err != storm.ErrNotFound {
+		return errors.Wrap(err, "could not remove old announces")
+	}
+	if err := adb.db.DB.Select(q.Lt("Timestamp", oldest)).Delete(&FeedItemSeen{}); err != nil && err != storm.ErrNotFound {
+		return errors.Wrap(err, "could not remove old feed items")
+	}
+	logthis.Info(fmt.Sprintf("Removed announces older than %d days.", retentionDays), logthis.VERBOSE)
+	return nil
+}
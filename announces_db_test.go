@@ -0,0 +1,91 @@
+package varroa
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnnouncesDB(t *testing.T) {
+	fmt.Println("+ Testing AnnouncesDB...")
+	check := assert.New(t)
+
+	// setting up
+	dbPath := filepath.Join("test", "test_announces.db")
+	defer os.Remove(dbPath)
+	announces, err := NewAnnouncesDB(dbPath)
+	check.Nil(err)
+	defer announces.Close()
+
+	fFLAC := &ConfigFilter{Name: "flac", Format: []string{"FLAC"}}
+	fCD := &ConfigFilter{Name: "cd", Format: []string{"FLAC"}, Source: []string{"CD"}}
+	fMP3 := &ConfigFilter{Name: "mp3", Format: []string{"MP3"}, Source: []string{"CD"}}
+
+	r1 := &Release{Tracker: "blue", Timestamp: time.Now(), Artists: []string{"a"}, Title: "t1", Format: "FLAC", Source: "WEB", Tags: []string{"jazz"}}
+	r2 := &Release{Tracker: "blue", Timestamp: time.Now().AddDate(0, 0, -10), Artists: []string{"b"}, Title: "t2", Format: "AAC", Source: "WEB", Tags: []string{"rock"}}
+	for _, r := range []*Release{r1, r2} {
+		for _, f := range []*ConfigFilter{fFLAC, fCD, fMP3} {
+			r.Verdicts = append(r.Verdicts, *r.Satisfies(f))
+		}
+	}
+
+	// r1: snatched by flac, near-miss for cd (source), rejected by mp3 (format, source)
+	a1 := NewAnnounce(r1)
+	check.True(a1.Snatched())
+	check.Equal("flac", a1.Filter)
+	check.True(a1.NearMiss)
+	check.Equal([]string{"cd"}, a1.NearMissFilters)
+	// r2: near-miss for flac (format) only
+	a2 := NewAnnounce(r2)
+	check.False(a2.Snatched())
+	check.Equal([]string{"flac"}, a2.NearMissFilters)
+
+	check.Nil(announces.Add(r1))
+	check.Nil(announces.Add(r2))
+
+	hits, err := announces.Search(AnnounceQuery{})
+	check.Nil(err)
+	check.Equal(2, len(hits))
+	check.Equal("t1", hits[0].Release.Title)
+	check.Equal(3, len(hits[0].Release.Verdicts))
+
+	hits, err = announces.Search(AnnounceQuery{Artist: "b"})
+	check.Nil(err)
+	check.Equal(1, len(hits))
+	check.Equal("t2", hits[0].Release.Title)
+
+	hits, err = announces.Search(AnnounceQuery{Tag: "jazz"})
+	check.Nil(err)
+	check.Equal(1, len(hits))
+	check.Equal("t1", hits[0].Release.Title)
+
+	hits, err = announces.Search(AnnounceQuery{Filter: "flac"})
+	check.Nil(err)
+	check.Equal(2, len(hits))
+	hits, err = announces.Search(AnnounceQuery{Filter: "flac", NearMiss: true})
+	check.Nil(err)
+	check.Equal(1, len(hits))
+	check.Equal("t2", hits[0].Release.Title)
+	hits, err = announces.Search(AnnounceQuery{Filter: "mp3", NearMiss: true})
+	check.Nil(err)
+	check.Equal(0, len(hits))
+
+	hits, err = announces.Search(AnnounceQuery{Limit: 1})
+	check.Nil(err)
+	check.Equal(1, len(hits))
+
+	// query round-trip to the daemon
+	q := AnnounceQuery{Artist: "a", Tag: "jazz", Filter: "flac", NearMiss: true, Limit: 3}
+	check.Equal(q, NewAnnounceQueryFromArgs(q.Args()))
+
+	// retention
+	check.Nil(announces.Purge(5))
+	hits, err = announces.Search(AnnounceQuery{})
+	check.Nil(err)
+	check.Equal(1, len(hits))
+	check.Equal("t1", hits[0].Release.Title)
+}
@@ -0,0 +1,107 @@
+package varroa
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"gitlab.com/catastrophic/assistance/logthis"
+)
+
+const (
+	autosnatchEnableCommand  = "autosnatch-enable"
+	autosnatchDisableCommand = "autosnatch-disable"
+	reasonManualToggle       = "on request"
+	reasonStatsIncident      = "ratio or buffer unacceptable"
+	reasonStatsRecovered     = "ratio and buffer have recovered"
+)
+
+// EnableAutosnatching for the given trackers, or for all of them if none is given.
+func (e *Environment) EnableAutosnatching(reason string, trackers ...string) error {
+	return e.toggleAutosnatching(true, false, 0, reason, trackers...)
+}
+
+// DisableAutosnatching for the given trackers, or for all of them if none is given.
+// It will only be enabled again on request.
+func (e *Environment) DisableAutosnatching(reason string, trackers ...string) error {
+	return e.toggleAutosnatching(false, false, 0, reason, trackers...)
+}
+
+// disableAutosnatchingAfterIncident remembers the buffer, to re-enable autosnatching automatically once it has recovered.
+func (e *Environment) disableAutosnatchingAfterIncident(tracker string, buffer int64) error {
+	return e.toggleAutosnatching(false, true, buffer, reasonStatsIncident, tracker)
+}
+
+// autosnatchState of a tracker: autosnatching is enabled unless it was disabled on request or after a stats incident.
+type autosnatchState struct {
+	disabled              bool
+	disabledAutomatically bool
+	bufferWhenDisabled    int64
+}
+
+// autosnatchingState of a tracker.
+func (e *Environment) autosnatchingState(tracker string) autosnatchState {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+	return e.autosnatchStates[tracker]
+}
+
+// reenableAutosnatchingAfterRecovery if it was disabled automatically and the stats policy allows it.
+func (e *Environment) reenableAutosnatchingAfterRecovery(tracker string, statsConfig *ConfigStats, stats *StatsEntry) error {
+	if _, err := e.Config().GetAutosnatch(tracker); err != nil {
+		return nil
+	}
+	state := e.autosnatchingState(tracker)
+	if !state.disabledAutomatically || !statsConfig.recovered(stats, state.bufferWhenDisabled) {
+		return nil
+	}
+	return e.EnableAutosnatching(reasonStatsRecovered, tracker)
+}
+
+// autosnatchingEnabled for a tracker unless it was disabled on request or after a stats incident.
+func (e *Environment) autosnatchingEnabled(tracker string) bool {
+	return !e.autosnatchingState(tracker).disabled
+}
+
+// toggleAutosnatching logs and notifies every change of state.
+func (e *Environment) toggleAutosnatching(enabled, automatically bool, buffer int64, reason string, trackers ...string) error {
+	conf := e.Config()
+	if len(trackers) == 0 {
+		for _, as := range conf.Autosnatch {
+			trackers = append(trackers, as.Tracker)
+		}
+	}
+	// checking all trackers before changing anything
+	for _, label := range trackers {
+		if _, err := conf.GetAutosnatch(label); err != nil {
+			return errors.Wrap(err, "autosnatching is not configured for tracker "+label)
+		}
+	}
+
+	state := "disabled"
+	if enabled {
+		state = "enabled"
+	}
+	for _, label := range trackers {
+		e.mutex.Lock()
+		if e.autosnatchStates == nil {
+			e.autosnatchStates = make(map[string]autosnatchState)
+		}
+		current := e.autosnatchStates[label]
+		changed := current.disabled == enabled
+		if changed || !automatically {
+			// disabling manually what was disabled automatically prevents it from being re-enabled automatically
+			e.autosnatchStates[label] = autosnatchState{disabled: !enabled, disabledAutomatically: automatically, bufferWhenDisabled: buffer}
+		}
+		e.mutex.Unlock()
+		if !changed {
+			logthis.Info(fmt.Sprintf("Autosnatching already %s for tracker %s.", state, label), logthis.NORMAL)
+			continue
+		}
+		msg := fmt.Sprintf("autosnatching %s (%s)", state, reason)
+		logthis.Info(label+": "+msg, logthis.NORMAL)
+		if err := Notify(msg, label, "info", e); err != nil {
+			logthis.Error(err, logthis.NORMAL)
+		}
+	}
+	return nil
+}
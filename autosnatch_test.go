@@ -0,0 +1,62 @@
+package varroa
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAutosnatchToggle(t *testing.T) {
+	fmt.Println("+ Testing Autosnatch/toggle...")
+	check := assert.New(t)
+
+	e := NewEnvironment(nil)
+	e.config = &Config{Autosnatch: []*ConfigAutosnatch{{Tracker: "blue"}, {Tracker: "purple"}}}
+
+	// unknown trackers change nothing
+	check.NotNil(e.DisableAutosnatching(reasonManualToggle, "purple", "red"))
+	check.False(e.autosnatchingState("purple").disabled)
+	check.Nil(e.DisableAutosnatching(reasonManualToggle))
+	check.True(e.autosnatchingState("blue").disabled)
+	check.True(e.autosnatchingState("purple").disabled)
+	check.Nil(e.EnableAutosnatching(reasonManualToggle, "blue"))
+	check.False(e.autosnatchingState("blue").disabled)
+	check.True(e.autosnatchingState("purple").disabled)
+	check.Nil(e.EnableAutosnatching(reasonManualToggle))
+	check.False(e.autosnatchingState("purple").disabled)
+
+	// buffer 900MB above the target ratio
+	statsConfig := &ConfigStats{Tracker: "blue", TargetRatio: 1, ReenableAutosnatch: true, ReenableRatio: 1, ReenableBufferMB: 200}
+	stats := &StatsEntry{Tracker: "blue", Up: 1000 * 1024 * 1024, Down: 100 * 1024 * 1024, Ratio: 10}
+	buffer, _ := stats.getBufferValues(statsConfig.TargetRatio)
+	check.True(statsConfig.recovered(stats, buffer-200*1024*1024))
+	check.False(statsConfig.recovered(stats, buffer-199*1024*1024))
+	check.False(statsConfig.recovered(&StatsEntry{Up: stats.Up, Down: stats.Down, Ratio: 0.9}, 0))
+	statsConfig.ReenableAutosnatch = false
+	check.False(statsConfig.recovered(stats, 0))
+	statsConfig.ReenableAutosnatch = true
+
+	// automatically disabled: re-enabled once the buffer has increased enough
+	check.Nil(e.disableAutosnatchingAfterIncident("blue", buffer-100*1024*1024))
+	check.True(e.autosnatchingState("blue").disabled)
+	check.True(e.autosnatchingState("blue").disabledAutomatically)
+	check.Nil(e.reenableAutosnatchingAfterRecovery("blue", statsConfig, stats))
+	check.True(e.autosnatchingState("blue").disabled)
+	// further incidents do not move the reference buffer
+	check.Nil(e.disableAutosnatchingAfterIncident("blue", buffer))
+	stats.Up += 100 * 1024 * 1024
+	check.Nil(e.reenableAutosnatchingAfterRecovery("blue", statsConfig, stats))
+	check.False(e.autosnatchingState("blue").disabled)
+	check.False(e.autosnatchingState("blue").disabledAutomatically)
+
+	// manually disabled: never re-enabled automatically, even if it had been disabled automatically first
+	check.Nil(e.disableAutosnatchingAfterIncident("blue", 0))
+	check.Nil(e.DisableAutosnatching(reasonManualToggle, "blue"))
+	check.False(e.autosnatchingState("blue").disabledAutomatically)
+	check.Nil(e.reenableAutosnatchingAfterRecovery("blue", statsConfig, stats))
+	check.True(e.autosnatchingState("blue").disabled)
+	// a new incident does not take over a manual decision
+	check.Nil(e.disableAutosnatchingAfterIncident("blue", 0))
+	check.False(e.autosnatchingState("blue").disabledAutomatically)
+}
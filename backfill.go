@@ -0,0 +1,303 @@
+package varroa
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"gitlab.com/catastrophic/assistance/logthis"
+	"gitlab.com/catastrophic/assistance/strslice"
+	"gitlab.com/passelecasque/obstruction/tracker"
+)
+
+const (
+	// backfillBrowseDelay between search pages, which do not go through the rate limiter of the tracker.
+	backfillBrowseDelay = 2100 * time.Millisecond
+	// backfillMaxPages of search results considered, to avoid going through the whole tracker.
+	backfillMaxPages = 20
+)
+
+// BackfillQuery describes which releases of a tracker to run a filter against. Only one of Artist, Tag and Label is set.
+type BackfillQuery struct {
+	Artist string
+	Tag    string
+	Label  string
+	DryRun bool
+}
+
+// Args encodes the query to send it to the daemon.
+func (bq BackfillQuery) Args() []string {
+	return []string{bq.Artist, bq.Tag, bq.Label, strconv.FormatBool(bq.DryRun)}
+}
+
+// NewBackfillQueryFromArgs decodes a query sent to the daemon.
+func NewBackfillQueryFromArgs(args []string) BackfillQuery {
+	var bq BackfillQuery
+	if len(args) != 4 {
+		return bq
+	}
+	bq.Artist, bq.Tag, bq.Label = args[0], args[1], args[2]
+	bq.DryRun, _ = strconv.ParseBool(args[3])
+	return bq
+}
+
+func (bq BackfillQuery) String() string {
+	switch {
+	case bq.Artist != "":
+		return "artist " + bq.Artist
+	case bq.Tag != "":
+		return "tag " + bq.Tag
+	default:
+		return "label " + bq.Label
+	}
+}
+
+func (bq BackfillQuery) check() error {
+	var set int
+	for _, v := range []string{bq.Artist, bq.Tag, bq.Label} {
+		if v != "" {
+			set++
+		}
+	}
+	if set != 1 {
+		return errors.New("backfilling requires one artist, tag, or label")
+	}
+	return nil
+}
+
+// Backfill runs a filter against the releases of a tracker found with the query, with the same checks and quotas as autosnatching.
+// Accepted releases are listed for a dry run, or added to the snatch queue, and returned.
+// If snatchNow is set, because the daemon is not there to go through the queue, they are snatched immediately.
+func Backfill(e *Environment, t *tracker.Gazelle, filterName string, query BackfillQuery, snatchNow bool) ([]Release, error) {
+	if err := query.check(); err != nil {
+		return nil, err
+	}
+	conf := e.Config()
+	var filter *ConfigFilter
+	for _, f := range conf.Filters {
+		if f.Name == filterName {
+			filter = f
+			break
+		}
+	}
+	if filter == nil {
+		return nil, errors.New("unknown filter " + filterName)
+	}
+	if len(filter.Tracker) != 0 && !strslice.Contains(filter.Tracker, t.Name) {
+		return nil, fmt.Errorf(infoFilterIgnoredForTracker, filter.Name, t.Name)
+	}
+	var blacklistedUploaders []string
+	var snatchInterval time.Duration
+	if autosnatchConfig, err := conf.GetAutosnatch(t.Name); err == nil {
+		blacklistedUploaders = autosnatchConfig.BlacklistedUploaders
+		snatchInterval = time.Duration(autosnatchConfig.SnatchIntervalSeconds) * time.Second
+	}
+	stats, err := NewStatsDB(e.paths.StatsDir(), conf)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not access the stats database")
+	}
+	queue, err := NewSnatchQueue(e.paths.SnatchQueueDB())
+	if err != nil {
+		return nil, errors.Wrap(err, "could not access the snatch queue")
+	}
+	destination := conf.General.WatchDir
+	if filter.WatchDir != "" {
+		destination = filter.WatchDir
+	}
+
+	IDs, err := backfillTorrentIDs(t, query)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not search "+t.Name)
+	}
+	logthis.Info(fmt.Sprintf("Found %d torrents on %s for %s.", len(IDs), t.Name, query.String()), logthis.NORMAL)
+
+	// in a dry run, the accepted releases are not queued, but must still count as duplicates and against the quotas
+	var accepted []Release
+	groupInfo := make(map[string]*tracker.GazelleTorrentGroup)
+	for _, id := range IDs {
+		info := &TrackerMetadata{}
+		if err := info.LoadFromID(t, id); err != nil {
+			logthis.Error(errors.Wrap(err, errorCouldNotGetTorrentInfo+" for torrent "+id), logthis.NORMAL)
+			continue
+		}
+		release := info.Release()
+		if !release.IsMusicRelease() {
+			logthis.Info(fmt.Sprintf("Torrent %s: %s", id, infoNotMusic), logthis.VERBOSE)
+			continue
+		}
+		verdict := release.Satisfies(filter)
+		if verdict.Accepted() {
+			verdict = release.HasCompatibleTrackerInfo(filter, blacklistedUploaders, info)
+		}
+		if !verdict.Accepted() {
+			logthis.Info(release.ShortString()+": "+verdict.String(), logthis.VERBOSE)
+			continue
+		}
+		release.Filter = filter.Name
+
+		if rejectDuplicate(conf.General, stats, queue, filter, release, verdict) {
+			continue
+		}
+		if !filter.AllowDuplicates && query.DryRun {
+			if findRelease(accepted, release.isDuplicate) != nil {
+				logthis.Info(filter.Name+": "+infoNotSnatchingDuplicate, logthis.VERBOSE)
+				continue
+			}
+		}
+		if !release.CrossSeed {
+			pending := queue.PendingForFilter(filter.Name)
+			if query.DryRun {
+				pending = append(pending, accepted...)
+			}
+			verdict, err = stats.CheckQuotas(filter, release, pending, verdict)
+			if err != nil {
+				return accepted, errors.Wrap(err, errorCheckingQuotas)
+			}
+			if !verdict.Accepted() {
+				logthis.Info(release.ShortString()+": "+verdict.String(), logthis.NORMAL)
+				continue
+			}
+		}
+		group := groupInfo[release.GroupID]
+		if rejectSameGroup(t, stats, queue, filter, release, info, verdict, &group) {
+			continue
+		}
+		groupInfo[release.GroupID] = group
+		if filter.UniqueInGroup && query.DryRun {
+			if findRelease(accepted, func(r *Release) bool { return r.GroupID == release.GroupID }) != nil {
+				logthis.Info(filter.Name+": "+infoNotSnatchingUniqueInGroup, logthis.VERBOSE)
+				continue
+			}
+		}
+
+		if query.DryRun {
+			logthis.Info(" -> "+release.ShortString()+" would be snatched by filter "+filter.Name+".", logthis.NORMAL)
+			accepted = append(accepted, *release)
+			continue
+		}
+		added, err := queue.Add(release, filter.Name, destination, 0)
+		if err != nil {
+			return accepted, err
+		}
+		if !added {
+			logthis.Info(release.ShortString()+": "+infoAlreadyQueued, logthis.NORMAL)
+			continue
+		}
+		logthis.Info(" -> "+release.ShortString()+" accepted by filter "+filter.Name+", queued for snatching.", logthis.NORMAL)
+		accepted = append(accepted, *release)
+	}
+	logthis.Info(fmt.Sprintf("%d of %d torrents accepted by filter %s.", len(accepted), len(IDs), filter.Name), logthis.NORMAL)
+	if query.DryRun || !snatchNow {
+		return accepted, nil
+	}
+
+	// without the daemon, snatching in the foreground, at the pace of the autosnatch configuration.
+	// Releases that could not be snatched stay in the queue, for the daemon to try again.
+	for i, r := range accepted {
+		if i != 0 {
+			time.Sleep(snatchInterval)
+		}
+		entry, err := queue.get(r.Tracker, r.TorrentID)
+		if err != nil {
+			logthis.Error(errors.Wrap(err, "could not find "+r.ShortString()+" in the snatch queue"), logthis.NORMAL)
+			continue
+		}
+		queue.snatch(e, entry)
+	}
+	return accepted, nil
+}
+
+// findRelease returns the first release matching, or nil.
+func findRelease(releases []Release, match func(*Release) bool) *Release {
+	for i := range releases {
+		if match(&releases[i]) {
+			return &releases[i]
+		}
+	}
+	return nil
+}
+
+// backfillTorrentIDs returns the IDs of the torrents of an artist, or with a tag or record label.
+func backfillTorrentIDs(t *tracker.Gazelle, query BackfillQuery) ([]string, error) {
+	var IDs []string
+	if query.Artist != "" {
+		artist, err := t.GetArtistFromName(query.Artist)
+		if err != nil {
+			return nil, err
+		}
+		for _, group := range artist.Torrentgroup {
+			for _, torrent := range group.Torrent {
+				IDs = append(IDs, strconv.Itoa(torrent.ID))
+			}
+		}
+		return IDs, nil
+	}
+
+	params := url.Values{}
+	params.Set("action", "browse")
+	if query.Tag != "" {
+		params.Set("taglist", query.Tag)
+	} else {
+		params.Set("recordlabel", query.Label)
+	}
+	for page := 1; page <= backfillMaxPages; page++ {
+		if page != 1 {
+			time.Sleep(backfillBrowseDelay)
+		}
+		params.Set("page", strconv.Itoa(page))
+		results, err := browse(t, params)
+		if err != nil {
+			return nil, err
+		}
+		for _, group := range results.Results {
+			for _, torrent := range group.Torrents {
+				IDs = append(IDs, strconv.Itoa(torrent.TorrentID))
+			}
+		}
+		if results.Pages <= page {
+			return IDs, nil
+		}
+	}
+	logthis.Info(fmt.Sprintf("Only considering the first %d pages of results.", backfillMaxPages), logthis.NORMAL)
+	return IDs, nil
+}
+
+// browse the torrents of a tracker.
+// The tracker library only searches by artist and title, so this authenticates the same way it does.
+func browse(t *tracker.Gazelle, params url.Values) (*tracker.GazelleSearch, error) {
+	if t.Client == nil {
+		return nil, errors.New("not logged in")
+	}
+	req, err := http.NewRequest(http.MethodGet, t.DomainURL+"/ajax.php?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", t.UserAgent)
+	if t.APIKey != "" {
+		req.Header.Set("Authorization", t.APIKey)
+	} else if t.SessionCookie != nil {
+		req.AddCookie(t.SessionCookie)
+	}
+	resp, err := t.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	var s tracker.GazelleSearchResponse
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, errors.Wrap(err, "could not parse search results")
+	}
+	if s.Status != "success" {
+		return nil, errors.New("search failed: " + s.Error)
+	}
+	return &s.Response, nil
+}
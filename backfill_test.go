@@ -0,0 +1,94 @@
+package varroa
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const backfillTestConfig = `general:
+  watch_directory: $WATCH
+  log_level: 2
+
+trackers:
+  - name: sim
+    user: simuser
+    api_key: simkey
+    url: $URL
+
+autosnatch:
+  - tracker: sim
+    feed:
+      url: $URL/feed
+
+filters:
+  - name: electronic
+    format:
+    - FLAC
+    - MP3
+    included_tags:
+    - electronic
+    unique_in_group: true
+  - name: cd
+    source:
+    - CD
+`
+
+func TestBackfill(t *testing.T) {
+	fmt.Println("+ Testing Backfill...")
+	check := assert.New(t)
+
+	q := BackfillQuery{Label: "Label", DryRun: true}
+	check.Equal(q, NewBackfillQueryFromArgs(q.Args()))
+	check.Nil(q.check())
+	check.NotNil(BackfillQuery{}.check())
+	check.NotNil(BackfillQuery{Artist: "a", Tag: "b"}.check())
+
+	sim, err := NewSimulator("127.0.0.1:0", "127.0.0.1:0", filepath.Join("test", "simulator"))
+	check.Nil(err)
+	sim.User = "simuser"
+	sim.Start()
+	defer sim.Stop()
+
+	e, _, cleanUp := newSimulatedEnvironment(t, sim, backfillTestConfig)
+	defer cleanUp()
+	tr := e.Trackers["sim"]
+
+	_, err = Backfill(e, tr, "unknown", BackfillQuery{Tag: "electronic"}, true)
+	check.NotNil(err)
+
+	// 102 is a duplicate of 101, 103 is from the same group, a release from the group of 201 and 202 was snatched on the tracker
+	accepted, err := Backfill(e, tr, "electronic", BackfillQuery{Tag: "electronic", DryRun: true}, true)
+	check.Nil(err)
+	check.Equal(1, len(accepted))
+	check.Equal("101", accepted[0].TorrentID)
+	check.Empty(sim.Downloads())
+	pending, _, err := snatchQueue.Counts()
+	check.Nil(err)
+	check.Equal(0, pending)
+
+	// snatching without the daemon
+	accepted, err = Backfill(e, tr, "electronic", BackfillQuery{Label: "label"}, true)
+	check.Nil(err)
+	check.Equal(1, len(accepted))
+	check.Equal([]int{101}, sim.Downloads())
+	check.True(statsDB.AlreadySnatchedFromGroup(&Release{Tracker: "sim", GroupID: "10"}))
+	pending, _, err = snatchQueue.Counts()
+	check.Nil(err)
+	check.Equal(0, pending)
+	accepted, err = Backfill(e, tr, "electronic", BackfillQuery{Artist: "Artist A"}, true)
+	check.Nil(err)
+	check.Empty(accepted)
+
+	// with the daemon, accepted releases wait in the queue
+	accepted, err = Backfill(e, tr, "cd", BackfillQuery{Artist: "Artist B"}, false)
+	check.Nil(err)
+	check.Equal(1, len(accepted))
+	check.Equal("202", accepted[0].TorrentID)
+	check.Equal([]int{101}, sim.Downloads())
+	pending, _, err = snatchQueue.Counts()
+	check.Nil(err)
+	check.Equal(1, pending)
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	docopt "github.com/docopt/docopt-go"
@@ -56,6 +57,9 @@ Daemon Commands:
 		shows how long it has been running.
 	status
 		returns information about the daemon status.
+	reload:
+		reloads the configuration file, restarting what needs to be restarted.
+		The daemon also reloads it on SIGHUP or when the file is modified.
 
 Commands:
 
@@ -103,6 +107,9 @@ Commands:
 	downloads clean:
 		clean up the downloads directory by moving all empty folders,
 		and folders with only tracker metadata, to a dedicated subfolder.
+	downloads retry:
+		run the stages that failed (metadata, scan, sort, notification)
+		again for completed downloads.
 	downloads fuse:
 		mount a read-only filesystem exposing your downloads using the
 		tracker metadata, using the following categories: artists, tags,
@@ -112,16 +119,66 @@ Commands:
 		using tracker metadata and the user-defined folder template.
 	library fuse:
 		similar to downloads fuse, but for your music library.
+	filters test:
+		replay announces from a file (one per line) against all filters,
+		without snatching anything, and show which criterion accepted or
+		rejected each release. If the tracker cannot be reached, cached
+		metadata or <TORRENT_ID>.json files next to the announce file
+		are used for the checks requiring tracker metadata.
+	announces search:
+		search the history of parsed announces by artist, tag, or filter,
+		showing why filters rejected them. With --near-miss, only show
+		releases that a filter rejected because of a single criterion.
+		Announces are kept for general.announce_retention_days days.
+	backfill:
+		run a filter against the releases of an artist, or with a tag
+		or record label, found on the tracker. Releases are checked
+		like announces, including duplicates and quotas, and accepted
+		ones are snatched through the snatch queue. With --dry-run,
+		they are only listed.
+	queue list:
+		show the releases accepted by a filter that are waiting to be
+		snatched, and those that could not be snatched after all
+		attempts. Failed snatches are kept as long as announces.
+	simulate:
+		run a local IRC server and tracker API standing in for a
+		configured tracker (which must use http and no IRC SSL), then
+		replay announces from a file once a bot has joined the announce
+		channel. <TORRENT_ID>.json and <TORRENT_ID>.torrent files next
+		to the announce file are served by the fake tracker. Point a
+		test instance of varroa at it to check autosnatching end to end.
+	autosnatch enable|disable:
+		enable or disable autosnatching for a tracker, or for all
+		trackers if none is given. Autosnatching disabled by hand is
+		never re-enabled automatically.
 	reseed:
-		reseed a downloaded release using tracker metadata. Does not check
-		the torrent files actually match the contents in the given PATH.
+		reseed a downloaded release using tracker metadata. The torrent
+		is only added if the names and sizes of its files match the
+		contents of the given PATH; use --check-pieces to also compare
+		their hashes. Files are hard linked or copied to the downloads
+		directory if necessary.
+	crossseed scan:
+		look for the given releases, or all releases in the downloads
+		directory, on the other configured trackers. Torrents in groups
+		with the same artist and title, whose file names and sizes match
+		the local files, are reseeded, and the tracker is added to the
+		origins of the release.
 	
+Running several instances:
+
+	Each instance needs its own configuration file and data directory,
+	which can be set with --config and --data-dir, or with the
+	VARROA_CONFIG and VARROA_DATA_DIR environment variables. The daemon
+	socket is in the data directory, unless --socket or VARROA_SOCKET
+	is set.
+
 Configuration Commands:
 
 	show-config:
 		displays what varroa has parsed from the configuration file
 		(useful for checking the YAML is correctly formatted, and the
-		filters are correctly interpreted).
+		filters are correctly interpreted). The announce formats of
+		each tracker are also checked against their sample announces.
 	encrypt:
 		encrypts your configuration file. The encrypted version can
 		be used in place of the plaintext version, if you're
@@ -134,19 +191,26 @@ Configuration Commands:
 		decrypts your encrypted configuration file.
 
 Usage:
-	varroa (start [--no-daemon]|stop|uptime|status)
-	varroa stats
-	varroa refresh-metadata <PATH>...
-	varroa refresh-metadata-by-id <TRACKER> <ID>...
-	varroa check-log <TRACKER> <LOG_FILE>
-	varroa snatch [--fl] <TRACKER> <ID>...
-	varroa info <TRACKER> <ID>...
-	varroa backup
-	varroa show-config
-	varroa (downloads|dl) (search <ARTIST>|metadata <ID>|sort [--new] [<PATH>...]|sort-id [<ID>...]|list [<STATE>]|clean|fuse <MOUNT_POINT>)
-	varroa library (fuse <MOUNT_POINT>|reorganize [--simulate|--interactive])
-	varroa reseed <TRACKER> <PATH>
-	varroa (encrypt|decrypt)
+	varroa [--config=<FILE> --data-dir=<DIR> --socket=<FILE>] (start [--no-daemon]|stop|uptime|status|reload)
+	varroa [--config=<FILE> --data-dir=<DIR> --socket=<FILE>] stats
+	varroa [--config=<FILE> --data-dir=<DIR> --socket=<FILE>] refresh-metadata <PATH>...
+	varroa [--config=<FILE> --data-dir=<DIR> --socket=<FILE>] refresh-metadata-by-id <TRACKER> <ID>...
+	varroa [--config=<FILE> --data-dir=<DIR> --socket=<FILE>] check-log <TRACKER> <LOG_FILE>
+	varroa [--config=<FILE> --data-dir=<DIR> --socket=<FILE>] snatch [--fl] <TRACKER> <ID>...
+	varroa [--config=<FILE> --data-dir=<DIR> --socket=<FILE>] info <TRACKER> <ID>...
+	varroa [--config=<FILE> --data-dir=<DIR> --socket=<FILE>] backup
+	varroa [--config=<FILE> --data-dir=<DIR> --socket=<FILE>] show-config
+	varroa [--config=<FILE> --data-dir=<DIR> --socket=<FILE>] (downloads|dl) (search <ARTIST>|metadata <ID>|sort [--new] [<PATH>...]|sort-id [<ID>...]|list [<STATE>]|clean|retry|fuse <MOUNT_POINT>)
+	varroa [--config=<FILE> --data-dir=<DIR> --socket=<FILE>] library (fuse <MOUNT_POINT>|reorganize [--simulate|--interactive])
+	varroa [--config=<FILE> --data-dir=<DIR> --socket=<FILE>] reseed [--check-pieces] <TRACKER> <PATH>
+	varroa [--config=<FILE> --data-dir=<DIR> --socket=<FILE>] crossseed scan [<PATH>...]
+	varroa [--config=<FILE> --data-dir=<DIR> --socket=<FILE>] autosnatch (enable|disable) [<TRACKER>]
+	varroa [--config=<FILE> --data-dir=<DIR> --socket=<FILE>] filters test <TRACKER> <ANNOUNCE_FILE>
+	varroa [--config=<FILE> --data-dir=<DIR> --socket=<FILE>] simulate <TRACKER> <ANNOUNCE_FILE>
+	varroa [--config=<FILE> --data-dir=<DIR> --socket=<FILE>] announces search [--artist=<ARTIST>] [--tag=<TAG>] [--filter=<FILTER>] [--near-miss] [--limit=<LIMIT>]
+	varroa [--config=<FILE> --data-dir=<DIR> --socket=<FILE>] backfill <TRACKER> <FILTER> (--artist=<ARTIST>|--tag=<TAG>|--label=<LABEL>) [--dry-run]
+	varroa [--config=<FILE> --data-dir=<DIR> --socket=<FILE>] queue list
+	varroa [--config=<FILE> --data-dir=<DIR> --socket=<FILE>] (encrypt|decrypt)
 	varroa --version
 
 Options:
@@ -156,7 +220,18 @@ Options:
 	--simulate             Simulate library reorganization to show what would be renamed.
 	--interactive          Library reorganization requires user confirmation for each release if necessary.
 	--new                  Only sort new releases (ignore previously sorted ones)
+	--artist=<ARTIST>      Only show announces for this artist, or backfill the releases of this artist.
+	--tag=<TAG>            Only show announces with this tag, or backfill the releases with this tag.
+	--label=<LABEL>        Backfill the releases of this record label.
+	--dry-run              Only list the releases that would be backfilled.
+	--check-pieces         Compare the piece hashes of the torrent with the local files before reseeding.
+	--filter=<FILTER>      Only show announces snatched or nearly snatched by this filter.
+	--near-miss            Only show announces rejected by a filter because of a single criterion.
+	--limit=<LIMIT>        Maximum number of announces to show [default: 50].
   	--version              Show version.
+	--config=<FILE>        Configuration file. Overrides $VARROA_CONFIG, defaults to config.yaml.
+	--data-dir=<DIR>       Directory for the stats, databases, logs and pid file. Overrides $VARROA_DATA_DIR, defaults to the current directory.
+	--socket=<FILE>        Unix socket used to talk to the daemon. Overrides $VARROA_SOCKET, defaults to varroa.sock in the data directory.
 `
 )
 
@@ -173,6 +248,7 @@ type varroaArguments struct {
 	stop                    bool
 	uptime                  bool
 	status                  bool
+	reload                  bool
 	stats                   bool
 	refreshMetadata         bool
 	refreshMetadataByID     bool
@@ -190,23 +266,41 @@ type varroaArguments struct {
 	downloadList            bool
 	downloadState           string
 	downloadClean           bool
+	downloadRetry           bool
 	downloadFuse            bool
 	libraryFuse             bool
 	libraryReorg            bool
 	libraryReorgInteractive bool
 	libraryReorgSimulate    bool
 	reseed                  bool
+	crossSeedScan           bool
+	checkPieces             bool
+	filtersTest             bool
+	simulate                bool
+	autosnatchEnable        bool
+	autosnatchDisable       bool
+	announcesSearch         bool
+	queueList               bool
+	backfill                bool
+	announceQuery           varroa.AnnounceQuery
+	backfillQuery           varroa.BackfillQuery
+	filterName              string
 	useFLToken              bool
 	ignoreSorted            bool
 	torrentIDs              []int
 	logFile                 string
+	announceFile            string
 	trackerLabel            string
+	autosnatchTrackers      []string
 	paths                   []string
 	artistName              string
 	mountPoint              string
 	requiresDaemon          bool
 	canUseDaemon            bool
 	toRefresh               []refreshTarget
+	configFile              string
+	dataDir                 string
+	socket                  string
 }
 
 func (b *varroaArguments) parseCLI(osArgs []string) error {
@@ -220,14 +314,31 @@ func (b *varroaArguments) parseCLI(osArgs []string) error {
 		b.builtin = true
 		return nil
 	}
+	// global options
+	if configFile, ok := args["--config"].(string); ok {
+		b.configFile = configFile
+	}
+	if dataDir, ok := args["--data-dir"].(string); ok {
+		b.dataDir = dataDir
+	}
+	if socket, ok := args["--socket"].(string); ok {
+		b.socket = socket
+	}
 	// commands
 	b.start = args["start"].(bool)
 	b.noDaemon = args["--no-daemon"].(bool)
 	b.stop = args["stop"].(bool)
 	b.uptime = args["uptime"].(bool)
 	b.status = args["status"].(bool)
+	b.reload = args["reload"].(bool)
 	b.stats = args["stats"].(bool)
 	b.reseed = args["reseed"].(bool)
+	if b.reseed {
+		b.checkPieces = args["--check-pieces"].(bool)
+	}
+	if args["crossseed"].(bool) {
+		b.crossSeedScan = args["scan"].(bool)
+	}
 	//b.enhance = args["enhance"].(bool)
 	b.refreshMetadataByID = args["refresh-metadata-by-id"].(bool)
 	b.refreshMetadata = args["refresh-metadata"].(bool)
@@ -251,6 +362,7 @@ func (b *varroaArguments) parseCLI(osArgs []string) error {
 		b.downloadSortID = args["sort-id"].(bool)
 		b.downloadList = args["list"].(bool)
 		b.downloadClean = args["clean"].(bool)
+		b.downloadRetry = args["retry"].(bool)
 		b.downloadFuse = args["fuse"].(bool)
 	}
 	if args["library"].(bool) {
@@ -259,7 +371,52 @@ func (b *varroaArguments) parseCLI(osArgs []string) error {
 		b.libraryReorgSimulate = args["--simulate"].(bool)
 		b.libraryReorgInteractive = args["--interactive"].(bool)
 	}
-	if b.reseed || b.downloadSort {
+	b.simulate = args["simulate"].(bool)
+	if args["autosnatch"].(bool) {
+		b.autosnatchEnable = args["enable"].(bool)
+		b.autosnatchDisable = args["disable"].(bool)
+		if label, ok := args["<TRACKER>"].(string); ok {
+			b.autosnatchTrackers = []string{label}
+		}
+	}
+	if args["filters"].(bool) {
+		b.filtersTest = args["test"].(bool)
+	}
+	b.backfill = args["backfill"].(bool)
+	if b.backfill {
+		b.filterName = args["<FILTER>"].(string)
+		if artist, ok := args["--artist"].(string); ok {
+			b.backfillQuery.Artist = artist
+		}
+		if tag, ok := args["--tag"].(string); ok {
+			b.backfillQuery.Tag = tag
+		}
+		if label, ok := args["--label"].(string); ok {
+			b.backfillQuery.Label = label
+		}
+		b.backfillQuery.DryRun = args["--dry-run"].(bool)
+	}
+	if args["queue"].(bool) {
+		b.queueList = args["list"].(bool)
+	}
+	if args["announces"].(bool) {
+		b.announcesSearch = args["search"].(bool)
+		if artist, ok := args["--artist"].(string); ok {
+			b.announceQuery.Artist = artist
+		}
+		if tag, ok := args["--tag"].(string); ok {
+			b.announceQuery.Tag = tag
+		}
+		if filter, ok := args["--filter"].(string); ok {
+			b.announceQuery.Filter = filter
+		}
+		b.announceQuery.NearMiss = args["--near-miss"].(bool)
+		b.announceQuery.Limit, err = strconv.Atoi(args["--limit"].(string))
+		if err != nil || b.announceQuery.Limit <= 0 {
+			return errors.New("invalid limit, must be a positive integer")
+		}
+	}
+	if b.reseed || b.downloadSort || b.crossSeedScan {
 		b.paths = args["<PATH>"].([]string)
 		for i, p := range b.paths {
 			if !fs.DirExists(p) {
@@ -273,6 +430,14 @@ func (b *varroaArguments) parseCLI(osArgs []string) error {
 			}
 		}
 	}
+	if b.crossSeedScan {
+		// the daemon does not run from the current directory
+		for i, p := range b.paths {
+			if b.paths[i], err = filepath.Abs(p); err != nil {
+				return err
+			}
+		}
+	}
 	// arguments
 	if b.refreshMetadataByID || b.snatch || b.downloadInfo || b.downloadSortID || b.info {
 		IDs, ok := args["<ID>"].([]string)
@@ -322,7 +487,14 @@ func (b *varroaArguments) parseCLI(osArgs []string) error {
 		}
 		b.logFile = logPath
 	}
-	if b.refreshMetadataByID || b.snatch || b.checkLog || b.info || b.reseed {
+	if b.filtersTest || b.simulate {
+		announcePath := args["<ANNOUNCE_FILE>"].(string)
+		if !fs.FileExists(announcePath) {
+			return errors.New("invalid announce file, does not exist")
+		}
+		b.announceFile = announcePath
+	}
+	if b.refreshMetadataByID || b.snatch || b.checkLog || b.info || b.reseed || b.filtersTest || b.simulate || b.backfill {
 		b.trackerLabel = args["<TRACKER>"].(string)
 	}
 
@@ -359,16 +531,21 @@ func (b *varroaArguments) parseCLI(osArgs []string) error {
 	// sorting which commands can use the daemon if it's there but should manage if it is not
 	b.requiresDaemon = true
 	b.canUseDaemon = true
-	if b.refreshMetadataByID || b.refreshMetadata || b.snatch || b.checkLog || b.backup || b.stats || b.downloadSearch || b.downloadInfo || b.downloadSort || b.downloadSortID || b.downloadList || b.info || b.downloadClean || b.downloadFuse || b.libraryFuse || b.libraryReorg || b.reseed {
+	if b.refreshMetadataByID || b.refreshMetadata || b.snatch || b.checkLog || b.backup || b.stats || b.downloadSearch || b.downloadInfo || b.downloadSort || b.downloadSortID || b.downloadList || b.info || b.downloadClean || b.downloadFuse || b.libraryFuse || b.libraryReorg || b.reseed || b.filtersTest || b.simulate || b.announcesSearch || b.queueList || b.backfill || b.downloadRetry || b.crossSeedScan {
 		b.requiresDaemon = false
 	}
 	// sorting which commands should not interact with the daemon in any case
-	if b.refreshMetadata || b.backup || b.showConfig || b.decrypt || b.encrypt || b.downloadSearch || b.downloadInfo || b.downloadSort || b.downloadSortID || b.downloadList || b.downloadClean || b.downloadFuse || b.libraryFuse || b.libraryReorg {
+	if b.refreshMetadata || b.backup || b.showConfig || b.decrypt || b.encrypt || b.downloadSearch || b.downloadInfo || b.downloadSort || b.downloadSortID || b.downloadList || b.downloadClean || b.downloadFuse || b.libraryFuse || b.libraryReorg || b.filtersTest || b.simulate {
 		b.canUseDaemon = false
 	}
 	return nil
 }
 
+// instancePaths for this instance, from the command line options or the environment variables.
+func (b *varroaArguments) instancePaths() *varroa.Paths {
+	return varroa.NewPathsFromEnvironment(b.configFile, b.dataDir, b.socket)
+}
+
 func (b *varroaArguments) commandToDaemon() []byte {
 	out := varroa.IncomingJSON{Site: b.trackerLabel}
 	if b.stats {
@@ -384,6 +561,9 @@ func (b *varroaArguments) commandToDaemon() []byte {
 	if b.status {
 		out.Command = "status"
 	}
+	if b.reload {
+		out.Command = "reload"
+	}
 	if b.refreshMetadataByID {
 		out.Command = "refresh-metadata-by-id"
 		out.Args = intslice.ToStringSlice(b.torrentIDs)
@@ -401,10 +581,36 @@ func (b *varroaArguments) commandToDaemon() []byte {
 		out.Command = "check-log"
 		out.Args = []string{b.logFile}
 	}
+	if b.announcesSearch {
+		out.Command = "announces-search"
+		out.Args = b.announceQuery.Args()
+	}
+	if b.queueList {
+		out.Command = "queue-list"
+	}
+	if b.downloadRetry {
+		out.Command = "downloads-retry"
+	}
+	if b.backfill {
+		out.Command = "backfill"
+		out.Args = append([]string{b.filterName}, b.backfillQuery.Args()...)
+	}
 	if b.reseed {
 		out.Command = "reseed"
+		out.Args = []string{b.paths[0], strconv.FormatBool(b.checkPieces)}
+	}
+	if b.crossSeedScan {
+		out.Command = "crossseed-scan"
 		out.Args = b.paths
 	}
+	if b.autosnatchEnable {
+		out.Command = "autosnatch-enable"
+		out.Args = b.autosnatchTrackers
+	}
+	if b.autosnatchDisable {
+		out.Command = "autosnatch-disable"
+		out.Args = b.autosnatchTrackers
+	}
 	commandBytes, err := json.Marshal(out)
 	if err != nil {
 		logthis.Error(errors.Wrap(err, "cannot parse command"), logthis.NORMAL)
@@ -18,8 +18,6 @@ import (
 )
 
 func main() {
-	env := varroa.NewEnvironment()
-
 	// parsing CLI
 	cli := &varroaArguments{}
 	if err := cli.parseCLI(os.Args[1:]); err != nil {
@@ -29,12 +27,20 @@ func main() {
 	if cli.builtin {
 		return
 	}
+	paths := cli.instancePaths()
+	if paths.DataDir != "" {
+		if err := os.MkdirAll(paths.DataDir, 0777); err != nil {
+			logthis.Error(errors.Wrap(err, "Error creating data directory"), logthis.NORMAL)
+			return
+		}
+	}
+	env := varroa.NewEnvironment(paths)
 
 	// prepare cleanup
-	defer closeDB()
+	defer varroa.CloseDatabases()
 
 	// loading configuration
-	config, err := varroa.NewConfig(varroa.DefaultConfigurationFile)
+	config, err := varroa.NewConfig(paths.ConfigurationFile)
 	if err != nil {
 		logthis.Error(errors.Wrap(err, varroa.ErrorLoadingConfig), logthis.NORMAL)
 		return
@@ -44,7 +50,7 @@ func main() {
 	// here commands that have no use for the daemon
 	if !cli.canUseDaemon {
 		if cli.backup {
-			if err := varroa.ArchiveUserFiles(); err == nil {
+			if err := varroa.ArchiveUserFiles(env); err == nil {
 				logthis.Info(varroa.InfoUserFilesArchived, logthis.NORMAL)
 			}
 			return
@@ -59,14 +65,14 @@ func main() {
 			passphraseBytes := make([]byte, 32)
 			copy(passphraseBytes[:], passphrase)
 			if cli.encrypt {
-				if err = config.Encrypt(varroa.DefaultConfigurationFile, passphraseBytes); err != nil {
+				if err = config.Encrypt(paths.ConfigurationFile, passphraseBytes); err != nil {
 					logthis.Info(err.Error(), logthis.NORMAL)
 					return
 				}
 				logthis.Info(varroa.InfoEncrypted, logthis.NORMAL)
 			}
 			if cli.decrypt {
-				if err = config.DecryptTo(varroa.DefaultConfigurationFile, passphraseBytes); err != nil {
+				if err = config.DecryptTo(paths.ConfigurationFile, passphraseBytes); err != nil {
 					logthis.Error(err, logthis.NORMAL)
 					return
 				}
@@ -77,6 +83,11 @@ func main() {
 		if cli.showConfig {
 			fmt.Print("Found in configuration file: \n\n")
 			fmt.Println(config)
+			if err := config.CheckAnnounceSamples(); err != nil {
+				logthis.Error(err, logthis.NORMAL)
+				return
+			}
+			fmt.Println("All sample announces were parsed successfully.")
 			return
 		}
 		if cli.downloadSearch || cli.downloadInfo || cli.downloadSort || cli.downloadSortID || cli.downloadList || cli.downloadClean {
@@ -88,7 +99,7 @@ func main() {
 			if config.LibraryConfigured {
 				additionalSources = config.Library.AdditionalSources
 			}
-			downloads, err := varroa.NewDownloadsDB(varroa.DefaultDownloadsDB, config.General.DownloadDir, additionalSources)
+			downloads, err := varroa.NewDownloadsDB(paths.DownloadsDB(), config.General.DownloadDir, additionalSources)
 			if err != nil {
 				logthis.Error(err, logthis.NORMAL)
 				return
@@ -206,6 +217,23 @@ func main() {
 				return
 			}
 		}
+		if cli.filtersTest {
+			// setting up to access trackers and cached metadata
+			if err = env.SetUp(false); err != nil {
+				logthis.Error(errors.Wrap(err, varroa.ErrorSettingUp), logthis.NORMAL)
+				return
+			}
+			if err = varroa.DryRunFilters(env, cli.trackerLabel, cli.announceFile); err != nil {
+				logthis.Error(errors.Wrap(err, varroa.ErrorTestingFilters), logthis.NORMAL)
+			}
+			return
+		}
+		if cli.simulate {
+			if err = varroa.Simulate(config, cli.trackerLabel, cli.announceFile); err != nil {
+				logthis.Error(errors.Wrap(err, varroa.ErrorSimulating), logthis.NORMAL)
+			}
+			return
+		}
 		if cli.libraryReorg {
 			if !config.LibraryConfigured {
 				logthis.Info("Library is not configured, missing relevant configuration section.", logthis.NORMAL)
@@ -218,7 +246,7 @@ func main() {
 				fmt.Println(ui.Green("This will apply the library folder template to all releases, using known tracker metadata. It will overwrite any specific name that may have been set manually."))
 			}
 			if ui.Accept("Confirm") {
-				if err = varroa.ReorganizeLibrary(cli.libraryReorgSimulate, cli.libraryReorgInteractive); err != nil {
+				if err = varroa.ReorganizeLibrary(config, cli.libraryReorgSimulate, cli.libraryReorgInteractive); err != nil {
 					logthis.Error(err, logthis.NORMAL)
 				}
 			}
@@ -227,7 +255,7 @@ func main() {
 		// using stormDB
 		if cli.downloadFuse {
 			logthis.Info("Mounting FUSE filesystem in "+cli.mountPoint, logthis.NORMAL)
-			if err = varroa.FuseMount(config.General.DownloadDir, cli.mountPoint, varroa.DefaultDownloadsDB); err != nil {
+			if err = varroa.FuseMount(config.General.DownloadDir, cli.mountPoint, paths.DownloadsDB()); err != nil {
 				logthis.Error(err, logthis.NORMAL)
 				return
 			}
@@ -240,7 +268,7 @@ func main() {
 				return
 			}
 			logthis.Info("Mounting FUSE filesystem in "+cli.mountPoint, logthis.NORMAL)
-			if err = varroa.FuseMount(config.Library.Directory, cli.mountPoint, varroa.DefaultLibraryDB); err != nil {
+			if err = varroa.FuseMount(config.Library.Directory, cli.mountPoint, paths.LibraryDB()); err != nil {
 				logthis.Error(err, logthis.NORMAL)
 				return
 			}
@@ -256,16 +284,16 @@ func main() {
 	}
 
 	// generating log filename
-	logFile := varroa.DefaultLogFile
+	logFile := paths.LogFile()
 	if config.General.TimestampedLogs {
-		filename, err := fs.GetUniqueTimestampedFilename(".", "varroa log", "")
+		filename, err := fs.GetUniqueTimestampedFilename(filepath.Dir(logFile), "varroa log", "")
 		if err == nil {
 			logFile = filename
 		}
 	}
 
 	// dealing with daemon
-	d := daemon.New(varroa.DefaultPIDFile, logFile)
+	d := daemon.New(paths.PIDFile(), logFile)
 	if cli.start {
 		// launching daemon
 		if !cli.noDaemon {
@@ -297,7 +325,7 @@ func main() {
 		} else {
 			// wait for ^C to quit.
 			fmt.Println(ui.Red("Running in no-daemon mode. Ctrl+C to quit."))
-			c := make(chan os.Signal)
+			c := make(chan os.Signal, 1)
 			signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 			// waiting...
 			<-c
@@ -332,6 +360,30 @@ func main() {
 			}
 			return
 		}
+		if cli.announcesSearch {
+			if err := varroa.SearchAnnounces(env, cli.announceQuery); err != nil {
+				logthis.Error(errors.Wrap(err, varroa.ErrorSearchingAnnounces), logthis.NORMAL)
+			}
+			return
+		}
+		if cli.queueList {
+			if err := varroa.ListSnatchQueue(env); err != nil {
+				logthis.Error(errors.Wrap(err, varroa.ErrorListingSnatchQueue), logthis.NORMAL)
+			}
+			return
+		}
+		if cli.downloadRetry {
+			if err := varroa.RetryDownloadPipelines(env, true); err != nil {
+				logthis.Error(errors.Wrap(err, varroa.ErrorRetryingDownloads), logthis.NORMAL)
+			}
+			return
+		}
+		if cli.crossSeedScan {
+			if err := varroa.CrossSeedScan(env, cli.paths); err != nil {
+				logthis.Error(errors.Wrap(err, varroa.ErrorCrossSeeding), logthis.NORMAL)
+			}
+			return
+		}
 		if cli.refreshMetadata {
 			for _, r := range cli.toRefresh {
 				tracker, err := env.Tracker(r.tracker)
@@ -339,7 +391,7 @@ func main() {
 					logthis.Info(fmt.Sprintf("Tracker %s not defined in configuration file", cli.trackerLabel), logthis.NORMAL)
 					return
 				}
-				if err = varroa.RefreshLibraryMetadata(r.path, tracker, strconv.Itoa(r.id)); err != nil {
+				if err = varroa.RefreshLibraryMetadata(r.path, tracker, strconv.Itoa(r.id), config); err != nil {
 					logthis.Error(errors.Wrap(err, varroa.ErrorRefreshingMetadata), logthis.NORMAL)
 				}
 			}
@@ -374,13 +426,18 @@ func main() {
 			}
 		}
 		if cli.reseed {
-			if err := varroa.Reseed(tracker, cli.paths); err != nil {
+			if err := varroa.Reseed(env, tracker, cli.paths[0], cli.checkPieces); err != nil {
 				logthis.Error(errors.Wrap(err, varroa.ErrorReseed), logthis.NORMAL)
 			}
 		}
+		if cli.backfill {
+			if _, err := varroa.Backfill(env, tracker, cli.filterName, cli.backfillQuery, true); err != nil {
+				logthis.Error(errors.Wrap(err, varroa.ErrorBackfilling), logthis.NORMAL)
+			}
+		}
 	} else {
 		// daemon is up, sending commands to the daemon through the unix socket
-		if err := varroa.SendOrders(cli.commandToDaemon()); err != nil {
+		if err := varroa.SendOrders(env, cli.commandToDaemon()); err != nil {
 			logthis.Error(errors.Wrap(err, varroa.ErrorSendingCommandToDaemon), logthis.NORMAL)
 			return
 		}
@@ -391,12 +448,3 @@ func main() {
 		}
 	}
 }
-
-func closeDB() {
-	// closing statsDB properly
-	if stats, err := varroa.NewDatabase(filepath.Join(varroa.StatsDir, varroa.DefaultHistoryDB)); err == nil {
-		if closingErr := stats.Close(); closingErr != nil {
-			logthis.Error(closingErr, logthis.NORMAL)
-		}
-	}
-}
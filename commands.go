@@ -1,8 +1,10 @@
 package varroa
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"os/user"
@@ -10,6 +12,7 @@ import (
 	"strconv"
 	"strings"
 	"syscall"
+	"text/tabwriter"
 	"time"
 
 	"github.com/asdine/storm"
@@ -32,8 +35,8 @@ const (
 )
 
 // SendOrders from the CLI to the running daemon
-func SendOrders(command []byte) error {
-	dcClient := ipc.NewUnixSocketClient(daemonSocket)
+func SendOrders(e *Environment, command []byte) error {
+	dcClient := ipc.NewUnixSocketClient(e.paths.Socket)
 	go func() {
 		if err := dcClient.RunClient(); err != nil {
 			logthis.Error(err, logthis.NORMAL)
@@ -126,10 +129,51 @@ Loop:
 					} else {
 						logthis.Info(statusString(e), logthis.NORMAL)
 					}
+				case "announces-search":
+					if err := SearchAnnounces(e, NewAnnounceQueryFromArgs(orders.Args)); err != nil {
+						logthis.Error(errors.Wrap(err, ErrorSearchingAnnounces), logthis.NORMAL)
+					}
+				case "queue-list":
+					if err := ListSnatchQueue(e); err != nil {
+						logthis.Error(errors.Wrap(err, ErrorListingSnatchQueue), logthis.NORMAL)
+					}
+				case "downloads-retry":
+					if err := RetryDownloadPipelines(e, true); err != nil {
+						logthis.Error(errors.Wrap(err, ErrorRetryingDownloads), logthis.NORMAL)
+					}
+				case "backfill":
+					if len(orders.Args) == 0 {
+						logthis.Error(errors.New(ErrorBackfilling+": no filter given"), logthis.NORMAL)
+						continue
+					}
+					if _, err := Backfill(e, t, orders.Args[0], NewBackfillQueryFromArgs(orders.Args[1:]), false); err != nil {
+						logthis.Error(errors.Wrap(err, ErrorBackfilling), logthis.NORMAL)
+					}
+				case autosnatchEnableCommand:
+					if err := e.EnableAutosnatching(reasonManualToggle, orders.Args...); err != nil {
+						logthis.Error(err, logthis.NORMAL)
+					}
+				case autosnatchDisableCommand:
+					if err := e.DisableAutosnatching(reasonManualToggle, orders.Args...); err != nil {
+						logthis.Error(err, logthis.NORMAL)
+					}
+				case "reload":
+					if err := e.ReloadConfiguration(); err != nil {
+						logthis.Error(err, logthis.NORMAL)
+					}
 				case "reseed":
-					if err := Reseed(t, orders.Args); err != nil {
+					if len(orders.Args) != 2 {
+						logthis.Error(errors.New(ErrorReseed+": no path given"), logthis.NORMAL)
+						continue
+					}
+					checkPieces, _ := strconv.ParseBool(orders.Args[1])
+					if err := Reseed(e, t, orders.Args[0], checkPieces); err != nil {
 						logthis.Error(errors.Wrap(err, ErrorReseed), logthis.NORMAL)
 					}
+				case "crossseed-scan":
+					if err := CrossSeedScan(e, orders.Args); err != nil {
+						logthis.Error(errors.Wrap(err, ErrorCrossSeeding), logthis.NORMAL)
+					}
 				case ipc.StopCommand:
 					logthis.Info("Stopping daemon...", logthis.NORMAL)
 					break Loop
@@ -151,17 +195,41 @@ func statusString(e *Environment) string {
 	// uptime
 	status += "Daemon up since " + e.startTime.Format("2006.01.02 15h04") + " (uptime: " + time.Since(e.startTime).String() + ").\n"
 	// autosnatch enabled?
-	conf, err := NewConfig(DefaultConfigurationFile)
-	if err == nil {
+	conf := e.Config()
+	e.mutex.RLock()
+	for _, as := range conf.Autosnatch {
+		status += "Autosnatching for tracker " + as.Tracker + ": "
+		state := e.autosnatchStates[as.Tracker]
+		if state.disabledAutomatically {
+			status += "disabled (" + reasonStatsIncident + ")!\n"
+		} else if state.disabled {
+			status += "disabled!\n"
+		} else {
+			status += "enabled.\n"
+		}
+	}
+	for _, as := range conf.Autosnatch {
+		for _, s := range e.announceSources[as.Tracker] {
+			status += s.String() + "\n"
+		}
+	}
+	e.mutex.RUnlock()
+	if stats, err := NewStatsDB(e.paths.StatsDir(), conf); err == nil {
 		for _, as := range conf.Autosnatch {
-			status += "Autosnatching for tracker " + as.Tracker + ": "
-			if as.disabledAutosnatching {
-				status += "disabled!\n"
-			} else {
-				status += "enabled.\n"
+			if as.FLTokens != 0 {
+				used, left := flTokensLeft(conf, stats, as.Tracker)
+				status += fmt.Sprintf("Freeleech tokens for tracker %s: %d used, %d left.\n", as.Tracker, used, left)
 			}
 		}
 	}
+	if snatchQueue != nil {
+		if pending, failed, err := snatchQueue.Counts(); err == nil {
+			status += fmt.Sprintf("Snatch queue: %d pending, %d failed.\n", pending, failed)
+		}
+	}
+	for _, f := range conf.Filters {
+		status += "Filter " + f.Name + ": " + f.ActiveState(time.Now()) + ".\n"
+	}
 
 	// TODO last autosnatched release for tracker X: date
 	return status
@@ -170,22 +238,18 @@ func statusString(e *Environment) string {
 // GenerateStats for all labels and the associated HTML index.
 func GenerateStats(e *Environment) error {
 	atLeastOneError := false
-	stats, err := NewStatsDB(filepath.Join(StatsDir, DefaultHistoryDB))
+	config := e.Config()
+	stats, err := NewStatsDB(e.paths.StatsDir(), config)
 	if err != nil {
 		return errors.Wrap(err, "could not access the stats database")
 	}
-	if err := stats.Update(); err != nil {
+	if err := stats.Update(config.TrackerLabels()); err != nil {
 		return errors.Wrap(err, "error updating database")
 	}
 
-	// get tracker labels from config.
-	config, configErr := NewConfig(DefaultConfigurationFile)
-	if configErr != nil {
-		return configErr
-	}
 	// generate graphs
-	for _, tracker := range config.TrackerLabels() {
-		if err := stats.GenerateAllGraphsForTracker(tracker); err != nil {
+	for _, statsConfig := range config.Stats {
+		if err := stats.GenerateAllGraphsForTracker(statsConfig); err != nil {
 			logthis.Error(err, logthis.NORMAL)
 			atLeastOneError = true
 		}
@@ -203,11 +267,12 @@ func GenerateStats(e *Environment) error {
 
 // RefreshMetadata for a list of releases on a tracker
 func RefreshMetadata(e *Environment, t *tracker.Gazelle, IDStrings []string) error {
+	conf := e.Config()
 	if len(IDStrings) == 0 {
 		return errors.New("Error: no ID provided")
 	}
 
-	stats, err := NewStatsDB(filepath.Join(StatsDir, DefaultHistoryDB))
+	stats, err := NewStatsDB(e.paths.StatsDir(), conf)
 	if err != nil {
 		return errors.Wrap(err, "could not access the stats database")
 	}
@@ -219,19 +284,19 @@ func RefreshMetadata(e *Environment, t *tracker.Gazelle, IDStrings []string) err
 		if err := stats.db.DB.Select(findIDsQuery).First(&found); err != nil {
 			if err == storm.ErrNotFound {
 				// not found, try to locate download directory nonetheless
-				if e.config.DownloadFolderConfigured {
+				if conf.DownloadFolderConfigured {
 					logthis.Info("Release not found in history, trying to locate in downloads directory.", logthis.NORMAL)
 					// get data from tracker
 					if err := info.LoadFromID(t, id); err != nil {
 						logthis.Error(errors.Wrap(err, errorCouldNotGetTorrentInfo), logthis.NORMAL)
 						break
 					}
-					fullFolder := filepath.Join(e.config.General.DownloadDir, info.FolderName)
+					fullFolder := filepath.Join(conf.General.DownloadDir, info.FolderName)
 					if fs.DirExists(fullFolder) {
 						if daemon.WasReborn() {
-							go info.SaveFromTracker(fullFolder, t)
+							go info.SaveFromTracker(fullFolder, t, conf)
 						} else {
-							info.SaveFromTracker(fullFolder, t)
+							info.SaveFromTracker(fullFolder, t, conf)
 						}
 					} else {
 						logthis.Info(fmt.Sprintf(errorCannotFindID, id), logthis.NORMAL)
@@ -252,11 +317,11 @@ func RefreshMetadata(e *Environment, t *tracker.Gazelle, IDStrings []string) err
 				logthis.Error(errors.Wrap(err, errorCouldNotGetTorrentInfo), logthis.NORMAL)
 				break
 			}
-			fullFolder := filepath.Join(e.config.General.DownloadDir, info.FolderName)
+			fullFolder := filepath.Join(conf.General.DownloadDir, info.FolderName)
 			if daemon.WasReborn() {
-				go info.SaveFromTracker(fullFolder, t)
+				go info.SaveFromTracker(fullFolder, t, conf)
 			} else {
-				info.SaveFromTracker(fullFolder, t)
+				info.SaveFromTracker(fullFolder, t, conf)
 			}
 		}
 		// check the number of active seeders
@@ -280,7 +345,7 @@ func RefreshMetadata(e *Environment, t *tracker.Gazelle, IDStrings []string) err
 }
 
 // RefreshLibraryMetadata for a list of releases on a tracker, using the given location instead of assuming they are in the download directory.
-func RefreshLibraryMetadata(path string, t *tracker.Gazelle, id string) error {
+func RefreshLibraryMetadata(path string, t *tracker.Gazelle, id string, conf *Config) error {
 	if !DirectoryContainsMusicAndMetadata(path) {
 		return fmt.Errorf(ErrorFindingMusicAndMetadata, path)
 	}
@@ -289,7 +354,7 @@ func RefreshLibraryMetadata(path string, t *tracker.Gazelle, id string) error {
 	if err := info.LoadFromID(t, id); err != nil {
 		return errors.Wrap(err, errorCouldNotGetTorrentInfo)
 	}
-	return info.SaveFromTracker(path, t)
+	return info.SaveFromTracker(path, t, conf)
 }
 
 // SnatchTorrents on a tracker using their TorrentIDs
@@ -297,9 +362,10 @@ func SnatchTorrents(e *Environment, t *tracker.Gazelle, IDStrings []string, useF
 	if len(IDStrings) == 0 {
 		return errors.New("Error: no ID provided")
 	}
+	conf := e.Config()
 	// snatch
 	for _, id := range IDStrings {
-		release, err := manualSnatchFromID(e, t, id, useFLToken)
+		release, err := manualSnatchFromID(e, conf, t, id, useFLToken)
 		if err != nil {
 			return errors.New("Error snatching torrent with ID #" + id)
 		}
@@ -314,11 +380,12 @@ func SnatchTorrents(e *Environment, t *tracker.Gazelle, IDStrings []string, useF
 
 // ShowTorrentInfo of a list of releases on a tracker
 func ShowTorrentInfo(e *Environment, t *tracker.Gazelle, IDStrings []string) error {
+	conf := e.Config()
 	if len(IDStrings) == 0 {
 		return errors.New("Error: no ID provided")
 	}
 
-	stats, err := NewStatsDB(filepath.Join(StatsDir, DefaultHistoryDB))
+	stats, err := NewStatsDB(e.paths.StatsDir(), conf)
 	if err != nil {
 		return errors.Wrap(err, "could not access the stats database")
 	}
@@ -344,8 +411,8 @@ func ShowTorrentInfo(e *Environment, t *tracker.Gazelle, IDStrings []string) err
 		}
 
 		// checking the files are still there (if snatched with or without varroa)
-		if e.config.DownloadFolderConfigured {
-			releaseFolder := filepath.Join(e.config.General.DownloadDir, info.FolderName)
+		if conf.DownloadFolderConfigured {
+			releaseFolder := filepath.Join(conf.General.DownloadDir, info.FolderName)
 			if fs.DirExists(releaseFolder) {
 				logthis.Info(fmt.Sprintf("Files seem to still be in the download directory: %s", releaseFolder), logthis.NORMAL)
 				// TODO maybe display when the metadata was last updated?
@@ -355,50 +422,233 @@ func ShowTorrentInfo(e *Environment, t *tracker.Gazelle, IDStrings []string) err
 		}
 
 		// check and print if info/release triggers filters
-		autosnatchConfig, err := e.config.GetAutosnatch(t.Name)
+		autosnatchConfig, err := conf.GetAutosnatch(t.Name)
 		if err != nil {
 			logthis.Info("Cannot find autosnatch configuration for tracker "+t.Name, logthis.NORMAL)
 		} else {
 			logthis.Info("+ Showing autosnatch filters results for this release:\n", logthis.NORMAL)
-			for _, filter := range e.config.Filters {
+			for _, filter := range conf.Filters {
 				// checking if filter is specifically set for this tracker (if nothing is indicated, all trackers match)
 				if len(filter.Tracker) != 0 && !strslice.Contains(filter.Tracker, t.Name) {
 					logthis.Info(fmt.Sprintf(infoFilterIgnoredForTracker, filter.Name, t.Name), logthis.NORMAL)
 					continue
 				}
 				// checking if a filter is triggered
-				if release.Satisfies(filter) && release.HasCompatibleTrackerInfo(filter, autosnatchConfig.BlacklistedUploaders, info) {
-					// checking if duplicate
-					if !filter.AllowDuplicates && stats.AlreadySnatchedDuplicate(release) {
-						logthis.Info(filter.Name+": "+infoNotSnatchingDuplicate, logthis.NORMAL)
-						continue
-					}
-					// checking if a torrent from the same group has already been downloaded
-					if filter.UniqueInGroup && stats.AlreadySnatchedFromGroup(release) {
-						logthis.Info(filter.Name+": "+infoNotSnatchingUniqueInGroup, logthis.NORMAL)
-						continue
-					}
-					logthis.Info(fmt.Sprintf(infoFilterTriggered, filter.Name), logthis.NORMAL)
+				verdict := release.Satisfies(filter)
+				if verdict.Accepted() {
+					verdict = release.HasCompatibleTrackerInfo(filter, autosnatchConfig.BlacklistedUploaders, info)
+				}
+				if !verdict.Accepted() {
+					logthis.Info(verdict.String(), logthis.NORMAL)
+					continue
+				}
+				// checking if duplicate
+				if !filter.AllowDuplicates && stats.AlreadySnatchedDuplicate(release) {
+					logthis.Info(filter.Name+": "+infoNotSnatchingDuplicate, logthis.NORMAL)
+					continue
+				}
+				// checking if a torrent from the same group has already been downloaded
+				if filter.UniqueInGroup && stats.AlreadySnatchedFromGroup(release) {
+					logthis.Info(filter.Name+": "+infoNotSnatchingUniqueInGroup, logthis.NORMAL)
+					continue
 				}
+				logthis.Info(fmt.Sprintf(infoFilterTriggered, filter.Name), logthis.NORMAL)
 			}
 		}
 	}
 	return nil
 }
 
-// Reseed a release using local files and tracker metadata
-func Reseed(t *tracker.Gazelle, path []string) error {
-	// get config.
-	conf, configErr := NewConfig(DefaultConfigurationFile)
-	if configErr != nil {
-		return configErr
+// DryRunFilters replays announces from a file against all filters, showing which criterion accepted or rejected them.
+// Nothing is snatched. If the tracker cannot be reached, cached or fixture tracker metadata JSONs are used instead.
+func DryRunFilters(e *Environment, trackerLabel, announceFile string) error {
+	conf := e.Config()
+	if len(conf.Filters) == 0 {
+		return errors.New("no filters are defined in the configuration file")
+	}
+	data, err := ioutil.ReadFile(announceFile)
+	if err != nil {
+		return errors.Wrap(err, "could not read announces file")
+	}
+	// the tracker is only used to retrieve metadata for the second-stage checks
+	t, err := e.Tracker(trackerLabel)
+	if err != nil {
+		logthis.Error(err, logthis.VERBOSE)
+		logthis.Info(fmt.Sprintf(infoDryRunOffline, trackerLabel), logthis.NORMAL)
+		t = nil
+	}
+	var blacklistedUploaders []string
+	announceFormats := defaultAnnounceFormats
+	if autosnatchConfig, err := conf.GetAutosnatch(trackerLabel); err == nil {
+		blacklistedUploaders = autosnatchConfig.BlacklistedUploaders
+		announceFormats = autosnatchConfig.announceFormats
+	}
+
+	for i, line := range strings.Split(string(data), "\n") {
+		announced := announceCleaner.Replace(strings.TrimSpace(line))
+		if announced == "" {
+			continue
+		}
+		release, err := parseAnnounce(trackerLabel, announced, announceFormats)
+		if err != nil {
+			logthis.Info(fmt.Sprintf("+ Line %d: %s", i+1, err.Error()), logthis.NORMAL)
+			continue
+		}
+		if release == nil {
+			logthis.Info(fmt.Sprintf("+ Line %d: %s", i+1, infoNotMusic), logthis.NORMAL)
+			continue
+		}
+
+		var table bytes.Buffer
+		w := tabwriter.NewWriter(&table, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "\tFILTER\tRESULT\tCRITERION\tEXPECTED\tACTUAL")
+		for _, v := range dryRunRelease(e, conf, t, trackerLabel, release, blacklistedUploaders, filepath.Dir(announceFile)) {
+			fmt.Fprintf(w, "\t%s\t%s\t%s\t%s\t%s\n", v.filter, v.result, v.reason, v.expected, v.actual)
+		}
+		w.Flush()
+		logthis.Info(fmt.Sprintf("+ Line %d: %s\n%s", i+1, release.ShortString(), table.String()), logthis.NORMAL)
+	}
+	return nil
+}
+
+// dryRunVerdict of a filter for a replayed announce.
+type dryRunVerdict struct {
+	filter   string
+	result   string
+	reason   string
+	expected string
+	actual   string
+}
+
+// dryRunRelease checks a release against all filters, and returns whether each one accepted, rejected, ignored it,
+// or could not decide for lack of tracker metadata.
+func dryRunRelease(e *Environment, conf *Config, t *tracker.Gazelle, trackerLabel string, release *Release, blacklistedUploaders []string, fixturesDir string) []dryRunVerdict {
+	var verdicts []dryRunVerdict
+	var info *TrackerMetadata
+	var infoErr error
+	var infoLoaded bool
+	for _, filter := range conf.Filters {
+		if len(filter.Tracker) != 0 && !strslice.Contains(filter.Tracker, trackerLabel) {
+			verdicts = append(verdicts, dryRunVerdict{filter: filter.Name, result: "ignored", reason: "not used for tracker " + trackerLabel})
+			continue
+		}
+		if v := release.unsatisfiedCriterion(filter); !v.Accepted() {
+			verdicts = append(verdicts, dryRunVerdict{filter: filter.Name, result: "rejected", reason: v.Reason, expected: v.Expected, actual: v.Actual})
+			continue
+		}
+		// second-stage checks, retrieving metadata only once
+		if !infoLoaded {
+			info, infoErr = dryRunMetadata(t, trackerLabel, release.TorrentID, e.paths.MetadataCacheDir(), fixturesDir)
+			infoLoaded = true
+		}
+		if infoErr != nil {
+			verdicts = append(verdicts, dryRunVerdict{filter: filter.Name, result: "unknown", reason: infoErr.Error()})
+			continue
+		}
+		if v := release.incompatibleTrackerInfo(filter, blacklistedUploaders, info); !v.Accepted() {
+			verdicts = append(verdicts, dryRunVerdict{filter: filter.Name, result: "rejected", reason: v.Reason, expected: v.Expected, actual: v.Actual})
+			continue
+		}
+		verdicts = append(verdicts, dryRunVerdict{filter: filter.Name, result: "accepted"})
 	}
+	return verdicts
+}
+
+// dryRunMetadata for a torrent, from the tracker if it is available, or from cached or fixture JSON files.
+func dryRunMetadata(t *tracker.Gazelle, trackerLabel, torrentID, cacheDir, fixturesDir string) (*TrackerMetadata, error) {
+	cachedJSON := filepath.Join(cacheDir, trackerLabel+"_"+torrentID+jsonExt)
+	if t != nil {
+		info := &TrackerMetadata{}
+		if err := info.LoadFromID(t, torrentID); err != nil {
+			logthis.Error(errors.Wrap(err, errorCouldNotGetTorrentInfo), logthis.VERBOSE)
+		} else {
+			if err := info.saveToCache(cachedJSON); err != nil {
+				logthis.Error(errors.Wrap(err, "could not cache tracker metadata"), logthis.VERBOSE)
+			}
+			return info, nil
+		}
+	}
+	metadataJSON, err := getFirstExistingFile(cachedJSON, filepath.Join(fixturesDir, torrentID+jsonExt))
+	if err != nil {
+		return nil, errors.New("no tracker metadata available for torrent " + torrentID)
+	}
+	info := &TrackerMetadata{}
+	if err := info.LoadFromCache(trackerLabel, metadataJSON); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// SearchAnnounces in the announces history, and show the verdicts of the filters that rejected them.
+func SearchAnnounces(e *Environment, query AnnounceQuery) error {
+	announces, err := NewAnnouncesDB(e.paths.AnnouncesDB())
+	if err != nil {
+		return errors.Wrap(err, "could not access the announces database")
+	}
+	hits, err := announces.Search(query)
+	if err != nil {
+		return err
+	}
+	if len(hits) == 0 {
+		logthis.Info("Nothing found.", logthis.NORMAL)
+		return nil
+	}
+	for _, a := range hits {
+		logthis.Info(a.String(), logthis.NORMAL)
+	}
+	return nil
+}
+
+// ListSnatchQueue shows the releases waiting to be snatched, and those that could not be.
+func ListSnatchQueue(e *Environment) error {
+	queue, err := NewSnatchQueue(e.paths.SnatchQueueDB())
+	if err != nil {
+		return errors.Wrap(err, "could not access the snatch queue")
+	}
+	entries, err := queue.List()
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		logthis.Info("The snatch queue is empty.", logthis.NORMAL)
+		return nil
+	}
+	for _, entry := range entries {
+		logthis.Info(entry.String(), logthis.NORMAL)
+	}
+	return nil
+}
+
+// PurgeSnatchQueue of the releases that could not be snatched, after the announce retention period.
+func PurgeSnatchQueue(e *Environment) error {
+	conf := e.Config()
+	queue, err := NewSnatchQueue(e.paths.SnatchQueueDB())
+	if err != nil {
+		return errors.Wrap(err, "could not access the snatch queue")
+	}
+	return queue.Purge(conf.General.AnnounceRetentionDays)
+}
+
+// PurgeAnnounces older than the configured retention period.
+func PurgeAnnounces(e *Environment) error {
+	conf := e.Config()
+	announces, err := NewAnnouncesDB(e.paths.AnnouncesDB())
+	if err != nil {
+		return errors.Wrap(err, "could not access the announces database")
+	}
+	return announces.Purge(conf.General.AnnounceRetentionDays)
+}
+
+// Reseed a release using local files and tracker metadata.
+// The torrent is only handed to the torrent client if the local files match its contents, optionally checking piece
+// hashes as well as file names and sizes.
+func Reseed(e *Environment, t *tracker.Gazelle, path string, checkPieces bool) error {
+	conf := e.Config()
 	if !conf.DownloadFolderConfigured {
 		return errors.New("impossible to reseed release if downloads directory is not configured")
 	}
 	// parse metadata for tracker, and get tid
-	// assuming reseeding one at a time only (as limited by CLI)
-	toc := TrackerOriginJSON{Path: filepath.Join(path[0], MetadataDir, OriginJSONFile)}
+	toc := TrackerOriginJSON{Path: filepath.Join(path, MetadataDir, OriginJSONFile)}
 	if err := toc.Load(); err != nil {
 		return errors.Wrap(err, "error reading origin.json")
 	}
@@ -408,31 +658,50 @@ func Reseed(t *tracker.Gazelle, path []string) error {
 		return errors.New("release does not originate from tracker " + t.Name)
 	}
 
-	// copy files if necessary
-	// if the relative path of the downloads directory and the release path is the folder name, it means the path is
-	// directly inside the downloads directory, where we want it to reseed.
-	// if it is not, we need to copy the files.
-	// TODO: maybe hard link instead if in the same filesystem
-	// TODO : deal with more than one path
-	rel, err := filepath.Rel(conf.General.DownloadDir, path[0])
+	// downloading torrent, and comparing its description with the local files
+	torrent, filename, err := downloadTorrent(t, oj.ID, false, "")
 	if err != nil {
-		return errors.Wrap(err, "error trying to locate the target path relatively to the downloads directory")
+		return errors.Wrap(err, "error downloading torrent file")
 	}
-	// copy files if not in downloads directory
-	if rel != filepath.Base(path[0]) {
-		if err := fs.CopyDir(path[0], filepath.Join(conf.General.DownloadDir, filepath.Base(path[0])), false); err != nil {
-			return errors.Wrap(err, "error copying files to downloads directory")
-		}
-		logthis.Info("Release files have been copied inside the downloads directory", logthis.NORMAL)
+	check, err := NewTorrentCheck(torrent, path)
+	if err != nil {
+		return err
 	}
+	if err := check.Run(checkPieces); err != nil {
+		return errors.Wrap(err, "error comparing the torrent with local files")
+	}
+	logthis.Info(check.String(), logthis.NORMAL)
+	if !check.Match() {
+		return errors.New("local files do not match the torrent, not reseeding")
+	}
+	_, err = seedCheckedTorrent(e, check, torrent, filename)
+	return err
+}
 
-	// TODO TO A TEMP DIR, then compare torrent description with path contents; if OK only copy .torrent to conf.General.WatchDir
-	// downloading torrent
-	if err := t.Download(oj.ID, false, conf.General.WatchDir, ""); err != nil {
-		return errors.Wrap(err, "error downloading torrent file")
+// seedCheckedTorrent places the files matching a torrent where the torrent client will look for them, in the downloads
+// directory, and adds the torrent. It returns where the files are seeded from.
+func seedCheckedTorrent(e *Environment, check *TorrentCheck, torrent []byte, filename string) (string, error) {
+	conf := e.Config()
+	source, err := filepath.Abs(check.root)
+	if err != nil {
+		return "", err
 	}
-	logthis.Info("Torrent downloaded, your bittorrent client should be able to reseed the release.", logthis.NORMAL)
-	return nil
+	destination, err := filepath.Abs(check.Destination(conf.General.DownloadDir))
+	if err != nil {
+		return "", err
+	}
+	if source != destination {
+		report, err := check.CopyTo(conf.General.DownloadDir, LinkOptions{HardLinks: true, Verify: conf.General.VerifyLinks})
+		if err != nil {
+			return "", errors.Wrap(err, "error copying files to downloads directory")
+		}
+		logthis.Info("Release files placed inside the downloads directory: "+report.String(), logthis.NORMAL)
+	}
+	if _, err := e.addTorrent(torrent, filename, conf.General.WatchDir, conf.General.DownloadDir); err != nil {
+		return "", err
+	}
+	logthis.Info("Torrent sent to "+e.TorrentClient(conf.General.WatchDir).String()+", it should be able to reseed the release.", logthis.NORMAL)
+	return destination, nil
 }
 
 // CheckLog on a tracker's logchecker
@@ -448,42 +717,43 @@ func CheckLog(t *tracker.Gazelle, logPaths []string) error {
 }
 
 // ArchiveUserFiles in a timestamped compressed archive.
-func ArchiveUserFiles() error {
+func ArchiveUserFiles(e *Environment) error {
 	// generate Timestamp
 	timestamp := time.Now().Format("2006-01-02_15h04m05s")
 	archiveName := fmt.Sprintf(archiveNameTemplate, timestamp)
-	if !fs.DirExists(archivesDir) {
-		if err := os.MkdirAll(archivesDir, 0755); err != nil {
+	archives := e.paths.ArchivesDir()
+	if !fs.DirExists(archives) {
+		if err := os.MkdirAll(archives, 0755); err != nil {
 			logthis.Error(errors.Wrap(err, errorArchiving), logthis.NORMAL)
 			return errors.Wrap(err, errorArchiving)
 		}
 	}
 	var backupFiles []string
 	// find all .db files, save them along with the configuration file
-	f, err := os.Open(StatsDir)
+	statsDir := e.paths.StatsDir()
+	f, err := os.Open(statsDir)
 	if err != nil {
-		return errors.Wrap(err, "Error opening "+StatsDir)
+		return errors.Wrap(err, "Error opening "+statsDir)
 	}
 	contents, err := f.Readdirnames(-1)
 	if err != nil {
-		return errors.Wrap(err, "Error reading directory "+StatsDir)
+		return errors.Wrap(err, "Error reading directory "+statsDir)
 	}
 	f.Close()
 	for _, c := range contents {
 		if filepath.Ext(c) == msgpackExt {
-			backupFiles = append(backupFiles, filepath.Join(StatsDir, c))
+			backupFiles = append(backupFiles, filepath.Join(statsDir, c))
 		}
 	}
 	// backup the configuration file
-	if fs.FileExists(DefaultConfigurationFile) {
-		backupFiles = append(backupFiles, DefaultConfigurationFile)
+	if fs.FileExists(e.paths.ConfigurationFile) {
+		backupFiles = append(backupFiles, e.paths.ConfigurationFile)
 	}
-	encryptedConfigurationFile := strings.TrimSuffix(DefaultConfigurationFile, yamlExt) + encryptedExt
-	if fs.FileExists(encryptedConfigurationFile) {
-		backupFiles = append(backupFiles, encryptedConfigurationFile)
+	if fs.FileExists(e.paths.EncryptedConfigurationFile()) {
+		backupFiles = append(backupFiles, e.paths.EncryptedConfigurationFile())
 	}
 	// generate archive
-	err = archiver.Archive(backupFiles, filepath.Join(archivesDir, archiveName))
+	err = archiver.Archive(backupFiles, filepath.Join(archives, archiveName))
 	if err != nil {
 		logthis.Error(errors.Wrap(err, errorArchiving), logthis.NORMAL)
 	}
@@ -547,11 +817,7 @@ func checkQuota(e *Environment) error {
 
 // checkFreeDiskSpace based on the main download directory's location.
 func checkFreeDiskSpace(e *Environment) error {
-	// get config.
-	conf, configErr := NewConfig(DefaultConfigurationFile)
-	if configErr != nil {
-		return configErr
-	}
+	conf := e.Config()
 	if conf.DownloadFolderConfigured {
 		var stat syscall.Statfs_t
 		if err := syscall.Statfs(conf.General.DownloadDir, &stat); err != nil {
@@ -576,13 +842,14 @@ func checkFreeDiskSpace(e *Environment) error {
 
 // automatedTasks is a list of cronjobs for maintenance, backup, or non-critical operations
 func automatedTasks(e *Environment) {
+	conf := e.Config()
 	// new scheduler
 	s := gocron.NewScheduler()
 
 	// 1. every day, backup user files
-	s.Every(1).Day().At("00:00").Do(ArchiveUserFiles)
+	s.Every(1).Day().At("00:00").Do(ArchiveUserFiles, e)
 	// 2. a little later, also compress the git repository if gitlab pages are configured
-	if e.config.gitlabPagesConfigured {
+	if conf.gitlabPagesConfigured {
 		s.Every(7).Days().At("00:15").Do(e.git.Compress)
 	}
 	// 3. check quota is available
@@ -595,7 +862,7 @@ func automatedTasks(e *Environment) {
 			logthis.Error(errors.Wrap(err, "warning: quota usage monitoring off"), logthis.NORMAL)
 		} else {
 			// scheduler for subsequent quota checks
-			s.Every(1).Hour().Do(checkQuota)
+			s.Every(1).Hour().Do(checkQuota, e)
 		}
 	}
 	// 4. check disk space is available
@@ -604,10 +871,17 @@ func automatedTasks(e *Environment) {
 		logthis.Error(errors.Wrap(err, "warning: disk usage monitoring off"), logthis.NORMAL)
 	} else {
 		// scheduler for subsequent quota checks
-		s.Every(1).Hour().Do(checkFreeDiskSpace)
+		s.Every(1).Hour().Do(checkFreeDiskSpace, e)
 	}
 	// 5. update database stats
 	s.Every(1).Day().At("00:05").Do(GenerateStats, e)
+	// 6. forget old announces
+	if err := PurgeAnnounces(e); err != nil {
+		logthis.Error(err, logthis.NORMAL)
+	}
+	s.Every(1).Day().At("00:10").Do(PurgeAnnounces, e)
+	// 7. forget releases that could not be snatched
+	s.Every(1).Day().At("00:10").Do(PurgeSnatchQueue, e)
 	// launch scheduler
 	<-s.Start()
 }
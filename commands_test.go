@@ -2,6 +2,9 @@ package varroa
 
 import (
 	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -13,6 +16,78 @@ const (
      /dev/md127 265117776  314572800       0           92837       0       0        `
 )
 
+const dryRunTestConfig = `general:
+  watch_directory: test
+  log_level: 2
+
+trackers:
+  - name: dryrun
+    api_key: key
+    url: http://127.0.0.1:1
+  - name: other
+    api_key: key
+    url: http://127.0.0.1:1
+
+autosnatch:
+  - tracker: dryrun
+    irc_server: irc.dryrun:6697
+    irc_key: key
+    nickserv_password: password
+    bot_name: bot
+    announcer: Announcer
+    announce_channel: "#announce"
+
+filters:
+  - name: flac
+    format:
+    - FLAC
+  - name: label
+    record_label:
+    - Label
+  - name: other
+    tracker:
+    - other
+`
+
+func TestDryRunFilters(t *testing.T) {
+	fmt.Println("+ Testing DryRunFilters...")
+	check := assert.New(t)
+
+	// the tracker cannot be reached: metadata comes from the cache in the data directory, or from the fixtures
+	// next to the announces file.
+	fixturesDir := filepath.Join("test", "dryrun")
+	e := NewEnvironment(NewPaths("", fixturesDir, ""))
+	check.Nil(e.config.LoadFromBytes([]byte(dryRunTestConfig)))
+	announceFile := filepath.Join(fixturesDir, "announces.txt")
+	check.Nil(DryRunFilters(e, "dryrun", announceFile))
+	check.NotNil(DryRunFilters(e, "dryrun", filepath.Join(fixturesDir, "missing.txt")))
+
+	// 301 is in the metadata cache, 302 is a fixture, and there is no metadata for 303.
+	expected := []map[string]string{
+		{"flac": "accepted", "label": "accepted", "other": "ignored"},
+		{"flac": "accepted", "label": "rejected", "other": "ignored"},
+		{"flac": "rejected", "label": "unknown", "other": "ignored"},
+	}
+	data, err := ioutil.ReadFile(announceFile)
+	check.Nil(err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	check.Equal(len(expected), len(lines))
+	for i, line := range lines {
+		release, err := parseAnnounce("dryrun", line, defaultAnnounceFormats)
+		check.Nil(err)
+		verdicts := dryRunRelease(e, e.Config(), nil, "dryrun", release, nil, fixturesDir)
+		check.Equal(len(e.config.Filters), len(verdicts))
+		for _, v := range verdicts {
+			check.Equal(expected[i][v.filter], v.result, release.TorrentID+": "+v.filter)
+		}
+		if release.TorrentID == "302" {
+			// the record label comes from the fixture
+			check.Equal("Label", verdicts[1].expected)
+			check.Equal("Other Label", verdicts[1].actual)
+		}
+	}
+}
+
 func TestQuota(t *testing.T) {
 	fmt.Println("\n --- Testing Quota parsing. ---")
 	check := assert.New(t)
@@ -15,6 +15,7 @@ import (
 
 var config *Config
 var onceConfig sync.Once
+var configMutex sync.RWMutex
 
 type Config struct {
 	General                     *ConfigGeneral
@@ -28,6 +29,7 @@ type Config struct {
 	Library                     *ConfigLibrary
 	MPD                         *ConfigMPD
 	Metadata                    *ConfigMetadata
+	TorrentClient               *ConfigTorrentClient `yaml:"torrent_client"`
 	autosnatchConfigured        bool
 	statsConfigured             bool
 	webserverConfigured         bool
@@ -44,42 +46,58 @@ type Config struct {
 	mpdConfigured               bool
 	metadataConfigured          bool
 	discogsTokenConfigured      bool
+	torrentClientConfigured     bool
 }
 
 func NewConfig(path string) (*Config, error) {
 	var newConfigErr error
 	onceConfig.Do(func() {
-		// TODO check path has yamlExt!
-		newConf := &Config{}
-		encryptedConfigurationFile := strings.TrimSuffix(path, yamlExt) + encryptedExt
-		if fs.FileExists(encryptedConfigurationFile) && !fs.FileExists(path) {
-			// if using encrypted config file, ask for the passphrase and retrieve it from the daemon side
-			passphraseBytes, err := SavePassphraseForDaemon()
-			if err != nil {
-				newConfigErr = err
-				return
-			}
-			configBytes, err := decrypt(encryptedConfigurationFile, passphraseBytes)
-			if err != nil {
-				newConfigErr = err
-				return
-			}
-			if err := newConf.LoadFromBytes(configBytes); err != nil {
-				newConfigErr = err
-				return
-			}
-		} else {
-			if err := newConf.Load(path); err != nil {
-				newConfigErr = err
-				return
-			}
+		newConf, err := readConfiguration(path)
+		if err != nil {
+			newConfigErr = err
+			return
 		}
 		// set the global pointer once everything is OK.
-		config = newConf
+		setCurrentConfig(newConf)
 	})
+	configMutex.RLock()
+	defer configMutex.RUnlock()
 	return config, newConfigErr
 }
 
+// setCurrentConfig replaces the configuration returned by NewConfig.
+func setCurrentConfig(c *Config) {
+	configMutex.Lock()
+	config = c
+	configMutex.Unlock()
+}
+
+// readConfiguration from the file, or from its encrypted version.
+func readConfiguration(path string) (*Config, error) {
+	// TODO check path has yamlExt!
+	newConf := &Config{}
+	encryptedConfigurationFile := strings.TrimSuffix(path, yamlExt) + encryptedExt
+	if fs.FileExists(encryptedConfigurationFile) && !fs.FileExists(path) {
+		// if using encrypted config file, ask for the passphrase and retrieve it from the daemon side
+		passphraseBytes, err := SavePassphraseForDaemon()
+		if err != nil {
+			return nil, err
+		}
+		configBytes, err := decrypt(encryptedConfigurationFile, passphraseBytes)
+		if err != nil {
+			return nil, err
+		}
+		if err := newConf.LoadFromBytes(configBytes); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := newConf.Load(path); err != nil {
+			return nil, err
+		}
+	}
+	return newConf, nil
+}
+
 func (c *Config) String() string {
 	txt := c.General.String() + "\n"
 	for _, f := range c.Trackers {
@@ -118,6 +136,9 @@ func (c *Config) String() string {
 	if c.metadataConfigured {
 		txt += c.Metadata.String() + "\n"
 	}
+	if c.torrentClientConfigured {
+		txt += c.TorrentClient.String() + "\n"
+	}
 	return txt
 }
 
@@ -226,6 +247,13 @@ func (c *Config) check() error {
 		}
 	}
 
+	// torrent client checks
+	if c.TorrentClient != nil {
+		if err := c.TorrentClient.check(); err != nil {
+			return errors.Wrap(err, "Error reading torrent client configuration")
+		}
+	}
+
 	// setting a few shortcut flags
 	c.autosnatchConfigured = len(c.Autosnatch) != 0
 	c.statsConfigured = len(c.Stats) != 0
@@ -243,12 +271,13 @@ func (c *Config) check() error {
 	c.webserverMetadata = c.DownloadFolderConfigured && c.webserverConfigured && c.WebServer.ServeMetadata
 	c.metadataConfigured = c.Metadata != nil
 	c.discogsTokenConfigured = c.metadataConfigured && c.Metadata.DiscogsToken != ""
+	c.torrentClientConfigured = c.TorrentClient != nil
 
 	// config-wide checks
 	configuredTrackers := c.TrackerLabels()
 	if c.autosnatchConfigured {
-		if c.General.WatchDir == "" {
-			return errors.New("Autosnatch enabled, existing watch directory must be provided")
+		if c.General.WatchDir == "" && !c.torrentClientConfigured {
+			return errors.New("Autosnatch enabled, existing watch directory or torrent client must be provided")
 		}
 		if len(c.Filters) == 0 {
 			return errors.New("Autosnatch enabled, but no filters are defined")
@@ -315,7 +344,9 @@ func (c *Config) check() error {
 		// check the tracker has an associated IRC server defined
 		var configuredIRCServers []string
 		for _, a := range c.Autosnatch {
-			configuredIRCServers = append(configuredIRCServers, a.Tracker)
+			if a.usesIRC() {
+				configuredIRCServers = append(configuredIRCServers, a.Tracker)
+			}
 		}
 		if !strslice.Contains(configuredIRCServers, c.Notifications.Irc.Tracker) {
 			return errors.New("IRC server for tracker " + c.Notifications.Irc.Tracker + " is not defined in the autosnatch section.")
@@ -371,3 +402,22 @@ func (c *Config) GetAutosnatch(label string) (*ConfigAutosnatch, error) {
 	}
 	return nil, errors.New("Could not find Autosnatch configuration for tracker " + label)
 }
+
+func (c *Config) GetFilter(name string) (*ConfigFilter, error) {
+	for _, f := range c.Filters {
+		if f.Name == name {
+			return f, nil
+		}
+	}
+	return nil, errors.New("Could not find filter " + name)
+}
+
+// CheckAnnounceSamples parses the sample announces of all announce formats.
+func (c *Config) CheckAnnounceSamples() error {
+	for _, a := range c.Autosnatch {
+		if err := a.checkSamples(); err != nil {
+			return errors.Wrap(err, "Error checking announce formats for tracker "+a.Tracker)
+		}
+	}
+	return nil
+}
@@ -34,7 +34,7 @@ func GetPassphrase() (string, error) {
 func SavePassphraseForDaemon() ([]byte, error) {
 	var passphrase string
 	var err error
-	if !daemon.WasReborn() {
+	if !daemon.WasReborn() && os.Getenv(envPassphrase) == "" {
 		// if necessary, ask for passphrase and add to env
 		passphrase, err = GetPassphrase()
 		if err != nil {
@@ -1,6 +1,7 @@
 package varroa
 
 import (
+	"crypto/tls"
 	"fmt"
 	"io/ioutil"
 	"reflect"
@@ -31,6 +32,12 @@ type ConfigGeneral struct {
 	AutomaticMetadataRetrieval bool   `yaml:"automatic_metadata_retrieval"`
 	FullMetadataRetrieval      bool   `yaml:"full_metadata_retrieval"`
 	TimestampedLogs            bool   `yaml:"timestamped_logs"`
+	AnnounceRetentionDays      int    `yaml:"announce_retention_days"`
+	SnatchWorkers              int    `yaml:"snatch_workers"`
+	CrossTrackerDuplicates     string `yaml:"cross_tracker_duplicates"`
+	CrossTrackerMatchSize      bool   `yaml:"cross_tracker_match_size"`
+	CrossTrackerMatchFiles     bool   `yaml:"cross_tracker_match_files"`
+	VerifyLinks                bool   `yaml:"verify_links"`
 }
 
 func (cg *ConfigGeneral) check() error {
@@ -46,6 +53,31 @@ func (cg *ConfigGeneral) check() error {
 	if (cg.AutomaticMetadataRetrieval || cg.FullMetadataRetrieval) && cg.DownloadDir == "" {
 		return errors.New("downloads directory must be defined to allow metadata retrieval")
 	}
+	if cg.AnnounceRetentionDays < 0 {
+		return errors.New("announce retention must be a positive number of days")
+	}
+	if cg.AnnounceRetentionDays == 0 {
+		cg.AnnounceRetentionDays = defaultAnnounceRetentionDays
+	}
+	if cg.SnatchWorkers < 0 {
+		return errors.New("the number of snatch workers must be positive")
+	}
+	if cg.SnatchWorkers == 0 {
+		cg.SnatchWorkers = defaultSnatchWorkers
+	}
+	switch cg.CrossTrackerDuplicates {
+	case "":
+		if cg.CrossTrackerMatchSize || cg.CrossTrackerMatchFiles {
+			return errors.New("cross-tracker duplicate criteria require cross_tracker_duplicates")
+		}
+	case crossTrackerSkip:
+	case crossTrackerCrossSeed:
+		if !cg.CrossTrackerMatchFiles {
+			return errors.New("cross-seeding duplicates requires matching their file lists")
+		}
+	default:
+		return errors.New("cross-tracker duplicates can only be skipped (" + crossTrackerSkip + ") or cross-seeded (" + crossTrackerCrossSeed + ")")
+	}
 	return nil
 }
 
@@ -58,6 +90,14 @@ func (cg *ConfigGeneral) String() string {
 	txt += "\tDownload directory: " + cg.DownloadDir + "\n"
 	txt += "\tDownload metadata automatically: " + fmt.Sprintf("%v", cg.AutomaticMetadataRetrieval) + "\n"
 	txt += "\tDownload all related metadata: " + fmt.Sprintf("%v", cg.FullMetadataRetrieval) + "\n"
+	txt += "\tKeep announces for (days): " + strconv.Itoa(cg.AnnounceRetentionDays) + "\n"
+	txt += "\tSnatch workers: " + strconv.Itoa(cg.SnatchWorkers) + "\n"
+	txt += "\tVerify linked or copied files: " + fmt.Sprintf("%v", cg.VerifyLinks) + "\n"
+	if cg.CrossTrackerDuplicates != "" {
+		txt += "\tCross-tracker duplicates: " + cg.CrossTrackerDuplicates + "\n"
+		txt += "\tCross-tracker duplicates must have the same size: " + fmt.Sprintf("%v", cg.CrossTrackerMatchSize) + "\n"
+		txt += "\tCross-tracker duplicates must have the same files: " + fmt.Sprintf("%v", cg.CrossTrackerMatchFiles) + "\n"
+	}
 	return txt
 }
 
@@ -97,30 +137,76 @@ func (ct *ConfigTracker) String() string {
 }
 
 type ConfigAutosnatch struct {
-	Tracker               string
-	LocalAddress          string `yaml:"local_address"`
-	IRCServer             string `yaml:"irc_server"`
-	IRCKey                string `yaml:"irc_key"`
-	IRCSSL                bool   `yaml:"irc_ssl"`
-	IRCSSLSkipVerify      bool   `yaml:"irc_ssl_skip_verify"`
-	NickservPassword      string `yaml:"nickserv_password"`
-	BotName               string `yaml:"bot_name"`
-	UseZNC                bool   `yaml:"use_znc"`
-	ZNCNetwork            string `yaml:"znc_network"`
-	ZNCPassword           string `yaml:"znc_password"`
-	Announcer             string
-	AnnounceChannel       string   `yaml:"announce_channel"`
-	BlacklistedUploaders  []string `yaml:"blacklisted_uploaders"`
-	disabledAutosnatching bool
+	Tracker                 string
+	LocalAddress            string `yaml:"local_address"`
+	IRCServer               string `yaml:"irc_server"`
+	IRCKey                  string `yaml:"irc_key"`
+	IRCSSL                  bool   `yaml:"irc_ssl"`
+	IRCSSLSkipVerify        bool   `yaml:"irc_ssl_skip_verify"`
+	NickservPassword        string `yaml:"nickserv_password"`
+	SASLMechanism           string `yaml:"sasl_mechanism"`
+	IRCClientCertificate    string `yaml:"irc_client_certificate"`
+	IRCClientKey            string `yaml:"irc_client_key"`
+	BotName                 string `yaml:"bot_name"`
+	UseZNC                  bool   `yaml:"use_znc"`
+	ZNCNetwork              string `yaml:"znc_network"`
+	ZNCPassword             string `yaml:"znc_password"`
+	Announcer               string
+	AnnounceChannel         string                  `yaml:"announce_channel"`
+	BlacklistedUploaders    []string                `yaml:"blacklisted_uploaders"`
+	AnnounceWatchdogMinutes int                     `yaml:"announce_watchdog_minutes"`
+	AnnounceFormats         []*ConfigAnnounceFormat `yaml:"announce_formats"`
+	SnatchDelaySeconds      int                     `yaml:"snatch_delay_seconds"`
+	SnatchIntervalSeconds   int                     `yaml:"snatch_interval_seconds"`
+	SnatchAttempts          int                     `yaml:"snatch_attempts"`
+	SnatchRetrySeconds      int                     `yaml:"snatch_retry_seconds"`
+	FLTokens                int                     `yaml:"fl_tokens"`
+	Feed                    *ConfigFeed             `yaml:"feed"`
+	announceFormats         []*ConfigAnnounceFormat
+	clientCertificate       *tls.Certificate
 }
 
 func (ca *ConfigAutosnatch) check() error {
 	if ca.Tracker == "" {
 		return errors.New("Missing tracker name")
 	}
-	if ca.IRCServer == "" {
-		return errors.New("Missing IRC server")
+	if !ca.usesIRC() && ca.Feed == nil {
+		return errors.New("Missing IRC server or feed")
 	}
+	if ca.usesIRC() {
+		if err := ca.checkIRC(); err != nil {
+			return err
+		}
+	}
+	if ca.Feed != nil {
+		if err := ca.Feed.check(); err != nil {
+			return errors.Wrap(err, "Invalid feed")
+		}
+	}
+	if ca.SnatchDelaySeconds < 0 || ca.SnatchIntervalSeconds < 0 {
+		return errors.New("Snatch delay and interval must be positive, or 0 to snatch immediately")
+	}
+	if ca.SnatchAttempts < 0 || ca.SnatchRetrySeconds < 0 {
+		return errors.New("Snatch attempts and retry delay must be positive")
+	}
+	if ca.FLTokens < 0 {
+		return errors.New("The number of freeleech tokens must be positive")
+	}
+	if ca.SnatchAttempts == 0 {
+		ca.SnatchAttempts = defaultSnatchAttempts
+	}
+	if ca.SnatchRetrySeconds == 0 {
+		ca.SnatchRetrySeconds = defaultSnatchRetrySeconds
+	}
+	return nil
+}
+
+// usesIRC if the tracker announces are followed on IRC, and not only with a feed.
+func (ca *ConfigAutosnatch) usesIRC() bool {
+	return ca.IRCServer != ""
+}
+
+func (ca *ConfigAutosnatch) checkIRC() error {
 	// check it's server:port
 	r := regexp.MustCompile(ircServerPattern)
 	hits := r.FindAllStringSubmatch(ca.IRCServer, -1)
@@ -130,9 +216,29 @@ func (ca *ConfigAutosnatch) check() error {
 	if ca.IRCKey == "" {
 		return errors.New("Missing IRC key")
 	}
-	if ca.NickservPassword == "" {
+	ca.SASLMechanism = strings.ToLower(ca.SASLMechanism)
+	if ca.SASLMechanism != "" && ca.SASLMechanism != saslPlain && ca.SASLMechanism != saslExternal {
+		return errors.New("SASL mechanism must be " + saslPlain + " or " + saslExternal)
+	}
+	if ca.NickservPassword == "" && ca.SASLMechanism != saslExternal {
 		return errors.New("Missing NickServ password")
 	}
+	if ca.SASLMechanism != "" && ca.UseZNC {
+		return errors.New("SASL cannot be used through ZNC")
+	}
+	if ca.IRCClientCertificate != "" || ca.IRCClientKey != "" {
+		if !ca.IRCSSL {
+			return errors.New("A client certificate can only be used with irc_ssl")
+		}
+		certificate, err := tls.LoadX509KeyPair(ca.IRCClientCertificate, ca.IRCClientKey)
+		if err != nil {
+			return errors.Wrap(err, "Could not load the IRC client certificate")
+		}
+		ca.clientCertificate = &certificate
+	}
+	if ca.SASLMechanism == saslExternal && ca.clientCertificate == nil {
+		return errors.New("SASL " + saslExternal + " requires a client certificate")
+	}
 	if ca.BotName == "" {
 		return errors.New("Missing bot registered nickname")
 	}
@@ -148,6 +254,42 @@ func (ca *ConfigAutosnatch) check() error {
 	if !strings.HasPrefix(ca.AnnounceChannel, "#") {
 		return errors.New("Invalid announce channel")
 	}
+	if ca.AnnounceWatchdogMinutes < 0 {
+		return errors.New("Announce watchdog delay must be positive, or 0 to disable it")
+	}
+	for _, f := range ca.AnnounceFormats {
+		if err := f.check(); err != nil {
+			return errors.Wrap(err, "Invalid announce format")
+		}
+	}
+	ca.announceFormats = ca.AnnounceFormats
+	if len(ca.announceFormats) == 0 {
+		ca.announceFormats = defaultAnnounceFormats
+	}
+	return nil
+}
+
+// checkSamples makes sure the sample announces of each format are parsed as music releases.
+func (ca *ConfigAutosnatch) checkSamples() error {
+	if ca.Feed != nil {
+		if err := ca.Feed.checkSamples(ca.Tracker); err != nil {
+			return err
+		}
+	}
+	for i, f := range ca.announceFormats {
+		for _, sample := range f.Samples {
+			if f.match(sample) == nil {
+				return fmt.Errorf("announce format #%d does not match its sample: %s", i+1, sample)
+			}
+			release, err := parseAnnounce(ca.Tracker, sample, []*ConfigAnnounceFormat{f})
+			if err != nil {
+				return errors.Wrapf(err, "announce format #%d cannot parse its sample: %s", i+1, sample)
+			}
+			if !release.IsMusicRelease() {
+				return fmt.Errorf("announce format #%d does not find an artist in its sample: %s", i+1, sample)
+			}
+		}
+	}
 	return nil
 }
 
@@ -156,14 +298,44 @@ func (ca *ConfigAutosnatch) String() string {
 	if ca.LocalAddress != "" {
 		txt += "\tLocal address: " + ca.LocalAddress + "\n"
 	}
-	txt += "\tIRC server: " + ca.IRCServer + "\n"
-	txt += "\tIRC KeyPassword: " + ca.IRCKey + "\n"
-	txt += "\tUse SSL: " + fmt.Sprintf("%v", ca.IRCSSL) + "\n"
-	txt += "\tSkip SSL verification: " + fmt.Sprintf("%v", ca.IRCSSLSkipVerify) + "\n"
-	txt += "\tNickserv password: " + ca.NickservPassword + "\n"
-	txt += "\tBot nickname: " + ca.BotName + "\n"
-	txt += "\tAnnouncer: " + ca.Announcer + "\n"
-	txt += "\tAnnounce channel: " + ca.AnnounceChannel + "\n"
+	if ca.usesIRC() {
+		txt += "\tIRC server: " + ca.IRCServer + "\n"
+		txt += "\tIRC KeyPassword: " + ca.IRCKey + "\n"
+		txt += "\tUse SSL: " + fmt.Sprintf("%v", ca.IRCSSL) + "\n"
+		txt += "\tSkip SSL verification: " + fmt.Sprintf("%v", ca.IRCSSLSkipVerify) + "\n"
+		txt += "\tNickserv password: " + ca.NickservPassword + "\n"
+		if ca.SASLMechanism != "" {
+			txt += "\tSASL mechanism: " + ca.SASLMechanism + "\n"
+		}
+		if ca.IRCClientCertificate != "" {
+			txt += "\tClient certificate: " + ca.IRCClientCertificate + " (key: " + ca.IRCClientKey + ")\n"
+		}
+		txt += "\tBot nickname: " + ca.BotName + "\n"
+		txt += "\tAnnouncer: " + ca.Announcer + "\n"
+		txt += "\tAnnounce channel: " + ca.AnnounceChannel + "\n"
+		if len(ca.AnnounceFormats) == 0 {
+			txt += "\tAnnounce formats: built-in\n"
+		}
+		for _, f := range ca.AnnounceFormats {
+			txt += "\tAnnounce format: " + f.Pattern + "\n"
+		}
+		if ca.AnnounceWatchdogMinutes != 0 {
+			txt += "\tReconnect after " + strconv.Itoa(ca.AnnounceWatchdogMinutes) + " minutes without announces\n"
+		}
+	}
+	if ca.Feed != nil {
+		txt += ca.Feed.String()
+	}
+	if ca.SnatchDelaySeconds != 0 {
+		txt += "\tSnatch after (seconds): " + strconv.Itoa(ca.SnatchDelaySeconds) + "\n"
+	}
+	if ca.SnatchIntervalSeconds != 0 {
+		txt += "\tMinimum interval between snatches (seconds): " + strconv.Itoa(ca.SnatchIntervalSeconds) + "\n"
+	}
+	if ca.FLTokens != 0 {
+		txt += "\tFreeleech tokens available to filters: " + strconv.Itoa(ca.FLTokens) + "\n"
+	}
+	txt += "\tSnatch attempts: " + strconv.Itoa(ca.SnatchAttempts) + ", retrying after (seconds): " + strconv.Itoa(ca.SnatchRetrySeconds) + "\n"
 	if len(ca.BlacklistedUploaders) != 0 {
 		txt += "\tBlacklisted uploaders: " + strings.Join(ca.BlacklistedUploaders, ",") + "\n"
 	} else {
@@ -172,11 +344,127 @@ func (ca *ConfigAutosnatch) String() string {
 	return txt
 }
 
+// ConfigAnnounceFormat describes announces with a regular expression using named capture groups, such as (?P<artist>.*?).
+type ConfigAnnounceFormat struct {
+	Pattern string
+	Samples []string
+	regexp  *regexp.Regexp
+}
+
+func (cf *ConfigAnnounceFormat) check() error {
+	return cf.checkGroups(announceRequiredGroups)
+}
+
+// checkGroups makes sure the pattern is valid and has all the required named groups.
+func (cf *ConfigAnnounceFormat) checkGroups(required []string) error {
+	if cf.Pattern == "" {
+		return errors.New("Missing pattern")
+	}
+	r, err := regexp.Compile(cf.Pattern)
+	if err != nil {
+		return errors.Wrap(err, "Invalid pattern")
+	}
+	var groups []string
+	for _, name := range r.SubexpNames() {
+		if name == "" {
+			continue
+		}
+		if !strslice.Contains(announceGroups, name) {
+			return errors.New("Unknown named group " + name + ", expected one of: " + strings.Join(announceGroups, ", "))
+		}
+		groups = append(groups, name)
+	}
+	for _, name := range required {
+		if !strslice.Contains(groups, name) {
+			return errors.New("Missing named group " + name)
+		}
+	}
+	cf.regexp = r
+	return nil
+}
+
+// match returns the named groups found in an announce, or nil if it does not match.
+func (cf *ConfigAnnounceFormat) match(announced string) map[string]string {
+	hits := cf.regexp.FindStringSubmatch(announced)
+	if hits == nil {
+		return nil
+	}
+	fields := make(map[string]string)
+	for i, name := range cf.regexp.SubexpNames() {
+		if name != "" {
+			fields[name] = hits[i]
+		}
+	}
+	return fields
+}
+
+// ConfigFeed describes a personal RSS or JSON notification feed, polled instead of, or in addition to, the IRC announces.
+// The item formats are matched against the title of the items; the torrent URL is the link of the item if they do not capture it.
+type ConfigFeed struct {
+	URL             string
+	IntervalMinutes int                     `yaml:"interval_minutes"`
+	ItemFormats     []*ConfigAnnounceFormat `yaml:"item_formats"`
+	itemFormats     []*ConfigAnnounceFormat
+}
+
+func (cf *ConfigFeed) check() error {
+	if cf.URL == "" {
+		return errors.New("Missing feed URL")
+	}
+	if !strings.HasPrefix(cf.URL, "http://") && !strings.HasPrefix(cf.URL, "https://") {
+		return errors.New("Feed URL must be an http(s) address")
+	}
+	if cf.IntervalMinutes < 0 {
+		return errors.New("Feed polling interval must be positive")
+	}
+	if cf.IntervalMinutes == 0 {
+		cf.IntervalMinutes = defaultFeedIntervalMinutes
+	}
+	for _, f := range cf.ItemFormats {
+		if err := f.checkGroups(feedRequiredGroups); err != nil {
+			return errors.Wrap(err, "Invalid item format")
+		}
+	}
+	cf.itemFormats = cf.ItemFormats
+	if len(cf.itemFormats) == 0 {
+		cf.itemFormats = defaultFeedFormats
+	}
+	return nil
+}
+
+// checkSamples makes sure the sample titles of each item format are parsed as music releases.
+func (cf *ConfigFeed) checkSamples(trackerName string) error {
+	for i, f := range cf.itemFormats {
+		for _, sample := range f.Samples {
+			release, err := parseFeedItem(trackerName, &feedItem{Title: sample, Link: feedSampleLink}, []*ConfigAnnounceFormat{f})
+			if err != nil {
+				return errors.Wrapf(err, "feed item format #%d cannot parse its sample: %s", i+1, sample)
+			}
+			if release == nil || !release.IsMusicRelease() {
+				return fmt.Errorf("feed item format #%d does not match its sample: %s", i+1, sample)
+			}
+		}
+	}
+	return nil
+}
+
+func (cf *ConfigFeed) String() string {
+	txt := "\tFeed: " + cf.URL + ", polled every " + strconv.Itoa(cf.IntervalMinutes) + " minutes\n"
+	if len(cf.ItemFormats) == 0 {
+		txt += "\tFeed item formats: built-in\n"
+	}
+	for _, f := range cf.ItemFormats {
+		txt += "\tFeed item format: " + f.Pattern + "\n"
+	}
+	return txt
+}
+
 type ConfigLibrary struct {
 	Directory         string              `yaml:"directory"`
 	UseHardLinks      bool                `yaml:"use_hard_links"`
 	MoveSorted        bool                `yaml:"move_sorted"`
 	AutomaticMode     bool                `yaml:"automatic_mode"`
+	SortOnCompletion  bool                `yaml:"sort_on_completion"`
 	Template          string              `yaml:"folder_template"`
 	AdditionalSources []string            `yaml:"additional_source_directories"`
 	AliasesFile       string              `yaml:"aliases_file"`
@@ -227,6 +515,9 @@ func (cl *ConfigLibrary) check() error {
 	if cl.UseHardLinks && cl.MoveSorted {
 		return errors.New("using hard links and moving sorted downloads are incompatible options")
 	}
+	if cl.SortOnCompletion && !cl.AutomaticMode {
+		return errors.New("sorting downloads on completion requires automatic mode")
+	}
 	return nil
 }
 
@@ -247,9 +538,10 @@ func (cl *ConfigLibrary) loadMap(path string) (*map[string][]string, error) {
 func (cl *ConfigLibrary) String() string {
 	txt := "Library configuration:\n"
 	txt += "\tDirectory: " + cl.Directory + "\n"
-	txt += "\tUse hard links: " + fmt.Sprintf("%v", cl.UseHardLinks) + "\n"
+	txt += "\tUse hard links if reflinks are not supported: " + fmt.Sprintf("%v", cl.UseHardLinks) + "\n"
 	txt += "\tMove sorted downloads: " + fmt.Sprintf("%v", cl.MoveSorted) + "\n"
 	txt += "\tAutomatic (non-interactive) mode: " + fmt.Sprintf("%v", cl.AutomaticMode) + "\n"
+	txt += "\tSort downloads on completion: " + fmt.Sprintf("%v", cl.SortOnCompletion) + "\n"
 	txt += "\tTemplate: " + cl.Template + "\n"
 	if len(cl.AdditionalSources) != 0 {
 		txt += "\tAdditional sources: " + strings.Join(cl.AdditionalSources, ",") + "\n"
@@ -271,6 +563,9 @@ type ConfigStats struct {
 	MaxBufferDecreaseMB int     `yaml:"max_buffer_decrease_by_period_mb"`
 	MinimumRatio        float64 `yaml:"min_ratio"`
 	TargetRatio         float64 `yaml:"target_ratio"`
+	ReenableAutosnatch  bool    `yaml:"reenable_autosnatch"`
+	ReenableRatio       float64 `yaml:"reenable_ratio"`
+	ReenableBufferMB    int     `yaml:"reenable_buffer_increase_mb"`
 }
 
 func (cs *ConfigStats) check() error {
@@ -295,15 +590,39 @@ func (cs *ConfigStats) check() error {
 	if cs.TargetRatio < cs.MinimumRatio {
 		return fmt.Errorf("target ratio must be higher than minimum ratio (%.2f)", cs.MinimumRatio)
 	}
+	if cs.ReenableBufferMB < 0 {
+		return errors.New("buffer increase before re-enabling autosnatching must be positive")
+	}
+	if cs.ReenableAutosnatch {
+		if cs.ReenableRatio == 0 {
+			cs.ReenableRatio = cs.TargetRatio
+		}
+		if cs.ReenableRatio <= cs.MinimumRatio {
+			return fmt.Errorf("ratio for re-enabling autosnatching must be higher than minimum ratio (%.2f)", cs.MinimumRatio)
+		}
+	}
 	return nil
 }
 
+// recovered returns true if the ratio and buffer are good enough to re-enable autosnatching,
+// given the buffer when it was disabled.
+func (cs *ConfigStats) recovered(stats *StatsEntry, bufferWhenDisabled int64) bool {
+	if !cs.ReenableAutosnatch || stats.Ratio < cs.ReenableRatio {
+		return false
+	}
+	buffer, _ := stats.getBufferValues(cs.TargetRatio)
+	return buffer-bufferWhenDisabled >= int64(cs.ReenableBufferMB)*1024*1024
+}
+
 func (cs *ConfigStats) String() string {
 	txt := "Stats configuration for " + cs.Tracker + "\n"
 	txt += "\tUpdate period (hours): " + strconv.Itoa(cs.UpdatePeriodH) + "\n"
 	txt += "\tMaximum buffer decrease (MB): " + strconv.Itoa(cs.MaxBufferDecreaseMB) + "\n"
 	txt += "\tMinimum ratio: " + strconv.FormatFloat(cs.MinimumRatio, 'f', 2, 64) + "\n"
 	txt += "\tTarget ratio: " + strconv.FormatFloat(cs.TargetRatio, 'f', 2, 64) + "\n"
+	if cs.ReenableAutosnatch {
+		txt += "\tRe-enable autosnatching above ratio: " + strconv.FormatFloat(cs.ReenableRatio, 'f', 2, 64) + ", after a buffer increase of (MB): " + strconv.Itoa(cs.ReenableBufferMB) + "\n"
+	}
 	return txt
 }
 
@@ -543,6 +862,32 @@ type ConfigFilter struct {
 	RejectUnknown        bool     `yaml:"reject_unknown_releases"`
 	RejectTrumpable      bool     `yaml:"reject_trumpable_releases"`
 	BlacklistedUploaders []string `yaml:"blacklisted_uploaders"`
+	Expression           string   `yaml:"expression"`
+	MaxSnatchesPerDay    int      `yaml:"max_snatches_per_day"`
+	MaxSizePerWeekGB     int      `yaml:"max_size_per_week_gb"`
+	MaxTotalSnatches     int      `yaml:"max_total_snatches"`
+	ActiveHours          []string `yaml:"active_hours"`
+	ActiveDays           []string `yaml:"active_days"`
+	ActiveUntil          string   `yaml:"active_until"`
+	UseFLToken           bool     `yaml:"use_fl_token"`
+	FLTokenMinSizeMB     int      `yaml:"fl_token_min_size_mb"`
+	FLTokenMaxRatio      float64  `yaml:"fl_token_max_ratio"`
+	FLTokenReserve       int      `yaml:"fl_token_reserve"`
+	expression           *FilterExpression
+	// patterns compiled by prepare()
+	artist         *filterMatcher
+	excludedArtist *filterMatcher
+	recordLabel    *filterMatcher
+	edition        *filterMatcher
+	title          *filterMatcher
+	tagsIncluded   *filterMatcher
+	// one matcher per required or excluded tag
+	tagsRequired []*filterMatcher
+	tagsExcluded []*filterMatcher
+	// schedule parsed by prepare()
+	activeHours []hoursWindow
+	activeDays  []time.Weekday
+	activeUntil time.Time
 }
 
 func getRange(r string) (int, int, error) {
@@ -602,7 +947,57 @@ func (cf *ConfigFilter) prepare() error {
 			}
 		}
 	}
-	return nil
+	// compiling the match modes
+	var err error
+	if cf.artist, err = compileFilterPatterns("artist", cf.Artist); err != nil {
+		return err
+	}
+	if cf.excludedArtist, err = compileFilterPatterns("excluded_artist", cf.ExcludedArtist); err != nil {
+		return err
+	}
+	if cf.recordLabel, err = compileFilterPatterns("record_label", cf.RecordLabel); err != nil {
+		return err
+	}
+	if cf.edition, err = compileFilterPatterns("edition", cf.Edition); err != nil {
+		return err
+	}
+	if cf.title, err = compileFilterPatterns("title", cf.Title); err != nil {
+		return err
+	}
+	if cf.tagsIncluded, err = compileFilterPatterns("included_tags", cf.TagsIncluded); err != nil {
+		return err
+	}
+	if cf.tagsRequired, err = compileEachFilterPattern("required_tags", cf.TagsRequired); err != nil {
+		return err
+	}
+	if cf.tagsExcluded, err = compileEachFilterPattern("excluded_tags", cf.TagsExcluded); err != nil {
+		return err
+	}
+	return cf.prepareSchedule()
+}
+
+func compileFilterPatterns(field string, patterns []string) (*filterMatcher, error) {
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+	fm, err := newFilterMatcher(patterns)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid "+field)
+	}
+	return fm, nil
+}
+
+// compileEachFilterPattern returns a matcher for each pattern, for lists where every value counts on its own.
+func compileEachFilterPattern(field string, patterns []string) ([]*filterMatcher, error) {
+	var matchers []*filterMatcher
+	for _, pattern := range patterns {
+		fm, err := compileFilterPatterns(field, []string{pattern})
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, fm)
+	}
+	return matchers, nil
 }
 
 func (cf *ConfigFilter) check() error {
@@ -612,12 +1007,28 @@ func (cf *ConfigFilter) check() error {
 	if cf.Name == "" {
 		return errors.New("Missing filter name")
 	}
+	if cf.Expression != "" {
+		expression, err := ParseFilterExpression(cf.Expression)
+		if err != nil {
+			return errors.Wrap(err, "Invalid expression")
+		}
+		cf.expression = expression
+	}
 	if (cf.HasCue || cf.HasLog || cf.LogScore != 0) && !strslice.Contains(cf.Source, tracker.SourceCD) {
 		return errors.New("Has Log/Cue only relevant if CD is an acceptable source")
 	}
 	if cf.MaxSizeMB < 0 || cf.MinSizeMB < 0 {
 		return errors.New("Minimun and maximum sizes must not be negative")
 	}
+	if cf.MaxSnatchesPerDay < 0 || cf.MaxSizePerWeekGB < 0 || cf.MaxTotalSnatches < 0 {
+		return errors.New("Quotas must not be negative")
+	}
+	if cf.FLTokenMinSizeMB < 0 || cf.FLTokenMaxRatio < 0 || cf.FLTokenReserve < 0 {
+		return errors.New("Freeleech token rules must not be negative")
+	}
+	if !cf.UseFLToken && (cf.FLTokenMinSizeMB != 0 || cf.FLTokenMaxRatio != 0 || cf.FLTokenReserve != 0) {
+		return errors.New("Freeleech token rules require use_fl_token")
+	}
 	if cf.MaxSizeMB > 0 && cf.MinSizeMB >= cf.MaxSizeMB {
 		return errors.New("Minimun release size must be lower than maximum release size")
 	}
@@ -651,7 +1062,13 @@ func (cf *ConfigFilter) check() error {
 		cf.LogScore = 100
 		cf.Source = tracker.KnownSources
 	}
-	if reflect.DeepEqual(*cf, ConfigFilter{Name: cf.Name}) {
+	// schedule and quotas do not select releases by themselves
+	selection := *cf
+	selection.ActiveHours, selection.ActiveDays, selection.ActiveUntil = nil, nil, ""
+	selection.activeHours, selection.activeDays, selection.activeUntil = nil, nil, time.Time{}
+	selection.MaxSnatchesPerDay, selection.MaxSizePerWeekGB, selection.MaxTotalSnatches = 0, 0, 0
+	selection.UseFLToken, selection.FLTokenMinSizeMB, selection.FLTokenMaxRatio, selection.FLTokenReserve = false, 0, 0, 0
+	if reflect.DeepEqual(selection, ConfigFilter{Name: cf.Name}) {
 		return errors.New("Empty filter would snatch everything, it probably is not what you want")
 	}
 	if len(cf.Year) != 0 && len(cf.EditionYear) != 0 {
@@ -773,6 +1190,40 @@ func (cf *ConfigFilter) String() string {
 	if len(cf.EditionYear) != 0 {
 		description += "\tEdition Year(s): " + strings.Join(intslice.ToStringSlice(cf.EditionYear), ", ") + "\n"
 	}
+	if cf.expression != nil {
+		description += "\tExpression:\n\t\t" + strings.Join(cf.expression.Lines(), "\n\t\t") + "\n"
+	}
+	if len(cf.ActiveHours) != 0 {
+		description += "\tActive hours: " + strings.Join(cf.ActiveHours, ", ") + "\n"
+	}
+	if len(cf.ActiveDays) != 0 {
+		description += "\tActive days: " + strings.Join(cf.ActiveDays, ", ") + "\n"
+	}
+	if cf.ActiveUntil != "" {
+		description += "\tActive until: " + cf.ActiveUntil + "\n"
+	}
+	if cf.MaxSnatchesPerDay != 0 {
+		description += "\tMaximum snatches per day: " + strconv.Itoa(cf.MaxSnatchesPerDay) + "\n"
+	}
+	if cf.MaxSizePerWeekGB != 0 {
+		description += "\tMaximum size per week: " + strconv.Itoa(cf.MaxSizePerWeekGB) + "GB\n"
+	}
+	if cf.MaxTotalSnatches != 0 {
+		description += "\tMaximum snatches: " + strconv.Itoa(cf.MaxTotalSnatches) + "\n"
+	}
+	if cf.UseFLToken {
+		description += "\tUse freeleech tokens"
+		if cf.FLTokenMinSizeMB != 0 {
+			description += ", for releases of at least " + strconv.Itoa(cf.FLTokenMinSizeMB) + "MB"
+		}
+		if cf.FLTokenMaxRatio != 0 {
+			description += ", while the ratio is below " + strconv.FormatFloat(cf.FLTokenMaxRatio, 'f', 2, 64)
+		}
+		if cf.FLTokenReserve != 0 {
+			description += ", keeping " + strconv.Itoa(cf.FLTokenReserve) + " in reserve"
+		}
+		description += "\n"
+	}
 	description += "\tReject unknown releases: " + fmt.Sprintf("%v", cf.RejectUnknown) + "\n"
 	description += "\tReject trumpable releases: " + fmt.Sprintf("%v", cf.RejectTrumpable) + "\n"
 	if len(cf.BlacklistedUploaders) != 0 {
@@ -799,3 +1250,45 @@ func (cm *ConfigMetadata) check() error {
 	}
 	return nil
 }
+
+// ConfigTorrentClient describes a torrent client that varroa adds torrents to directly, instead of going through the watch directory.
+type ConfigTorrentClient struct {
+	Type        string `yaml:"type"`
+	URL         string `yaml:"url"`
+	User        string `yaml:"user"`
+	Password    string `yaml:"password"`
+	Label       string `yaml:"label"`
+	SavePath    string `yaml:"save_path"`
+	PollMinutes int    `yaml:"poll_minutes"`
+}
+
+func (ct *ConfigTorrentClient) String() string {
+	txt := "Torrent client configuration:\n"
+	txt += "\tType: " + ct.Type + "\n"
+	txt += "\tURL: " + ct.URL + "\n"
+	txt += "\tUser: " + ct.User + "\n"
+	txt += "\tPassword: " + ct.Password + "\n"
+	txt += "\tLabel: " + ct.Label + "\n"
+	txt += "\tSave path: " + ct.SavePath + "\n"
+	txt += "\tCheck downloads every (minutes): " + strconv.Itoa(ct.PollMinutes) + "\n"
+	return txt
+}
+
+func (ct *ConfigTorrentClient) check() error {
+	if ct.Type != torrentClientTransmission && ct.Type != torrentClientQBittorrent {
+		return errors.New("Torrent client type must be " + torrentClientTransmission + " or " + torrentClientQBittorrent)
+	}
+	if !strings.HasPrefix(ct.URL, "http://") && !strings.HasPrefix(ct.URL, "https://") {
+		return errors.New("Torrent client URL must be an http(s) address")
+	}
+	if ct.PollMinutes < 0 {
+		return errors.New("Torrent client polling interval must be positive")
+	}
+	if ct.PollMinutes == 0 {
+		ct.PollMinutes = defaultTorrentClientPollMinutes
+	}
+	if ct.Label == "" {
+		ct.Label = defaultTorrentClientLabel
+	}
+	return nil
+}
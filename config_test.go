@@ -30,6 +30,12 @@ func TestConfig(t *testing.T) {
 	check.True(c.General.AutomaticMetadataRetrieval)
 	check.True(c.General.FullMetadataRetrieval)
 	check.True(c.General.TimestampedLogs)
+	check.Equal(15, c.General.AnnounceRetentionDays)
+	check.Equal(3, c.General.SnatchWorkers)
+	check.Equal(crossTrackerCrossSeed, c.General.CrossTrackerDuplicates)
+	check.True(c.General.CrossTrackerMatchSize)
+	check.True(c.General.CrossTrackerMatchFiles)
+	check.True(c.General.VerifyLinks)
 
 	// trackers
 	fmt.Println("Checking trackers")
@@ -66,10 +72,18 @@ func TestConfig(t *testing.T) {
 	check.True(a.IRCSSL)
 	check.False(a.IRCSSLSkipVerify)
 	check.Equal("something", a.NickservPassword)
+	check.Equal(saslPlain, a.SASLMechanism)
+	check.Nil(a.clientCertificate)
 	check.Equal("mybot", a.BotName)
 	check.Equal("Bee", a.Announcer)
 	check.Equal("#blue-announce", a.AnnounceChannel)
 	check.Equal([]string{"AwfulUser"}, a.BlacklistedUploaders)
+	check.Equal(90, a.AnnounceWatchdogMinutes)
+	check.Equal(20, a.SnatchDelaySeconds)
+	check.Equal(5, a.SnatchIntervalSeconds)
+	check.Equal(3, a.SnatchAttempts)
+	check.Equal(10, a.FLTokens)
+	check.Equal(defaultSnatchRetrySeconds, a.SnatchRetrySeconds)
 	a = c.Autosnatch[1]
 	check.Equal("purple", a.Tracker)
 	check.Equal("irc.server.cd:6697", a.IRCServer)
@@ -77,10 +91,27 @@ func TestConfig(t *testing.T) {
 	check.True(a.IRCSSL)
 	check.True(a.IRCSSLSkipVerify)
 	check.Equal("somethingŁ", a.NickservPassword)
+	check.Equal(saslExternal, a.SASLMechanism)
+	check.Equal("test/irc_client.pem", a.IRCClientCertificate)
+	check.Equal("test/irc_client.key", a.IRCClientKey)
+	check.NotNil(a.clientCertificate)
 	check.Equal("bobot", a.BotName)
 	check.Equal("bolivar", a.Announcer)
 	check.Equal("#announce", a.AnnounceChannel)
 	check.Nil(a.BlacklistedUploaders)
+	check.Equal(0, a.AnnounceWatchdogMinutes)
+	check.Equal(0, a.SnatchDelaySeconds)
+	check.Equal(defaultSnatchAttempts, a.SnatchAttempts)
+	check.Equal(1, len(a.AnnounceFormats))
+	check.Equal(1, len(a.AnnounceFormats[0].Samples))
+	check.Equal(a.AnnounceFormats, a.announceFormats)
+	check.Equal(defaultAnnounceFormats, c.Autosnatch[0].announceFormats)
+	check.Nil(c.Autosnatch[0].Feed)
+	check.NotNil(a.Feed)
+	check.Equal("https://purple.net/feeds.php?feed=torrents_notify_1&user=1&auth=aaa&passkey=bbb&authkey=ccc", a.Feed.URL)
+	check.Equal(10, a.Feed.IntervalMinutes)
+	check.Equal(defaultFeedFormats, a.Feed.itemFormats)
+	check.Nil(c.CheckAnnounceSamples())
 	// stats
 	fmt.Println("Checking stats")
 	check.Equal(2, len(c.Stats))
@@ -90,12 +121,16 @@ func TestConfig(t *testing.T) {
 	check.Equal(500, s.MaxBufferDecreaseMB)
 	check.Equal(0.78, s.MinimumRatio)
 	check.Equal(0.8, s.TargetRatio)
+	check.True(s.ReenableAutosnatch)
+	check.Equal(0.8, s.ReenableRatio)
+	check.Equal(200, s.ReenableBufferMB)
 	s = c.Stats[1]
 	check.Equal("purple", s.Tracker)
 	check.Equal(12, s.UpdatePeriodH)
 	check.Equal(2500, s.MaxBufferDecreaseMB)
 	check.Equal(0.60, s.MinimumRatio)
 	check.Equal(1.0, s.TargetRatio)
+	check.False(s.ReenableAutosnatch)
 	// webserver
 	fmt.Println("Checking webserver")
 	check.True(c.WebServer.ServeStats)
@@ -128,6 +163,7 @@ func TestConfig(t *testing.T) {
 	check.True(c.Library.UseHardLinks)
 	check.False(c.Library.MoveSorted)
 	check.True(c.Library.AutomaticMode)
+	check.True(c.Library.SortOnCompletion)
 	check.Equal("$a/$a ($y) $t [$f $q] [$s] [$l $n $e]", c.Library.Template)
 	check.Equal([]string{"../varroa/test", "../varroa/cmd"}, c.Library.AdditionalSources)
 	check.Equal("test/aliases.yaml", c.Library.AliasesFile)
@@ -153,6 +189,15 @@ func TestConfig(t *testing.T) {
 	// metadata
 	fmt.Println("Checking metadata")
 	check.Equal("THISISASECRETTOKENGENERATEDFROMDISCOGSACCOUNT", c.Metadata.DiscogsToken)
+	// torrent client
+	fmt.Println("Checking torrent client")
+	check.Equal(torrentClientTransmission, c.TorrentClient.Type)
+	check.Equal("http://localhost:9091/transmission/rpc", c.TorrentClient.URL)
+	check.Equal("transmissionuser", c.TorrentClient.User)
+	check.Equal("transmissionpassword", c.TorrentClient.Password)
+	check.Equal(defaultTorrentClientLabel, c.TorrentClient.Label)
+	check.Equal("test", c.TorrentClient.SavePath)
+	check.Equal(defaultTorrentClientPollMinutes, c.TorrentClient.PollMinutes)
 	// filters
 	fmt.Println("Checking filters")
 	check.Equal(2, len(c.Filters))
@@ -234,6 +279,17 @@ func TestConfig(t *testing.T) {
 	check.False(f.RejectTrumpable)
 	check.Nil(f.Edition)
 	check.Nil(f.EditionYear)
+	check.Equal("(format == FLAC AND source == WEB) OR (source == CD AND log_score >= 100)", f.expression.String())
+	check.Equal(5, f.MaxSnatchesPerDay)
+	check.Equal(20, f.MaxSizePerWeekGB)
+	check.Equal(0, f.MaxTotalSnatches)
+	check.Equal([]string{"22:00-06:00"}, f.ActiveHours)
+	check.Equal([]string{"saturday", "sunday"}, f.ActiveDays)
+	check.Equal("", f.ActiveUntil)
+	check.True(f.UseFLToken)
+	check.Equal(500, f.FLTokenMinSizeMB)
+	check.Equal(1.5, f.FLTokenMaxRatio)
+	check.Equal(2, f.FLTokenReserve)
 
 	check.True(c.autosnatchConfigured)
 	check.True(c.statsConfigured)
@@ -248,18 +304,12 @@ func TestConfig(t *testing.T) {
 	check.True(c.playlistDirectoryConfigured)
 	check.True(c.metadataConfigured)
 	check.True(c.discogsTokenConfigured)
+	check.True(c.torrentClientConfigured)
 
-	// disabling autosnatch
-	check.False(c.Autosnatch[0].disabledAutosnatching)
+	// autosnatch configuration of a tracker
 	autosnatchConfig, err := c.GetAutosnatch("blue")
 	check.Nil(err)
-	autosnatchConfig.disabledAutosnatching = true
-	check.True(c.Autosnatch[0].disabledAutosnatching)
-	// enabling again
-	for _, a := range c.Autosnatch {
-		a.disabledAutosnatching = false
-	}
-	check.False(c.Autosnatch[0].disabledAutosnatching)
+	check.True(autosnatchConfig == c.Autosnatch[0])
 
 	// quick testing of files that only use a few features
 	c = &Config{}
@@ -301,3 +351,98 @@ func TestConfig(t *testing.T) {
 	check.True(c.webserverHTTPS)
 	check.False(c.LibraryConfigured)
 }
+
+func TestConfigFilterSchedule(t *testing.T) {
+	fmt.Println("+ Testing ConfigFilter/schedule...")
+	check := assert.New(t)
+
+	// friday 2018-06-01
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2018, 6, day, hour, minute, 0, 0, time.Local)
+	}
+
+	f := &ConfigFilter{Name: "night", Format: []string{"FLAC"}, ActiveHours: []string{"22:30-06", "12-13"}}
+	check.Nil(f.check())
+	check.True(f.IsActive(at(1, 23, 0)))
+	check.True(f.IsActive(at(1, 5, 59)))
+	check.True(f.IsActive(at(1, 12, 30)))
+	check.False(f.IsActive(at(1, 6, 0)))
+	check.False(f.IsActive(at(1, 22, 29)))
+	check.Equal("inactive (outside active hours 22:30-06, 12-13)", f.ActiveState(at(1, 15, 0)))
+	check.Equal("active", f.ActiveState(at(1, 12, 0)))
+
+	f = &ConfigFilter{Name: "weekend", Format: []string{"FLAC"}, ActiveDays: []string{"Saturday", "sun"}, ActiveHours: []string{"20:00-24:00"}}
+	check.Nil(f.check())
+	check.False(f.IsActive(at(1, 21, 0)))
+	check.True(f.IsActive(at(2, 21, 0)))
+	check.False(f.IsActive(at(3, 19, 0)))
+	check.Equal("inactive (not active on Friday)", f.ActiveState(at(1, 21, 0)))
+
+	f = &ConfigFilter{Name: "freeleech", Format: []string{"FLAC"}, ActiveUntil: "2018-06-02"}
+	check.Nil(f.check())
+	check.True(f.IsActive(at(2, 23, 59)))
+	check.False(f.IsActive(at(3, 0, 0)))
+	check.Equal("active until 2018-06-03 00:00", f.ActiveState(at(1, 0, 0)))
+	check.Equal("inactive (expired on 2018-06-03 00:00)", f.ActiveState(at(4, 0, 0)))
+	f = &ConfigFilter{Name: "freeleech", Format: []string{"FLAC"}, ActiveUntil: "2018-06-02 18:00"}
+	check.Nil(f.check())
+	check.False(f.IsActive(at(2, 18, 0)))
+
+	// a schedule alone would snatch everything
+	check.NotNil((&ConfigFilter{Name: "empty", ActiveDays: []string{"monday"}}).check())
+	for _, bad := range []*ConfigFilter{
+		{Name: "bad", Format: []string{"FLAC"}, ActiveHours: []string{"25:00-06:00"}},
+		{Name: "bad", Format: []string{"FLAC"}, ActiveHours: []string{"22h-06h"}},
+		{Name: "bad", Format: []string{"FLAC"}, ActiveHours: []string{"10:00-10:00"}},
+		{Name: "bad", Format: []string{"FLAC"}, ActiveDays: []string{"someday"}},
+		{Name: "bad", Format: []string{"FLAC"}, ActiveUntil: "06/02/2018"},
+	} {
+		check.NotNil(bad.check())
+	}
+}
+
+func TestConfigAutosnatchAuthentication(t *testing.T) {
+	fmt.Println("+ Testing ConfigAutosnatch/authentication...")
+	check := assert.New(t)
+
+	newConfig := func() *ConfigAutosnatch {
+		return &ConfigAutosnatch{Tracker: "blue", IRCServer: "irc.server.net:6697", IRCKey: "kkeeyy", IRCSSL: true, NickservPassword: "something", BotName: "mybot", Announcer: "Bee", AnnounceChannel: "#blue-announce"}
+	}
+	a := newConfig()
+	check.Nil(a.check())
+	a.SASLMechanism = "SCRAM-SHA-256"
+	check.NotNil(a.check())
+	a.SASLMechanism = "Plain"
+	check.Nil(a.check())
+	check.Equal(saslPlain, a.SASLMechanism)
+	a.UseZNC = true
+	check.NotNil(a.check())
+
+	// EXTERNAL needs a client certificate, but no password
+	a = newConfig()
+	a.SASLMechanism = saslExternal
+	check.NotNil(a.check())
+	a.IRCClientCertificate = "test/irc_client.pem"
+	check.NotNil(a.check())
+	a.IRCClientKey = "test/irc_client.key"
+	a.NickservPassword = ""
+	check.Nil(a.check())
+	check.NotNil(a.clientCertificate)
+	a.IRCSSL = false
+	check.NotNil(a.check())
+	a.IRCSSL = true
+	a.IRCClientKey = "test/missing.key"
+	check.NotNil(a.check())
+
+	// a feed can replace IRC
+	a = &ConfigAutosnatch{Tracker: "blue"}
+	check.NotNil(a.check())
+	a.Feed = &ConfigFeed{URL: "irc://blue.ch/feed"}
+	check.NotNil(a.check())
+	a.Feed.URL = "https://blue.ch/feed"
+	check.Nil(a.check())
+	check.False(a.usesIRC())
+	check.Equal(defaultFeedIntervalMinutes, a.Feed.IntervalMinutes)
+	a.Feed.ItemFormats = []*ConfigAnnounceFormat{{Pattern: `(?P<artist>.*?) - (?P<title>.*)`}}
+	check.NotNil(a.check())
+}
@@ -18,6 +18,7 @@ const (
 	daemonSocket               = "varroa.sock"
 	StatsDir                   = "stats"
 	MetadataDir                = "TrackerMetadata"
+	metadataCacheDir           = "metadata_cache"
 	downloadsCleanDir          = "VarroaClean"
 	userMetadataJSONFile       = "user_metadata.json"
 	OriginJSONFile             = "origin.json"
@@ -34,6 +35,7 @@ const (
 	overallStatsFile           = "stats"
 	numberSnatchedPerDayFile   = "snatches_per_day"
 	sizeSnatchedPerDayFile     = "size_snatched_per_day"
+	flTokensPerDayFile         = "fl_tokens_per_day"
 	totalSnatchesByFilterFile  = "total_snatched_by_filter"
 	toptagsFile                = "top_tags"
 	gitlabCIYamlFile           = ".gitlab-ci.yml"
@@ -42,6 +44,8 @@ const (
 	DefaultHistoryDB           = "history.db"
 	DefaultDownloadsDB         = "downloads.db"
 	DefaultLibraryDB           = "library.db"
+	DefaultAnnouncesDB         = "announces.db"
+	DefaultSnatchQueueDB       = "snatch_queue.db"
 	manualSnatchFilterName     = "remote"
 	overallPrefix              = "overall"
 	lastWeekPrefix             = "lastweek"
@@ -53,6 +57,16 @@ const (
 	warningRatio       = 0.6
 	minimumSeeders     = 5
 
+	defaultAnnounceRetentionDays = 30
+	defaultAnnounceSearchLimit   = 50
+	defaultSnatchWorkers         = 2
+	defaultSnatchAttempts        = 5
+	defaultSnatchRetrySeconds    = 60
+	defaultFeedIntervalMinutes   = 5
+
+	defaultTorrentClientPollMinutes = 1
+	defaultTorrentClientLabel       = "varroa"
+
 	// file extensions
 	yamlExt      = ".yaml"
 	encryptedExt = ".enc"
@@ -65,6 +79,9 @@ const (
 	// filters
 	filterRegExpPrefix        = "r/"
 	filterExcludeRegExpPrefix = "xr/"
+	filterFoldedRegExpPrefix  = "re:"
+	filterFuzzyPrefix         = "fuzzy:"
+	fuzzyCharactersPerTypo    = 10
 
 	// information
 	InfoUserFilesArchived         = "User files backed up."
@@ -74,8 +91,11 @@ const (
 	infoNotInteresting            = "No filter is interested in release: %s. Ignoring."
 	infoNotMusic                  = "Not a music release, ignoring."
 	infoNotSnatchingDuplicate     = "Similar release already downloaded, and duplicates are not allowed"
+	infoAlreadyQueued             = "Release already waiting to be snatched"
 	infoFilterIgnoredForTracker   = "Filter %s ignored for tracker %s."
+	infoFilterInactive            = "Filter %s ignored, %s."
 	infoFilterTriggered           = "This release would trigger filter %s!"
+	infoDryRunOffline             = "Could not reach tracker %s, only using cached tracker metadata."
 	infoNotSnatchingUniqueInGroup = "Release from the same torrentgroup already downloaded, and snatch must be unique in group"
 	infoAllMetadataSaved          = "All %s metadata saved to: %s."
 	infoAllMetadataSaving         = "Saving metadata to: %s."
@@ -84,6 +104,7 @@ const (
 	infoTorrentGroupMetadataSaved = "Torrent Group metadata saved."
 	infoCollageMetadataSaved      = "Collage #%d metadata saved."
 	infoCoverSaved                = "Cover saved."
+	infoConfigurationReloaded     = "Configuration reloaded."
 	webServerNotConfigured        = "No configuration found for the web server."
 	webServerShutDown             = "Web server has closed."
 	webServerUpHTTP               = "Starting http web server."
@@ -107,8 +128,20 @@ const (
 	// command refresh-metadata errors
 	ErrorRefreshingMetadata = "Error refreshing metadata"
 	errorCannotFindID       = "Error with ID#%s, not found in history or in downloads directory."
+	// command filters test
+	ErrorTestingFilters = "Error testing filters"
+	ErrorSimulating     = "Error simulating tracker"
+	// command announces search
+	ErrorSearchingAnnounces = "Error searching announces"
+	// command queue list
+	ErrorListingSnatchQueue = "Error listing snatch queue"
+	// command backfill
+	ErrorBackfilling       = "Error backfilling"
+	ErrorRetryingDownloads = "Error processing completed downloads again"
 	// command reseed
 	ErrorReseed = "error trying to reseed release"
+	// command crossseed
+	ErrorCrossSeeding = "Error cross-seeding releases"
 	// command backup errors
 	errorArchiving = "Error while archiving user files"
 	// set up errors
@@ -117,6 +150,7 @@ const (
 	ErrorSettingUp                 = "Error setting up"
 	ErrorLoadingConfig             = "Error loading configuration"
 	errorReadingConfig             = "Error reading configuration file"
+	errorReloadingConfig           = "Error reloading configuration, keeping the current one"
 	errorLoadingYAML               = "YAML file cannot be parsed, check if it is correctly formatted and has all the required parts"
 	errorGettingPassphrase         = "Error getting passphrase"
 	errorPassphraseNotFound        = "Error retrieving passphrase for daemon"
@@ -157,9 +191,13 @@ const (
 	// irc errors
 	errorDealingWithAnnounce    = "Error dealing with announced torrent"
 	errorConnectingToIRC        = "Error connecting to IRC"
+	errorIRCAuthentication      = "SASL authentication failed"
 	errorCouldNotGetTorrentInfo = "Error retrieving torrent info from tracker"
 	errorDownloadingTorrent     = "Error downloading torrent"
 	errorAddingToHistory        = "Error adding release to history"
+	errorAddingToAnnounces      = "Error adding announce to history"
+	errorAddingToSnatchQueue    = "Error adding release to snatch queue"
+	errorCheckingQuotas         = "Error checking filter quotas"
 	announcerBadCredentials     = "Bad credentials."
 	// notifications errors
 	errorNotification  = "Error while sending pushover notification"
@@ -0,0 +1,90 @@
+package varroa
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gitlab.com/catastrophic/assistance/logthis"
+)
+
+const (
+	crossTrackerSkip      = "skip"
+	crossTrackerCrossSeed = "crossseed"
+)
+
+// filesHash identifies the contents of a torrent from its file list, as given by the tracker API.
+// The order of the files does not matter, so that the same release uploaded on different trackers has the same hash.
+func filesHash(fileList string) string {
+	if fileList == "" {
+		return ""
+	}
+	files := strings.Split(html.UnescapeString(fileList), "|||")
+	sort.Strings(files)
+	hash := sha256.Sum256([]byte(strings.Join(files, "|||")))
+	return hex.EncodeToString(hash[:])
+}
+
+// isCrossTrackerDuplicate tells if another release, from a different tracker, has the same contents.
+// Without a known file list, releases can never match on files.
+func (r *Release) isCrossTrackerDuplicate(other *Release, matchSize, matchFiles bool) bool {
+	if other.Tracker == r.Tracker || len(r.Artists) == 0 {
+		return false
+	}
+	var sameArtist bool
+	for _, a := range other.Artists {
+		if strings.EqualFold(a, r.Artists[0]) {
+			sameArtist = true
+			break
+		}
+	}
+	if !sameArtist || !strings.EqualFold(other.Title, r.Title) || other.Year != r.Year {
+		return false
+	}
+	if !strings.EqualFold(other.EditionName, r.EditionName) || other.EditionYear != r.EditionYear {
+		return false
+	}
+	if other.Format != r.Format || other.Quality != r.Quality {
+		return false
+	}
+	if matchSize && other.Size != r.Size {
+		return false
+	}
+	if matchFiles && (r.FilesHash == "" || other.FilesHash != r.FilesHash) {
+		return false
+	}
+	return true
+}
+
+// crossTrackerDuplicate returns the release already snatched or waiting to be snatched from another tracker
+// that has the same contents, or nil.
+func crossTrackerDuplicate(conf *ConfigGeneral, stats *StatsDB, queue *SnatchQueue, release *Release) *Release {
+	if conf.CrossTrackerDuplicates == "" {
+		return nil
+	}
+	if original := queue.QueuedCrossTrackerDuplicate(release, conf.CrossTrackerMatchSize, conf.CrossTrackerMatchFiles); original != nil {
+		return original
+	}
+	original, err := stats.CrossTrackerDuplicate(release, conf.CrossTrackerMatchSize, conf.CrossTrackerMatchFiles)
+	if err != nil {
+		logthis.Error(errors.Wrap(err, "error looking for cross-tracker duplicates"), logthis.NORMAL)
+		return nil
+	}
+	return original
+}
+
+// crossSeedRefusal returns why a cross-tracker duplicate cannot be cross-seeded, or an empty string.
+// The torrent client only finds the existing download if the new torrent uses the same folder.
+func crossSeedRefusal(conf *ConfigGeneral, release, original *Release) string {
+	if conf.CrossTrackerDuplicates != crossTrackerCrossSeed {
+		return fmt.Sprintf("already snatched on %s", original.Tracker)
+	}
+	if original.Folder == "" || original.Folder != release.Folder {
+		return fmt.Sprintf("already snatched on %s, in a different folder", original.Tracker)
+	}
+	return ""
+}
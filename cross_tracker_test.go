@@ -0,0 +1,77 @@
+package varroa
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCrossTrackerDuplicates(t *testing.T) {
+	fmt.Println("+ Testing Cross-tracker duplicates...")
+	check := assert.New(t)
+
+	hash := filesHash("01 - A.flac{{{100}}}|||02 - B&amp;C.flac{{{200}}}")
+	check.NotEqual("", hash)
+	check.Equal(hash, filesHash("02 - B&C.flac{{{200}}}|||01 - A.flac{{{100}}}"))
+	check.NotEqual(hash, filesHash("01 - A.flac{{{100}}}|||02 - B&C.flac{{{201}}}"))
+	check.Equal("", filesHash(""))
+
+	blue := Release{Tracker: "blue", TorrentID: "1", Artists: []string{"Artist", "Other"}, Title: "Album", Year: 2018, EditionName: "Deluxe", EditionYear: 2019, Format: "FLAC", Quality: "Lossless", Size: 1000, FilesHash: hash, Folder: "Artist - Album"}
+	purple := blue
+	purple.Tracker = "purple"
+	purple.TorrentID = "2"
+	purple.Artists = []string{"artist"}
+	purple.Title = "ALBUM"
+	check.True(purple.isCrossTrackerDuplicate(&blue, true, true))
+	check.False(blue.isCrossTrackerDuplicate(&blue, false, false))
+
+	for _, c := range []struct {
+		change     func(r *Release)
+		matchSize  bool
+		matchFiles bool
+		duplicate  bool
+	}{
+		{func(r *Release) { r.EditionName = "" }, false, false, false},
+		{func(r *Release) { r.EditionYear = 2018 }, false, false, false},
+		{func(r *Release) { r.Year = 2017 }, false, false, false},
+		{func(r *Release) { r.Quality = "24bit Lossless" }, false, false, false},
+		{func(r *Release) { r.Size = 1001 }, false, false, true},
+		{func(r *Release) { r.Size = 1001 }, true, false, false},
+		{func(r *Release) { r.FilesHash = "other" }, true, false, true},
+		{func(r *Release) { r.FilesHash = "other" }, true, true, false},
+		{func(r *Release) { r.FilesHash = "" }, false, true, false},
+	} {
+		other := purple
+		c.change(&other)
+		check.Equal(c.duplicate, other.isCrossTrackerDuplicate(&blue, c.matchSize, c.matchFiles))
+	}
+
+	// looking in the history
+	dbPath := filepath.Join("test", "test_crosstracker.db")
+	defer os.Remove(dbPath)
+	db, err := NewDatabase(dbPath)
+	check.Nil(err)
+	defer db.Close()
+	stats := &StatsDB{db: db}
+	check.Nil(stats.init())
+	check.Nil(stats.AddSnatch(blue))
+
+	original, err := stats.CrossTrackerDuplicate(&purple, true, true)
+	check.Nil(err)
+	check.NotNil(original)
+	check.Equal("blue", original.Tracker)
+	original, err = stats.CrossTrackerDuplicate(&blue, true, true)
+	check.Nil(err)
+	check.Nil(original)
+
+	// skipping or cross-seeding
+	conf := &ConfigGeneral{CrossTrackerDuplicates: crossTrackerSkip}
+	check.NotEqual("", crossSeedRefusal(conf, &purple, &blue))
+	conf.CrossTrackerDuplicates = crossTrackerCrossSeed
+	check.Equal("", crossSeedRefusal(conf, &purple, &blue))
+	purple.Folder = "Artist - Album (FLAC)"
+	check.NotEqual("", crossSeedRefusal(conf, &purple, &blue))
+}
@@ -0,0 +1,198 @@
+package varroa
+
+import (
+	"fmt"
+	"html"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gitlab.com/catastrophic/assistance/fs"
+	"gitlab.com/catastrophic/assistance/logthis"
+	"gitlab.com/passelecasque/obstruction/tracker"
+)
+
+// CrossSeedScan looks for the releases found in paths, or in the downloads directory if none is given, on the
+// configured trackers they were not snatched from. Torrents with the same files are reseeded, and added to the
+// origins of the release.
+func CrossSeedScan(e *Environment, paths []string) error {
+	conf := e.Config()
+	if !conf.DownloadFolderConfigured {
+		return errors.New("impossible to cross-seed releases if downloads directory is not configured")
+	}
+	if len(conf.Trackers) < 2 {
+		return errors.New("cross-seeding requires at least two configured trackers")
+	}
+	if len(paths) == 0 {
+		var err error
+		paths, err = downloadsWithMetadata(conf.General.DownloadDir)
+		if err != nil {
+			return errors.Wrap(err, "could not list the downloads directory")
+		}
+	}
+	var crossSeeded int
+	for _, path := range paths {
+		n, err := crossSeedRelease(e, path)
+		if err != nil {
+			logthis.Error(errors.Wrap(err, "could not cross-seed "+path), logthis.NORMAL)
+		}
+		crossSeeded += n
+	}
+	logthis.Info(fmt.Sprintf("Cross-seeded %d torrents from %d releases.", crossSeeded, len(paths)), logthis.NORMAL)
+	return nil
+}
+
+// downloadsWithMetadata returns the folders of the downloads directory with an origin.json.
+func downloadsWithMetadata(downloadDir string) ([]string, error) {
+	entries, err := ioutil.ReadDir(downloadDir)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, entry := range entries {
+		path := filepath.Join(downloadDir, entry.Name())
+		if entry.IsDir() && fs.FileExists(filepath.Join(path, MetadataDir, OriginJSONFile)) {
+			paths = append(paths, path)
+		}
+	}
+	return paths, nil
+}
+
+// crossSeedRelease reseeds a release on every other tracker with a torrent matching its files, and returns how many.
+func crossSeedRelease(e *Environment, path string) (int, error) {
+	conf := e.Config()
+	info, origins, err := loadLocalMetadata(path)
+	if err != nil {
+		return 0, err
+	}
+	var crossSeeded int
+	for _, label := range conf.TrackerLabels() {
+		if _, ok := origins.Origins[label]; ok {
+			continue
+		}
+		t, err := e.Tracker(label)
+		if err != nil {
+			logthis.Error(errors.Wrap(err, "could not search "+label), logthis.NORMAL)
+			continue
+		}
+		match, err := findCrossSeedTorrent(t, info, path)
+		if err != nil {
+			logthis.Error(errors.Wrap(err, "could not search "+label), logthis.NORMAL)
+			continue
+		}
+		if match == nil {
+			logthis.Info(fmt.Sprintf("%s: no matching torrent found on %s.", filepath.Base(path), label), logthis.VERBOSE)
+			continue
+		}
+		logthis.Info(fmt.Sprintf("%s: torrent %d on %s has the same files, reseeding it.", filepath.Base(path), match.id, label), logthis.NORMAL)
+		destination, err := seedCheckedTorrent(e, match.check, match.torrent, match.filename)
+		if err != nil {
+			return crossSeeded, errors.Wrap(err, ErrorReseed)
+		}
+		crossSeeded++
+
+		// the release now originates from this tracker too
+		candidate := &TrackerMetadata{}
+		if err := candidate.LoadFromID(t, strconv.Itoa(match.id)); err != nil {
+			return crossSeeded, err
+		}
+		if err := candidate.SaveFromTracker(path, t, conf); err != nil {
+			return crossSeeded, err
+		}
+		if source, err := filepath.Abs(path); err == nil && source != destination && fs.DirExists(filepath.Join(destination, MetadataDir)) {
+			if err := candidate.SaveFromTracker(destination, t, conf); err != nil {
+				return crossSeeded, err
+			}
+		}
+	}
+	return crossSeeded, nil
+}
+
+// loadLocalMetadata of a release, from its origin.json and the Release.json of the first tracker it originates from.
+func loadLocalMetadata(path string) (*TrackerMetadata, *TrackerOriginJSON, error) {
+	origins := &TrackerOriginJSON{Path: filepath.Join(path, MetadataDir, OriginJSONFile)}
+	if err := origins.Load(); err != nil {
+		return nil, nil, errors.Wrap(err, "error reading origin.json")
+	}
+	var labels []string
+	for label := range origins.Origins {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	for _, label := range labels {
+		releaseJSON := filepath.Join(path, MetadataDir, releaseMetadataFile(label))
+		if !fs.FileExists(releaseJSON) {
+			continue
+		}
+		info := &TrackerMetadata{}
+		if err := info.LoadFromJSON(label, origins.Path, releaseJSON); err != nil {
+			return nil, nil, err
+		}
+		return info, origins, nil
+	}
+	return nil, nil, errors.New("could not find tracker metadata in " + path)
+}
+
+// crossSeedMatch is a torrent with the same files as a local release.
+type crossSeedMatch struct {
+	id       int
+	check    *TorrentCheck
+	torrent  []byte
+	filename string
+}
+
+// findCrossSeedTorrent searches a tracker for a torrent with the same files as a local release, in a group of the
+// same artist with the same title. Editions are not compared, since trackers do not always describe them the same
+// way: the files decide, and only the .torrent of a candidate with the same size and file list is downloaded to
+// compare them. It returns nil if nothing matches.
+func findCrossSeedTorrent(t *tracker.Gazelle, info *TrackerMetadata, path string) (*crossSeedMatch, error) {
+	if len(info.Artists) == 0 {
+		return nil, errors.New("unknown artist")
+	}
+	artist, err := t.GetArtistFromName(info.Artists[0].Name)
+	if err != nil {
+		// the artist is not known on this tracker
+		logthis.Info(errors.Wrap(err, "could not find "+info.Artists[0].Name+" on "+t.Name).Error(), logthis.VERBOSEST)
+		return nil, nil
+	}
+	for _, g := range artist.Torrentgroup {
+		if !strings.EqualFold(html.UnescapeString(g.GroupName), info.Title) {
+			continue
+		}
+		group, err := t.GetTorrentGroup(g.GroupID)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf(errorRetrievingTorrentGroupInfo, g.GroupID))
+		}
+		for _, candidate := range group.Torrents {
+			if html.UnescapeString(candidate.Media) != info.Source || candidate.Format != info.Format || candidate.Encoding != info.Quality {
+				continue
+			}
+			// only downloading the .torrent of a candidate with the same size and, if known, the same files
+			if uint64(candidate.Size) != info.Size {
+				continue
+			}
+			if hash := filesHash(candidate.FileList); hash != "" && info.FilesHash != "" && hash != info.FilesHash {
+				continue
+			}
+			torrent, filename, err := downloadTorrent(t, candidate.ID, false, "")
+			if err != nil {
+				return nil, errors.Wrap(err, "error downloading torrent file")
+			}
+			check, err := NewTorrentCheck(torrent, path)
+			if err != nil {
+				return nil, err
+			}
+			if err := check.Run(false); err != nil {
+				return nil, errors.Wrap(err, "error comparing the torrent with local files")
+			}
+			logthis.Info(check.String(), logthis.VERBOSE)
+			if check.Match() {
+				return &crossSeedMatch{id: candidate.ID, check: check, torrent: torrent, filename: filename}, nil
+			}
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,82 @@
+package varroa
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/catastrophic/assistance/fs"
+)
+
+const crossSeedTestConfig = `general:
+  download_directory: $DOWNLOADS
+  watch_directory: $WATCH
+  log_level: 2
+
+trackers:
+  - name: sim
+    user: simuser
+    api_key: simkey
+    url: $URL
+  - name: other
+    user: simuser
+    api_key: simkey
+    url: $URL
+`
+
+func TestCrossSeedScan(t *testing.T) {
+	fmt.Println("+ Testing CrossSeedScan...")
+	check := assert.New(t)
+
+	sim, err := NewSimulator("127.0.0.1:0", "127.0.0.1:0", filepath.Join("test", "simulator"))
+	check.Nil(err)
+	sim.User = "simuser"
+	sim.Start()
+	defer sim.Stop()
+
+	// both trackers are the same simulator
+	e, dataDir, cleanUp := newSimulatedEnvironment(t, sim, crossSeedTestConfig)
+	defer cleanUp()
+	downloadDir := filepath.Join(dataDir, "downloads")
+	watchDir := filepath.Join(dataDir, "watch")
+
+	// nothing to scan in the downloads directory
+	check.Nil(CrossSeedScan(e, nil))
+
+	// a release snatched from sim, outside of the downloads directory.
+	// The simulated torrent 102 has a single file, which the release contains.
+	folder := filepath.Join(dataDir, "library", "Artist A - First Album")
+	info := &TrackerMetadata{}
+	check.Nil(info.LoadFromID(e.Trackers["sim"], "102"))
+	check.Nil(info.SaveFromTracker(folder, e.Trackers["sim"], e.config))
+	check.Nil(ioutil.WriteFile(filepath.Join(folder, "simulated_102"), make([]byte, 1024), 0666))
+
+	local, origins, err := loadLocalMetadata(folder)
+	check.Nil(err)
+	check.Equal("First Album", local.Title)
+	check.Equal(1, len(origins.Origins))
+	match, err := findCrossSeedTorrent(e.Trackers["other"], local, folder)
+	check.Nil(err)
+	check.NotNil(match)
+	check.Equal(102, match.id)
+	// 101 has the same size, but not the same files: its .torrent is not downloaded
+	check.Equal([]int{102}, sim.Downloads())
+
+	check.Nil(CrossSeedScan(e, []string{folder}))
+	check.True(fs.FileExists(filepath.Join(downloadDir, "simulated_102")))
+	check.True(fs.FileExists(filepath.Join(watchDir, "other_id102.torrent")))
+	check.True(fs.FileExists(filepath.Join(folder, MetadataDir, releaseMetadataFile("other"))))
+	origins = &TrackerOriginJSON{Path: filepath.Join(folder, MetadataDir, OriginJSONFile)}
+	check.Nil(origins.Load())
+	check.Equal(2, len(origins.Origins))
+	check.Equal(102, origins.Origins["sim"].ID)
+	check.Equal(102, origins.Origins["other"].ID)
+
+	// already cross-seeded
+	check.Nil(os.Remove(filepath.Join(watchDir, "other_id102.torrent")))
+	check.Nil(CrossSeedScan(e, []string{folder}))
+	check.False(fs.FileExists(filepath.Join(watchDir, "other_id102.torrent")))
+}
@@ -4,6 +4,7 @@ import (
 	"github.com/asdine/storm"
 	"github.com/asdine/storm/codec/msgpack"
 	"github.com/pkg/errors"
+	"gitlab.com/catastrophic/assistance/logthis"
 )
 
 // Database allows manipulating stats or release entries.
@@ -41,3 +42,25 @@ func NewDatabase(path string) (*Database, error) {
 	}
 	return db, err
 }
+
+// CloseDatabases opened by varroa, before exiting.
+func CloseDatabases() {
+	var errs []error
+	if statsDB != nil {
+		errs = append(errs, statsDB.Close())
+	}
+	if snatchQueue != nil {
+		errs = append(errs, snatchQueue.Close())
+	}
+	if announcesDB != nil {
+		errs = append(errs, announcesDB.Close())
+	}
+	if downloadsDB != nil {
+		errs = append(errs, downloadsDB.Close())
+	}
+	for _, err := range errs {
+		if err != nil {
+			logthis.Error(errors.Wrap(err, "could not close database"), logthis.NORMAL)
+		}
+	}
+}
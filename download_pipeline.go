@@ -0,0 +1,257 @@
+package varroa
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	daemon "github.com/sevlyar/go-daemon"
+	"gitlab.com/catastrophic/assistance/fs"
+	"gitlab.com/catastrophic/assistance/logthis"
+	"gitlab.com/passelecasque/obstruction/tracker"
+)
+
+const (
+	stageMetadata = "metadata"
+	stageScan     = "scan"
+	stageSort     = "sort"
+	stageNotify   = "notify"
+
+	// downloadFolderPollPeriod when completion is deduced from the contents of the downloads directory.
+	downloadFolderPollPeriod = time.Minute
+	// downloadFolderSettleTime without modifications before a download folder of the right size is considered complete.
+	downloadFolderSettleTime = 2 * time.Minute
+	// pipelineMaxAttempts before the daemon stops retrying a failed stage; it can still be retried manually.
+	pipelineMaxAttempts = 5
+	pipelineRetryDelay  = 15 * time.Minute
+)
+
+// downloadPipelineStages run in this order when a download is complete.
+var downloadPipelineStages = []string{stageMetadata, stageScan, stageSort, stageNotify}
+
+// CompletedDownload of a snatched release, and what remains to be done with it.
+type CompletedDownload struct {
+	ID          int `storm:"id,increment"`
+	Release     Release
+	Path        string
+	Timestamp   time.Time
+	Done        bool
+	Stage       string
+	Error       string
+	Attempts    int
+	LastAttempt time.Time
+}
+
+// run the stages of the pipeline, starting from the one that failed last time, if any.
+func (cd *CompletedDownload) run(e *Environment) error {
+	var started bool
+	for _, stage := range downloadPipelineStages {
+		if !started && cd.Stage != "" && stage != cd.Stage {
+			continue
+		}
+		started = true
+		cd.Stage = stage
+		if err := cd.runStage(e, stage); err != nil {
+			cd.Error = err.Error()
+			cd.Attempts++
+			cd.LastAttempt = time.Now()
+			return errors.Wrap(err, "error during stage "+stage)
+		}
+	}
+	cd.Done = true
+	cd.Stage = ""
+	cd.Error = ""
+	return nil
+}
+
+// saveMetadataAtSnatch saves the metadata of a snatched release in the downloads directory right away when the
+// daemon, which saves it once the download is complete, is not running.
+func saveMetadataAtSnatch(e *Environment, t *tracker.Gazelle, info *TrackerMetadata) {
+	conf := e.Config()
+	if daemon.WasReborn() || !conf.General.AutomaticMetadataRetrieval || !conf.DownloadFolderConfigured || info.FolderName == "" {
+		return
+	}
+	if err := info.SaveFromTracker(filepath.Join(conf.General.DownloadDir, info.FolderName), t, conf); err != nil {
+		logthis.Error(err, logthis.NORMAL)
+	}
+}
+
+func (cd *CompletedDownload) runStage(e *Environment, stage string) error {
+	conf := e.Config()
+	switch stage {
+	case stageMetadata:
+		if !conf.General.AutomaticMetadataRetrieval {
+			return nil
+		}
+		t, err := e.Tracker(cd.Release.Tracker)
+		if err != nil {
+			return err
+		}
+		info := &TrackerMetadata{}
+		if err := info.LoadFromID(t, cd.Release.TorrentID); err != nil {
+			return errors.Wrap(err, errorCouldNotGetTorrentInfo)
+		}
+		return info.SaveFromTracker(cd.Path, t, conf)
+	case stageScan, stageSort:
+		if !conf.DownloadFolderConfigured || (stage == stageSort && (!conf.LibraryConfigured || !conf.Library.SortOnCompletion)) {
+			return nil
+		}
+		var additionalSources []string
+		if conf.LibraryConfigured {
+			additionalSources = conf.Library.AdditionalSources
+		}
+		downloads, err := NewDownloadsDB(e.paths.DownloadsDB(), conf.General.DownloadDir, additionalSources)
+		if err != nil {
+			return err
+		}
+		if stage == stageScan {
+			return downloads.RescanPath(cd.Path)
+		}
+		dl, err := downloads.FindByFolderName(filepath.Base(cd.Path))
+		if err != nil {
+			return errors.Wrap(err, "could not find "+cd.Path+" in the downloads database")
+		}
+		// only sorting new downloads, in automatic mode
+		return downloads.SortThisID(e, dl.ID, true)
+	case stageNotify:
+		return Notify("Download complete: "+cd.Release.ShortString(), cd.Release.Tracker, "info", e)
+	}
+	return errors.New("unknown stage " + stage)
+}
+
+// runDownloadPipeline and remember how far it went.
+func runDownloadPipeline(e *Environment, stats *StatsDB, cd *CompletedDownload) {
+	err := cd.run(e)
+	if err != nil {
+		logthis.Error(errors.Wrap(err, "could not process completed download "+cd.Release.ShortString()), logthis.NORMAL)
+	} else {
+		logthis.Info("Processed completed download "+cd.Release.ShortString(), logthis.VERBOSE)
+	}
+	if err := stats.SaveCompletedDownload(cd); err != nil {
+		logthis.Error(errors.Wrap(err, "could not save the state of completed download "+cd.Release.ShortString()), logthis.NORMAL)
+	}
+}
+
+// RetryDownloadPipelines that have failed.
+// Unless forced, only those which have not failed too often, and not too recently, are retried.
+func RetryDownloadPipelines(e *Environment, force bool) error {
+	stats, err := NewStatsDB(e.paths.StatsDir(), e.Config())
+	if err != nil {
+		return errors.Wrap(err, "could not access the stats database")
+	}
+	failed, err := stats.FailedCompletedDownloads()
+	if err != nil {
+		return err
+	}
+	for i := range failed {
+		cd := &failed[i]
+		if !force && (cd.Attempts >= pipelineMaxAttempts || time.Since(cd.LastAttempt) < pipelineRetryDelay) {
+			continue
+		}
+		logthis.Info("Retrying stage "+cd.Stage+" for completed download "+cd.Release.ShortString(), logthis.NORMAL)
+		runDownloadPipeline(e, stats, cd)
+	}
+	return nil
+}
+
+// watchCompletions regularly checks which of the releases snatched recently have been downloaded, and processes them.
+func watchCompletions(e *Environment, period time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for {
+		if err := checkCompletions(e); err != nil {
+			logthis.Error(errors.Wrap(err, "could not check completed downloads"), logthis.NORMAL)
+		}
+		if err := RetryDownloadPipelines(e, false); err != nil {
+			logthis.Error(errors.Wrap(err, "could not retry processing completed downloads"), logthis.NORMAL)
+		}
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// checkCompletions of the releases snatched recently, asking the torrent client or looking at the downloads directory.
+func checkCompletions(e *Environment) error {
+	conf := e.Config()
+	stats, err := NewStatsDB(e.paths.StatsDir(), conf)
+	if err != nil {
+		return errors.Wrap(err, "could not access the stats database")
+	}
+	releases, err := stats.Downloading(time.Now().AddDate(0, 0, -completionWatchDays))
+	if err != nil {
+		return err
+	}
+	for i := range releases {
+		release := &releases[i]
+		path, err := downloadPath(e, conf, release)
+		if err != nil {
+			logthis.Error(errors.Wrap(err, "could not get the status of "+release.ShortString()), logthis.VERBOSE)
+			continue
+		}
+		if path == "" {
+			continue
+		}
+		release.Completed = true
+		if err := stats.UpdateSnatch(*release); err != nil {
+			logthis.Error(errors.Wrap(err, "could not remember that "+release.ShortString()+" has completed"), logthis.NORMAL)
+			continue
+		}
+		logthis.Info("Download complete: "+release.ShortString()+" in "+path, logthis.NORMAL)
+		runDownloadPipeline(e, stats, &CompletedDownload{Release: *release, Path: path, Timestamp: time.Now()})
+	}
+	return nil
+}
+
+// downloadPath of a release if its download is complete, or an empty string.
+func downloadPath(e *Environment, conf *Config, release *Release) (string, error) {
+	if conf.torrentClientConfigured {
+		status, err := e.TorrentClient("").Status(release.InfoHash)
+		if err != nil || !status.Completed {
+			return "", err
+		}
+		return filepath.Join(status.SavePath, status.Name), nil
+	}
+	if release.Folder == "" {
+		return "", nil
+	}
+	path := filepath.Join(conf.General.DownloadDir, release.Folder)
+	complete, err := folderComplete(path, release.Size, downloadFolderSettleTime)
+	if err != nil || !complete {
+		return "", err
+	}
+	return path, nil
+}
+
+// folderComplete if its files add up to the expected size, and have not been modified for a while.
+// Metadata saved by varroa is not taken into account.
+func folderComplete(path string, size uint64, settleTime time.Duration) (bool, error) {
+	if !fs.DirExists(path) {
+		return false, nil
+	}
+	var total uint64
+	var lastModified time.Time
+	err := filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if p != path && info.Name() == MetadataDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		total += uint64(info.Size())
+		if info.ModTime().After(lastModified) {
+			lastModified = info.ModTime()
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return total != 0 && total >= size && time.Since(lastModified) > settleTime, nil
+}
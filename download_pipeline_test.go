@@ -0,0 +1,132 @@
+package varroa
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/catastrophic/assistance/fs"
+)
+
+const downloadPipelineTestConfig = `general:
+  download_directory: $DOWNLOADS
+  automatic_metadata_retrieval: true
+  log_level: 2
+
+trackers:
+  - name: sim
+    user: simuser
+    api_key: simkey
+    url: $URL
+`
+
+func TestFolderComplete(t *testing.T) {
+	fmt.Println("+ Testing DownloadPipeline/folder completion...")
+	check := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "varroa")
+	check.Nil(err)
+	defer os.RemoveAll(dir)
+	folder := filepath.Join(dir, "release")
+
+	complete, err := folderComplete(folder, 10, 0)
+	check.Nil(err)
+	check.False(complete)
+	check.Nil(os.MkdirAll(filepath.Join(folder, MetadataDir), 0777))
+	check.Nil(ioutil.WriteFile(filepath.Join(folder, MetadataDir, "Release.json"), make([]byte, 100), 0666))
+	complete, err = folderComplete(folder, 10, 0)
+	check.Nil(err)
+	check.False(complete)
+	check.Nil(ioutil.WriteFile(filepath.Join(folder, "01.flac"), make([]byte, 10), 0666))
+	complete, err = folderComplete(folder, 10, 0)
+	check.Nil(err)
+	check.True(complete)
+	complete, err = folderComplete(folder, 11, 0)
+	check.Nil(err)
+	check.False(complete)
+	// recently modified
+	complete, err = folderComplete(folder, 10, time.Hour)
+	check.Nil(err)
+	check.False(complete)
+}
+
+func TestDownloadPipeline(t *testing.T) {
+	fmt.Println("+ Testing DownloadPipeline...")
+	check := assert.New(t)
+
+	sim, err := NewSimulator("127.0.0.1:0", "127.0.0.1:0", filepath.Join("test", "simulator"))
+	check.Nil(err)
+	sim.User = "simuser"
+	sim.Start()
+	defer sim.Stop()
+
+	e, dataDir, cleanUp := newSimulatedEnvironment(t, sim, downloadPipelineTestConfig)
+	defer cleanUp()
+	downloadDir := filepath.Join(dataDir, "downloads")
+	tr := e.Trackers["sim"]
+
+	// a snatched release, being downloaded
+	info := &TrackerMetadata{}
+	check.Nil(info.LoadFromID(tr, "101"))
+	release := info.Release()
+	release.Timestamp = time.Now()
+	release.InfoHash = "hash"
+	release.Size = 10
+	check.Nil(statsDB.AddSnatch(*release))
+	check.Nil(checkCompletions(e))
+	failed, err := statsDB.FailedCompletedDownloads()
+	check.Nil(err)
+	check.Empty(failed)
+
+	// the download is complete once its files have not been modified for a while
+	folder := filepath.Join(downloadDir, release.Folder)
+	check.Nil(os.Mkdir(folder, 0777))
+	check.Nil(ioutil.WriteFile(filepath.Join(folder, "01.flac"), make([]byte, 10), 0666))
+	old := time.Now().Add(-time.Hour)
+	check.Nil(os.Chtimes(filepath.Join(folder, "01.flac"), old, old))
+	check.Nil(checkCompletions(e))
+	downloading, err := statsDB.Downloading(time.Now().AddDate(0, 0, -1))
+	check.Nil(err)
+	check.Empty(downloading)
+	check.True(DirectoryContainsMusicAndMetadata(folder))
+	dl, err := downloadsDB.FindByFolderName(release.Folder)
+	check.Nil(err)
+	check.Equal([]string{"sim"}, dl.Tracker)
+	check.Equal([]int{101}, dl.TrackerID)
+	failed, err = statsDB.FailedCompletedDownloads()
+	check.Nil(err)
+	check.Empty(failed)
+
+	// failing stages are remembered, and can be retried
+	unknown := *release
+	unknown.Tracker = "unknown"
+	cd := &CompletedDownload{Release: unknown, Path: folder, Timestamp: time.Now()}
+	runDownloadPipeline(e, statsDB, cd)
+	failed, err = statsDB.FailedCompletedDownloads()
+	check.Nil(err)
+	check.Equal(1, len(failed))
+	check.Equal(stageMetadata, failed[0].Stage)
+	check.Equal(1, failed[0].Attempts)
+	check.NotEmpty(failed[0].Error)
+	failed[0].Release.Tracker = "sim"
+	check.Nil(statsDB.SaveCompletedDownload(&failed[0]))
+	// too soon to retry automatically
+	check.Nil(RetryDownloadPipelines(e, false))
+	failed, err = statsDB.FailedCompletedDownloads()
+	check.Nil(err)
+	check.Equal(1, len(failed))
+	check.Nil(RetryDownloadPipelines(e, true))
+	failed, err = statsDB.FailedCompletedDownloads()
+	check.Nil(err)
+	check.Empty(failed)
+
+	// without the daemon, metadata is saved when snatching
+	other := &TrackerMetadata{}
+	check.Nil(other.LoadFromID(tr, "201"))
+	saveMetadataAtSnatch(e, tr, other)
+	check.True(fs.FileExists(filepath.Join(downloadDir, other.FolderName, MetadataDir, OriginJSONFile)))
+}
@@ -54,6 +54,14 @@ func NewDownloadsDB(path, root string, additionalSources []string) (*DownloadsDB
 	return downloadsDB, returnErr
 }
 
+// useDownloadsDB makes NewDownloadsDB return d instead of opening the database, and returns the database it replaces.
+func useDownloadsDB(d *DownloadsDB) *DownloadsDB {
+	onceDownloadsDB.Do(func() {})
+	previous := downloadsDB
+	downloadsDB = d
+	return previous
+}
+
 func (d *DownloadsDB) init() error {
 	return d.db.DB.Init(&DownloadEntry{})
 }
@@ -248,30 +256,27 @@ func (d *DownloadsDB) locateFolderName(folderName string) (string, string, error
 
 	var found bool
 	var basePath string
-	c, err := NewConfig(DefaultConfigurationFile)
-	if err != nil {
-		return "", "", err
-	}
-	if !c.LibraryConfigured || !c.DownloadFolderConfigured {
-		return "", "", errors.New("insufficient information from the configuration file: download directory, library section")
+	if d.root == "" {
+		return "", "", errors.New("insufficient information from the configuration file: download directory")
 	}
 
-	rel, err := filepath.Rel(c.General.DownloadDir, absFolderName)
+	// the folder must be directly inside one of the known directories
+	rel, err := filepath.Rel(d.root, absFolderName)
 	if err != nil {
 		return "", "", err
 	}
-	if filepath.Clean(folderName) == rel {
-		basePath = c.General.DownloadDir
+	if filepath.Base(absFolderName) == rel {
+		basePath = d.root
 		found = true
 	}
 	if !found {
-		for _, s := range c.Library.AdditionalSources {
+		for _, s := range d.additionalSources {
 			rel, err = filepath.Rel(s, absFolderName)
 			if err != nil {
 				logthis.Error(err, logthis.VERBOSESTEST)
 				continue
 			}
-			if filepath.Clean(folderName) == rel {
+			if filepath.Base(absFolderName) == rel {
 				basePath = s
 				found = true
 			}
@@ -299,12 +304,12 @@ func (d *DownloadsDB) RescanPath(folderName string) error {
 		defer tx.Rollback()
 
 		var newEntry bool
-		dl, err := d.FindByFolderName(folderName)
+		dl, err := d.FindByFolderName(filepath.Base(absFolderName))
 		if err != nil {
 			if err == storm.ErrNotFound {
 				logthis.Info("Adding new entry!", logthis.NORMAL)
 				newEntry = true
-				dl.FolderName = folderName
+				dl.FolderName = filepath.Base(absFolderName)
 			} else {
 				return errors.Wrap(err, fmt.Sprintf("error looking for entry %s", absFolderName))
 			}
@@ -348,6 +353,7 @@ func (d *DownloadsDB) FindByFolderName(folderName string) (DownloadEntry, error)
 }
 
 func (d *DownloadsDB) Sort(e *Environment) error {
+	conf := e.Config()
 	var downloadEntries []DownloadEntry
 	query := d.db.DB.Select(q.Or(q.Eq("State", stateUnsorted), q.Eq("State", stateAccepted))).OrderBy("FolderName")
 	if err := query.Find(&downloadEntries); err != nil {
@@ -359,15 +365,15 @@ func (d *DownloadsDB) Sort(e *Environment) error {
 	}
 	for _, dl := range downloadEntries {
 		if dl.State == stateUnsorted {
-			if e.config.Library.AutomaticMode || ui.Accept(fmt.Sprintf("Sorting download #%d (%s), continue ", dl.ID, dl.FolderName)) {
+			if conf.Library.AutomaticMode || ui.Accept(fmt.Sprintf("Sorting download #%d (%s), continue ", dl.ID, dl.FolderName)) {
 				if err := dl.Sort(e, d.root); err != nil {
 					return errors.Wrap(err, "Error sorting download "+strconv.Itoa(dl.ID))
 				}
 			}
 		}
 		if dl.State == stateAccepted {
-			if e.config.Library.AutomaticMode || ui.Accept(fmt.Sprintf("Do you want to export already accepted release #%d (%s) ", dl.ID, dl.FolderName)) {
-				if err := dl.export(d.root, e.config); err != nil {
+			if conf.Library.AutomaticMode || ui.Accept(fmt.Sprintf("Do you want to export already accepted release #%d (%s) ", dl.ID, dl.FolderName)) {
+				if err := dl.export(d.root, conf); err != nil {
 					return errors.Wrap(err, "Error exporting download "+strconv.Itoa(dl.ID))
 				}
 			} else {
@@ -382,11 +388,12 @@ func (d *DownloadsDB) Sort(e *Environment) error {
 }
 
 func (d *DownloadsDB) SortThisID(e *Environment, id int, ignoreSorted bool) error {
+	conf := e.Config()
 	dl, err := d.FindByID(id)
 	if err != nil {
 		return errors.Wrap(err, "Error finding such an ID in the downloads database")
 	}
-	if dl.State != stateUnsorted && (ignoreSorted || e.config.Library.AutomaticMode || !ui.Accept(fmt.Sprintf("Download #%d (%s) has already been accepted or rejected. Do you want to sort it again ", dl.ID, dl.FolderName))) {
+	if dl.State != stateUnsorted && (ignoreSorted || conf.Library.AutomaticMode || !ui.Accept(fmt.Sprintf("Download #%d (%s) has already been accepted or rejected. Do you want to sort it again ", dl.ID, dl.FolderName))) {
 		return nil
 	}
 	if err := dl.Sort(e, d.root); err != nil {
@@ -186,16 +186,17 @@ func (d *DownloadEntry) getMetadata(root, tracker string) (TrackerMetadata, erro
 }
 
 func (d *DownloadEntry) Sort(e *Environment, root string) error {
+	conf := e.Config()
 	// reading metadata
 	if err := d.Load(root); err != nil {
 		return err
 	}
 	ui.Header("Sorting " + d.FolderName)
 	// if mpd configured, allow playing the release...
-	if e.config.MPD != nil && ui.Accept("Load release into MPD") {
+	if conf.MPD != nil && !conf.Library.AutomaticMode && ui.Accept("Load release into MPD") {
 		fmt.Println("Sending to MPD.")
 		mpdClient := MPD{}
-		if err := mpdClient.Connect(e.config.MPD); err == nil {
+		if err := mpdClient.Connect(conf.MPD); err == nil {
 			defer mpdClient.DisableAndDisconnect(root, d.FolderName)
 			if err := mpdClient.SendAndPlay(root, d.FolderName); err != nil {
 				fmt.Println(ui.RedBold("Error sending to MPD: " + err.Error()))
@@ -212,7 +213,7 @@ func (d *DownloadEntry) Sort(e *Environment, root string) error {
 			fmt.Println(ui.Green(origin.lastUpdatedString()))
 		}
 
-		if e.config.Library.AutomaticMode || ui.Accept("Try to refresh metadata from tracker") {
+		if conf.Library.AutomaticMode || ui.Accept("Try to refresh metadata from tracker") {
 			for i, t := range d.Tracker {
 				tracker, err := e.Tracker(t)
 				if err != nil {
@@ -234,7 +235,7 @@ func (d *DownloadEntry) Sort(e *Environment, root string) error {
 	// display metadata
 	fmt.Println(d.Description(root))
 
-	if e.config.Library.AutomaticMode {
+	if conf.Library.AutomaticMode {
 		d.State = stateAccepted
 	} else {
 		ui.Title("Sorting release")
@@ -259,7 +260,7 @@ func (d *DownloadEntry) Sort(e *Environment, root string) error {
 				d.State = stateUnsorted
 				validChoice = true
 			case strings.ToUpper(choice) == "A":
-				if err := d.export(root, e.config); err != nil {
+				if err := d.export(root, conf); err != nil {
 					return err
 				}
 				d.State = stateAccepted
@@ -320,7 +321,7 @@ func (d *DownloadEntry) export(root string, config *Config) error {
 			info.MainArtist = mainArtist
 
 			// retrieving main artist alias from the configuration
-			if err = info.checkAliasAndCategory(filepath.Join(root, d.FolderName, MetadataDir)); err != nil {
+			if err = info.checkAliasAndCategory(filepath.Join(root, d.FolderName, MetadataDir), config); err != nil {
 				return err
 			}
 			// main artist alias
@@ -341,7 +342,7 @@ func (d *DownloadEntry) export(root string, config *Config) error {
 			}
 
 			// category
-			if err = info.checkAliasAndCategory(filepath.Join(root, d.FolderName, MetadataDir)); err != nil {
+			if err = info.checkAliasAndCategory(filepath.Join(root, d.FolderName, MetadataDir), config); err != nil {
 				return err
 			}
 			categoryCandidates := info.Tags
@@ -376,9 +377,11 @@ func (d *DownloadEntry) export(root string, config *Config) error {
 	ui.Title("Exporting release")
 	if config.Library.AutomaticMode || ui.Accept("Export as "+newName) {
 		fmt.Println("Exporting files to the library...")
-		if err := fs.CopyDir(filepath.Join(root, d.FolderName), filepath.Join(config.Library.Directory, newName), config.Library.UseHardLinks); err != nil {
+		report, err := LinkDir(filepath.Join(root, d.FolderName), filepath.Join(config.Library.Directory, newName), LinkOptions{HardLinks: config.Library.UseHardLinks, Verify: config.General.VerifyLinks})
+		if err != nil {
 			return errors.Wrap(err, "Error exporting download "+d.FolderName)
 		}
+		fmt.Println(report.String())
 		// if moving downloads, removing source
 		if config.Library.MoveSorted {
 			if err := os.RemoveAll(filepath.Join(root, d.FolderName)); err != nil {
@@ -3,6 +3,7 @@ package varroa
 import (
 	"fmt"
 	"io/ioutil"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
@@ -16,8 +17,8 @@ import (
 	"gitlab.com/catastrophic/assistance/git"
 	"gitlab.com/catastrophic/assistance/ipc"
 	"gitlab.com/catastrophic/assistance/logthis"
-	irc "gitlab.com/catastrophic/go-ircevent"
 	"gitlab.com/passelecasque/obstruction/tracker"
+	irc "gitlab.com/passelecasque/varroa/internal/ircevent"
 )
 
 const (
@@ -39,6 +40,7 @@ pages:
 // Environment keeps track of all the context varroa needs.
 type Environment struct {
 	config     *Config
+	paths      *Paths
 	serverData *ServerPage
 	Trackers   map[string]*tracker.Gazelle
 
@@ -47,38 +49,89 @@ type Environment struct {
 	daemonUnixSocket *ipc.UnixSocket
 	startTime        time.Time
 	ircClient        *irc.Connection
+	reachedQuotas    map[string]bool
+	// autosnatching state of each tracker, which survives configuration reloads
+	autosnatchStates map[string]autosnatchState
+	// running services, so that they can be restarted when the configuration is reloaded
+	announceSources map[string][]AnnounceSource
+	webServers      []*http.Server
+	stopStats       chan struct{}
+	stopCompletions chan struct{}
+	reloading       sync.Mutex
+	// torrent client, kept while its configuration does not change
+	torrentClient       TorrentClient
+	torrentClientConfig ConfigTorrentClient
 }
 
-// NewEnvironment prepares a new Environment.
-func NewEnvironment() *Environment {
+// NewEnvironment prepares a new Environment, using the default paths if none are given.
+func NewEnvironment(paths *Paths) *Environment {
 	e := &Environment{}
 	e.config = &Config{}
+	if paths == nil {
+		paths = NewPaths("", "", "")
+	}
+	e.paths = paths
 	e.serverData = &ServerPage{}
 	// make maps
 	e.Trackers = make(map[string]*tracker.Gazelle)
-	e.daemonUnixSocket = ipc.NewUnixSocketServer(daemonSocket)
+	e.reachedQuotas = make(map[string]bool)
+	e.autosnatchStates = make(map[string]autosnatchState)
+	e.announceSources = make(map[string][]AnnounceSource)
+	e.daemonUnixSocket = ipc.NewUnixSocketServer(e.paths.Socket)
 	// irc
 	e.ircClient = nil
 	return e
 }
 
 func (e *Environment) SetConfig(c *Config) {
+	e.mutex.Lock()
 	e.config = c
+	e.mutex.Unlock()
+}
+
+// Paths used by this instance.
+func (e *Environment) Paths() *Paths {
+	return e.paths
+}
+
+// Config currently in use.
+func (e *Environment) Config() *Config {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+	return e.config
+}
+
+// setQuotaReached remembers if a filter has reached one of its quotas, and returns true if that is new.
+func (e *Environment) setQuotaReached(filter string, reached bool) bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.reachedQuotas == nil {
+		e.reachedQuotas = make(map[string]bool)
+	}
+	wasReached := e.reachedQuotas[filter]
+	e.reachedQuotas[filter] = reached
+	return reached && !wasReached
 }
 
 // LoadConfiguration whether the configuration file is encrypted or not.
 func (e *Environment) LoadConfiguration() error {
-	var err error
-	e.config, err = NewConfig(DefaultConfigurationFile)
+	conf, err := NewConfig(e.paths.ConfigurationFile)
 	if err != nil {
 		return err
 	}
+	e.SetConfig(conf)
+	return e.applyConfiguration()
+}
 
+// applyConfiguration sets up the parts of the Environment that only depend on the configuration.
+func (e *Environment) applyConfiguration() error {
+	conf := e.Config()
+	var err error
 	// get theme for stats & webserver
-	if e.config.statsConfigured {
+	if conf.statsConfigured {
 		theme := knownThemes[darkOrange]
-		if e.config.webserverConfigured {
-			theme = knownThemes[e.config.WebServer.Theme]
+		if conf.webserverConfigured {
+			theme = knownThemes[conf.WebServer.Theme]
 			commonStyleSVG.StrokeColor = drawing.ColorFromHex(theme.GraphColor[1:])
 			commonStyleSVG.FillColor = drawing.ColorFromHex(theme.GraphColor[1:]).WithAlpha(theme.GraphFillerOpacity)
 			commonStyleSVG.FontColor = drawing.ColorFromHex(theme.GraphAxisColor[1:])
@@ -90,8 +143,8 @@ func (e *Environment) LoadConfiguration() error {
 		e.serverData.index = HTMLIndex{Title: strings.ToUpper(FullName), Version: Version, CSS: theme.CSS(), Script: indexJS}
 	}
 	// git
-	if e.config.gitlabPagesConfigured {
-		e.git, err = git.New(StatsDir, e.config.GitlabPages.User, e.config.GitlabPages.User+"+varroa@musica")
+	if conf.gitlabPagesConfigured {
+		e.git, err = git.New(e.paths.StatsDir(), conf.GitlabPages.User, conf.GitlabPages.User+"+varroa@musica")
 		if err != nil {
 			return err
 		}
@@ -101,6 +154,7 @@ func (e *Environment) LoadConfiguration() error {
 
 // SetUp the Environment
 func (e *Environment) SetUp(autologin bool) error {
+	conf := e.Config()
 	// for uptime
 	if daemon.WasReborn() {
 		e.startTime = time.Now()
@@ -108,13 +162,13 @@ func (e *Environment) SetUp(autologin bool) error {
 		logthis.SetStdOutput(false)
 	}
 	// prepare directory for stats if necessary
-	if !fs.DirExists(StatsDir) {
-		if err := os.MkdirAll(StatsDir, 0777); err != nil {
+	if !fs.DirExists(e.paths.StatsDir()) {
+		if err := os.MkdirAll(e.paths.StatsDir(), 0777); err != nil {
 			return errors.Wrap(err, errorCreatingStatsDir)
 		}
 	}
 	// log in all trackers, assuming labels are unique (configuration was checked)
-	for _, label := range e.config.TrackerLabels() {
+	for _, label := range conf.TrackerLabels() {
 		if _, err := e.setUpTracker(label, autologin); err != nil {
 			return err
 		}
@@ -123,45 +177,78 @@ func (e *Environment) SetUp(autologin bool) error {
 }
 
 func (e *Environment) setUpTracker(label string, autologin bool) (*tracker.Gazelle, error) {
+	e.mutex.Lock()
 	t, ok := e.Trackers[label]
 	if !ok {
 		// not found:
 		trackerConfig, err := e.config.GetTracker(label)
 		if err != nil {
+			e.mutex.Unlock()
 			return nil, errors.Wrap(err, "Error getting tracker information")
 		}
-		t, err = tracker.NewGazelle(trackerConfig.Name, trackerConfig.URL, trackerConfig.User, trackerConfig.Password, "session", trackerConfig.Cookie, trackerConfig.APIKey, userAgent())
+		t, err = newTracker(trackerConfig)
 		if err != nil {
-			return nil, errors.Wrap(err, "Error setting up tracker "+trackerConfig.Name)
+			e.mutex.Unlock()
+			return nil, err
 		}
-		// start rate limiter
-		t.StartRateLimiter()
 		// saving
 		e.Trackers[label] = t
 	}
+	e.mutex.Unlock()
 	if t.Client == nil && autologin {
-		if err := t.Login(); err != nil {
-			return nil, errors.Wrap(err, "Error logging in tracker "+label)
+		if err := loginTracker(t, label); err != nil {
+			return nil, err
 		}
-		logthis.Info(fmt.Sprintf("Logged in tracker %s.", label), logthis.NORMAL)
 	}
 	return t, nil
 }
 
+// newTracker from its configuration, with its rate limiter started.
+func newTracker(trackerConfig *ConfigTracker) (*tracker.Gazelle, error) {
+	t, err := tracker.NewGazelle(trackerConfig.Name, trackerConfig.URL, trackerConfig.User, trackerConfig.Password, "session", trackerConfig.Cookie, trackerConfig.APIKey, userAgent())
+	if err != nil {
+		return nil, errors.Wrap(err, "Error setting up tracker "+trackerConfig.Name)
+	}
+	// start rate limiter
+	t.StartRateLimiter()
+	return t, nil
+}
+
+func loginTracker(t *tracker.Gazelle, label string) error {
+	if err := t.Login(); err != nil {
+		return errors.Wrap(err, "Error logging in tracker "+label)
+	}
+	logthis.Info(fmt.Sprintf("Logged in tracker %s.", label), logthis.NORMAL)
+	return nil
+}
+
+// trackers currently set up, by label.
+func (e *Environment) trackers() map[string]*tracker.Gazelle {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+	trackers := make(map[string]*tracker.Gazelle, len(e.Trackers))
+	for label, t := range e.Trackers {
+		trackers[label] = t
+	}
+	return trackers
+}
+
 func (e *Environment) Tracker(label string) (*tracker.Gazelle, error) {
 	return e.setUpTracker(label, true)
 }
 
 func (e *Environment) GenerateIndex() error {
-	if !e.config.statsConfigured {
+	conf := e.Config()
+	if !conf.statsConfigured {
 		return nil
 	}
-	return e.serverData.SaveIndex(e, filepath.Join(StatsDir, htmlIndexFile))
+	return e.serverData.SaveIndex(e, filepath.Join(e.paths.StatsDir(), htmlIndexFile))
 }
 
 // DeployToGitlabPages with git wrapper
 func (e *Environment) DeployToGitlabPages() error {
-	if !e.config.gitlabPagesConfigured {
+	conf := e.Config()
+	if !conf.gitlabPagesConfigured {
 		return nil
 	}
 	if e.git == nil {
@@ -174,7 +261,7 @@ func (e *Environment) DeployToGitlabPages() error {
 			return errors.Wrap(err, errorGitInit)
 		}
 		// create .gitlab-ci.yml
-		if err := ioutil.WriteFile(filepath.Join(StatsDir, gitlabCIYamlFile), []byte(gitlabCI), 0666); err != nil {
+		if err := ioutil.WriteFile(filepath.Join(e.paths.StatsDir(), gitlabCIYamlFile), []byte(gitlabCI), 0666); err != nil {
 			return err
 		}
 	}
@@ -192,33 +279,30 @@ func (e *Environment) DeployToGitlabPages() error {
 	}
 	// push
 	if !e.git.HasRemote("origin") {
-		if err := e.git.AddRemote("origin", e.config.GitlabPages.GitHTTPS); err != nil {
+		if err := e.git.AddRemote("origin", conf.GitlabPages.GitHTTPS); err != nil {
 			return errors.Wrap(err, errorGitAddRemote)
 		}
 	}
-	if err := e.git.Push("origin", e.config.GitlabPages.GitHTTPS, e.config.GitlabPages.User, e.config.GitlabPages.Password); err != nil {
+	if err := e.git.Push("origin", conf.GitlabPages.GitHTTPS, conf.GitlabPages.User, conf.GitlabPages.Password); err != nil {
 		return err
 	}
-	logthis.Info("Pushed new stats to "+e.config.GitlabPages.URL, logthis.NORMAL)
+	logthis.Info("Pushed new stats to "+conf.GitlabPages.URL, logthis.NORMAL)
 	return nil
 }
 
 func GoGoRoutines(e *Environment, noDaemon bool) {
 	//  tracker-dependent goroutines
-	for _, t := range e.Trackers {
-		if e.config.autosnatchConfigured {
-			go ircHandler(e, t)
-		}
+	for label := range e.trackers() {
+		e.startAnnounceSources(label)
 	}
 	// general goroutines
-	if e.config.statsConfigured {
-		go monitorAllStats(e)
-	}
-	if e.config.webserverConfigured {
-		go webServer(e)
-	}
+	e.startSnatchQueue()
+	e.startStatsMonitoring()
+	e.startCompletionWatcher()
+	e.startWebServer()
 	// background goroutines
 	go automatedTasks(e)
+	go watchConfiguration(e)
 	if !noDaemon {
 		go awaitOrders(e)
 	}
@@ -0,0 +1,275 @@
+package varroa
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"gitlab.com/catastrophic/assistance/logthis"
+	"gitlab.com/passelecasque/obstruction/tracker"
+)
+
+const (
+	feedPattern    = `(?P<artist>.*?) - (?P<title>.*) \[(?P<year>[\d]{4})\] \[(?P<release_type>Album|Soundtrack|Compilation|Anthology|EP|Single|Live album|Remix|Bootleg|Interview|Mixtape|Demo|Concert Recording|DJ Mix|Unknown)\] - (?P<format>FLAC|MP3|AAC|DSD) / (?P<quality>Lossless|24bit Lossless|V0 \(VBR\)|V2 \(VBR\)|320|256|DSD64|DSD128|DSD256|DSD512) /( (?P<log>Log) /)?( (?P<log_score>-*\d+)\% /)?( (?P<cue>Cue) /)? (?P<source>CD|DVD|Vinyl|Soundboard|SACD|DAT|Cassette|WEB|Blu-Ray)( / (?P<scene>Scene))?`
+	feedSampleLink = "https://mysterious.address/torrents.php?action=download&id=923266"
+	feedTimeout    = time.Minute
+	// feedMaxAttempts is how many polls try to analyze an item before it is given up.
+	feedMaxAttempts = 3
+)
+
+var (
+	// feedRequiredGroups must be in item formats; the torrent URL can be the link of the item.
+	feedRequiredGroups = []string{announceArtist, announceTitle, announceReleaseType, announceFormat, announceQuality, announceSource}
+	// defaultFeedFormats are used for feeds without item_formats in their configuration.
+	defaultFeedFormats = []*ConfigAnnounceFormat{
+		{
+			Pattern: feedPattern,
+			Samples: []string{"Some fellow & Aníkúlápó - first / second [1999] [Anthology] - FLAC / Lossless / Log / 100% / Cue / CD"},
+			regexp:  regexp.MustCompile(feedPattern),
+		},
+	}
+)
+
+// feedItem is what varroa needs from an item of an RSS or JSON feed.
+type feedItem struct {
+	GUID       string
+	Title      string
+	Link       string
+	Categories []string
+}
+
+type rssFeed struct {
+	Items []struct {
+		GUID      string `xml:"guid"`
+		Title     string `xml:"title"`
+		Link      string `xml:"link"`
+		Enclosure struct {
+			URL string `xml:"url,attr"`
+		} `xml:"enclosure"`
+		Categories []string `xml:"category"`
+	} `xml:"channel>item"`
+}
+
+// jsonFeed follows the JSON Feed format (https://jsonfeed.org).
+type jsonFeed struct {
+	Items []struct {
+		ID          string   `json:"id"`
+		Title       string   `json:"title"`
+		URL         string   `json:"url"`
+		Tags        []string `json:"tags"`
+		Attachments []struct {
+			URL string `json:"url"`
+		} `json:"attachments"`
+	} `json:"items"`
+}
+
+// parseFeed returns the items of an RSS or JSON feed, in the order of the feed.
+// The link of an item is its enclosure or attachment, which is usually the torrent file, if it has one.
+func parseFeed(data []byte) ([]feedItem, error) {
+	var items []feedItem
+	data = bytes.TrimSpace(data)
+	if bytes.HasPrefix(data, []byte("{")) {
+		var feed jsonFeed
+		if err := json.Unmarshal(data, &feed); err != nil {
+			return nil, errors.Wrap(err, "could not parse JSON feed")
+		}
+		for _, i := range feed.Items {
+			item := feedItem{GUID: i.ID, Title: i.Title, Link: i.URL, Categories: i.Tags}
+			if len(i.Attachments) != 0 && i.Attachments[0].URL != "" {
+				item.Link = i.Attachments[0].URL
+			}
+			items = append(items, item)
+		}
+	} else {
+		var feed rssFeed
+		if err := xml.Unmarshal(data, &feed); err != nil {
+			return nil, errors.Wrap(err, "could not parse RSS feed")
+		}
+		for _, i := range feed.Items {
+			item := feedItem{GUID: strings.TrimSpace(i.GUID), Title: strings.TrimSpace(i.Title), Link: strings.TrimSpace(i.Link), Categories: i.Categories}
+			if i.Enclosure.URL != "" {
+				item.Link = i.Enclosure.URL
+			}
+			items = append(items, item)
+		}
+	}
+	// without a GUID, an item is identified by its link
+	for i := range items {
+		if items[i].GUID == "" {
+			items[i].GUID = items[i].Link
+		}
+	}
+	return items, nil
+}
+
+// parseFeedItem returns the Release described by the title of a feed item, using the first format that matches it.
+// If the item does not describe a music release, it returns nil.
+func parseFeedItem(trackerName string, item *feedItem, formats []*ConfigAnnounceFormat) (*Release, error) {
+	for _, f := range formats {
+		fields := f.match(item.Title)
+		if fields == nil {
+			continue
+		}
+		if fields[announceTorrentURL] == "" {
+			fields[announceTorrentURL] = item.Link
+		}
+		if fields[announceTags] == "" {
+			fields[announceTags] = strings.Join(item.Categories, ",")
+		}
+		release, err := NewRelease(trackerName, fields)
+		if err != nil {
+			return nil, err
+		}
+		if release.TorrentID == "" {
+			return nil, errors.New("no torrent ID found in " + fields[announceTorrentURL])
+		}
+		return release, nil
+	}
+	return nil, nil
+}
+
+// feedPoller regularly polls the personal notification feed of a tracker, as an alternative to its IRC announces.
+// The items already considered are remembered in the announces database.
+type feedPoller struct {
+	e       *Environment
+	tracker *tracker.Gazelle
+	config  *ConfigAutosnatch
+	client  *http.Client
+
+	mutex     sync.RWMutex
+	lastPoll  time.Time
+	lastItem  time.Time
+	lastError error
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+func newFeedPoller(e *Environment, t *tracker.Gazelle, autosnatchConfig *ConfigAutosnatch) *feedPoller {
+	return &feedPoller{e: e, tracker: t, config: autosnatchConfig, client: &http.Client{Timeout: feedTimeout}, stop: make(chan struct{}), done: make(chan struct{})}
+}
+
+// Start polling the feed in the background, immediately and then at the configured interval.
+func (p *feedPoller) Start() {
+	go p.run()
+}
+
+func (p *feedPoller) run() {
+	defer close(p.done)
+	ticker := time.NewTicker(time.Duration(p.config.Feed.IntervalMinutes) * time.Minute)
+	defer ticker.Stop()
+	for {
+		err := p.poll()
+		p.mutex.Lock()
+		p.lastPoll = time.Now()
+		p.lastError = err
+		p.mutex.Unlock()
+		if err != nil {
+			logthis.Error(errors.Wrap(err, "could not poll the feed of tracker "+p.tracker.Name), logthis.NORMAL)
+		}
+		select {
+		case <-ticker.C:
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// Stop polling, waiting for the current poll to end.
+func (p *feedPoller) Stop() {
+	close(p.stop)
+	<-p.done
+}
+
+// poll the feed once, and send the new items to the filters, oldest first.
+// Items that could not be analyzed are tried again at the next polls, up to feedMaxAttempts times. Their announce
+// is only kept once it is not tried again.
+func (p *feedPoller) poll() error {
+	announces, err := NewAnnouncesDB(p.e.paths.AnnouncesDB())
+	if err != nil {
+		return errors.Wrap(err, "could not access the announces database")
+	}
+	req, err := http.NewRequest("GET", p.config.Feed.URL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", userAgent())
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("feed returned status %d", resp.StatusCode)
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	items, err := parseFeed(data)
+	if err != nil {
+		return err
+	}
+
+	for i := len(items) - 1; i >= 0; i-- {
+		item := items[i]
+		if item.GUID == "" || announces.SeenFeedItem(p.tracker.Name, item.GUID) {
+			continue
+		}
+		p.mutex.Lock()
+		p.lastItem = time.Now()
+		p.mutex.Unlock()
+		if p.e.autosnatchingEnabled(p.tracker.Name) {
+			logthis.Info("++ New in the feed of "+p.tracker.Name+": "+item.Title, logthis.VERBOSE)
+			release, err := parseFeedItem(p.tracker.Name, &item, p.config.Feed.itemFormats)
+			if err != nil {
+				logthis.Error(errors.Wrap(err, errorDealingWithAnnounce), logthis.VERBOSE)
+			} else if release == nil {
+				logthis.Info(infoNotMusic, logthis.VERBOSE)
+			} else if err := filterRelease(release, p.e, p.e.Config(), p.tracker); err != nil {
+				logthis.Error(errors.Wrap(err, errorDealingWithAnnounce), logthis.VERBOSE)
+				attempts, err := announces.AddFeedItemFailure(p.tracker.Name, item.GUID)
+				if err != nil {
+					logthis.Error(errors.Wrap(err, "could not remember feed item"), logthis.NORMAL)
+				}
+				if attempts < feedMaxAttempts {
+					continue
+				}
+				logthis.Info(fmt.Sprintf("Giving up on %s after %d attempts.", item.Title, attempts), logthis.NORMAL)
+				keepAnnounce(announces, release)
+			} else {
+				keepAnnounce(announces, release)
+			}
+		}
+		if err := announces.AddSeenFeedItem(p.tracker.Name, item.GUID); err != nil {
+			logthis.Error(errors.Wrap(err, "could not remember feed item"), logthis.NORMAL)
+		}
+	}
+	return nil
+}
+
+// String describes the state of the poller.
+func (p *feedPoller) String() string {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	status := "Feed for tracker " + p.tracker.Name + ": "
+	if p.lastPoll.IsZero() {
+		status += "not polled yet"
+	} else {
+		status += "last polled " + p.lastPoll.Format("2006.01.02 15h04")
+	}
+	if p.lastError != nil {
+		status += " (" + p.lastError.Error() + ")"
+	}
+	if p.lastItem.IsZero() {
+		return status + ", no new item yet."
+	}
+	return status + ", last new item " + p.lastItem.Format("2006.01.02 15h04") + "."
+}
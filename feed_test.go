@@ -0,0 +1,149 @@
+package varroa
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/passelecasque/obstruction/tracker"
+)
+
+const (
+	testRSSFeed = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0">
+<channel>
+	<title>Notifications</title>
+	<item>
+		<title>Artist B - Second Album [2019] [EP] - MP3 / 320 / WEB / Scene</title>
+		<link>https://blue.ch/torrents.php?action=download&amp;id=12&amp;authkey=a&amp;torrent_pass=b</link>
+		<guid>https://blue.ch/torrents.php?torrentid=12</guid>
+		<category>pop</category>
+	</item>
+	<item>
+		<title>Artist A - First Album [2018] [Album] - FLAC / Lossless / Log / 100% / Cue / CD</title>
+		<link>https://blue.ch/torrents.php?id=10</link>
+		<enclosure url="https://blue.ch/torrents.php?action=download&amp;id=11&amp;authkey=a&amp;torrent_pass=b" type="application/x-bittorrent"/>
+		<category>rock</category>
+		<category>indie</category>
+	</item>
+	<item>
+		<title>Some Movie (2018)</title>
+		<link>https://blue.ch/torrents.php?action=download&amp;id=13</link>
+	</item>
+</channel>
+</rss>`
+	testJSONFeed = `{"version": "https://jsonfeed.org/version/1", "title": "Notifications", "items": [
+		{"id": "14", "title": "Artist C - Third Album [2020] [Single] - FLAC / 24bit Lossless / WEB", "url": "https://blue.ch/torrents.php?id=15", "tags": ["jazz"], "attachments": [{"url": "https://blue.ch/torrents.php?action=download&id=14"}]}
+	]}`
+)
+
+func TestFeed(t *testing.T) {
+	fmt.Println("+ Testing Feed...")
+	check := assert.New(t)
+
+	// RSS
+	items, err := parseFeed([]byte(testRSSFeed))
+	check.Nil(err)
+	check.Equal(3, len(items))
+	check.Equal("https://blue.ch/torrents.php?torrentid=12", items[0].GUID)
+	check.Equal("https://blue.ch/torrents.php?action=download&id=11&authkey=a&torrent_pass=b", items[1].Link)
+	check.Equal(items[1].Link, items[1].GUID)
+	check.Equal([]string{"rock", "indie"}, items[1].Categories)
+
+	r, err := parseFeedItem("blue", &items[0], defaultFeedFormats)
+	check.Nil(err)
+	check.Equal("12", r.TorrentID)
+	check.Equal([]string{"Artist B"}, r.Artists)
+	check.Equal("EP", r.ReleaseType)
+	check.Equal("320", r.Quality)
+	check.True(r.IsScene)
+	check.Equal([]string{"pop"}, r.Tags)
+	r, err = parseFeedItem("blue", &items[1], defaultFeedFormats)
+	check.Nil(err)
+	check.Equal("11", r.TorrentID)
+	check.Equal(2018, r.Year)
+	check.True(r.HasLog)
+	check.Equal(100, r.LogScore)
+	check.True(r.HasCue)
+	check.Equal("CD", r.Source)
+	check.Equal([]string{"rock", "indie"}, r.Tags)
+	r, err = parseFeedItem("blue", &items[2], defaultFeedFormats)
+	check.Nil(err)
+	check.Nil(r)
+	// the link must lead to the torrent
+	_, err = parseFeedItem("blue", &feedItem{Title: items[1].Title, Link: "https://blue.ch/torrents.php?id=10"}, defaultFeedFormats)
+	check.NotNil(err)
+	check.Nil((&ConfigFeed{}).checkSamples("blue"))
+	feedConfig := &ConfigFeed{URL: "https://blue.ch/feed"}
+	check.Nil(feedConfig.check())
+	check.Nil(feedConfig.checkSamples("blue"))
+
+	// JSON
+	items, err = parseFeed([]byte(testJSONFeed))
+	check.Nil(err)
+	check.Equal(1, len(items))
+	check.Equal("14", items[0].GUID)
+	r, err = parseFeedItem("blue", &items[0], defaultFeedFormats)
+	check.Nil(err)
+	check.Equal("14", r.TorrentID)
+	check.Equal("24bit Lossless", r.Quality)
+	check.Equal([]string{"jazz"}, r.Tags)
+	_, err = parseFeed([]byte("{not json"))
+	check.NotNil(err)
+
+	// polling: items are only considered once
+	dataDir, err := ioutil.TempDir("", "varroa")
+	check.Nil(err)
+	defer os.RemoveAll(dataDir)
+	db, err := NewDatabase(filepath.Join(dataDir, DefaultAnnouncesDB))
+	check.Nil(err)
+	defer db.Close()
+	adb := &AnnouncesDB{db: db}
+	check.Nil(adb.init())
+	defer useAnnouncesDB(useAnnouncesDB(adb))
+
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(testRSSFeed))
+	}))
+	defer server.Close()
+	e := NewEnvironment(NewPaths("", dataDir, ""))
+	tr := &tracker.Gazelle{}
+	tr.Name = "blue"
+	// autosnatching disabled: nothing reaches the tracker
+	e.autosnatchStates["blue"] = autosnatchState{disabled: true}
+	autosnatchConfig := &ConfigAutosnatch{Tracker: "blue", Feed: &ConfigFeed{URL: server.URL}}
+	check.Nil(autosnatchConfig.check())
+	p := newFeedPoller(e, tr, autosnatchConfig)
+	check.Nil(p.poll())
+	check.Equal(1, requests)
+	check.True(announcesDB.SeenFeedItem("blue", "https://blue.ch/torrents.php?torrentid=12"))
+	check.True(announcesDB.SeenFeedItem("blue", "https://blue.ch/torrents.php?action=download&id=13"))
+	check.False(announcesDB.SeenFeedItem("purple", "https://blue.ch/torrents.php?torrentid=12"))
+	check.Nil(announcesDB.Purge(1))
+	check.True(announcesDB.SeenFeedItem("blue", "https://blue.ch/torrents.php?torrentid=12"))
+	check.Nil(announcesDB.Purge(-1))
+	check.False(announcesDB.SeenFeedItem("blue", "https://blue.ch/torrents.php?torrentid=12"))
+
+	// items that could not be analyzed are tried again until they are given up
+	for i := 1; i <= feedMaxAttempts; i++ {
+		attempts, err := announcesDB.AddFeedItemFailure("blue", "16")
+		check.Nil(err)
+		check.Equal(i, attempts)
+		check.False(announcesDB.SeenFeedItem("blue", "16"))
+	}
+	check.Nil(announcesDB.AddSeenFeedItem("blue", "16"))
+	check.True(announcesDB.SeenFeedItem("blue", "16"))
+
+	autosnatchConfig.Feed.URL = server.URL + "/missing"
+	server.Config.Handler = http.NotFoundHandler()
+	check.NotNil(p.poll())
+	check.True(strings.HasPrefix(p.String(), "Feed for tracker blue: not polled yet, last new item "))
+}
@@ -0,0 +1,696 @@
+package varroa
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"gitlab.com/catastrophic/assistance/intslice"
+	"gitlab.com/catastrophic/assistance/strslice"
+	"gitlab.com/passelecasque/obstruction/tracker"
+)
+
+// Filter expressions combine conditions on release fields with AND, OR, NOT and parentheses, for example:
+//	(format == FLAC and quality == "24bit Lossless" and source == WEB) or (source == CD and log_score >= 100)
+// Fields holding lists (tags, artist) match if any of their elements matches.
+// String values can use the same r/ and xr/ regexp prefixes as the other filter options.
+
+const (
+	tokenEOF = iota
+	tokenWord
+	tokenString
+	tokenOperator
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenIn
+	tokenLeftParenthesis
+	tokenRightParenthesis
+	tokenLeftBracket
+	tokenRightBracket
+	tokenComma
+)
+
+const (
+	fieldString = iota
+	fieldInt
+	fieldBool
+	fieldList
+)
+
+const expressionOperatorCharacters = "=!<>"
+
+type expressionToken struct {
+	kind     int
+	value    string
+	position int
+}
+
+func (t expressionToken) String() string {
+	if t.kind == tokenEOF {
+		return "end of expression"
+	}
+	return strconv.Quote(t.value)
+}
+
+// ExpressionError points at the token of a filter expression that could not be parsed.
+type ExpressionError struct {
+	Expression string
+	Position   int
+	Message    string
+}
+
+func (e *ExpressionError) Error() string {
+	return fmt.Sprintf("%s at position %d:\n\t%s\n\t%s^", e.Message, e.Position+1, e.Expression, strings.Repeat(" ", e.Position))
+}
+
+type expressionField struct {
+	kind          int
+	needsMetadata bool
+	knownValues   []string
+}
+
+var expressionFields = map[string]expressionField{
+	"year":           {kind: fieldInt},
+	"format":         {kind: fieldString, knownValues: tracker.KnownFormats},
+	"quality":        {kind: fieldString, knownValues: tracker.KnownQualities},
+	"source":         {kind: fieldString, knownValues: tracker.KnownSources},
+	"type":           {kind: fieldString, knownValues: tracker.KnownReleaseTypes},
+	"tags":           {kind: fieldList},
+	"has_log":        {kind: fieldBool},
+	"has_cue":        {kind: fieldBool},
+	"scene":          {kind: fieldBool},
+	"log_score":      {kind: fieldInt},
+	"title":          {kind: fieldString},
+	"artist":         {kind: fieldList, needsMetadata: true},
+	"size_mb":        {kind: fieldInt, needsMetadata: true},
+	"record_label":   {kind: fieldString, needsMetadata: true},
+	"catalog_number": {kind: fieldString, needsMetadata: true},
+	"edition":        {kind: fieldString, needsMetadata: true},
+	"edition_year":   {kind: fieldInt, needsMetadata: true},
+	"uploader":       {kind: fieldString, needsMetadata: true},
+	"trumpable":      {kind: fieldBool, needsMetadata: true},
+}
+
+// expressionValue returns the value of a field for the release and its tracker metadata (which can be nil),
+// and false if it cannot be known yet.
+func expressionValue(field string, r *Release, info *TrackerMetadata) (interface{}, bool) {
+	if expressionFields[field].needsMetadata && info == nil {
+		return nil, false
+	}
+	switch field {
+	case "year":
+		return r.Year, true
+	case "format":
+		return r.Format, true
+	case "quality":
+		return r.Quality, true
+	case "source":
+		return r.Source, true
+	case "type":
+		return r.ReleaseType, true
+	case "tags":
+		return r.Tags, true
+	case "has_log":
+		return r.HasLog, true
+	case "has_cue":
+		return r.HasCue, true
+	case "scene":
+		return r.IsScene, true
+	case "log_score":
+		if info != nil {
+			return info.LogScore, true
+		}
+		if !r.HasLog {
+			return 0, true
+		}
+		// the announce does not always contain the log score
+		return r.LogScore, r.LogScore != logScoreNotInAnnounce
+	case "title":
+		return r.Title, true
+	case "artist":
+		var artists []string
+		for _, a := range info.Artists {
+			artists = append(artists, a.Name)
+		}
+		return artists, true
+	case "size_mb":
+		return int(info.Size / (1024 * 1024)), true
+	case "record_label":
+		return info.RecordLabel, true
+	case "catalog_number":
+		return info.CatalogNumber, true
+	case "edition":
+		return info.EditionName, true
+	case "edition_year":
+		return info.EditionYear, true
+	case "uploader":
+		return info.Uploader, true
+	case "trumpable":
+		return info.Trumpable, true
+	}
+	return nil, false
+}
+
+// ------------
+// lexer
+
+func tokenizeExpression(expression string) ([]expressionToken, error) {
+	var tokens []expressionToken
+	// positions are counted in runes, so that errors point at the right character
+	runes := []rune(expression)
+	for i := 0; i < len(runes); {
+		c := runes[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(':
+			tokens = append(tokens, expressionToken{kind: tokenLeftParenthesis, value: "(", position: i})
+			i++
+		case c == ')':
+			tokens = append(tokens, expressionToken{kind: tokenRightParenthesis, value: ")", position: i})
+			i++
+		case c == '[':
+			tokens = append(tokens, expressionToken{kind: tokenLeftBracket, value: "[", position: i})
+			i++
+		case c == ']':
+			tokens = append(tokens, expressionToken{kind: tokenRightBracket, value: "]", position: i})
+			i++
+		case c == ',':
+			tokens = append(tokens, expressionToken{kind: tokenComma, value: ",", position: i})
+			i++
+		case c == '"':
+			start := i
+			var value []rune
+			i++
+			for i < len(runes) && runes[i] != '"' {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+				}
+				value = append(value, runes[i])
+				i++
+			}
+			if i == len(runes) {
+				return nil, &ExpressionError{Expression: expression, Position: start, Message: "unterminated string"}
+			}
+			i++
+			tokens = append(tokens, expressionToken{kind: tokenString, value: string(value), position: start})
+		case c == '&' || c == '|':
+			if i+1 >= len(runes) || runes[i+1] != c {
+				return nil, &ExpressionError{Expression: expression, Position: i, Message: "unexpected character " + strconv.QuoteRune(c)}
+			}
+			kind := tokenAnd
+			if c == '|' {
+				kind = tokenOr
+			}
+			tokens = append(tokens, expressionToken{kind: kind, value: string([]rune{c, c}), position: i})
+			i += 2
+		case strings.ContainsRune(expressionOperatorCharacters, c):
+			start := i
+			for i < len(runes) && strings.ContainsRune(expressionOperatorCharacters, runes[i]) {
+				i++
+			}
+			operator := string(runes[start:i])
+			if operator == "!" {
+				tokens = append(tokens, expressionToken{kind: tokenNot, value: operator, position: start})
+				continue
+			}
+			if !strslice.Contains([]string{"=", "==", "!=", "<", "<=", ">", ">="}, operator) {
+				return nil, &ExpressionError{Expression: expression, Position: start, Message: "unknown operator " + strconv.Quote(operator)}
+			}
+			if operator == "=" {
+				operator = "=="
+			}
+			tokens = append(tokens, expressionToken{kind: tokenOperator, value: operator, position: start})
+		default:
+			start := i
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && !strings.ContainsRune(`()[],"&|`+expressionOperatorCharacters, runes[i]) {
+				i++
+			}
+			word := string(runes[start:i])
+			kind := tokenWord
+			switch strings.ToLower(word) {
+			case "and":
+				kind = tokenAnd
+			case "or":
+				kind = tokenOr
+			case "not":
+				kind = tokenNot
+			case "in":
+				kind = tokenIn
+			}
+			tokens = append(tokens, expressionToken{kind: kind, value: word, position: start})
+		}
+	}
+	tokens = append(tokens, expressionToken{kind: tokenEOF, position: len(runes)})
+	return tokens, nil
+}
+
+// ------------
+// AST
+
+type expressionNode interface {
+	// eval returns the result, and false if it cannot be known without tracker metadata.
+	eval(r *Release, info *TrackerMetadata) (bool, bool)
+	fields() []string
+	String() string
+}
+
+type expressionAnd struct {
+	operands []expressionNode
+}
+
+func (n *expressionAnd) eval(r *Release, info *TrackerMetadata) (bool, bool) {
+	known := true
+	for _, o := range n.operands {
+		result, ok := o.eval(r, info)
+		if ok && !result {
+			return false, true
+		}
+		known = known && ok
+	}
+	return true, known
+}
+
+func (n *expressionAnd) fields() []string {
+	return operandsFields(n.operands)
+}
+
+func (n *expressionAnd) String() string {
+	parts := make([]string, len(n.operands))
+	for i, o := range n.operands {
+		if _, isOr := o.(*expressionOr); isOr {
+			parts[i] = "(" + o.String() + ")"
+		} else {
+			parts[i] = o.String()
+		}
+	}
+	return strings.Join(parts, " AND ")
+}
+
+type expressionOr struct {
+	operands []expressionNode
+}
+
+func (n *expressionOr) eval(r *Release, info *TrackerMetadata) (bool, bool) {
+	known := true
+	for _, o := range n.operands {
+		result, ok := o.eval(r, info)
+		if ok && result {
+			return true, true
+		}
+		known = known && ok
+	}
+	return false, known
+}
+
+func (n *expressionOr) fields() []string {
+	return operandsFields(n.operands)
+}
+
+func (n *expressionOr) String() string {
+	parts := make([]string, len(n.operands))
+	for i, o := range n.operands {
+		if _, isAnd := o.(*expressionAnd); isAnd {
+			parts[i] = "(" + o.String() + ")"
+		} else {
+			parts[i] = o.String()
+		}
+	}
+	return strings.Join(parts, " OR ")
+}
+
+type expressionNot struct {
+	operand expressionNode
+}
+
+func (n *expressionNot) eval(r *Release, info *TrackerMetadata) (bool, bool) {
+	result, known := n.operand.eval(r, info)
+	return !result, known
+}
+
+func (n *expressionNot) fields() []string {
+	return n.operand.fields()
+}
+
+func (n *expressionNot) String() string {
+	if _, isComparison := n.operand.(*expressionComparison); isComparison {
+		return "NOT " + n.operand.String()
+	}
+	return "NOT (" + n.operand.String() + ")"
+}
+
+type expressionComparison struct {
+	field    string
+	operator string
+	values   []string
+	number   int
+	// values compiled once parsed, for text fields
+	matcher *filterMatcher
+}
+
+func (n *expressionComparison) eval(r *Release, info *TrackerMetadata) (bool, bool) {
+	value, known := expressionValue(n.field, r, info)
+	if !known {
+		return false, false
+	}
+	switch expressionFields[n.field].kind {
+	case fieldInt:
+		v := value.(int)
+		switch n.operator {
+		case "==":
+			return v == n.number, true
+		case "!=":
+			return v != n.number, true
+		case "<":
+			return v < n.number, true
+		case "<=":
+			return v <= n.number, true
+		case ">":
+			return v > n.number, true
+		case ">=":
+			return v >= n.number, true
+		case "in":
+			ints, _ := strslice.ToIntSlice(n.values)
+			return intslice.Contains(ints, v), true
+		}
+	case fieldBool:
+		expected, _ := strconv.ParseBool(n.values[0])
+		if n.operator == "!=" {
+			return value.(bool) != expected, true
+		}
+		return value.(bool) == expected, true
+	case fieldString:
+		match := matchAnyPatterns(n.matcher, n.values, []string{value.(string)})
+		if n.operator == "!=" {
+			return !match, true
+		}
+		return match, true
+	case fieldList:
+		match := matchAnyPatterns(n.matcher, n.values, value.([]string))
+		if n.operator == "!=" {
+			return !match, true
+		}
+		return match, true
+	}
+	return false, true
+}
+
+func (n *expressionComparison) fields() []string {
+	return []string{n.field}
+}
+
+func (n *expressionComparison) String() string {
+	if n.operator == "in" {
+		values := make([]string, len(n.values))
+		for i, v := range n.values {
+			values[i] = quoteExpressionValue(v)
+		}
+		return n.field + " IN [" + strings.Join(values, ", ") + "]"
+	}
+	if expressionFields[n.field].kind == fieldBool && n.operator == "==" && n.values[0] == "true" {
+		return n.field
+	}
+	return n.field + " " + n.operator + " " + quoteExpressionValue(n.values[0])
+}
+
+func quoteExpressionValue(v string) string {
+	if v == "" || strings.ContainsAny(v, " \t()[],\"&|"+expressionOperatorCharacters) {
+		return strconv.Quote(v)
+	}
+	return v
+}
+
+func operandsFields(operands []expressionNode) []string {
+	var fields []string
+	for _, o := range operands {
+		for _, f := range o.fields() {
+			if !strslice.Contains(fields, f) {
+				fields = append(fields, f)
+			}
+		}
+	}
+	return fields
+}
+
+// ------------
+// parser
+
+type expressionParser struct {
+	expression string
+	tokens     []expressionToken
+	current    int
+}
+
+func (p *expressionParser) peek() expressionToken {
+	return p.tokens[p.current]
+}
+
+func (p *expressionParser) next() expressionToken {
+	t := p.tokens[p.current]
+	if t.kind != tokenEOF {
+		p.current++
+	}
+	return t
+}
+
+func (p *expressionParser) errorAt(t expressionToken, message string) error {
+	return &ExpressionError{Expression: p.expression, Position: t.position, Message: message}
+}
+
+func (p *expressionParser) parseOr() (expressionNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	operands := []expressionNode{left}
+	for p.peek().kind == tokenOr {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		operands = append(operands, right)
+	}
+	if len(operands) == 1 {
+		return left, nil
+	}
+	return &expressionOr{operands: operands}, nil
+}
+
+func (p *expressionParser) parseAnd() (expressionNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	operands := []expressionNode{left}
+	for p.peek().kind == tokenAnd {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		operands = append(operands, right)
+	}
+	if len(operands) == 1 {
+		return left, nil
+	}
+	return &expressionAnd{operands: operands}, nil
+}
+
+func (p *expressionParser) parseUnary() (expressionNode, error) {
+	if p.peek().kind == tokenNot {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &expressionNot{operand: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *expressionParser) parsePrimary() (expressionNode, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenLeftParenthesis:
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokenRightParenthesis {
+			return nil, p.errorAt(closing, "expected \")\" instead of "+closing.String())
+		}
+		return node, nil
+	case tokenWord:
+		return p.parseComparison(t)
+	default:
+		return nil, p.errorAt(t, "expected a field name or \"(\" instead of "+t.String())
+	}
+}
+
+func (p *expressionParser) parseComparison(fieldToken expressionToken) (expressionNode, error) {
+	name := strings.ToLower(fieldToken.value)
+	f, ok := expressionFields[name]
+	if !ok {
+		var known []string
+		for k := range expressionFields {
+			known = append(known, k)
+		}
+		sort.Strings(known)
+		return nil, p.errorAt(fieldToken, "unknown field "+fieldToken.String()+", acceptable fields: "+strings.Join(known, ", "))
+	}
+	comparison := &expressionComparison{field: name}
+
+	operatorToken := p.peek()
+	switch operatorToken.kind {
+	case tokenOperator:
+		p.next()
+		comparison.operator = operatorToken.value
+		if f.kind != fieldInt && comparison.operator != "==" && comparison.operator != "!=" {
+			return nil, p.errorAt(operatorToken, "operator "+operatorToken.String()+" can only be used with numbers")
+		}
+		valueToken := p.next()
+		if valueToken.kind != tokenWord && valueToken.kind != tokenString {
+			return nil, p.errorAt(valueToken, "expected a value instead of "+valueToken.String())
+		}
+		if err := p.checkValue(f, valueToken, comparison); err != nil {
+			return nil, err
+		}
+	case tokenIn:
+		p.next()
+		if f.kind == fieldBool {
+			return nil, p.errorAt(operatorToken, "operator \"in\" cannot be used with true/false fields")
+		}
+		comparison.operator = "in"
+		if opening := p.next(); opening.kind != tokenLeftBracket {
+			return nil, p.errorAt(opening, "expected \"[\" instead of "+opening.String())
+		}
+		for {
+			valueToken := p.next()
+			if valueToken.kind != tokenWord && valueToken.kind != tokenString {
+				return nil, p.errorAt(valueToken, "expected a value instead of "+valueToken.String())
+			}
+			if err := p.checkValue(f, valueToken, comparison); err != nil {
+				return nil, err
+			}
+			separator := p.next()
+			if separator.kind == tokenRightBracket {
+				break
+			}
+			if separator.kind != tokenComma {
+				return nil, p.errorAt(separator, "expected \",\" or \"]\" instead of "+separator.String())
+			}
+		}
+	default:
+		// a true/false field on its own is enough
+		if f.kind != fieldBool {
+			return nil, p.errorAt(operatorToken, "expected an operator after "+fieldToken.String()+" instead of "+operatorToken.String())
+		}
+		comparison.operator = "=="
+		comparison.values = []string{"true"}
+	}
+	if f.kind == fieldString || f.kind == fieldList {
+		// the values were checked above
+		comparison.matcher, _ = newFilterMatcher(comparison.values)
+	}
+	return comparison, nil
+}
+
+func (p *expressionParser) checkValue(f expressionField, t expressionToken, comparison *expressionComparison) error {
+	switch f.kind {
+	case fieldInt:
+		number, err := strconv.Atoi(t.value)
+		if err != nil {
+			return p.errorAt(t, "expected a number instead of "+t.String())
+		}
+		comparison.number = number
+	case fieldBool:
+		if _, err := strconv.ParseBool(t.value); err != nil {
+			return p.errorAt(t, "expected true or false instead of "+t.String())
+		}
+	case fieldString, fieldList:
+		pattern, err := compileFilterPattern(t.value)
+		if err != nil {
+			return p.errorAt(t, err.Error())
+		}
+		if len(f.knownValues) != 0 && pattern.mode == matchExact && !strslice.Contains(f.knownValues, t.value) {
+			return p.errorAt(t, "unknown value "+t.String()+", acceptable values: "+strings.Join(f.knownValues, ", "))
+		}
+	}
+	comparison.values = append(comparison.values, t.value)
+	return nil
+}
+
+// FilterExpression is a parsed filter expression.
+type FilterExpression struct {
+	root expressionNode
+}
+
+// ParseFilterExpression returns the parsed expression, or an ExpressionError pointing at the offending token.
+func ParseFilterExpression(expression string) (*FilterExpression, error) {
+	tokens, err := tokenizeExpression(expression)
+	if err != nil {
+		return nil, err
+	}
+	p := &expressionParser{expression: expression, tokens: tokens}
+	if p.peek().kind == tokenEOF {
+		return nil, p.errorAt(p.peek(), "empty expression")
+	}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, p.errorAt(t, "unexpected "+t.String())
+	}
+	return &FilterExpression{root: root}, nil
+}
+
+// Eval the expression against a release and its tracker metadata, which can be nil if it is not known yet.
+// The second value is false if the result cannot be known without tracker metadata.
+func (fe *FilterExpression) Eval(r *Release, info *TrackerMetadata) (bool, bool) {
+	return fe.root.eval(r, info)
+}
+
+// Values of the fields used in the expression, to explain a verdict.
+func (fe *FilterExpression) Values(r *Release, info *TrackerMetadata) string {
+	var values []string
+	for _, name := range fe.root.fields() {
+		value, known := expressionValue(name, r, info)
+		if !known {
+			continue
+		}
+		if list, isList := value.([]string); isList {
+			value = strings.Join(list, ", ")
+		}
+		values = append(values, fmt.Sprintf("%s: %v", name, value))
+	}
+	return strings.Join(values, "; ")
+}
+
+func (fe *FilterExpression) String() string {
+	return fe.root.String()
+}
+
+// Lines splits long expressions on their top-level OR for readability.
+func (fe *FilterExpression) Lines() []string {
+	or, isOr := fe.root.(*expressionOr)
+	if !isOr || len(fe.String()) <= 80 {
+		return []string{fe.String()}
+	}
+	lines := make([]string, len(or.operands))
+	for i, o := range or.operands {
+		line := o.String()
+		if _, isAnd := o.(*expressionAnd); isAnd {
+			line = "(" + line + ")"
+		}
+		if i != 0 {
+			line = "OR " + line
+		}
+		lines[i] = line
+	}
+	return lines
+}
@@ -0,0 +1,134 @@
+package varroa
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterExpressionParsing(t *testing.T) {
+	fmt.Println("+ Testing FilterExpression/parsing...")
+	check := assert.New(t)
+
+	valid := []struct {
+		expression string
+		expected   string
+	}{
+		{`format == FLAC`, `format == FLAC`},
+		{`format = FLAC and source == WEB`, `format == FLAC AND source == WEB`},
+		{`(format == FLAC && quality == "24bit Lossless" && source == WEB) || (format == FLAC AND quality == Lossless AND source == CD AND log_score >= 100)`, `(format == FLAC AND quality == "24bit Lossless" AND source == WEB) OR (format == FLAC AND quality == Lossless AND source == CD AND log_score >= 100)`},
+		{`not scene and has_log`, `NOT scene AND has_log`},
+		{`!(tags in [jazz, "free jazz"] or year < 1970)`, `NOT (tags IN [jazz, "free jazz"] OR year < 1970)`},
+		{`year in [2018, 2019]`, `year IN [2018, 2019]`},
+	}
+	for _, v := range valid {
+		e, err := ParseFilterExpression(v.expression)
+		check.Nil(err, v.expression)
+		if err == nil {
+			check.Equal(v.expected, e.String())
+			// the pretty-printed expression can be parsed again
+			e2, err := ParseFilterExpression(e.String())
+			check.Nil(err)
+			check.Equal(e.String(), e2.String())
+		}
+	}
+
+	invalid := []struct {
+		expression string
+		position   int
+	}{
+		{``, 0},
+		{`format == FLAC and`, 18},
+		{`format == FLAKE`, 10},
+		{`colour == blue`, 0},
+		{`format == FLAC and (source == WEB`, 33},
+		{`format == FLAC) or source == WEB`, 14},
+		{`format > FLAC`, 7},
+		{`year >= nineteen`, 8},
+		{`year => 1990`, 5},
+		{`format == "FLAC`, 10},
+		{`has_log == maybe`, 11},
+		{`format == FLAC & source == WEB`, 15},
+		{`tags in [jazz, rock`, 19},
+		{`tags in jazz`, 8},
+		{`format FLAC`, 7},
+	}
+	for _, v := range invalid {
+		_, err := ParseFilterExpression(v.expression)
+		check.NotNil(err, v.expression)
+		expressionErr, ok := err.(*ExpressionError)
+		check.True(ok)
+		if ok {
+			check.Equal(v.position, expressionErr.Position, v.expression+": "+err.Error())
+		}
+	}
+
+	// long expressions are split on their top-level OR
+	e, err := ParseFilterExpression(valid[2].expression)
+	check.Nil(err)
+	check.Equal([]string{`(format == FLAC AND quality == "24bit Lossless" AND source == WEB)`, `OR (format == FLAC AND quality == Lossless AND source == CD AND log_score >= 100)`}, e.Lines())
+}
+
+func TestFilterExpressionEval(t *testing.T) {
+	fmt.Println("+ Testing FilterExpression/eval...")
+	check := assert.New(t)
+
+	web := &Release{Format: "FLAC", Quality: "24bit Lossless", Source: "WEB", Tags: []string{"jazz", "free.jazz"}, Year: 2018}
+	cd := &Release{Format: "FLAC", Quality: "Lossless", Source: "CD", HasLog: true, LogScore: logScoreNotInAnnounce, Year: 1972}
+	mp3 := &Release{Format: "MP3", Quality: "320", Source: "WEB", IsScene: true, Year: 2018}
+	perfect := &TrackerMetadata{LogScore: 100, RecordLabel: "Blue Note", Artists: []TrackerMetadataArtist{{Name: "a"}}}
+	imperfect := &TrackerMetadata{LogScore: 80, RecordLabel: "Impulse!", Artists: []TrackerMetadataArtist{{Name: "b"}}}
+
+	e, err := ParseFilterExpression(`(format == FLAC and quality == "24bit Lossless" and source == WEB) or (format == FLAC and quality == Lossless and source == CD and log_score >= 100)`)
+	check.Nil(err)
+	result, known := e.Eval(web, nil)
+	check.True(result)
+	check.True(known)
+	// log score is not in the announce, the tracker metadata is needed
+	_, known = e.Eval(cd, nil)
+	check.False(known)
+	result, known = e.Eval(cd, perfect)
+	check.True(result)
+	check.True(known)
+	result, _ = e.Eval(cd, imperfect)
+	check.False(result)
+	result, known = e.Eval(mp3, nil)
+	check.False(result)
+	check.True(known)
+
+	e, err = ParseFilterExpression(`not scene and tags in [r/^free, blues] and record_label != "Impulse!"`)
+	check.Nil(err)
+	_, known = e.Eval(web, nil)
+	check.False(known)
+	result, _ = e.Eval(web, perfect)
+	check.True(result)
+	result, _ = e.Eval(web, imperfect)
+	check.False(result)
+	// known to be false even without metadata
+	result, known = e.Eval(mp3, nil)
+	check.False(result)
+	check.True(known)
+	check.Equal("scene: true; tags: ; record_label: Blue Note", e.Values(mp3, perfect))
+
+	// through filters
+	f := &ConfigFilter{Name: "expr", Expression: `artist == a or year < 1980`}
+	check.Nil(f.check())
+	check.True(web.Satisfies(f).Accepted())
+	check.True(web.HasCompatibleTrackerInfo(f, []string{}, perfect).Accepted())
+	v := web.HasCompatibleTrackerInfo(f, []string{}, imperfect)
+	check.False(v.Accepted())
+	check.Equal(CriterionExpression, v.Criterion)
+	check.Equal("artist == a OR year < 1980", v.Expected)
+	check.Equal("artist: b; year: 2018", v.Actual)
+	check.True(cd.HasCompatibleTrackerInfo(f, []string{}, imperfect).Accepted())
+
+	f = &ConfigFilter{Name: "expr", Format: []string{"FLAC"}, Expression: `source == WEB`}
+	check.Nil(f.check())
+	check.True(web.Satisfies(f).Accepted())
+	check.Equal(CriterionExpression, cd.Satisfies(f).Criterion)
+	check.Equal(CriterionFormat, mp3.Satisfies(f).Criterion)
+
+	f = &ConfigFilter{Name: "expr", Expression: `source == WEB and`}
+	check.NotNil(f.check())
+}
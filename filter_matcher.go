@@ -0,0 +1,217 @@
+package varroa
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+	"gitlab.com/catastrophic/assistance/logthis"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	matchExact = iota
+	matchRegExp
+	matchExcludeRegExp
+	matchFoldedRegExp
+	matchFuzzy
+)
+
+// filterPattern is one compiled filter value.
+type filterPattern struct {
+	mode  int
+	value string
+	rx    *regexp.Regexp
+}
+
+// compileFilterPattern parses the match mode of a filter value:
+//   - "r/" and "xr/": regular expression to include or exclude, as typed
+//   - "re:": case and diacritics-insensitive regular expression
+//   - "fuzzy:": tolerates case, diacritics, punctuation, a leading or trailing "The", and a few typos
+//   - anything else must be identical, after Unicode normalisation.
+func compileFilterPattern(pattern string) (filterPattern, error) {
+	var err error
+	p := filterPattern{mode: matchExact, value: norm.NFC.String(pattern)}
+	switch {
+	case strings.HasPrefix(pattern, filterRegExpPrefix):
+		p.mode = matchRegExp
+		p.rx, err = regexp.Compile(strings.TrimPrefix(pattern, filterRegExpPrefix))
+	case strings.HasPrefix(pattern, filterExcludeRegExpPrefix):
+		p.mode = matchExcludeRegExp
+		p.rx, err = regexp.Compile(strings.TrimPrefix(pattern, filterExcludeRegExpPrefix))
+	case strings.HasPrefix(pattern, filterFoldedRegExpPrefix):
+		p.mode = matchFoldedRegExp
+		p.rx, err = regexp.Compile("(?i)" + removeDiacritics(strings.TrimPrefix(pattern, filterFoldedRegExpPrefix)))
+	case strings.HasPrefix(pattern, filterFuzzyPrefix):
+		p.mode = matchFuzzy
+		p.value = foldForFuzzyMatch(strings.TrimPrefix(pattern, filterFuzzyPrefix))
+		if p.value == "" {
+			err = errors.New("empty fuzzy pattern")
+		}
+	}
+	if err != nil {
+		return p, errors.Wrap(err, "invalid pattern "+pattern)
+	}
+	return p, nil
+}
+
+func (p filterPattern) match(a string) bool {
+	switch p.mode {
+	case matchRegExp, matchExcludeRegExp:
+		return p.rx.MatchString(a)
+	case matchFoldedRegExp:
+		return p.rx.MatchString(removeDiacritics(a))
+	case matchFuzzy:
+		folded := foldForFuzzyMatch(a)
+		return folded == p.value || levenshtein(folded, p.value) <= len([]rune(p.value))/fuzzyCharactersPerTypo
+	default:
+		return norm.NFC.String(a) == p.value
+	}
+}
+
+// filterMatcher checks strings against the values of a filter list.
+type filterMatcher struct {
+	patterns    []filterPattern
+	hasIncludes bool
+	hasExcludes bool
+}
+
+// newFilterMatcher compiles all patterns. Invalid patterns are returned in the error, and left out of the matcher.
+func newFilterMatcher(patterns []string) (*filterMatcher, error) {
+	var firstErr error
+	fm := &filterMatcher{}
+	for _, pattern := range patterns {
+		if strings.HasPrefix(pattern, filterExcludeRegExpPrefix) {
+			fm.hasExcludes = true
+		} else {
+			fm.hasIncludes = true
+		}
+		p, err := compileFilterPattern(pattern)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		fm.patterns = append(fm.patterns, p)
+	}
+	return fm, firstErr
+}
+
+// Match returns true if a matches at least one of the included patterns and none of the excluded patterns.
+func (fm *filterMatcher) Match(a string) bool {
+	// if no patterns, no match by default
+	if !fm.hasIncludes && !fm.hasExcludes {
+		return false
+	}
+	// match if we only have excludes and no source string
+	if a == "" {
+		return !fm.hasIncludes
+	}
+	var matchFound bool
+	for _, p := range fm.patterns {
+		if !p.match(a) {
+			continue
+		}
+		if p.mode == matchExcludeRegExp {
+			return false // a is excluded
+		}
+		if !fm.hasExcludes {
+			return true // if only includes, one match is enough
+		}
+		matchFound = true // found match, but wait to see if it should be excluded
+	}
+	if fm.hasExcludes && !fm.hasIncludes {
+		// if we're here, no excludes were triggered and that's the only thing that counts
+		return true
+	}
+	return matchFound
+}
+
+// matchPatterns uses the matcher compiled by ConfigFilter.prepare(), or compiles the patterns if the filter was not prepared.
+func matchPatterns(fm *filterMatcher, patterns []string, a string) bool {
+	if fm == nil {
+		return MatchInSlice(a, patterns)
+	}
+	return fm.Match(a)
+}
+
+// matchAnyPatterns tells if one of the values matches, using the matcher compiled by ConfigFilter.prepare(), or
+// compiling the patterns once if the filter was not prepared.
+func matchAnyPatterns(fm *filterMatcher, patterns []string, values []string) bool {
+	if fm == nil {
+		var err error
+		if fm, err = newFilterMatcher(patterns); err != nil {
+			logthis.Error(err, logthis.VERBOSE)
+		}
+	}
+	for _, v := range values {
+		if fm.Match(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// matcherAt returns the i-th matcher compiled by ConfigFilter.prepare(), or nil if the filter was not prepared.
+func matcherAt(matchers []*filterMatcher, i int) *filterMatcher {
+	if i >= len(matchers) {
+		return nil
+	}
+	return matchers[i]
+}
+
+// removeDiacritics decomposes the string and drops its combining marks: "Aníkúlápó" becomes "Anikulapo".
+func removeDiacritics(a string) string {
+	return norm.NFC.String(strings.Map(func(r rune) rune {
+		if unicode.Is(unicode.Mn, r) {
+			return -1
+		}
+		return r
+	}, norm.NFKD.String(a)))
+}
+
+// foldForFuzzyMatch only keeps lowercase letters and digits, separated by single spaces, without a leading or trailing "the".
+func foldForFuzzyMatch(a string) string {
+	a = strings.ToLower(removeDiacritics(a))
+	a = strings.Replace(a, "&", " and ", -1)
+	words := strings.FieldsFunc(a, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) > 1 && words[0] == "the" {
+		words = words[1:]
+	} else if len(words) > 1 && words[len(words)-1] == "the" {
+		words = words[:len(words)-1]
+	}
+	return strings.Join(words, " ")
+}
+
+// levenshtein returns the edit distance between two strings, in runes.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(previous[j]+1, minInt(current[j-1]+1, previous[j-1]+cost))
+		}
+		previous, current = current, previous
+	}
+	return previous[len(rb)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,164 @@
+package varroa
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	activeHoursPattern = `^(\d{1,2})(?::(\d{2}))?-(\d{1,2})(?::(\d{2}))?$`
+	activeUntilDate    = "2006-01-02"
+	activeUntilTime    = "2006-01-02 15:04"
+)
+
+var activeHoursRegexp = regexp.MustCompile(activeHoursPattern)
+
+// hoursWindow is a daily time window, in minutes since midnight. It wraps around midnight if end < start.
+type hoursWindow struct {
+	start int
+	end   int
+}
+
+func (w hoursWindow) contains(t time.Time) bool {
+	minutes := t.Hour()*60 + t.Minute()
+	if w.start <= w.end {
+		return minutes >= w.start && minutes < w.end
+	}
+	return minutes >= w.start || minutes < w.end
+}
+
+func parseHoursWindow(window string) (hoursWindow, error) {
+	var w hoursWindow
+	hits := activeHoursRegexp.FindStringSubmatch(strings.TrimSpace(window))
+	if hits == nil {
+		return w, errors.New("invalid active hours " + window + ", expected HH:MM-HH:MM")
+	}
+	minutes := func(hours, minutes string) (int, error) {
+		h, _ := strconv.Atoi(hours)
+		m := 0
+		if minutes != "" {
+			m, _ = strconv.Atoi(minutes)
+		}
+		if h > 24 || m > 59 || (h == 24 && m != 0) {
+			return 0, errors.New("invalid time in active hours " + window)
+		}
+		return h*60 + m, nil
+	}
+	var err error
+	if w.start, err = minutes(hits[1], hits[2]); err != nil {
+		return w, err
+	}
+	if w.end, err = minutes(hits[3], hits[4]); err != nil {
+		return w, err
+	}
+	if w.start == w.end {
+		return w, errors.New("empty active hours " + window)
+	}
+	return w, nil
+}
+
+func parseWeekday(day string) (time.Weekday, error) {
+	day = strings.ToLower(strings.TrimSpace(day))
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		name := strings.ToLower(d.String())
+		if day == name || day == name[:3] {
+			return d, nil
+		}
+	}
+	return time.Sunday, errors.New("invalid active day " + day + ", expected a day of the week")
+}
+
+func parseActiveUntil(date string) (time.Time, error) {
+	if t, err := time.ParseInLocation(activeUntilTime, date, time.Local); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation(activeUntilDate, date, time.Local)
+	if err != nil {
+		return t, errors.New("invalid active_until date " + date + ", expected YYYY-MM-DD or YYYY-MM-DD HH:MM")
+	}
+	// the filter stays active until the end of that day
+	return t.AddDate(0, 0, 1), nil
+}
+
+// prepareSchedule parses active_hours, active_days and active_until.
+func (cf *ConfigFilter) prepareSchedule() error {
+	cf.activeHours = nil
+	for _, h := range cf.ActiveHours {
+		w, err := parseHoursWindow(h)
+		if err != nil {
+			return err
+		}
+		cf.activeHours = append(cf.activeHours, w)
+	}
+	cf.activeDays = nil
+	for _, d := range cf.ActiveDays {
+		day, err := parseWeekday(d)
+		if err != nil {
+			return err
+		}
+		cf.activeDays = append(cf.activeDays, day)
+	}
+	cf.activeUntil = time.Time{}
+	if cf.ActiveUntil != "" {
+		until, err := parseActiveUntil(cf.ActiveUntil)
+		if err != nil {
+			return err
+		}
+		cf.activeUntil = until
+	}
+	return nil
+}
+
+// inactiveReason returns why the filter is not active at a given time, or an empty string if it is.
+// Hours and days are checked independently: a window overnight on a friday stops at midnight.
+func (cf *ConfigFilter) inactiveReason(t time.Time) string {
+	if !cf.activeUntil.IsZero() && !t.Before(cf.activeUntil) {
+		return "expired on " + cf.activeUntil.Format(activeUntilTime)
+	}
+	if len(cf.activeDays) != 0 {
+		var activeDay bool
+		for _, d := range cf.activeDays {
+			if t.Weekday() == d {
+				activeDay = true
+				break
+			}
+		}
+		if !activeDay {
+			return "not active on " + t.Weekday().String()
+		}
+	}
+	if len(cf.activeHours) != 0 {
+		var activeHour bool
+		for _, w := range cf.activeHours {
+			if w.contains(t) {
+				activeHour = true
+				break
+			}
+		}
+		if !activeHour {
+			return "outside active hours " + strings.Join(cf.ActiveHours, ", ")
+		}
+	}
+	return ""
+}
+
+// IsActive returns true if the filter is active at a given time.
+func (cf *ConfigFilter) IsActive(t time.Time) bool {
+	return cf.inactiveReason(t) == ""
+}
+
+// ActiveState describes whether the filter is active at a given time.
+func (cf *ConfigFilter) ActiveState(t time.Time) string {
+	if reason := cf.inactiveReason(t); reason != "" {
+		return fmt.Sprintf("inactive (%s)", reason)
+	}
+	if !cf.activeUntil.IsZero() {
+		return "active until " + cf.activeUntil.Format(activeUntilTime)
+	}
+	return "active"
+}
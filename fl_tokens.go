@@ -0,0 +1,62 @@
+package varroa
+
+import (
+	"fmt"
+
+	"github.com/dustin/go-humanize"
+	"gitlab.com/catastrophic/assistance/logthis"
+)
+
+// flTokenRefusal returns why the freeleech token rules of the filter do not allow using a token, or an empty string.
+// An unknown ratio (0) never satisfies a maximum ratio.
+func (cf *ConfigFilter) flTokenRefusal(size uint64, ratio float64, tokensLeft int) string {
+	if !cf.UseFLToken {
+		return "not enabled"
+	}
+	if tokensLeft <= cf.FLTokenReserve {
+		return fmt.Sprintf("%d token(s) left, keeping %d in reserve", tokensLeft, cf.FLTokenReserve)
+	}
+	if cf.FLTokenMinSizeMB != 0 && size < uint64(cf.FLTokenMinSizeMB)*1024*1024 {
+		return fmt.Sprintf("release size %s is below %dMB", humanize.IBytes(size), cf.FLTokenMinSizeMB)
+	}
+	if cf.FLTokenMaxRatio != 0 && (ratio == 0 || ratio >= cf.FLTokenMaxRatio) {
+		return fmt.Sprintf("ratio %.3f is not below %.3f", ratio, cf.FLTokenMaxRatio)
+	}
+	return ""
+}
+
+// flTokensLeft for a tracker: the tokens made available in its autosnatch configuration, minus those already used.
+func flTokensLeft(conf *Config, stats *StatsDB, tracker string) (int, int) {
+	autosnatchConfig, err := conf.GetAutosnatch(tracker)
+	if err != nil {
+		return 0, 0
+	}
+	used, err := stats.FLTokensUsed(tracker)
+	if err != nil {
+		logthis.Error(err, logthis.NORMAL)
+		// not taking any chances
+		return used, 0
+	}
+	if used >= autosnatchConfig.FLTokens {
+		return used, 0
+	}
+	return used, autosnatchConfig.FLTokens - used
+}
+
+// useFLToken decides if a freeleech token is spent on a queued release, following the rules of the filter that accepted it.
+func useFLToken(conf *Config, stats *StatsDB, entry *QueuedSnatch, info *TrackerMetadata) bool {
+	filter, err := conf.GetFilter(entry.Filter)
+	if err != nil || !filter.UseFLToken {
+		return false
+	}
+	var ratio float64
+	if last, err := stats.GetLastCollected(entry.Tracker, 1); err == nil && len(last) != 0 {
+		ratio = last[0].Ratio
+	}
+	_, left := flTokensLeft(conf, stats, entry.Tracker)
+	if reason := filter.flTokenRefusal(info.Size, ratio, left); reason != "" {
+		logthis.Info(fmt.Sprintf("%s: not using a freeleech token for %s: %s.", filter.Name, entry.Release.ShortString(), reason), logthis.VERBOSE)
+		return false
+	}
+	return true
+}
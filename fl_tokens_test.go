@@ -0,0 +1,67 @@
+package varroa
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFLTokenRules(t *testing.T) {
+	fmt.Println("+ Testing FL tokens/rules...")
+	check := assert.New(t)
+
+	mb := uint64(1024 * 1024)
+	filter := &ConfigFilter{Name: "f", UseFLToken: true, FLTokenMinSizeMB: 500, FLTokenMaxRatio: 1.5, FLTokenReserve: 2}
+	for _, c := range []struct {
+		size       uint64
+		ratio      float64
+		tokensLeft int
+		allowed    bool
+	}{
+		{600 * mb, 1.2, 3, true},
+		{500 * mb, 1.49, 10, true},
+		{499 * mb, 1.2, 3, false},
+		{600 * mb, 1.5, 3, false},
+		{600 * mb, 0, 3, false},
+		{600 * mb, 1.2, 2, false},
+		{600 * mb, 1.2, 0, false},
+	} {
+		reason := filter.flTokenRefusal(c.size, c.ratio, c.tokensLeft)
+		check.Equal(c.allowed, reason == "", reason)
+	}
+	check.NotEqual("", (&ConfigFilter{Name: "f"}).flTokenRefusal(600*mb, 1.2, 3))
+	check.Equal("", (&ConfigFilter{Name: "f", UseFLToken: true}).flTokenRefusal(1, 0, 1))
+
+	// tokens used are counted in the history
+	dbPath := filepath.Join("test", "test_fltokens.db")
+	defer os.Remove(dbPath)
+	db, err := NewDatabase(dbPath)
+	check.Nil(err)
+	defer db.Close()
+	stats := &StatsDB{db: db}
+	check.Nil(stats.init())
+	check.Nil(stats.AddSnatch(Release{Tracker: "blue", Filter: "f", FLToken: true}))
+	check.Nil(stats.AddSnatch(Release{Tracker: "blue", Filter: "f"}))
+	check.Nil(stats.AddSnatch(Release{Tracker: "blue", Filter: manualSnatchFilterName, FLToken: true}))
+	check.Nil(stats.AddSnatch(Release{Tracker: "purple", Filter: "f", FLToken: true}))
+
+	conf := &Config{Autosnatch: []*ConfigAutosnatch{{Tracker: "blue", FLTokens: 5}, {Tracker: "purple"}}, Filters: []*ConfigFilter{filter}}
+	used, left := flTokensLeft(conf, stats, "blue")
+	check.Equal(2, used)
+	check.Equal(3, left)
+	used, left = flTokensLeft(conf, stats, "purple")
+	check.Equal(1, used)
+	check.Equal(0, left)
+
+	// the ratio comes from the last collected stats
+	entry := &QueuedSnatch{Tracker: "blue", Filter: "f", Release: Release{Tracker: "blue", Artists: []string{"a"}}}
+	info := &TrackerMetadata{Size: 600 * mb}
+	check.False(useFLToken(conf, stats, entry, info))
+	check.Nil(stats.db.DB.Save(&StatsEntry{Tracker: "blue", Ratio: 1.2, Collected: true, TimestampUnix: 1}))
+	check.True(useFLToken(conf, stats, entry, info))
+	entry.Filter = "unknown"
+	check.False(useFLToken(conf, stats, entry, info))
+}
@@ -4,6 +4,7 @@ require (
 	bazil.org/fuse v0.0.0-20180421153158-65cc252bf669
 	github.com/DataDog/zstd v1.3.5 // indirect
 	github.com/Sereal/Sereal v0.0.0-20181211220259-509a78ddbda3 // indirect
+	github.com/anacrolix/torrent v1.9.0
 	github.com/asdine/storm v2.1.2+incompatible
 	github.com/blend/go-sdk v1.20220411.3 // indirect
 	github.com/briandowns/spinner v0.0.0-20181029155426-195c31b675a7
@@ -38,10 +39,11 @@ require (
 	github.com/wcharczuk/go-chart v2.0.1+incompatible
 	github.com/xi2/xz v0.0.0-20171230120015-48954b6210f8 // indirect
 	gitlab.com/catastrophic/assistance v0.32.1
-	gitlab.com/catastrophic/go-ircevent v0.1.0
 	gitlab.com/passelecasque/obstruction v0.15.10
 	go.etcd.io/bbolt v1.3.4 // indirect
 	golang.org/x/net v0.0.0-20211216030914-fe4d6282115f
+	golang.org/x/sys v0.0.0-20211205182925-97ca703d548d
+	golang.org/x/text v0.3.7
 	gopkg.in/yaml.v2 v2.4.0
 )
 
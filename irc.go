@@ -3,141 +3,99 @@ package varroa
 import (
 	"crypto/tls"
 	"fmt"
-	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
 	"gitlab.com/catastrophic/assistance/logthis"
-	"gitlab.com/catastrophic/assistance/strslice"
-	irc "gitlab.com/catastrophic/go-ircevent"
 	"gitlab.com/passelecasque/obstruction/tracker"
+	irc "gitlab.com/passelecasque/varroa/internal/ircevent"
 )
 
 const (
-	announcePattern            = `(.*?) - (.*) \[([\d]{4})\] \[(Album|Soundtrack|Compilation|Anthology|EP|Single|Live album|Remix|Bootleg|Interview|Mixtape|Demo|Concert Recording|DJ Mix|Unknown)\] - (FLAC|MP3|AAC|DSD) / (Lossless|24bit Lossless|V0 \(VBR\)|V2 \(VBR\)|320|256|DSD64|DSD128|DSD256|DSD512) /( (Log) /)?( (-*\d+)\% /)?( (Cue) /)? (CD|DVD|Vinyl|Soundboard|SACD|DAT|Cassette|WEB|Blu-Ray) (/ (Scene) )?- (http[s]?://[\w\./:]*torrents\.php\?id=[\d]*) / (http[s]?://[\w\./:]*torrents\.php\?action=download&id=[\d]*) - ([\w\., ]*)`
-	alternativeAnnouncePattern = `(.*?) - (.*) \[([\d]{4})\] \[(Album|Soundtrack|Compilation|Anthology|EP|Single|Live album|Remix|Bootleg|Interview|Mixtape|Demo|Concert Recording|DJ Mix|Unknown)\] - (FLAC|MP3|AAC|DSD) / (Lossless|24bit Lossless|V0 \(VBR\)|V2 \(VBR\)|320|256|DSD64|DSD128|DSD256|DSD512) /( (Log.*?) /)?( (-*\d+)\% /)?( (Cue) /)? (CD|DVD|Vinyl|Soundboard|SACD|DAT|Cassette|WEB|Blu-Ray) (/ (Scene) )?- ([\w\., ]*) - (http[s]?://[\w\./:]*torrents\.php\?id=[\d]*) / (http[s]?://[\w\./:]*torrents\.php\?action=download&id=[\d]*)`
+	announcePattern            = `(?P<artist>.*?) - (?P<title>.*) \[(?P<year>[\d]{4})\] \[(?P<release_type>Album|Soundtrack|Compilation|Anthology|EP|Single|Live album|Remix|Bootleg|Interview|Mixtape|Demo|Concert Recording|DJ Mix|Unknown)\] - (?P<format>FLAC|MP3|AAC|DSD) / (?P<quality>Lossless|24bit Lossless|V0 \(VBR\)|V2 \(VBR\)|320|256|DSD64|DSD128|DSD256|DSD512) /( (?P<log>Log) /)?( (?P<log_score>-*\d+)\% /)?( (?P<cue>Cue) /)? (?P<source>CD|DVD|Vinyl|Soundboard|SACD|DAT|Cassette|WEB|Blu-Ray) (/ (?P<scene>Scene) )?- (?P<group_url>http[s]?://[\w\./:]*torrents\.php\?id=[\d]*) / (?P<torrent_url>http[s]?://[\w\./:]*torrents\.php\?action=download&id=[\d]*) - (?P<tags>[\w\., ]*)`
+	alternativeAnnouncePattern = `(?P<artist>.*?) - (?P<title>.*) \[(?P<year>[\d]{4})\] \[(?P<release_type>Album|Soundtrack|Compilation|Anthology|EP|Single|Live album|Remix|Bootleg|Interview|Mixtape|Demo|Concert Recording|DJ Mix|Unknown)\] - (?P<format>FLAC|MP3|AAC|DSD) / (?P<quality>Lossless|24bit Lossless|V0 \(VBR\)|V2 \(VBR\)|320|256|DSD64|DSD128|DSD256|DSD512) /( (?P<log>Log.*?) /)?( (?P<log_score>-*\d+)\% /)?( (?P<cue>Cue) /)? (?P<source>CD|DVD|Vinyl|Soundboard|SACD|DAT|Cassette|WEB|Blu-Ray) (/ (?P<scene>Scene) )?- (?P<tags>[\w\., ]*) - (?P<group_url>http[s]?://[\w\./:]*torrents\.php\?id=[\d]*) / (?P<torrent_url>http[s]?://[\w\./:]*torrents\.php\?action=download&id=[\d]*)`
 )
 
-func analyzeAnnounce(announced string, e *Environment, t *tracker.Gazelle, autosnatchConfig *ConfigAutosnatch) error {
-	stats, err := NewStatsDB(filepath.Join(StatsDir, DefaultHistoryDB))
-	if err != nil {
-		return errors.Wrap(err, "could not access the stats database")
-	}
+// named capture groups of the announce patterns, and the Release fields they describe.
+const (
+	announceArtist      = "artist"
+	announceTitle       = "title"
+	announceYear        = "year"
+	announceReleaseType = "release_type"
+	announceFormat      = "format"
+	announceQuality     = "quality"
+	announceLog         = "log"
+	announceLogScore    = "log_score"
+	announceCue         = "cue"
+	announceSource      = "source"
+	announceScene       = "scene"
+	announceGroupURL    = "group_url"
+	announceTorrentURL  = "torrent_url"
+	announceTorrentID   = "torrent_id"
+	announceTags        = "tags"
+)
 
-	// getting information, trying the alternative pattern if the main one fails
-	r := regexp.MustCompile(announcePattern)
-	r2 := regexp.MustCompile(alternativeAnnouncePattern)
-	alternative := false
-	hits := r.FindAllStringSubmatch(announced, -1)
-	if len(hits) == 0 {
-		hits = r2.FindAllStringSubmatch(announced, -1)
-		alternative = true
+var (
+	// announceGroups can be used in announce patterns; announceRequiredGroups must be.
+	announceGroups         = []string{announceArtist, announceTitle, announceYear, announceReleaseType, announceFormat, announceQuality, announceLog, announceLogScore, announceCue, announceSource, announceScene, announceGroupURL, announceTorrentURL, announceTorrentID, announceTags}
+	announceRequiredGroups = []string{announceArtist, announceTitle, announceReleaseType, announceFormat, announceQuality, announceSource, announceTorrentURL}
+
+	// defaultAnnounceFormats are used for trackers without announce_formats in their autosnatch configuration.
+	defaultAnnounceFormats = []*ConfigAnnounceFormat{
+		{
+			Pattern: announcePattern,
+			Samples: []string{"Some fellow & Aníkúlápó - first / second [1999] [Anthology] - FLAC / Lossless / Log / 100% / Cue / CD - https://mysterious.address/torrents.php?id=271487 / https://mysterious.address/torrents.php?action=download&id=923266 - soul, funk, afrobeat, world.music"},
+			regexp:  regexp.MustCompile(announcePattern),
+		},
+		{
+			Pattern: alternativeAnnouncePattern,
+			Samples: []string{"Some fellow - first / second [1999] [Album] - FLAC / Lossless / Log (100%) / Cue / CD / Scene - soul, funk - https://mysterious.address/torrents.php?id=271487 / https://mysterious.address/torrents.php?action=download&id=923266"},
+			regexp:  regexp.MustCompile(alternativeAnnouncePattern),
+		},
 	}
+)
 
-	if len(hits) != 0 {
-		release, err := NewRelease(t.Name, hits[0], alternative)
-		if err != nil {
-			return err
-		}
-		logthis.Info(release.String(), logthis.VERBOSEST)
+// announceCleaner removes color codes and other useless things from announces.
+var announceCleaner = strings.NewReplacer("\x02TORRENT:\x02 ", "", "\x0303", "", "\x0304", "", "\x0310", "", "\x0312", "", "\x03", "")
 
-		// if satisfies a filter, download
-		var downloadedInfo bool
-		var downloadedTorrent bool
-		info := &TrackerMetadata{}
-		var torrentGroupInfo *tracker.GazelleTorrentGroup
-		for _, filter := range e.config.Filters {
-			// checking if filter is specifically set for this tracker (if nothing is indicated, all trackers match)
-			if len(filter.Tracker) != 0 && !strslice.Contains(filter.Tracker, t.Name) {
-				logthis.Info(fmt.Sprintf(infoFilterIgnoredForTracker, filter.Name, t.Name), logthis.VERBOSE)
-				continue
+// parseAnnounce returns the Release described by an announce, using the first format that matches it.
+// If the announce does not describe a music release, it returns nil.
+func parseAnnounce(trackerName, announced string, formats []*ConfigAnnounceFormat) (*Release, error) {
+	for _, f := range formats {
+		if fields := f.match(announced); fields != nil {
+			release, err := NewRelease(trackerName, fields)
+			if err != nil {
+				return nil, err
 			}
-			// checking if a filter is triggered
-			if release.Satisfies(filter) {
-				// getting torrent info
-				if !downloadedInfo {
-					if err := info.LoadFromID(t, release.TorrentID); err != nil {
-						return errors.Wrap(err, errorCouldNotGetTorrentInfo)
-					}
-					downloadedInfo = true
-					logthis.Info(info.TextDescription(false), logthis.VERBOSE)
-				}
-				// else check other criteria
-				if release.HasCompatibleTrackerInfo(filter, autosnatchConfig.BlacklistedUploaders, info) {
-					release.Filter = filter.Name
-
-					// checking if duplicate
-					if !filter.AllowDuplicates && stats.AlreadySnatchedDuplicate(release) {
-						logthis.Info(filter.Name+": "+infoNotSnatchingDuplicate, logthis.VERBOSE)
-						continue
-					}
-					// checking if a torrent from the same group has already been downloaded
-					if filter.UniqueInGroup {
-						// if varroa knows about the group, rejecting
-						if stats.AlreadySnatchedFromGroup(release) {
-							logthis.Info(filter.Name+": "+infoNotSnatchingUniqueInGroup, logthis.VERBOSE)
-							continue
-						}
-						// else, getting the torrentgroup to check if the site itself know about past snatches
-						if torrentGroupInfo == nil {
-							torrentGroupInfo, err = t.GetTorrentGroup(info.GroupID)
-							if err != nil {
-								logthis.Error(errors.Wrap(err, "error retrieving torrent group info"), logthis.NORMAL)
-							} else {
-								if torrentGroupInfo.AlreadySnatched() {
-									logthis.Info(filter.Name+": "+infoNotSnatchingUniqueInGroup, logthis.VERBOSE)
-									continue
-								}
-							}
-						}
-					}
-					logthis.Info(" -> "+release.ShortString()+" triggered filter "+filter.Name+", snatching.", logthis.NORMAL)
-					// move to relevant watch directory
-					destination := e.config.General.WatchDir
-					if filter.WatchDir != "" {
-						destination = filter.WatchDir
-					}
-					if err := t.Download(info.ID, false, destination, release.TorrentFile()); err != nil {
-						return errors.Wrap(err, errorDownloadingTorrent)
-					}
-					downloadedTorrent = true
-					// adding to history
-					if err := stats.AddSnatch(*release); err != nil {
-						logthis.Error(errors.Wrap(err, errorAddingToHistory), logthis.NORMAL)
-					}
-					// send notification
-					if err := Notify(filter.Name+": Snatched "+release.ShortString(), t.Name, "info", e); err != nil {
-						logthis.Error(err, logthis.NORMAL)
-					}
-					// save metadata once the download folder is created
-					if e.config.General.AutomaticMetadataRetrieval {
-						go info.SaveFromTracker(filepath.Join(e.config.General.DownloadDir, info.FolderName), t)
-					}
-					// no need to consider other filters
-					break
-				}
+			if release.TorrentID == "" {
+				return nil, errors.New("no torrent ID found in " + fields[announceTorrentURL])
 			}
+			return release, nil
 		}
-		if !downloadedTorrent {
-			logthis.Info(fmt.Sprintf(infoNotInteresting, release.ShortString()), logthis.VERBOSE)
-		}
-		return nil
 	}
-	logthis.Info(infoNotMusic, logthis.VERBOSE)
-	return nil
+	return nil, nil
 }
 
-func ircHandler(e *Environment, t *tracker.Gazelle) {
-	// general replacer to remove color codes and other useless things from announces.
-	r := strings.NewReplacer("\x02TORRENT:\x02 ", "", "\x0303", "", "\x0304", "", "\x0310", "", "\x0312", "", "\x03", "")
-
-	autosnatchConfig, err := e.config.GetAutosnatch(t.Name)
+// analyzeAnnounce parses an IRC announce and sends the release it describes to the filters.
+func analyzeAnnounce(announced string, e *Environment, t *tracker.Gazelle, autosnatchConfig *ConfigAutosnatch) error {
+	release, err := parseAnnounce(t.Name, announced, autosnatchConfig.announceFormats)
 	if err != nil {
-		logthis.Info("Cannot find autosnatch configuration for tracker "+t.Name, logthis.NORMAL)
-		return
+		return err
 	}
+	if release == nil {
+		logthis.Info(infoNotMusic, logthis.VERBOSE)
+		return nil
+	}
+	return analyzeRelease(release, e, t)
+}
+
+// newIRCConnection prepares a connection to the announce channel of a tracker, reporting its activity to the supervisor.
+// Once registered, the bot identifies with NickServ and asks the announcer to let it in the announce channel.
+func newIRCConnection(e *Environment, t *tracker.Gazelle, s *ircSupervisor) *irc.Connection {
+	autosnatchConfig := s.config
 	var IRCClient *irc.Connection
 
 	if autosnatchConfig.UseZNC {
@@ -156,11 +114,46 @@ func ircHandler(e *Environment, t *tracker.Gazelle) {
 	}
 	IRCClient.UseTLS = autosnatchConfig.IRCSSL
 	IRCClient.TLSConfig = &tls.Config{InsecureSkipVerify: autosnatchConfig.IRCSSLSkipVerify}
+	// the announcer is only asked for an invitation once authenticated
+	var invitation sync.Once
+	var awaitingNickServ bool
+	askForInvitation := func() {
+		invitation.Do(func() {
+			askAnnouncer(IRCClient, t, autosnatchConfig)
+		})
+	}
 	IRCClient.AddCallback("001", func(_ *irc.Event) {
-		IRCClient.Privmsg("NickServ", "IDENTIFY "+autosnatchConfig.NickservPassword)
-		IRCClient.Privmsg(autosnatchConfig.Announcer, fmt.Sprintf("enter %s %s %s", autosnatchConfig.AnnounceChannel, t.User, autosnatchConfig.IRCKey))
-		if e.config.ircNotifsConfigured {
-			IRCClient.Privmsg(e.config.Notifications.Irc.User, "varroa bot, connected.")
+		s.registered(IRCClient)
+		if identifyWithNickServ(IRCClient, autosnatchConfig) {
+			awaitingNickServ = true
+			time.AfterFunc(ircIdentifyTimeout, func() {
+				if IRCClient.Connected() {
+					askForInvitation()
+				}
+			})
+		} else {
+			askForInvitation()
+		}
+		if conf := e.Config(); conf.ircNotifsConfigured {
+			IRCClient.Privmsg(conf.Notifications.Irc.User, "varroa bot, connected.")
+		}
+	})
+	// SASL also logs in before registering, then the bot does not wait for NickServ
+	IRCClient.AddCallback(rplLoggedIn, func(_ *irc.Event) {
+		if awaitingNickServ {
+			askForInvitation()
+		}
+	})
+	IRCClient.AddCallback("NOTICE", func(ev *irc.Event) {
+		if !awaitingNickServ || !strings.EqualFold(ev.Nick, "NickServ") {
+			return
+		}
+		confirmed, rejected := nickServAnswer(ev.Message())
+		if rejected {
+			logthis.Info("NickServ rejected the identification of "+autosnatchConfig.BotName+" on "+t.Name+": "+ev.Message(), logthis.NORMAL)
+		}
+		if confirmed || rejected {
+			askForInvitation()
 		}
 	})
 	IRCClient.AddCallback("PRIVMSG", func(ev *irc.Event) {
@@ -169,7 +162,7 @@ func ircHandler(e *Environment, t *tracker.Gazelle) {
 		}
 		if strings.HasPrefix(ev.Message(), announcerBadCredentials) {
 			logthis.Info("error connecting to IRC: IRC key rejected by "+autosnatchConfig.Announcer+"; disconnecting.", logthis.NORMAL)
-			IRCClient.Quit()
+			s.rejected()
 			return
 		}
 		// e.Arguments's first element is the message's recipient, the second is the actual message
@@ -181,26 +174,36 @@ func ircHandler(e *Environment, t *tracker.Gazelle) {
 			IRCClient.Join(autosnatchConfig.AnnounceChannel)
 		case strings.ToLower(autosnatchConfig.AnnounceChannel):
 			// if sent to the announce channel, it's a new release
-			e.mutex.RLock()
-			canSnatch := !autosnatchConfig.disabledAutosnatching
-			e.mutex.RUnlock()
-			if canSnatch {
-				announced := r.Replace(ev.Message())
+			s.announced()
+			if e.autosnatchingEnabled(t.Name) {
+				announced := announceCleaner.Replace(ev.Message())
 				logthis.Info("++ Announced on "+t.Name+": "+announced, logthis.VERBOSE)
-				if err = analyzeAnnounce(announced, e, t, autosnatchConfig); err != nil {
+				if err := analyzeAnnounce(announced, e, t, autosnatchConfig); err != nil {
 					logthis.Error(errors.Wrap(err, errorDealingWithAnnounce), logthis.VERBOSE)
 					return
 				}
 			}
 		}
 	})
-	err = IRCClient.Connect(autosnatchConfig.IRCServer)
-	if err != nil {
-		logthis.Error(errors.Wrap(err, errorConnectingToIRC), logthis.NORMAL)
-		return
-	}
-	if e.config.ircNotifsConfigured && e.config.Notifications.Irc.Tracker == autosnatchConfig.Tracker {
-		e.ircClient = IRCClient
+	return IRCClient
+}
+
+// enterAnnounceChannel identifies with NickServ if necessary and asks the announcer for an invitation to the announce channel.
+func enterAnnounceChannel(client *irc.Connection, t *tracker.Gazelle, autosnatchConfig *ConfigAutosnatch) {
+	identifyWithNickServ(client, autosnatchConfig)
+	askAnnouncer(client, t, autosnatchConfig)
+}
+
+// identifyWithNickServ returns true if the bot had to identify, because it did not authenticate with SASL.
+func identifyWithNickServ(client *irc.Connection, autosnatchConfig *ConfigAutosnatch) bool {
+	if autosnatchConfig.SASLMechanism != "" || autosnatchConfig.NickservPassword == "" {
+		return false
 	}
-	IRCClient.Loop()
+	client.Privmsg("NickServ", "IDENTIFY "+autosnatchConfig.NickservPassword)
+	return true
+}
+
+// askAnnouncer for an invitation to the announce channel.
+func askAnnouncer(client *irc.Connection, t *tracker.Gazelle, autosnatchConfig *ConfigAutosnatch) {
+	client.Privmsg(autosnatchConfig.Announcer, fmt.Sprintf("enter %s %s %s", autosnatchConfig.AnnounceChannel, t.User, autosnatchConfig.IRCKey))
 }
@@ -0,0 +1,75 @@
+package varroa
+
+import (
+	"crypto/tls"
+	"strings"
+	"sync"
+	"time"
+
+	irc "gitlab.com/passelecasque/varroa/internal/ircevent"
+)
+
+const (
+	saslPlain    = "plain"
+	saslExternal = "external"
+
+	// ircIdentifyTimeout is how long to wait for NickServ to confirm the identification before asking for an invitation anyway.
+	ircIdentifyTimeout = 30 * time.Second
+	// rplLoggedIn is sent by the server once the services have recognized the account.
+	rplLoggedIn = "900"
+)
+
+var (
+	nickServConfirmations = []string{"you are now identified", "you are now logged in", "you are now recognized", "password accepted"}
+	nickServRejections    = []string{"invalid password", "password incorrect", "is not a registered nickname"}
+)
+
+// setUpAuthentication configures how the bot authenticates: with SASL before registering, or with NickServ once connected.
+// A client certificate is presented if configured, which also identifies the bot with NickServ on some networks.
+// It returns a function telling if the server took part in the SASL negotiation: if connecting then fails,
+// the connection is open and must be closed.
+func setUpAuthentication(client *irc.Connection, autosnatchConfig *ConfigAutosnatch) func() bool {
+	if autosnatchConfig.clientCertificate != nil {
+		client.TLSConfig.Certificates = []tls.Certificate{*autosnatchConfig.clientCertificate}
+	}
+	switch autosnatchConfig.SASLMechanism {
+	case saslPlain:
+		client.SASLLogin = autosnatchConfig.BotName
+		client.SASLPassword = autosnatchConfig.NickservPassword
+	case saslExternal:
+		client.SASLMech = "EXTERNAL"
+	default:
+		return func() bool { return false }
+	}
+	client.UseSASL = true
+
+	answered := make(chan struct{})
+	var once sync.Once
+	client.AddCallback("CAP", func(e *irc.Event) {
+		once.Do(func() { close(answered) })
+	})
+	return func() bool {
+		select {
+		case <-answered:
+			return true
+		default:
+			return false
+		}
+	}
+}
+
+// nickServAnswer tells if a notice from NickServ confirms or rejects the identification.
+func nickServAnswer(message string) (confirmed bool, rejected bool) {
+	message = strings.ToLower(message)
+	for _, c := range nickServConfirmations {
+		if strings.Contains(message, c) {
+			return true, false
+		}
+	}
+	for _, r := range nickServRejections {
+		if strings.Contains(message, r) {
+			return false, true
+		}
+	}
+	return false, false
+}
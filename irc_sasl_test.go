@@ -0,0 +1,101 @@
+package varroa
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/passelecasque/obstruction/tracker"
+)
+
+func TestNickServAnswer(t *testing.T) {
+	fmt.Println("+ Testing IRC/NickServ answers...")
+	check := assert.New(t)
+
+	for _, c := range []struct {
+		message   string
+		confirmed bool
+		rejected  bool
+	}{
+		{"You are now identified for mybot.", true, false},
+		{"Password accepted - you are now recognized.", true, false},
+		{"Invalid password for mybot.", false, true},
+		{"Password incorrect.", false, true},
+		{"This nickname is registered. Please choose a different nickname.", false, false},
+	} {
+		confirmed, rejected := nickServAnswer(c.message)
+		check.Equal(c.confirmed, confirmed, c.message)
+		check.Equal(c.rejected, rejected, c.message)
+	}
+}
+
+func TestIRCAuthentication(t *testing.T) {
+	fmt.Println("+ Testing IRC/authentication...")
+	check := assert.New(t)
+
+	e := NewEnvironment(nil)
+	e.config = &Config{}
+	tr := &tracker.Gazelle{}
+	tr.Name = "blue"
+	tr.User = "user"
+
+	connect := func(mechanism, password string) (*Simulator, *ircSupervisor) {
+		sim, err := NewSimulator("127.0.0.1:0", "127.0.0.1:0", "test")
+		check.Nil(err)
+		sim.User = "user"
+		sim.IRCKey = "kkeeyy"
+		sim.NickServPassword = "something"
+		sim.Announcer = "Bee"
+		sim.AnnounceChannel = "#announce"
+		sim.Start()
+		s := newIRCSupervisor(e, tr, &ConfigAutosnatch{Tracker: "blue", IRCServer: sim.IRCServer(), IRCKey: "kkeeyy", NickservPassword: password, SASLMechanism: mechanism, BotName: "bot", Announcer: "Bee", AnnounceChannel: "#announce"})
+		go s.run()
+		return sim, s
+	}
+	lastError := func(s *ircSupervisor) error {
+		for i := 0; i < 100; i++ {
+			s.mutex.RLock()
+			err := s.lastError
+			s.mutex.RUnlock()
+			if err != nil {
+				return err
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		return nil
+	}
+
+	// the announcer only invites identified bots
+	for _, mechanism := range []string{"", saslPlain} {
+		sim, s := connect(mechanism, "something")
+		check.Nil(sim.WaitForJoin(5*time.Second), mechanism)
+		s.Stop()
+		sim.Stop()
+	}
+	sim, s := connect("", "wrong")
+	check.NotNil(sim.WaitForJoin(500 * time.Millisecond))
+	s.Stop()
+	sim.Stop()
+
+	// failed SASL authentication: the connection is closed
+	goroutines := runtime.NumGoroutine()
+	sim, s = connect(saslPlain, "wrong")
+	err := lastError(s)
+	check.NotNil(err)
+	check.True(strings.HasPrefix(err.Error(), errorIRCAuthentication))
+	s.Stop()
+	sim.Stop()
+	sim, s = connect(saslExternal, "")
+	err = lastError(s)
+	check.NotNil(err)
+	check.True(strings.Contains(err.Error(), "client certificate"))
+	s.Stop()
+	sim.Stop()
+	for i := 0; i < 50 && runtime.NumGoroutine() > goroutines; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	check.True(runtime.NumGoroutine() <= goroutines)
+}
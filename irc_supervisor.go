@@ -0,0 +1,312 @@
+package varroa
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"gitlab.com/catastrophic/assistance/logthis"
+	"gitlab.com/passelecasque/obstruction/tracker"
+	irc "gitlab.com/passelecasque/varroa/internal/ircevent"
+)
+
+const (
+	ircInitialBackoff = 10 * time.Second
+	ircMaxBackoff     = 10 * time.Minute
+	ircWatchdogPeriod = time.Minute
+)
+
+var (
+	errIRCStopped     = errors.New("disconnected on request")
+	errIRCKeyRejected = errors.New("IRC key rejected by the announcer")
+	errIRCNoAnnounce  = errors.New("no announce received in time")
+)
+
+type ircState int
+
+const (
+	ircDisconnected ircState = iota
+	ircConnecting
+	ircConnected
+	ircStopped
+)
+
+func (s ircState) String() string {
+	switch s {
+	case ircConnecting:
+		return "connecting"
+	case ircConnected:
+		return "connected"
+	case ircStopped:
+		return "stopped"
+	default:
+		return "disconnected"
+	}
+}
+
+// nextIRCBackoff doubles the delay before the next connection attempt, up to ircMaxBackoff.
+func nextIRCBackoff(current time.Duration) time.Duration {
+	if current < ircInitialBackoff {
+		return ircInitialBackoff
+	}
+	if current*2 > ircMaxBackoff {
+		return ircMaxBackoff
+	}
+	return current * 2
+}
+
+// ircSupervisor keeps the connection to the announce channel of a tracker alive.
+// It reconnects with an exponential backoff, and reconnects when no announce has been seen for too long.
+type ircSupervisor struct {
+	e       *Environment
+	tracker *tracker.Gazelle
+	config  *ConfigAutosnatch
+
+	mutex            sync.RWMutex
+	state            ircState
+	client           *irc.Connection
+	connectedSince   time.Time
+	lastAnnounce     time.Time
+	lastHandshake    time.Time
+	handshakeRetried bool
+	reconnections    int
+	lastError        error
+	backoff          time.Duration
+	keyRejected      chan struct{}
+	stop             chan struct{}
+	done             chan struct{}
+}
+
+func newIRCSupervisor(e *Environment, t *tracker.Gazelle, autosnatchConfig *ConfigAutosnatch) *ircSupervisor {
+	return &ircSupervisor{e: e, tracker: t, config: autosnatchConfig, stop: make(chan struct{}), done: make(chan struct{})}
+}
+
+// Start connecting to IRC in the background.
+func (s *ircSupervisor) Start() {
+	go s.run()
+}
+
+// run connects to IRC until the supervisor is stopped or the IRC key is rejected.
+func (s *ircSupervisor) run() {
+	defer close(s.done)
+	for {
+		s.setState(ircConnecting)
+		client, err := s.connect()
+		if err == nil {
+			err = s.session(client)
+		}
+		s.forgetClient(client)
+		if err == errIRCStopped || err == errIRCKeyRejected {
+			s.mutex.Lock()
+			s.state = ircStopped
+			s.lastError = err
+			s.mutex.Unlock()
+			return
+		}
+
+		s.mutex.Lock()
+		s.state = ircDisconnected
+		s.lastError = err
+		s.reconnections++
+		s.backoff = nextIRCBackoff(s.backoff)
+		delay := s.backoff
+		s.mutex.Unlock()
+		logthis.Info(fmt.Sprintf("Disconnected from IRC for tracker %s (%s), reconnecting in %s.", s.tracker.Name, err.Error(), delay), logthis.NORMAL)
+		select {
+		case <-time.After(delay):
+		case <-s.stop:
+			s.setState(ircStopped)
+			return
+		}
+	}
+}
+
+// Stop disconnects and waits for the supervisor to return.
+func (s *ircSupervisor) Stop() {
+	close(s.stop)
+	<-s.done
+}
+
+func (s *ircSupervisor) connect() (*irc.Connection, error) {
+	client := newIRCConnection(s.e, s.tracker, s)
+	negotiated := setUpAuthentication(client, s.config)
+	s.mutex.Lock()
+	s.keyRejected = make(chan struct{})
+	s.lastHandshake = time.Now()
+	s.mutex.Unlock()
+	if err := client.Connect(s.config.IRCServer); err != nil {
+		if negotiated() {
+			// the connection is open, but the bot could not authenticate
+			err = errors.Wrap(err, errorIRCAuthentication)
+			client.Close()
+		}
+		logthis.Error(errors.Wrap(err, errorConnectingToIRC), logthis.NORMAL)
+		return nil, err
+	}
+	return client, nil
+}
+
+// session follows a connection until it fails, and returns why it ended.
+func (s *ircSupervisor) session(client *irc.Connection) error {
+	errs := client.ErrorChan()
+	watchdog := time.NewTicker(ircWatchdogPeriod)
+	defer watchdog.Stop()
+	stop := s.stop
+	s.mutex.RLock()
+	keyRejected := s.keyRejected
+	s.mutex.RUnlock()
+
+	var reason error
+	var disconnected chan struct{}
+	disconnect := func(why error) {
+		if disconnected != nil {
+			return
+		}
+		reason = why
+		disconnected = make(chan struct{})
+		// Disconnect closes the socket and signals the error channel, which is read below.
+		go func() {
+			client.Disconnect()
+			close(disconnected)
+		}()
+	}
+	for {
+		select {
+		case err := <-errs:
+			if reason == nil {
+				reason = err
+			}
+			if disconnected != nil {
+				<-disconnected
+			}
+			client.Close()
+			return reason
+		case <-stop:
+			stop = nil
+			disconnect(errIRCStopped)
+		case <-keyRejected:
+			keyRejected = nil
+			disconnect(errIRCKeyRejected)
+		case <-watchdog.C:
+			switch s.checkWatchdog(time.Now()) {
+			case watchdogHandshake:
+				logthis.Info("No announce on "+s.tracker.Name+" for a while, entering the announce channel again.", logthis.NORMAL)
+				s.handshake()
+				enterAnnounceChannel(client, s.tracker, s.config)
+			case watchdogReconnect:
+				disconnect(errIRCNoAnnounce)
+			}
+		}
+	}
+}
+
+type watchdogAction int
+
+const (
+	watchdogNothing watchdogAction = iota
+	watchdogHandshake
+	watchdogReconnect
+)
+
+// checkWatchdog decides what to do if nothing was announced for longer than configured.
+// The handshake with the announcer is tried once again before reconnecting.
+func (s *ircSupervisor) checkWatchdog(now time.Time) watchdogAction {
+	if s.config.AnnounceWatchdogMinutes == 0 {
+		return watchdogNothing
+	}
+	limit := time.Duration(s.config.AnnounceWatchdogMinutes) * time.Minute
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if now.Sub(s.lastAnnounce) < limit || now.Sub(s.lastHandshake) < limit {
+		return watchdogNothing
+	}
+	if s.state != ircConnected || s.handshakeRetried {
+		return watchdogReconnect
+	}
+	return watchdogHandshake
+}
+
+func (s *ircSupervisor) setState(state ircState) {
+	s.mutex.Lock()
+	s.state = state
+	s.mutex.Unlock()
+}
+
+// registered is called once the server has accepted the connection.
+func (s *ircSupervisor) registered(client *irc.Connection) {
+	now := time.Now()
+	s.mutex.Lock()
+	s.state = ircConnected
+	s.client = client
+	s.connectedSince = now
+	s.lastHandshake = now
+	s.handshakeRetried = false
+	s.lastError = nil
+	s.backoff = 0
+	s.mutex.Unlock()
+	logthis.Info("Connected to IRC for tracker "+s.tracker.Name+".", logthis.NORMAL)
+
+	s.e.mutex.Lock()
+	if s.e.config.ircNotifsConfigured && s.e.config.Notifications.Irc.Tracker == s.config.Tracker {
+		s.e.ircClient = client
+	}
+	s.e.mutex.Unlock()
+}
+
+func (s *ircSupervisor) handshake() {
+	s.mutex.Lock()
+	s.lastHandshake = time.Now()
+	s.handshakeRetried = true
+	s.mutex.Unlock()
+}
+
+func (s *ircSupervisor) announced() {
+	s.mutex.Lock()
+	s.lastAnnounce = time.Now()
+	s.handshakeRetried = false
+	s.mutex.Unlock()
+}
+
+func (s *ircSupervisor) rejected() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	select {
+	case <-s.keyRejected:
+	default:
+		close(s.keyRejected)
+	}
+}
+
+// forgetClient stops using a connection for notifications, unless it has already been replaced.
+func (s *ircSupervisor) forgetClient(client *irc.Connection) {
+	s.mutex.Lock()
+	s.client = nil
+	s.mutex.Unlock()
+	if client == nil {
+		return
+	}
+	s.e.mutex.Lock()
+	if s.e.ircClient == client {
+		s.e.ircClient = nil
+	}
+	s.e.mutex.Unlock()
+}
+
+// String describes the state of the connection.
+func (s *ircSupervisor) String() string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	status := "IRC for tracker " + s.tracker.Name + ": " + s.state.String()
+	if s.state == ircConnected {
+		status += " since " + s.connectedSince.Format("2006.01.02 15h04")
+	} else if s.lastError != nil {
+		status += " (" + s.lastError.Error() + ")"
+	}
+	if s.lastAnnounce.IsZero() {
+		status += ", no announce yet"
+	} else {
+		status += ", last announce " + s.lastAnnounce.Format("2006.01.02 15h04")
+	}
+	return status + fmt.Sprintf(", %d reconnection(s).", s.reconnections)
+}
@@ -0,0 +1,133 @@
+package varroa
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/passelecasque/obstruction/tracker"
+	irc "gitlab.com/passelecasque/varroa/internal/ircevent"
+)
+
+func TestIRCBackoff(t *testing.T) {
+	fmt.Println("+ Testing IRC/backoff...")
+	check := assert.New(t)
+
+	check.Equal(ircInitialBackoff, nextIRCBackoff(0))
+	check.Equal(2*ircInitialBackoff, nextIRCBackoff(ircInitialBackoff))
+	delay := time.Duration(0)
+	for i := 0; i < 20; i++ {
+		delay = nextIRCBackoff(delay)
+	}
+	check.Equal(ircMaxBackoff, delay)
+}
+
+func TestIRCWatchdog(t *testing.T) {
+	fmt.Println("+ Testing IRC/watchdog...")
+	check := assert.New(t)
+
+	tr := &tracker.Gazelle{}
+	tr.Name = "blue"
+	s := newIRCSupervisor(NewEnvironment(nil), tr, &ConfigAutosnatch{Tracker: "blue"})
+	now := time.Now()
+	check.Equal(watchdogNothing, s.checkWatchdog(now))
+
+	s.config.AnnounceWatchdogMinutes = 30
+	// still trying to register
+	s.lastHandshake = now.Add(-10 * time.Minute)
+	check.Equal(watchdogNothing, s.checkWatchdog(now))
+	check.Equal(watchdogReconnect, s.checkWatchdog(now.Add(30*time.Minute)))
+	// connected, without announces: entering the channel again, then reconnecting
+	s.state = ircConnected
+	check.Equal(watchdogHandshake, s.checkWatchdog(now.Add(30*time.Minute)))
+	s.handshakeRetried = true
+	check.Equal(watchdogReconnect, s.checkWatchdog(now.Add(30*time.Minute)))
+	// a recent announce
+	s.lastAnnounce = now.Add(20 * time.Minute)
+	check.Equal(watchdogNothing, s.checkWatchdog(now.Add(30*time.Minute)))
+
+	check.True(strings.HasPrefix(s.String(), "IRC for tracker blue: connected since "))
+	check.True(strings.HasSuffix(s.String(), ", 0 reconnection(s)."))
+	s.state = ircDisconnected
+	s.lastError = errIRCNoAnnounce
+	s.lastAnnounce = time.Time{}
+	s.reconnections = 2
+	check.Equal("IRC for tracker blue: disconnected (no announce received in time), no announce yet, 2 reconnection(s).", s.String())
+}
+
+func TestIRCSupervisorStop(t *testing.T) {
+	fmt.Println("+ Testing IRC/supervisor...")
+	check := assert.New(t)
+
+	goroutines := runtime.NumGoroutine()
+	// a server that accepts a connection and reads what it gets
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	check.Nil(err)
+	defer listener.Close()
+	received := make(chan string, 10)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				close(received)
+				return
+			}
+			received <- strings.TrimSpace(line)
+		}
+	}()
+
+	tr := &tracker.Gazelle{}
+	tr.Name = "blue"
+	tr.User = "user"
+	s := newIRCSupervisor(NewEnvironment(nil), tr, &ConfigAutosnatch{Tracker: "blue", IRCServer: listener.Addr().String(), BotName: "bot", Announcer: "Bee", AnnounceChannel: "#announce"})
+	go s.run()
+	check.Equal("NICK bot", <-received)
+
+	s.Stop()
+	// the server sees the connection close
+	for range received {
+	}
+	check.Equal(ircStopped, s.state)
+	check.Equal(errIRCStopped, s.lastError)
+	// all the goroutines of the connection are gone
+	for i := 0; i < 50 && runtime.NumGoroutine() > goroutines; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	check.True(runtime.NumGoroutine() <= goroutines)
+}
+
+func TestIRCConnectionClose(t *testing.T) {
+	fmt.Println("+ Testing IRC/close...")
+	check := assert.New(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	check.Nil(err)
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		bufio.NewReader(conn).WriteTo(ioutil.Discard)
+	}()
+
+	client := irc.IRC("bot", "user")
+	check.Nil(client.Connect(listener.Addr().String()))
+	client.Close()
+	check.False(client.Connected())
+	// closing again does nothing
+	check.NotPanics(client.Close)
+}
@@ -2,7 +2,6 @@ package varroa
 
 import (
 	"fmt"
-	"regexp"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -29,6 +28,15 @@ var (
 	filter17 = &ConfigFilter{Name: "filter17", Quality: []string{"Lossless"}, AllowScene: true}
 	filter18 = &ConfigFilter{Name: "filter18", Year: []int{2017}, Format: []string{"FLAC"}, Source: []string{"WEB"}, Quality: []string{"Lossless"}, AllowScene: true, TagsIncluded: []string{"abstract"}, TagsExcluded: []string{"korean"}}
 
+	// match modes, checked against the tracker metadata
+	filter19 = &ConfigFilter{Name: "filter19", Artist: []string{"fuzzy:Anikulapo"}}
+	filter20 = &ConfigFilter{Name: "filter20", Artist: []string{"re:^tobias"}, Title: []string{"re:thing$"}}
+	filter21 = &ConfigFilter{Name: "filter21", Artist: []string{"fuzzy:The Tobbias Tobias"}}
+	filter22 = &ConfigFilter{Name: "filter22", Artist: []string{"fuzzy:Various Artists"}}
+	filter23 = &ConfigFilter{Name: "filter23", Title: []string{"fuzzy:something about blues, second edition"}, ExcludedArtist: []string{"re:^various"}}
+	filter24 = &ConfigFilter{Name: "filter24", Artist: []string{"Aníkúlápó"}}
+	filter25 = &ConfigFilter{Name: "filter25", Title: []string{"re:first / SECOND"}, ExcludedArtist: []string{"fuzzy:some fellow"}}
+
 	allFilters = []*ConfigFilter{filter1, filter2, filter3, filter4, filter5, filter6, filter7, filter8, filter9, filter10, filter11, filter12, filter13, filter14, filter15, filter16, filter17, filter18}
 )
 
@@ -141,15 +149,64 @@ var announces = []testAnnounce{
 	},
 }
 
-func testFilters(announced testAnnounce, hits [][]string, alternate bool, verify *assert.Assertions) {
-	verify.NotZero(len(hits))
-	release, err := NewRelease("tracker", hits[0], alternate)
+type testMatchModes struct {
+	announce         string
+	satisfiedFilters []*ConfigFilter
+}
+
+var matchModeAnnounces = []testMatchModes{
+	{
+		// decomposed diacritics still match the exact artist name
+		"Some fellow & Ani\u0301ku\u0301la\u0301po\u0301 - first / second [1999] [Anthology] - FLAC / Lossless / Log / Cue / CD - https://mysterious.address/torrents.php?id=271487 / https://mysterious.address/torrents.php?action=download&id=923266 - soul, funk, afrobeat, world.music",
+		[]*ConfigFilter{filter19, filter24},
+	},
+	{
+		"Some fellow & Aníkúlápó - first / second [1999] [Anthology] - FLAC / Lossless / Log / Cue / CD - https://mysterious.address/torrents.php?id=271487 / https://mysterious.address/torrents.php?action=download&id=923266 - soul, funk, afrobeat, world.music",
+		[]*ConfigFilter{filter19, filter24},
+	},
+	{
+		"Tobias Tobias - That Thing [2017] [Album] - FLAC / 24bit Lossless / WEB - https://mysterious.address/torrents.php?id=493677 / https://mysterious.address/torrents.php?action=download&id=1030280 - abstract,ambient,drone",
+		[]*ConfigFilter{filter20, filter21},
+	},
+	{
+		"Various Artists - Something about Blues (Second Edition) [2016] [Compilation] - MP3 / V0 (VBR) / WEB - https://mysterious.address/torrents.php?id=452491 / https://mysterious.address/torrents.php?action=download&id=922592 - blues",
+		[]*ConfigFilter{filter22},
+	},
+	{
+		"Various Artist - Something About The Blues: Second Edition [2016] [Compilation] - MP3 / V0 (VBR) / WEB - https://mysterious.address/torrents.php?id=452491 / https://mysterious.address/torrents.php?action=download&id=922592 - blues",
+		[]*ConfigFilter{filter22},
+	},
+	{
+		"Another fellow - Something about Blues (2nd Edition) [2016] [Compilation] - MP3 / V0 (VBR) / WEB - https://mysterious.address/torrents.php?id=452491 / https://mysterious.address/torrents.php?action=download&id=922592 - blues",
+		[]*ConfigFilter{},
+	},
+	{
+		"Another fellow - Something about Blues (Second Editon) [2016] [Compilation] - MP3 / V0 (VBR) / WEB - https://mysterious.address/torrents.php?id=452491 / https://mysterious.address/torrents.php?action=download&id=922592 - blues",
+		[]*ConfigFilter{filter23},
+	},
+	{
+		"Some fellow - First / Second [1999] [Anthology] - FLAC / Lossless / Log / Cue / CD - https://mysterious.address/torrents.php?id=271487 / https://mysterious.address/torrents.php?action=download&id=923266 - soul",
+		[]*ConfigFilter{},
+	},
+	{
+		"Sóme Fellows - First / Second [1999] [Anthology] - FLAC / Lossless / Log / Cue / CD - https://mysterious.address/torrents.php?id=271487 / https://mysterious.address/torrents.php?action=download&id=923266 - soul",
+		[]*ConfigFilter{},
+	},
+	{
+		"Another fellow - First / Second [1999] [Anthology] - FLAC / Lossless / Log / Cue / CD - https://mysterious.address/torrents.php?id=271487 / https://mysterious.address/torrents.php?action=download&id=923266 - soul",
+		[]*ConfigFilter{filter25},
+	},
+}
+
+func testFilters(announced testAnnounce, fields map[string]string, verify *assert.Assertions) {
+	verify.NotNil(fields)
+	release, err := NewRelease("tracker", fields)
 	verify.Nil(err)
 	verify.Equal(announced.expectedRelease, release.String())
 	fmt.Println(release)
 	satisfied := 0
 	for _, f := range allFilters {
-		if release.Satisfies(f) {
+		if release.Satisfies(f).Accepted() {
 			found := false
 			for _, ef := range announced.satisfiedFilters {
 				if f == ef {
@@ -174,21 +231,107 @@ func TestRegexp(t *testing.T) {
 
 	// testing parser
 	for _, announced := range announces {
-		r := regexp.MustCompile(announcePattern)
-		r2 := regexp.MustCompile(alternativeAnnouncePattern)
-
-		hits := r.FindAllStringSubmatch(announced.announce, -1)
+		fields := defaultAnnounceFormats[0].match(announced.announce)
 		if announced.expectedHit {
-			testFilters(announced, hits, false, verify)
+			testFilters(announced, fields, verify)
 		} else {
-			verify.Zero(len(hits))
+			verify.Nil(fields)
 		}
 
-		hits = r2.FindAllStringSubmatch(announced.announce, -1)
+		fields = defaultAnnounceFormats[1].match(announced.announce)
 		if announced.expectedAlternativeHit {
-			testFilters(announced, hits, true, verify)
+			testFilters(announced, fields, verify)
 		} else {
-			verify.Zero(len(hits))
+			verify.Nil(fields)
+		}
+	}
+
+	// the built-in formats parse their samples
+	a := &ConfigAutosnatch{Tracker: "tracker", IRCServer: "irc.server.net:6697", IRCKey: "key", NickservPassword: "pass", BotName: "bot", Announcer: "Bee", AnnounceChannel: "#announce"}
+	verify.Nil(a.check())
+	verify.Nil(a.checkSamples())
+	release, err := parseAnnounce("tracker", defaultAnnounceFormats[1].Samples[0], a.announceFormats)
+	verify.Nil(err)
+	verify.Equal("Release info:\n\tArtist: Some fellow\n\tTitle: first / second\n\tYear: 1999\n\tRelease Type: Album\n\tFormat: FLAC\n\tQuality: Lossless\n\tHasLog: true\n\tLog Score: -9999\n\tHas Cue: true\n\tScene: true\n\tSource: CD\n\tTags: [soul funk]\n\tTorrent URL: https://mysterious.address/torrents.php?action=download&id=923266\n\tTorrent ID: 923266", release.String())
+	release, err = parseAnnounce("tracker", "Non-music artist - Ebook Title!  - https://mysterious.address/torrents.php?id=452618 / https://mysterious.address/torrents.php?action=download&id=922495 - science.fiction", a.announceFormats)
+	verify.Nil(err)
+	verify.Nil(release)
+}
+
+func TestAnnounceFormats(t *testing.T) {
+	fmt.Println("+ Testing Announce formats...")
+	verify := assert.New(t)
+
+	f := &ConfigAnnounceFormat{Pattern: `(?P<artist>.*?) - (?P<title>.*) \[(?P<release_type>[\w ]+)\] (?P<format>\w+) (?P<quality>\w+) (?P<source>\w+) (?P<torrent_url>\S+)`}
+	verify.Nil(f.check())
+	release, err := NewRelease("tracker", f.match("A - B [Album] FLAC Lossless WEB https://mysterious.address/torrents.php?action=download&id=12"))
+	verify.Nil(err)
+	verify.Equal([]string{"A"}, release.Artists)
+	verify.Equal("B", release.Title)
+	verify.Equal(-1, release.Year)
+	verify.Equal("12", release.TorrentID)
+	verify.False(release.HasLog)
+	// unknown values
+	_, err = NewRelease("tracker", f.match("A - B [Album] FLAC Lossy WEB https://mysterious.address/torrents.php?action=download&id=12"))
+	verify.NotNil(err)
+
+	// samples
+	a := &ConfigAutosnatch{Tracker: "tracker", announceFormats: []*ConfigAnnounceFormat{f}}
+	f.Samples = []string{"A - B [Album] FLAC Lossless WEB https://mysterious.address/torrents.php?action=download&id=12"}
+	verify.Nil(a.checkSamples())
+	f.Samples = append(f.Samples, "A - B [Album] FLAC")
+	verify.NotNil(a.checkSamples())
+
+	// torrent URLs without a Gazelle download link need a torrent_id group
+	f.Samples = []string{"A - B [Album] FLAC Lossless WEB https://other.address/dl/12/A-B.torrent"}
+	verify.NotNil(a.checkSamples())
+	_, err = parseAnnounce("tracker", f.Samples[0], a.announceFormats)
+	verify.NotNil(err)
+	g := &ConfigAnnounceFormat{Pattern: `(?P<artist>.*?) - (?P<title>.*) \[(?P<release_type>[\w ]+)\] (?P<format>\w+) (?P<quality>\w+) (?P<source>\w+) (?P<torrent_url>\S+/dl/(?P<torrent_id>\d+)/\S+)`, Samples: f.Samples}
+	verify.Nil(g.check())
+	a.announceFormats = []*ConfigAnnounceFormat{g}
+	verify.Nil(a.checkSamples())
+	release, err = parseAnnounce("tracker", f.Samples[0], a.announceFormats)
+	verify.Nil(err)
+	verify.Equal("12", release.TorrentID)
+	verify.Equal("https://other.address/dl/12/A-B.torrent", release.torrentURL)
+
+	// invalid patterns
+	verify.NotNil((&ConfigAnnounceFormat{}).check())
+	verify.NotNil((&ConfigAnnounceFormat{Pattern: `(?P<artist>.*`}).check())
+	verify.NotNil((&ConfigAnnounceFormat{Pattern: `(?P<artist>.*?) - (?P<title>.*)`}).check())
+	verify.NotNil((&ConfigAnnounceFormat{Pattern: f.Pattern + ` (?P<unknown>.*)`}).check())
+}
+
+func TestMatchModes(t *testing.T) {
+	fmt.Println("+ Testing Announce filtering with match modes...")
+	verify := assert.New(t)
+
+	filters := []*ConfigFilter{filter19, filter20, filter21, filter22, filter23, filter24, filter25}
+	for _, f := range filters {
+		verify.Nil(f.check())
+	}
+	verify.NotNil((&ConfigFilter{Name: "bad", Artist: []string{"re:("}}).check())
+	verify.NotNil((&ConfigFilter{Name: "bad", Title: []string{"fuzzy: ()"}}).check())
+
+	for _, announced := range matchModeAnnounces {
+		fields := defaultAnnounceFormats[0].match(announced.announce)
+		verify.NotNil(fields)
+		release, err := NewRelease("tracker", fields)
+		verify.Nil(err)
+		info := &TrackerMetadata{Title: release.Title}
+		for _, a := range release.Artists {
+			info.Artists = append(info.Artists, TrackerMetadataArtist{Name: a})
+		}
+		var expected, satisfied []string
+		for _, f := range announced.satisfiedFilters {
+			expected = append(expected, f.Name)
+		}
+		for _, f := range filters {
+			if release.HasCompatibleTrackerInfo(f, []string{}, info).Accepted() {
+				satisfied = append(satisfied, f.Name)
+			}
 		}
+		verify.Equal(expected, satisfied, announced.announce)
 	}
 }
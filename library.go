@@ -15,17 +15,13 @@ import (
 )
 
 // ReorganizeLibrary using tracker metadata and the user-defined template
-func ReorganizeLibrary(doNothing, interactive bool) error {
+func ReorganizeLibrary(c *Config, doNothing, interactive bool) error {
 	defer TimeTrack(time.Now(), "Reorganize Library")
 
 	if doNothing {
 		logthis.Info("Simulating library reorganization...", logthis.NORMAL)
 	}
 
-	c, e := NewConfig(DefaultConfigurationFile)
-	if e != nil {
-		return e
-	}
 	if !c.LibraryConfigured {
 		return errors.New("library section of the configuration file not found")
 	}
@@ -46,7 +42,7 @@ func ReorganizeLibrary(doNothing, interactive bool) error {
 	var playlists []m3u.Playlist
 	if c.playlistDirectoryConfigured {
 		// load all playlists
-		e = filepath.Walk(c.Library.PlaylistDirectory, func(path string, fileInfo os.FileInfo, walkError error) error {
+		e := filepath.Walk(c.Library.PlaylistDirectory, func(path string, fileInfo os.FileInfo, walkError error) error {
 			if os.IsNotExist(walkError) {
 				return nil
 			}
@@ -88,6 +84,10 @@ func ReorganizeLibrary(doNothing, interactive bool) error {
 					logthis.Info("Could not find metadata for tracker "+t, logthis.NORMAL)
 					continue
 				}
+				// apply the artist aliases/categories from the configuration
+				if err := info.checkAliasAndCategory(filepath.Join(path, MetadataDir), c); err != nil {
+					logthis.Error(err, logthis.VERBOSE)
+				}
 				newName = info.GeneratePath(template, path)
 				break // stop once we have a name.
 			}
@@ -132,15 +132,11 @@ func ReorganizeLibrary(doNothing, interactive bool) error {
 		s.Stop()
 	}
 	logthis.Info(fmt.Sprintf("Moved %d release(s).", movedAlbums), logthis.NORMAL)
-	return deleteEmptyLibraryFolders()
+	return deleteEmptyLibraryFolders(c)
 }
 
 // DeleteEmptyLibraryFolders deletes empty folders that may appear after sorting albums.
-func deleteEmptyLibraryFolders() error {
-	c, err := NewConfig(DefaultConfigurationFile)
-	if err != nil {
-		return err
-	}
+func deleteEmptyLibraryFolders(c *Config) error {
 	if !c.LibraryConfigured {
 		return errors.New("library section of the configuration file not found")
 	}
@@ -0,0 +1,213 @@
+package varroa
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"gitlab.com/catastrophic/assistance/fs"
+	"gitlab.com/catastrophic/assistance/logthis"
+)
+
+const (
+	linkReflink  = "reflink"
+	linkHardLink = "hard link"
+	linkCopy     = "copy"
+
+	linkVerifyBufferSize = 1024 * 1024
+)
+
+// LinkOptions describe how files can be placed elsewhere.
+type LinkOptions struct {
+	// HardLinks are allowed. Contrary to reflinks and copies, modifying a hard linked file modifies the original.
+	HardLinks bool
+	// Verify that the destination files match the source files.
+	Verify bool
+}
+
+// LinkedFile records how a file was placed.
+type LinkedFile struct {
+	Source      string
+	Destination string
+	Strategy    string
+}
+
+// LinkReport lists how files were placed.
+type LinkReport struct {
+	Files    []LinkedFile
+	Verified bool
+}
+
+func (lr *LinkReport) String() string {
+	counts := make(map[string]int)
+	for _, f := range lr.Files {
+		counts[f.Strategy]++
+	}
+	txt := fmt.Sprintf("%d files placed: %d reflinked, %d hard linked, %d copied", len(lr.Files), counts[linkReflink], counts[linkHardLink], counts[linkCopy])
+	if lr.Verified {
+		txt += ", all verified"
+	}
+	return txt + "."
+}
+
+// LinkDir places all the files of a directory in another, reflinking, hard linking or copying them.
+func LinkDir(src, dst string, options LinkOptions) (*LinkReport, error) {
+	var files []string
+	err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, rel)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return LinkFiles(src, dst, files, options)
+}
+
+// LinkFiles places files, relative to src, at the same relative paths in dst.
+// If both are on the same device, it tries, in order, a reflink, a hard link if allowed, and a copy.
+func LinkFiles(src, dst string, files []string, options LinkOptions) (*LinkReport, error) {
+	sameDevice, err := onSameDevice(src, dst)
+	if err != nil {
+		return nil, err
+	}
+	report := &LinkReport{Verified: options.Verify}
+	for _, f := range files {
+		source, destination := filepath.Join(src, f), filepath.Join(dst, f)
+		strategy, err := linkFile(source, destination, sameDevice, options.HardLinks)
+		if err != nil {
+			return report, errors.Wrap(err, "could not place "+destination)
+		}
+		logthis.Info(strategy+": "+destination, logthis.VERBOSE)
+		if options.Verify {
+			if err := verifyLinkedFile(source, destination); err != nil {
+				return report, err
+			}
+		}
+		report.Files = append(report.Files, LinkedFile{Source: source, Destination: destination, Strategy: strategy})
+	}
+	return report, nil
+}
+
+// linkFile places a copy of src at dst, as cheaply as possible, and returns how it did.
+// A different file already at dst is never replaced.
+func linkFile(src, dst string, sameDevice, hardLinks bool) (string, error) {
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		return "", err
+	}
+	if dstInfo, err := os.Stat(dst); err == nil {
+		if os.SameFile(srcInfo, dstInfo) {
+			return linkHardLink, nil
+		}
+		return "", errors.New("a different file already exists at " + dst)
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0777); err != nil {
+		return "", err
+	}
+	if sameDevice {
+		if err := reflink(src, dst, srcInfo.Mode()); err == nil {
+			return linkReflink, nil
+		}
+		if hardLinks {
+			if err := os.Link(src, dst); err == nil {
+				return linkHardLink, nil
+			}
+		}
+	}
+	return linkCopy, fs.CopyFile(src, dst, false)
+}
+
+// onSameDevice is true if both paths, or their closest existing parents, are on the same device.
+func onSameDevice(a, b string) (bool, error) {
+	deviceA, err := deviceID(a)
+	if err != nil {
+		return false, err
+	}
+	deviceB, err := deviceID(b)
+	if err != nil {
+		return false, err
+	}
+	return deviceA == deviceB, nil
+}
+
+// deviceID of the device containing a path, or its closest existing parent.
+func deviceID(path string) (uint64, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return 0, err
+	}
+	for {
+		info, err := os.Stat(path)
+		if err == nil {
+			stat, ok := info.Sys().(*syscall.Stat_t)
+			if !ok {
+				return 0, errors.New("could not find the device of " + path)
+			}
+			return uint64(stat.Dev), nil
+		}
+		parent := filepath.Dir(path)
+		if !os.IsNotExist(err) || parent == path {
+			return 0, err
+		}
+		path = parent
+	}
+}
+
+// verifyLinkedFile checks that dst has the same contents as src.
+func verifyLinkedFile(src, dst string) error {
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	dstInfo, err := os.Stat(dst)
+	if err != nil {
+		return err
+	}
+	if os.SameFile(srcInfo, dstInfo) {
+		return nil
+	}
+	if srcInfo.Size() != dstInfo.Size() {
+		return fmt.Errorf("%s does not have the same size as %s", dst, src)
+	}
+	a, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+	b, err := os.Open(dst)
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+	bufA, bufB := make([]byte, linkVerifyBufferSize), make([]byte, linkVerifyBufferSize)
+	for {
+		nA, errA := io.ReadFull(a, bufA)
+		nB, errB := io.ReadFull(b, bufB)
+		if nA != nB || !bytes.Equal(bufA[:nA], bufB[:nB]) {
+			return fmt.Errorf("%s does not have the same contents as %s", dst, src)
+		}
+		if errA == io.EOF || errA == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if errA != nil {
+			return errA
+		}
+		if errB != nil {
+			return errB
+		}
+	}
+}
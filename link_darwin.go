@@ -0,0 +1,12 @@
+package varroa
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// reflink creates dst as a copy-on-write clone of src, if the filesystem supports it.
+func reflink(src, dst string, mode os.FileMode) error {
+	return unix.Clonefile(src, dst, 0)
+}
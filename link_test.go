@@ -0,0 +1,78 @@
+package varroa
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLinkDir(t *testing.T) {
+	fmt.Println("+ Testing Link...")
+	check := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "varroa")
+	check.Nil(err)
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "source")
+	check.Nil(os.MkdirAll(filepath.Join(src, "CD1"), 0777))
+	check.Nil(ioutil.WriteFile(filepath.Join(src, "CD1", "01.flac"), []byte("first track"), 0666))
+	check.Nil(ioutil.WriteFile(filepath.Join(src, "cover.jpg"), []byte("cover"), 0666))
+
+	// the destination does not exist yet, its parent is on the same device
+	sameDevice, err := onSameDevice(src, filepath.Join(dir, "a", "b"))
+	check.Nil(err)
+	check.True(sameDevice)
+
+	// with hard links, files are never copied on the same device
+	dst := filepath.Join(dir, "hardlinks")
+	report, err := LinkDir(src, dst, LinkOptions{HardLinks: true, Verify: true})
+	check.Nil(err)
+	check.True(report.Verified)
+	check.Equal(2, len(report.Files))
+	for _, f := range report.Files {
+		check.NotEqual(linkCopy, f.Strategy)
+		content, err := ioutil.ReadFile(f.Destination)
+		check.Nil(err)
+		original, err := ioutil.ReadFile(f.Source)
+		check.Nil(err)
+		check.Equal(original, content)
+	}
+	check.Equal(filepath.Join(dst, "CD1", "01.flac"), report.Files[0].Destination)
+	// already there
+	report, err = LinkDir(src, dst, LinkOptions{HardLinks: true})
+	check.Nil(err)
+	check.Equal(2, len(report.Files))
+
+	// without hard links, files are reflinked if possible, or copied
+	dst = filepath.Join(dir, "copies")
+	report, err = LinkDir(src, dst, LinkOptions{Verify: true})
+	check.Nil(err)
+	for _, f := range report.Files {
+		check.NotEqual(linkHardLink, f.Strategy)
+		srcInfo, err := os.Stat(f.Source)
+		check.Nil(err)
+		dstInfo, err := os.Stat(f.Destination)
+		check.Nil(err)
+		check.False(os.SameFile(srcInfo, dstInfo))
+	}
+	check.Contains(report.String(), "2 files placed")
+
+	// verification
+	check.Nil(verifyLinkedFile(filepath.Join(src, "cover.jpg"), filepath.Join(dst, "cover.jpg")))
+	check.Nil(ioutil.WriteFile(filepath.Join(dst, "cover.jpg"), []byte("COVER"), 0666))
+	check.NotNil(verifyLinkedFile(filepath.Join(src, "cover.jpg"), filepath.Join(dst, "cover.jpg")))
+	check.Nil(ioutil.WriteFile(filepath.Join(dst, "cover.jpg"), []byte("cover!"), 0666))
+	check.NotNil(verifyLinkedFile(filepath.Join(src, "cover.jpg"), filepath.Join(dst, "cover.jpg")))
+
+	// files that are already there, but not the same, are not replaced
+	check.Nil(ioutil.WriteFile(filepath.Join(dst, "cover.jpg"), []byte("other cover"), 0666))
+	_, err = LinkDir(src, dst, LinkOptions{HardLinks: true})
+	check.NotNil(err)
+	content, err := ioutil.ReadFile(filepath.Join(dst, "cover.jpg"))
+	check.Nil(err)
+	check.Equal("other cover", string(content))
+}
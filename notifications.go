@@ -20,10 +20,7 @@ import (
 
 // Notify in a goroutine, or directly.
 func Notify(msg, tracker, msgType string, e *Environment) error {
-	conf, err := NewConfig(DefaultConfigurationFile)
-	if err != nil {
-		return err
-	}
+	conf := e.Config()
 	notify := func() error {
 		link := ""
 		if conf.gitlabPagesConfigured {
@@ -38,7 +35,7 @@ func Notify(msg, tracker, msgType string, e *Environment) error {
 			pushOver := &Notification{client: pushover.New(conf.Notifications.Pushover.Token), recipient: pushover.NewRecipient(conf.Notifications.Pushover.User)}
 			var pngLink string
 			if tracker != FullName && strings.HasPrefix(msg, statsNotificationPrefix) && conf.Notifications.Pushover.IncludeBufferGraph {
-				pngLink = filepath.Join(StatsDir, tracker+"_"+lastWeekPrefix+"_"+bufferStatsFile+pngExt)
+				pngLink = filepath.Join(e.paths.StatsDir(), tracker+"_"+lastWeekPrefix+"_"+bufferStatsFile+pngExt)
 			}
 			if err := pushOver.Send(tracker+": "+msg, conf.gitlabPagesConfigured, link, pngLink); err != nil {
 				logthis.Error(errors.Wrap(err, errorNotification), logthis.VERBOSE)
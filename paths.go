@@ -0,0 +1,94 @@
+package varroa
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	envConfigurationFile = "VARROA_CONFIG"
+	envDataDir           = "VARROA_DATA_DIR"
+	envSocket            = "VARROA_SOCKET"
+)
+
+// Paths of the files and directories used by an instance of varroa.
+// By default, they are all relative to the current directory.
+// Setting a different configuration file and data directory allows running several isolated instances on the same host.
+type Paths struct {
+	ConfigurationFile string
+	DataDir           string
+	Socket            string
+}
+
+// NewPaths for an instance, using the defaults for any empty value.
+func NewPaths(configurationFile, dataDir, socket string) *Paths {
+	p := &Paths{ConfigurationFile: configurationFile, DataDir: dataDir, Socket: socket}
+	if p.ConfigurationFile == "" {
+		p.ConfigurationFile = DefaultConfigurationFile
+	}
+	if p.Socket == "" {
+		p.Socket = filepath.Join(p.DataDir, daemonSocket)
+	}
+	return p
+}
+
+// NewPathsFromEnvironment uses the VARROA_CONFIG, VARROA_DATA_DIR and VARROA_SOCKET environment variables, unless the given values are set.
+func NewPathsFromEnvironment(configurationFile, dataDir, socket string) *Paths {
+	if configurationFile == "" {
+		configurationFile = os.Getenv(envConfigurationFile)
+	}
+	if dataDir == "" {
+		dataDir = os.Getenv(envDataDir)
+	}
+	if socket == "" {
+		socket = os.Getenv(envSocket)
+	}
+	return NewPaths(configurationFile, dataDir, socket)
+}
+
+// EncryptedConfigurationFile is the encrypted version of the configuration file.
+func (p *Paths) EncryptedConfigurationFile() string {
+	return strings.TrimSuffix(p.ConfigurationFile, yamlExt) + encryptedExt
+}
+
+// StatsDir contains the stats databases and graphs.
+func (p *Paths) StatsDir() string {
+	return filepath.Join(p.DataDir, StatsDir)
+}
+
+func (p *Paths) HistoryDB() string {
+	return filepath.Join(p.StatsDir(), DefaultHistoryDB)
+}
+
+func (p *Paths) AnnouncesDB() string {
+	return filepath.Join(p.StatsDir(), DefaultAnnouncesDB)
+}
+
+func (p *Paths) SnatchQueueDB() string {
+	return filepath.Join(p.StatsDir(), DefaultSnatchQueueDB)
+}
+
+func (p *Paths) DownloadsDB() string {
+	return filepath.Join(p.DataDir, DefaultDownloadsDB)
+}
+
+func (p *Paths) LibraryDB() string {
+	return filepath.Join(p.DataDir, DefaultLibraryDB)
+}
+
+func (p *Paths) PIDFile() string {
+	return filepath.Join(p.DataDir, DefaultPIDFile)
+}
+
+func (p *Paths) LogFile() string {
+	return filepath.Join(p.DataDir, DefaultLogFile)
+}
+
+func (p *Paths) ArchivesDir() string {
+	return filepath.Join(p.DataDir, archivesDir)
+}
+
+func (p *Paths) MetadataCacheDir() string {
+	return filepath.Join(p.StatsDir(), metadataCacheDir)
+}
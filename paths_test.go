@@ -0,0 +1,47 @@
+package varroa
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPaths(t *testing.T) {
+	fmt.Println("+ Testing Paths...")
+	check := assert.New(t)
+
+	// defaults, relative to the current directory
+	p := NewPaths("", "", "")
+	check.Equal(DefaultConfigurationFile, p.ConfigurationFile)
+	check.Equal("config.enc", p.EncryptedConfigurationFile())
+	check.Equal(daemonSocket, p.Socket)
+	check.Equal(StatsDir, p.StatsDir())
+	check.Equal(filepath.Join(StatsDir, DefaultHistoryDB), p.HistoryDB())
+	check.Equal(DefaultDownloadsDB, p.DownloadsDB())
+	check.Equal(DefaultPIDFile, p.PIDFile())
+
+	// isolated instance
+	p = NewPaths("/etc/varroa/seedbox2.yaml", "/var/lib/varroa2", "")
+	check.Equal("/etc/varroa/seedbox2.enc", p.EncryptedConfigurationFile())
+	check.Equal("/var/lib/varroa2/varroa.sock", p.Socket)
+	check.Equal("/var/lib/varroa2/stats/announces.db", p.AnnouncesDB())
+	check.Equal("/var/lib/varroa2/library.db", p.LibraryDB())
+	check.Equal("/var/lib/varroa2/log", p.LogFile())
+
+	// environment variables, overridden by explicit values
+	check.Nil(os.Setenv(envDataDir, "/var/lib/varroa3"))
+	check.Nil(os.Setenv(envSocket, "/run/varroa3.sock"))
+	defer os.Unsetenv(envDataDir)
+	defer os.Unsetenv(envSocket)
+	p = NewPathsFromEnvironment("", "", "")
+	check.Equal(DefaultConfigurationFile, p.ConfigurationFile)
+	check.Equal("/var/lib/varroa3", p.DataDir)
+	check.Equal("/run/varroa3.sock", p.Socket)
+	p = NewPathsFromEnvironment("other.yaml", "/var/lib/other", "")
+	check.Equal("other.yaml", p.ConfigurationFile)
+	check.Equal("/var/lib/other", p.DataDir)
+	check.Equal("/run/varroa3.sock", p.Socket)
+}
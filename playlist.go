@@ -10,14 +10,6 @@ import (
 )
 
 func getCurrentPlaylists(root string) (*m3u.Playlist, *m3u.Playlist, error) {
-	c, e := NewConfig(DefaultConfigurationFile)
-	if e != nil {
-		return nil, nil, e
-	}
-	if !c.LibraryConfigured {
-		return nil, nil, errors.New("library section of the configuration file not found")
-	}
-
 	var daily, monthly *m3u.Playlist
 	var err error
 
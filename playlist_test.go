@@ -27,11 +27,6 @@ func TestPlaylist(t *testing.T) {
 	fakeReleaseMoved := "Polka/Artist (2000) Release"
 	fakeFiles := []string{"01. Track1.flac", "02. Track2.mp3", "this.log"}
 
-	c, e := NewConfig("test/test_complete.yaml")
-	check.Nil(e)
-	c.LibraryConfigured = true
-	c.Library.Directory = fakeLibraryPath
-
 	// create test dir
 	check.Nil(os.MkdirAll(filepath.Join(fakeLibraryPath, fakeRelease, MetadataDir), 0777))
 	check.Nil(os.MkdirAll(fakePlaylistPath, 0777))
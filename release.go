@@ -36,6 +36,14 @@ const (
 	TorrentNotification = `%s - %s (%d) [%s/%s/%s/%s] [%s]`
 
 	logScoreNotInAnnounce = -9999
+
+	torrentURLPattern = `http[s]?://[[:alnum:]\./:]*torrents\.php\?action=download&id=([\d]*)`
+	artistsSeparator  = "&|performed by"
+)
+
+var (
+	torrentURLRegexp       = regexp.MustCompile(torrentURLPattern)
+	artistsSeparatorRegexp = regexp.MustCompile(artistsSeparator)
 )
 
 type Release struct {
@@ -47,6 +55,8 @@ type Release struct {
 	Artists     []string
 	Title       string
 	Year        int
+	EditionName string
+	EditionYear int
 	ReleaseType string
 	Format      string
 	Quality     string
@@ -59,30 +69,33 @@ type Release struct {
 	torrentURL  string
 	Size        uint64
 	Folder      string
+	FilesHash   string
 	Filter      string
+	FLToken     bool
+	CrossSeed   bool
+	Verdicts    []FilterVerdict
+	InfoHash    string
+	Completed   bool
 }
 
-func NewRelease(trackerName string, parts []string, alternative bool) (*Release, error) {
-	if len(parts) != 19 {
-		return nil, errors.New("incomplete announce information")
+// NewRelease from the named groups of an announce pattern.
+func NewRelease(trackerName string, fields map[string]string) (*Release, error) {
+	for _, g := range announceRequiredGroups {
+		if _, ok := fields[g]; !ok {
+			return nil, errors.New("incomplete announce information")
+		}
 	}
 
-	var tags []string
-	var torrentURL, torrentID string
-	pattern := `http[s]?://[[:alnum:]\./:]*torrents\.php\?action=download&id=([\d]*)`
-	rg := regexp.MustCompile(pattern)
+	var torrentID string
+	tags := strings.Split(fields[announceTags], ",")
+	torrentURL := fields[announceTorrentURL]
 
-	if alternative {
-		tags = strings.Split(parts[16], ",")
-		torrentURL = parts[18]
-	} else {
-		tags = strings.Split(parts[18], ",")
-		torrentURL = parts[17]
-	}
-
-	// getting torrentID
-	hits := rg.FindAllStringSubmatch(torrentURL, -1)
-	if len(hits) != 0 {
+	// getting torrentID, from its own group if the announce pattern has one, or from a Gazelle download URL
+	if id, ok := fields[announceTorrentID]; ok {
+		if _, err := strconv.Atoi(id); err == nil {
+			torrentID = id
+		}
+	} else if hits := torrentURLRegexp.FindAllStringSubmatch(torrentURL, -1); len(hits) != 0 {
 		torrentID = hits[0][1]
 	}
 	// cleaning up tags
@@ -90,21 +103,21 @@ func NewRelease(trackerName string, parts []string, alternative bool) (*Release,
 		tags[i] = strings.TrimSpace(el)
 	}
 
-	year, err := strconv.Atoi(parts[3])
+	year, err := strconv.Atoi(fields[announceYear])
 	if err != nil {
 		year = -1
 	}
-	hasLog := parts[8] != ""
-	logScore, err := strconv.Atoi(parts[10])
+	hasLog := fields[announceLog] != ""
+	logScore, err := strconv.Atoi(fields[announceLogScore])
 	if err != nil {
 		logScore = logScoreNotInAnnounce
 	}
-	hasCue := parts[12] != ""
-	isScene := parts[15] != ""
+	hasCue := fields[announceCue] != ""
+	isScene := fields[announceScene] != ""
 
-	artist := []string{parts[1]}
+	artist := []string{fields[announceArtist]}
 	// if the raw Artists announce contains & or "performed by", split and add to slice
-	subArtists := regexp.MustCompile("&|performed by").Split(parts[1], -1)
+	subArtists := artistsSeparatorRegexp.Split(fields[announceArtist], -1)
 	if len(subArtists) != 1 {
 		for i, a := range subArtists {
 			subArtists[i] = strings.TrimSpace(a)
@@ -113,24 +126,24 @@ func NewRelease(trackerName string, parts []string, alternative bool) (*Release,
 	}
 
 	// checks
-	releaseType := parts[4]
+	releaseType := fields[announceReleaseType]
 	if !strslice.Contains(tracker.KnownReleaseTypes, releaseType) {
 		return nil, errors.New("Unknown release type: " + releaseType)
 	}
-	format := parts[5]
+	format := fields[announceFormat]
 	if !strslice.Contains(tracker.KnownFormats, format) {
 		return nil, errors.New("Unknown format: " + format)
 	}
-	source := parts[13]
+	source := fields[announceSource]
 	if !strslice.Contains(tracker.KnownSources, source) {
 		return nil, errors.New("Unknown source: " + source)
 	}
-	quality := parts[6]
+	quality := fields[announceQuality]
 	if !strslice.Contains(tracker.KnownQualities, quality) {
 		return nil, errors.New("Unknown quality: " + quality)
 	}
 
-	r := &Release{Tracker: trackerName, Timestamp: time.Now(), Artists: artist, Title: parts[2], Year: year, ReleaseType: releaseType, Format: format, Quality: quality, Source: source, HasLog: hasLog, LogScore: logScore, HasCue: hasCue, IsScene: isScene, torrentURL: torrentURL, Tags: tags, TorrentID: torrentID}
+	r := &Release{Tracker: trackerName, Timestamp: time.Now(), Artists: artist, Title: fields[announceTitle], Year: year, ReleaseType: releaseType, Format: format, Quality: quality, Source: source, HasLog: hasLog, LogScore: logScore, HasCue: hasCue, IsScene: isScene, torrentURL: torrentURL, Tags: tags, TorrentID: torrentID}
 	return r, nil
 }
 
@@ -156,159 +169,163 @@ func (r *Release) TorrentFile() string {
 	return fs.SanitizePath(torrentFile)
 }
 
-func (r *Release) Satisfies(filter *ConfigFilter) bool {
+// Satisfies returns the verdict of the filter on the announced information.
+func (r *Release) Satisfies(filter *ConfigFilter) *FilterVerdict {
+	v := r.unsatisfiedCriterion(filter)
+	if !v.Accepted() {
+		logthis.Info(v.String(), logthis.VERBOSE)
+		return v
+	}
+	// taking the opportunity to retrieve and save some info
+	r.Filter = filter.Name
+	return v
+}
+
+// unsatisfiedCriterion returns the verdict of the filter on the announced information, without side effects.
+// All criteria are evaluated, so that the verdict knows how many failed.
+func (r *Release) unsatisfiedCriterion(filter *ConfigFilter) *FilterVerdict {
+	v := &FilterVerdict{Filter: filter.Name}
 	// no longer filtering on artists. If a filter has artists defined,
 	// varroa will now wait until it gets the TorrentInfo and all of the artists
 	// to make a call.
 	if len(filter.Year) != 0 && !intslice.Contains(filter.Year, r.Year) {
-		logthis.Info(filter.Name+": Wrong year", logthis.VERBOSE)
-		return false
+		v.reject(CriterionYear, "Wrong year", intsToString(filter.Year), strconv.Itoa(r.Year))
 	}
 	if len(filter.Format) != 0 && !strslice.Contains(filter.Format, r.Format) {
-		logthis.Info(filter.Name+": Wrong format", logthis.VERBOSE)
-		return false
+		v.reject(CriterionFormat, "Wrong format", strings.Join(filter.Format, ", "), r.Format)
 	}
 	if len(filter.Source) != 0 && !strslice.Contains(filter.Source, r.Source) {
-		logthis.Info(filter.Name+": Wrong source", logthis.VERBOSE)
-		return false
+		v.reject(CriterionSource, "Wrong source", strings.Join(filter.Source, ", "), r.Source)
 	}
 	if len(filter.Quality) != 0 && !strslice.Contains(filter.Quality, r.Quality) {
-		logthis.Info(filter.Name+": Wrong quality", logthis.VERBOSE)
-		return false
+		v.reject(CriterionQuality, "Wrong quality", strings.Join(filter.Quality, ", "), r.Quality)
 	}
 	if r.Source == tracker.SourceCD && r.Format == tracker.FormatFLAC && filter.HasLog && !r.HasLog {
-		logthis.Info(filter.Name+": Release has no log", logthis.VERBOSE)
-		return false
+		v.reject(CriterionLog, "Release has no log", "log", "no log")
 	}
 	// only compare logscores if the announce contained that information
 	if r.Source == tracker.SourceCD && r.Format == tracker.FormatFLAC && filter.LogScore != 0 && (!r.HasLog || (r.LogScore != logScoreNotInAnnounce && filter.LogScore > r.LogScore)) {
-		logthis.Info(filter.Name+": Incorrect log score", logthis.VERBOSE)
-		return false
+		actual := "no log"
+		if r.HasLog {
+			actual = strconv.Itoa(r.LogScore)
+		}
+		v.reject(CriterionLogScore, "Incorrect log score", ">= "+strconv.Itoa(filter.LogScore), actual)
 	}
 	if r.Source == tracker.SourceCD && r.Format == tracker.FormatFLAC && filter.HasCue && !r.HasCue {
-		logthis.Info(filter.Name+": Release has no cue", logthis.VERBOSE)
-		return false
+		v.reject(CriterionCue, "Release has no cue", "cue", "no cue")
 	}
 	if !filter.AllowScene && r.IsScene {
-		logthis.Info(filter.Name+": Scene release not allowed", logthis.VERBOSE)
-		return false
+		v.reject(CriterionScene, "Scene release not allowed", "non-scene", "scene")
 	}
 	if len(filter.ExcludedReleaseType) != 0 && strslice.Contains(filter.ExcludedReleaseType, r.ReleaseType) {
-		logthis.Info(filter.Name+": Excluded release type", logthis.VERBOSE)
-		return false
+		v.reject(CriterionReleaseType, "Excluded release type", "not "+strings.Join(filter.ExcludedReleaseType, ", "), r.ReleaseType)
 	}
 	if len(filter.ReleaseType) != 0 && !strslice.Contains(filter.ReleaseType, r.ReleaseType) {
-		logthis.Info(filter.Name+": Wrong release type", logthis.VERBOSE)
-		return false
+		v.reject(CriterionReleaseType, "Wrong release type", strings.Join(filter.ReleaseType, ", "), r.ReleaseType)
 	}
 	// checking tags
-	if len(filter.TagsRequired) != 0 && !MatchAllInSlice(filter.TagsRequired, r.Tags) {
-		logthis.Info(filter.Name+": Does not have all required tags", logthis.VERBOSE)
-		return false
-	}
-	for _, excluded := range filter.TagsExcluded {
-		if MatchInSlice(excluded, r.Tags) {
-			logthis.Info(filter.Name+": Has excluded tag", logthis.VERBOSE)
-			return false
+	for i, required := range filter.TagsRequired {
+		if !matchAnyPatterns(matcherAt(filter.tagsRequired, i), []string{required}, r.Tags) {
+			v.reject(CriterionTags, "Does not have all required tags", "all of "+strings.Join(filter.TagsRequired, ", "), strings.Join(r.Tags, ", "))
+			break
 		}
 	}
-	if len(filter.TagsIncluded) != 0 {
-		// if none of r.tags in conf.includedTags, return false
-		atLeastOneIncludedTag := false
-		for _, t := range r.Tags {
-			if MatchInSlice(t, filter.TagsIncluded) {
-				atLeastOneIncludedTag = true
-				break
-			}
+	for i, excluded := range filter.TagsExcluded {
+		if matchAnyPatterns(matcherAt(filter.tagsExcluded, i), []string{excluded}, r.Tags) {
+			v.reject(CriterionTags, "Has excluded tag", "not "+excluded, strings.Join(r.Tags, ", "))
+			break
 		}
-		if !atLeastOneIncludedTag {
-			logthis.Info(filter.Name+": Does not have any wanted tag", logthis.VERBOSE)
-			return false
+	}
+	if len(filter.TagsIncluded) != 0 && !matchAnyPatterns(filter.tagsIncluded, filter.TagsIncluded, r.Tags) {
+		v.reject(CriterionTags, "Does not have any wanted tag", "one of "+strings.Join(filter.TagsIncluded, ", "), strings.Join(r.Tags, ", "))
+	}
+	// without tracker metadata, only reject if the expression cannot be true
+	if filter.expression != nil {
+		if result, known := filter.expression.Eval(r, nil); known && !result {
+			v.reject(CriterionExpression, "Does not match expression", filter.expression.String(), filter.expression.Values(r, nil))
 		}
 	}
+	return v
+}
+
+// HasCompatibleTrackerInfo returns the verdict of the filter on the tracker metadata.
+func (r *Release) HasCompatibleTrackerInfo(filter *ConfigFilter, blacklistedUploaders []string, info *TrackerMetadata) *FilterVerdict {
+	v := r.incompatibleTrackerInfo(filter, blacklistedUploaders, info)
+	if !v.Accepted() {
+		logthis.Info(v.String(), logthis.VERBOSE)
+		return v
+	}
 	// taking the opportunity to retrieve and save some info
-	r.Filter = filter.Name
-	return true
+	r.Size = info.Size
+	r.LogScore = info.LogScore
+	r.Folder = info.FolderName
+	r.EditionName = info.EditionName
+	r.EditionYear = info.EditionYear
+	r.FilesHash = info.FilesHash
+	r.GroupID = strconv.Itoa(info.GroupID)
+	return v
 }
 
-func (r *Release) HasCompatibleTrackerInfo(filter *ConfigFilter, blacklistedUploaders []string, info *TrackerMetadata) bool {
-	// checks
+// incompatibleTrackerInfo returns the verdict of the filter on the tracker metadata, without side effects.
+// All criteria are evaluated, so that the verdict knows how many failed.
+func (r *Release) incompatibleTrackerInfo(filter *ConfigFilter, blacklistedUploaders []string, info *TrackerMetadata) *FilterVerdict {
+	v := &FilterVerdict{Filter: filter.Name}
 	if len(filter.EditionYear) != 0 && !intslice.Contains(filter.EditionYear, info.EditionYear) {
-		logthis.Info(filter.Name+": Wrong edition year", logthis.VERBOSE)
-		return false
+		v.reject(CriterionEditionYear, "Wrong edition year", intsToString(filter.EditionYear), strconv.Itoa(info.EditionYear))
 	}
 	if filter.MaxSizeMB != 0 && uint64(filter.MaxSizeMB) < (info.Size/(1024*1024)) {
-		logthis.Info(filter.Name+": Release too big.", logthis.VERBOSE)
-		return false
+		v.reject(CriterionSize, "Release too big", fmt.Sprintf("<= %dMB", filter.MaxSizeMB), fmt.Sprintf("%dMB", info.Size/(1024*1024)))
 	}
 	if filter.MinSizeMB > 0 && uint64(filter.MinSizeMB) > (info.Size/(1024*1024)) {
-		logthis.Info(filter.Name+": Release too small.", logthis.VERBOSE)
-		return false
+		v.reject(CriterionSize, "Release too small", fmt.Sprintf(">= %dMB", filter.MinSizeMB), fmt.Sprintf("%dMB", info.Size/(1024*1024)))
 	}
 	if r.Source == tracker.SourceCD && r.Format == tracker.FormatFLAC && r.HasLog && filter.LogScore != 0 && filter.LogScore > info.LogScore {
-		logthis.Info(filter.Name+": Incorrect log score", logthis.VERBOSE)
-		return false
+		v.reject(CriterionLogScore, "Incorrect log score", ">= "+strconv.Itoa(filter.LogScore), strconv.Itoa(info.LogScore))
 	}
-	if len(filter.RecordLabel) != 0 && !MatchInSlice(info.RecordLabel, filter.RecordLabel) {
-		logthis.Info(filter.Name+": No match for record label", logthis.VERBOSE)
-		return false
+	if len(filter.RecordLabel) != 0 && !matchPatterns(filter.recordLabel, filter.RecordLabel, info.RecordLabel) {
+		v.reject(CriterionRecordLabel, "No match for record label", strings.Join(filter.RecordLabel, ", "), info.RecordLabel)
 	}
 	if len(filter.Artist) != 0 || len(filter.ExcludedArtist) != 0 {
 		var foundAtLeastOneArtist bool
+		var excludedArtist string
+		var artists []string
 		for _, iArtist := range info.Artists {
-			if MatchInSlice(iArtist.Name, filter.Artist) {
+			if matchPatterns(filter.artist, filter.Artist, iArtist.Name) {
 				foundAtLeastOneArtist = true
 			}
-			if MatchInSlice(iArtist.Name, filter.ExcludedArtist) {
-				logthis.Info(filter.Name+": Found excluded artist "+iArtist.Name, logthis.VERBOSE)
-				return false
+			if excludedArtist == "" && matchPatterns(filter.excludedArtist, filter.ExcludedArtist, iArtist.Name) {
+				excludedArtist = iArtist.Name
 			}
+			artists = append(artists, iArtist.Name)
 		}
-		if !foundAtLeastOneArtist && len(filter.Artist) != 0 {
-			logthis.Info(filter.Name+": No match for artists", logthis.VERBOSE)
-			return false
+		if excludedArtist != "" {
+			v.reject(CriterionArtist, "Found excluded artist "+excludedArtist, "not "+strings.Join(filter.ExcludedArtist, ", "), excludedArtist)
+		} else if !foundAtLeastOneArtist && len(filter.Artist) != 0 {
+			v.reject(CriterionArtist, "No match for artists", strings.Join(filter.Artist, ", "), strings.Join(artists, ", "))
 		}
 	}
 	if strslice.Contains(blacklistedUploaders, info.Uploader) || strslice.Contains(filter.BlacklistedUploaders, info.Uploader) {
-		logthis.Info(filter.Name+": Uploader "+info.Uploader+" is blacklisted.", logthis.VERBOSE)
-		return false
+		v.reject(CriterionUploader, "Uploader "+info.Uploader+" is blacklisted", "not blacklisted", info.Uploader)
 	}
 	if len(filter.Uploader) != 0 && !strslice.Contains(filter.Uploader, info.Uploader) {
-		logthis.Info(filter.Name+": No match for uploader", logthis.VERBOSE)
-		return false
+		v.reject(CriterionUploader, "No match for uploader", strings.Join(filter.Uploader, ", "), info.Uploader)
 	}
-	if len(filter.Edition) != 0 {
-		found := false
-		if MatchInSlice(info.EditionName, filter.Edition) {
-			found = true
-		}
-		if !found {
-			logthis.Info(filter.Name+": Edition name does not match any criteria.", logthis.VERBOSE)
-			return false
-		}
+	if len(filter.Edition) != 0 && !matchPatterns(filter.edition, filter.Edition, info.EditionName) {
+		v.reject(CriterionEdition, "Edition name does not match any criteria", strings.Join(filter.Edition, ", "), info.EditionName)
 	}
-	if len(filter.Title) != 0 {
-		found := false
-		if MatchInSlice(info.Title, filter.Title) {
-			found = true
-		}
-		if !found {
-			logthis.Info(filter.Name+": Title does not match any criteria.", logthis.VERBOSE)
-			return false
-		}
+	if len(filter.Title) != 0 && !matchPatterns(filter.title, filter.Title, info.Title) {
+		v.reject(CriterionTitle, "Title does not match any criteria", strings.Join(filter.Title, ", "), info.Title)
 	}
 	if filter.RejectUnknown && info.CatalogNumber == "" && info.RecordLabel == "" {
-		logthis.Info(filter.Name+": Release has neither a record label or catalog number, rejected.", logthis.VERBOSE)
-		return false
+		v.reject(CriterionRecordLabel, "Release has neither a record label or catalog number, rejected", "record label or catalog number", "none")
 	}
 	if filter.RejectTrumpable && info.Trumpable {
-		logthis.Info(filter.Name+": Release is marked as trumpable, rejected.", logthis.VERBOSE)
-		return false
+		v.reject(CriterionTrumpable, "Release is marked as trumpable, rejected", "not trumpable", "trumpable")
 	}
-	// taking the opportunity to retrieve and save some info
-	r.Size = info.Size
-	r.LogScore = info.LogScore
-	r.Folder = info.FolderName
-	r.GroupID = strconv.Itoa(info.GroupID)
-	return true
+	if filter.expression != nil {
+		if result, _ := filter.expression.Eval(r, info); !result {
+			v.reject(CriterionExpression, "Does not match expression", filter.expression.String(), filter.expression.Values(r, info))
+		}
+	}
+	return v
 }
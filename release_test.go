@@ -176,6 +176,8 @@ func TestRelease(t *testing.T) {
 	f35 := &ConfigFilter{Name: "f35", AllowScene: true, TagsRequired: []string{"nope"}}
 	f36 := &ConfigFilter{Name: "f36", AllowScene: true, TagsRequired: []string{"tag1"}}
 	f37 := &ConfigFilter{Name: "f37", AllowScene: true, TagsRequired: []string{"tag1", "nope"}}
+	f38 := &ConfigFilter{Name: "f38", AllowScene: true, TagsIncluded: []string{"r/^tag[13]$"}, TagsExcluded: []string{"r/4$"}}
+	f39 := &ConfigFilter{Name: "f39", AllowScene: true, TagsRequired: []string{"re:^TAG1$"}}
 
 	// checking filters
 	check.NotNil(f0.check())
@@ -216,226 +218,262 @@ func TestRelease(t *testing.T) {
 	check.Nil(f35.check())
 	check.Nil(f36.check())
 	check.Nil(f37.check())
+	check.Nil(f38.check())
+	check.Nil(f39.check())
 
 	// tests
-	check.True(r1.Satisfies(f1))
-	check.True(r2.Satisfies(f1))
-	check.False(r3.Satisfies(f1))
-	check.False(r4.Satisfies(f1))
-	check.False(r5.Satisfies(f1))
-
-	check.True(r1.Satisfies(f2))
-	check.False(r2.Satisfies(f2))
-	check.False(r3.Satisfies(f2))
-	check.False(r4.Satisfies(f2))
-	check.True(r5.Satisfies(f2))
-
-	check.False(r1.Satisfies(f3))
-	check.True(r2.Satisfies(f3))
-	check.False(r3.Satisfies(f3))
-	check.False(r4.Satisfies(f3))
-	check.False(r5.Satisfies(f3))
-
-	check.True(r1.Satisfies(f4))
-	check.True(r2.Satisfies(f4))
-	check.False(r3.Satisfies(f4))
-	check.False(r4.Satisfies(f4))
-	check.True(r5.Satisfies(f4))
-
-	check.False(r1.Satisfies(f5))
-	check.False(r2.Satisfies(f5))
-	check.False(r3.Satisfies(f5))
-	check.True(r4.Satisfies(f5))
-	check.False(r5.Satisfies(f5))
-
-	check.False(r1.Satisfies(f6))
-	check.False(r2.Satisfies(f6))
-	check.False(r3.Satisfies(f6))
-	check.True(r4.Satisfies(f6))
-	check.False(r5.Satisfies(f6))
-
-	check.False(r1.Satisfies(f7))
-	check.False(r2.Satisfies(f7))
-	check.False(r3.Satisfies(f7))
-	check.True(r4.Satisfies(f7))
-	check.False(r5.Satisfies(f7))
-
-	check.False(r1.Satisfies(f8))
-	check.False(r2.Satisfies(f8))
-	check.True(r3.Satisfies(f8))
-	check.True(r4.Satisfies(f8))
-	check.False(r5.Satisfies(f8))
-
-	check.False(r1.Satisfies(f9))
-	check.False(r2.Satisfies(f9))
-	check.False(r3.Satisfies(f9))
-	check.True(r4.Satisfies(f9))
-	check.False(r5.Satisfies(f9))
-
-	check.False(r1.Satisfies(f10))
-	check.True(r2.Satisfies(f10))
-	check.True(r3.Satisfies(f10))
-	check.False(r4.Satisfies(f10))
-	check.False(r5.Satisfies(f10))
-
-	check.False(r1.Satisfies(f11))
-	check.True(r2.Satisfies(f11))
-	check.False(r3.Satisfies(f11))
-	check.False(r4.Satisfies(f11))
-	check.False(r5.Satisfies(f11))
-
-	check.True(r1.Satisfies(f12))
-	check.True(r2.Satisfies(f12))
-	check.False(r3.Satisfies(f12))
-	check.True(r4.Satisfies(f12))
-	check.True(r5.Satisfies(f12))
-
-	check.True(r1.Satisfies(f16))
-	check.False(r2.Satisfies(f16))
-	check.False(r3.Satisfies(f16))
-	check.True(r4.Satisfies(f16)) // logscore isn't evaluated since it's not FLAC
-	check.True(r5.Satisfies(f16))
-
-	check.True(r1.Satisfies(f17))
-	check.False(r2.Satisfies(f17))
-	check.False(r3.Satisfies(f17))
-	check.True(r4.Satisfies(f17)) // logscore isn't evaluated since it's not FLAC
-	check.False(r5.Satisfies(f17))
-
-	check.True(r1.Satisfies(f18))
-	check.True(r2.Satisfies(f18))
-	check.True(r3.Satisfies(f18)) // false with torrent info only
-	check.True(r4.Satisfies(f18))
-	check.True(r5.Satisfies(f18))
-
-	check.True(r1.Satisfies(f19)) // artists are checked with torrent info only
-	check.True(r2.Satisfies(f19))
-	check.True(r3.Satisfies(f19)) // false with torrent info only
-	check.True(r4.Satisfies(f19))
-	check.True(r5.Satisfies(f19))
-
-	check.False(r1.Satisfies(f20))
-	check.False(r2.Satisfies(f20))
-	check.True(r3.Satisfies(f20))
-	check.True(r4.Satisfies(f20))
-	check.False(r5.Satisfies(f20))
-
-	check.True(r1.Satisfies(f21))
-	check.True(r2.Satisfies(f21))
-	check.True(r3.Satisfies(f21))
-	check.True(r4.Satisfies(f21))
-	check.True(r5.Satisfies(f21))
-
-	check.True(r1.Satisfies(f22))
-	check.False(r2.Satisfies(f22))
-	check.False(r3.Satisfies(f22))
-	check.True(r4.Satisfies(f22)) // logscore isn't evaluated since it's not FLAC
-	check.True(r5.Satisfies(f22))
-
-	check.False(r1.Satisfies(f24))
-	check.False(r2.Satisfies(f24))
-	check.True(r3.Satisfies(f24))
-	check.True(r4.Satisfies(f24))
-	check.False(r5.Satisfies(f24))
-
-	check.True(r1.Satisfies(f25))
-	check.False(r2.Satisfies(f25))
-	check.False(r3.Satisfies(f25))
-	check.False(r4.Satisfies(f25))
-	check.False(r5.Satisfies(f25))
-
-	check.True(r1.Satisfies(f27)) // artists are checked with torrent info only
-	check.True(r2.Satisfies(f27))
-	check.True(r3.Satisfies(f27))
-	check.True(r4.Satisfies(f27))
-	check.True(r5.Satisfies(f27))
-
-	check.True(r1.Satisfies(f30))
+	check.True(r1.Satisfies(f1).Accepted())
+	check.True(r2.Satisfies(f1).Accepted())
+	check.False(r3.Satisfies(f1).Accepted())
+	check.False(r4.Satisfies(f1).Accepted())
+	check.False(r5.Satisfies(f1).Accepted())
+
+	check.True(r1.Satisfies(f2).Accepted())
+	check.False(r2.Satisfies(f2).Accepted())
+	check.False(r3.Satisfies(f2).Accepted())
+	check.False(r4.Satisfies(f2).Accepted())
+	check.True(r5.Satisfies(f2).Accepted())
+
+	check.False(r1.Satisfies(f3).Accepted())
+	check.True(r2.Satisfies(f3).Accepted())
+	check.False(r3.Satisfies(f3).Accepted())
+	check.False(r4.Satisfies(f3).Accepted())
+	check.False(r5.Satisfies(f3).Accepted())
+
+	check.True(r1.Satisfies(f4).Accepted())
+	check.True(r2.Satisfies(f4).Accepted())
+	check.False(r3.Satisfies(f4).Accepted())
+	check.False(r4.Satisfies(f4).Accepted())
+	check.True(r5.Satisfies(f4).Accepted())
+
+	check.False(r1.Satisfies(f5).Accepted())
+	check.False(r2.Satisfies(f5).Accepted())
+	check.False(r3.Satisfies(f5).Accepted())
+	check.True(r4.Satisfies(f5).Accepted())
+	check.False(r5.Satisfies(f5).Accepted())
+
+	check.False(r1.Satisfies(f6).Accepted())
+	check.False(r2.Satisfies(f6).Accepted())
+	check.False(r3.Satisfies(f6).Accepted())
+	check.True(r4.Satisfies(f6).Accepted())
+	check.False(r5.Satisfies(f6).Accepted())
+
+	check.False(r1.Satisfies(f7).Accepted())
+	check.False(r2.Satisfies(f7).Accepted())
+	check.False(r3.Satisfies(f7).Accepted())
+	check.True(r4.Satisfies(f7).Accepted())
+	check.False(r5.Satisfies(f7).Accepted())
+
+	check.False(r1.Satisfies(f8).Accepted())
+	check.False(r2.Satisfies(f8).Accepted())
+	check.True(r3.Satisfies(f8).Accepted())
+	check.True(r4.Satisfies(f8).Accepted())
+	check.False(r5.Satisfies(f8).Accepted())
+
+	check.False(r1.Satisfies(f9).Accepted())
+	check.False(r2.Satisfies(f9).Accepted())
+	check.False(r3.Satisfies(f9).Accepted())
+	check.True(r4.Satisfies(f9).Accepted())
+	check.False(r5.Satisfies(f9).Accepted())
+
+	check.False(r1.Satisfies(f10).Accepted())
+	check.True(r2.Satisfies(f10).Accepted())
+	check.True(r3.Satisfies(f10).Accepted())
+	check.False(r4.Satisfies(f10).Accepted())
+	check.False(r5.Satisfies(f10).Accepted())
+
+	check.False(r1.Satisfies(f11).Accepted())
+	check.True(r2.Satisfies(f11).Accepted())
+	check.False(r3.Satisfies(f11).Accepted())
+	check.False(r4.Satisfies(f11).Accepted())
+	check.False(r5.Satisfies(f11).Accepted())
+
+	check.True(r1.Satisfies(f12).Accepted())
+	check.True(r2.Satisfies(f12).Accepted())
+	check.False(r3.Satisfies(f12).Accepted())
+	check.True(r4.Satisfies(f12).Accepted())
+	check.True(r5.Satisfies(f12).Accepted())
+
+	check.True(r1.Satisfies(f16).Accepted())
+	check.False(r2.Satisfies(f16).Accepted())
+	check.False(r3.Satisfies(f16).Accepted())
+	check.True(r4.Satisfies(f16).Accepted()) // logscore isn't evaluated since it's not FLAC
+	check.True(r5.Satisfies(f16).Accepted())
+
+	check.True(r1.Satisfies(f17).Accepted())
+	check.False(r2.Satisfies(f17).Accepted())
+	check.False(r3.Satisfies(f17).Accepted())
+	check.True(r4.Satisfies(f17).Accepted()) // logscore isn't evaluated since it's not FLAC
+	check.False(r5.Satisfies(f17).Accepted())
+
+	check.True(r1.Satisfies(f18).Accepted())
+	check.True(r2.Satisfies(f18).Accepted())
+	check.True(r3.Satisfies(f18).Accepted()) // false with torrent info only
+	check.True(r4.Satisfies(f18).Accepted())
+	check.True(r5.Satisfies(f18).Accepted())
+
+	check.True(r1.Satisfies(f19).Accepted()) // artists are checked with torrent info only
+	check.True(r2.Satisfies(f19).Accepted())
+	check.True(r3.Satisfies(f19).Accepted()) // false with torrent info only
+	check.True(r4.Satisfies(f19).Accepted())
+	check.True(r5.Satisfies(f19).Accepted())
+
+	check.False(r1.Satisfies(f20).Accepted())
+	check.False(r2.Satisfies(f20).Accepted())
+	check.True(r3.Satisfies(f20).Accepted())
+	check.True(r4.Satisfies(f20).Accepted())
+	check.False(r5.Satisfies(f20).Accepted())
+
+	check.True(r1.Satisfies(f21).Accepted())
+	check.True(r2.Satisfies(f21).Accepted())
+	check.True(r3.Satisfies(f21).Accepted())
+	check.True(r4.Satisfies(f21).Accepted())
+	check.True(r5.Satisfies(f21).Accepted())
+
+	check.True(r1.Satisfies(f22).Accepted())
+	check.False(r2.Satisfies(f22).Accepted())
+	check.False(r3.Satisfies(f22).Accepted())
+	check.True(r4.Satisfies(f22).Accepted()) // logscore isn't evaluated since it's not FLAC
+	check.True(r5.Satisfies(f22).Accepted())
+
+	check.False(r1.Satisfies(f24).Accepted())
+	check.False(r2.Satisfies(f24).Accepted())
+	check.True(r3.Satisfies(f24).Accepted())
+	check.True(r4.Satisfies(f24).Accepted())
+	check.False(r5.Satisfies(f24).Accepted())
+
+	check.True(r1.Satisfies(f25).Accepted())
+	check.False(r2.Satisfies(f25).Accepted())
+	check.False(r3.Satisfies(f25).Accepted())
+	check.False(r4.Satisfies(f25).Accepted())
+	check.False(r5.Satisfies(f25).Accepted())
+
+	check.True(r1.Satisfies(f27).Accepted()) // artists are checked with torrent info only
+	check.True(r2.Satisfies(f27).Accepted())
+	check.True(r3.Satisfies(f27).Accepted())
+	check.True(r4.Satisfies(f27).Accepted())
+	check.True(r5.Satisfies(f27).Accepted())
+
+	check.True(r1.Satisfies(f30).Accepted())
 
 	// required tags
-	check.False(r1.Satisfies(f35))
-	check.False(r2.Satisfies(f35))
-	check.False(r3.Satisfies(f35))
-	check.False(r4.Satisfies(f35))
-	check.False(r5.Satisfies(f35))
-
-	check.True(r1.Satisfies(f36))
-	check.True(r2.Satisfies(f36))
-	check.False(r3.Satisfies(f36))
-	check.False(r4.Satisfies(f36))
-	check.True(r5.Satisfies(f36))
-
-	check.False(r1.Satisfies(f37))
-	check.False(r2.Satisfies(f37))
-	check.False(r3.Satisfies(f37))
-	check.False(r4.Satisfies(f37))
-	check.False(r5.Satisfies(f37))
+	check.False(r1.Satisfies(f35).Accepted())
+	check.False(r2.Satisfies(f35).Accepted())
+	check.False(r3.Satisfies(f35).Accepted())
+	check.False(r4.Satisfies(f35).Accepted())
+	check.False(r5.Satisfies(f35).Accepted())
+
+	check.True(r1.Satisfies(f36).Accepted())
+	check.True(r2.Satisfies(f36).Accepted())
+	check.False(r3.Satisfies(f36).Accepted())
+	check.False(r4.Satisfies(f36).Accepted())
+	check.True(r5.Satisfies(f36).Accepted())
+
+	check.False(r1.Satisfies(f37).Accepted())
+	check.False(r2.Satisfies(f37).Accepted())
+	check.False(r3.Satisfies(f37).Accepted())
+	check.False(r4.Satisfies(f37).Accepted())
+	check.False(r5.Satisfies(f37).Accepted())
+
+	// tag patterns compiled by check()
+	check.NotNil(f38.tagsIncluded)
+	check.Equal(1, len(f38.tagsExcluded))
+	check.True(r1.Satisfies(f38).Accepted())
+	check.True(r2.Satisfies(f38).Accepted())
+	check.False(r3.Satisfies(f38).Accepted())
+	check.True(r4.Satisfies(f38).Accepted())
+	check.True(r5.Satisfies(f38).Accepted())
+
+	check.True(r1.Satisfies(f39).Accepted())
+	check.True(r2.Satisfies(f39).Accepted())
+	check.False(r3.Satisfies(f39).Accepted())
+	check.False(r4.Satisfies(f39).Accepted())
+	check.True(r5.Satisfies(f39).Accepted())
 
 	// checking with TorrentInfo
 
 	// artist
-	check.True(r1.HasCompatibleTrackerInfo(f18, []string{}, i1))
-	check.False(r1.HasCompatibleTrackerInfo(f18, []string{}, i2))
-	check.False(r1.HasCompatibleTrackerInfo(f18, []string{}, i3))
-	check.True(r1.HasCompatibleTrackerInfo(f19, []string{}, i1))
-	check.False(r1.HasCompatibleTrackerInfo(f19, []string{}, i2))
-	check.False(r1.HasCompatibleTrackerInfo(f19, []string{}, i3))
-	check.False(r1.HasCompatibleTrackerInfo(f27, []string{}, i1))
-	check.True(r1.HasCompatibleTrackerInfo(f27, []string{}, i2))
-	check.True(r1.HasCompatibleTrackerInfo(f27, []string{}, i3))
+	check.True(r1.HasCompatibleTrackerInfo(f18, []string{}, i1).Accepted())
+	check.False(r1.HasCompatibleTrackerInfo(f18, []string{}, i2).Accepted())
+	check.False(r1.HasCompatibleTrackerInfo(f18, []string{}, i3).Accepted())
+	check.True(r1.HasCompatibleTrackerInfo(f19, []string{}, i1).Accepted())
+	check.False(r1.HasCompatibleTrackerInfo(f19, []string{}, i2).Accepted())
+	check.False(r1.HasCompatibleTrackerInfo(f19, []string{}, i3).Accepted())
+	check.False(r1.HasCompatibleTrackerInfo(f27, []string{}, i1).Accepted())
+	check.True(r1.HasCompatibleTrackerInfo(f27, []string{}, i2).Accepted())
+	check.True(r1.HasCompatibleTrackerInfo(f27, []string{}, i3).Accepted())
 
 	// log score
-	check.True(r1.HasCompatibleTrackerInfo(f17, []string{}, i1))
-	check.False(r1.HasCompatibleTrackerInfo(f17, []string{}, i2))
-	check.True(r1.HasCompatibleTrackerInfo(f14, []string{}, i2))
-	check.True(r1.HasCompatibleTrackerInfo(f14, []string{}, i1))
-	check.True(r1.HasCompatibleTrackerInfo(f25, []string{}, i1))
-	check.False(r1.HasCompatibleTrackerInfo(f25, []string{}, i2))
+	check.True(r1.HasCompatibleTrackerInfo(f17, []string{}, i1).Accepted())
+	check.False(r1.HasCompatibleTrackerInfo(f17, []string{}, i2).Accepted())
+	check.True(r1.HasCompatibleTrackerInfo(f14, []string{}, i2).Accepted())
+	check.True(r1.HasCompatibleTrackerInfo(f14, []string{}, i1).Accepted())
+	check.True(r1.HasCompatibleTrackerInfo(f25, []string{}, i1).Accepted())
+	check.False(r1.HasCompatibleTrackerInfo(f25, []string{}, i2).Accepted())
 
 	// blacklisted users
-	check.False(r1.HasCompatibleTrackerInfo(f17, []string{"that_guy", "another_one"}, i1))
-	check.False(r1.HasCompatibleTrackerInfo(f17, []string{"another_test", "that_guy", "another_one"}, i1))
-	check.True(r1.HasCompatibleTrackerInfo(f17, []string{"another_test", "another_one"}, i1))
+	check.False(r1.HasCompatibleTrackerInfo(f17, []string{"that_guy", "another_one"}, i1).Accepted())
+	check.False(r1.HasCompatibleTrackerInfo(f17, []string{"another_test", "that_guy", "another_one"}, i1).Accepted())
+	check.True(r1.HasCompatibleTrackerInfo(f17, []string{"another_test", "another_one"}, i1).Accepted())
 
 	// whitelisted users
-	check.False(r1.HasCompatibleTrackerInfo(f29, []string{"that_guy", "another_one"}, i1))
-	check.True(r1.HasCompatibleTrackerInfo(f29, []string{"another_one"}, i1))
-	check.False(r1.HasCompatibleTrackerInfo(f29, []string{"another_one"}, i2))
+	check.False(r1.HasCompatibleTrackerInfo(f29, []string{"that_guy", "another_one"}, i1).Accepted())
+	check.True(r1.HasCompatibleTrackerInfo(f29, []string{"another_one"}, i1).Accepted())
+	check.False(r1.HasCompatibleTrackerInfo(f29, []string{"another_one"}, i2).Accepted())
 
 	// labels
-	check.True(r1.HasCompatibleTrackerInfo(f26, []string{}, i5))
-	check.False(r1.HasCompatibleTrackerInfo(f26, []string{}, i6))
+	check.True(r1.HasCompatibleTrackerInfo(f26, []string{}, i5).Accepted())
+	check.False(r1.HasCompatibleTrackerInfo(f26, []string{}, i6).Accepted())
 
 	// min/max size out of bounds
-	check.False(r5.HasCompatibleTrackerInfo(f21, []string{}, i3))
-	check.False(r5.HasCompatibleTrackerInfo(f21, []string{}, i4))
+	check.False(r5.HasCompatibleTrackerInfo(f21, []string{}, i3).Accepted())
+	check.False(r5.HasCompatibleTrackerInfo(f21, []string{}, i4).Accepted())
 
 	// edition
-	check.False(r1.HasCompatibleTrackerInfo(f28, []string{}, i5))
-	check.False(r1.HasCompatibleTrackerInfo(f28, []string{}, i6))
-	check.True(r1.HasCompatibleTrackerInfo(f28, []string{}, i7))
-	check.False(r1.HasCompatibleTrackerInfo(f28, []string{}, i8))
-	check.False(r1.HasCompatibleTrackerInfo(f32, []string{}, i5))
-	check.False(r1.HasCompatibleTrackerInfo(f32, []string{}, i6))
-	check.False(r1.HasCompatibleTrackerInfo(f32, []string{}, i7))
-	check.False(r1.HasCompatibleTrackerInfo(f32, []string{}, i8))
-	check.True(r1.HasCompatibleTrackerInfo(f34, []string{}, i5))
-	check.True(r1.HasCompatibleTrackerInfo(f34, []string{}, i6))
-	check.False(r1.HasCompatibleTrackerInfo(f34, []string{}, i7))
-	check.False(r1.HasCompatibleTrackerInfo(f34, []string{}, i8))
+	check.False(r1.HasCompatibleTrackerInfo(f28, []string{}, i5).Accepted())
+	check.False(r1.HasCompatibleTrackerInfo(f28, []string{}, i6).Accepted())
+	check.True(r1.HasCompatibleTrackerInfo(f28, []string{}, i7).Accepted())
+	check.False(r1.HasCompatibleTrackerInfo(f28, []string{}, i8).Accepted())
+	check.False(r1.HasCompatibleTrackerInfo(f32, []string{}, i5).Accepted())
+	check.False(r1.HasCompatibleTrackerInfo(f32, []string{}, i6).Accepted())
+	check.False(r1.HasCompatibleTrackerInfo(f32, []string{}, i7).Accepted())
+	check.False(r1.HasCompatibleTrackerInfo(f32, []string{}, i8).Accepted())
+	check.True(r1.HasCompatibleTrackerInfo(f34, []string{}, i5).Accepted())
+	check.True(r1.HasCompatibleTrackerInfo(f34, []string{}, i6).Accepted())
+	check.False(r1.HasCompatibleTrackerInfo(f34, []string{}, i7).Accepted())
+	check.False(r1.HasCompatibleTrackerInfo(f34, []string{}, i8).Accepted())
 
 	// reject unknown releases
-	check.False(r1.HasCompatibleTrackerInfo(f30, []string{}, i1))
-	check.True(r1.HasCompatibleTrackerInfo(f30, []string{}, i5))
+	check.False(r1.HasCompatibleTrackerInfo(f30, []string{}, i1).Accepted())
+	check.True(r1.HasCompatibleTrackerInfo(f30, []string{}, i5).Accepted())
 
 	// edition year
-	check.False(r1.HasCompatibleTrackerInfo(f31, []string{}, i6))
-	check.True(r1.HasCompatibleTrackerInfo(f31, []string{}, i7))
-	check.False(r1.HasCompatibleTrackerInfo(f31, []string{}, i8))
+	check.False(r1.HasCompatibleTrackerInfo(f31, []string{}, i6).Accepted())
+	check.True(r1.HasCompatibleTrackerInfo(f31, []string{}, i7).Accepted())
+	check.False(r1.HasCompatibleTrackerInfo(f31, []string{}, i8).Accepted())
 
 	// filter-level blacklisted uploaders
-	check.False(r1.HasCompatibleTrackerInfo(f33, []string{}, i1))
-	check.False(r1.HasCompatibleTrackerInfo(f33, []string{"that_guy"}, i1))
-	check.False(r1.HasCompatibleTrackerInfo(f33, []string{"another_one"}, i1))
-	check.True(r1.HasCompatibleTrackerInfo(f33, []string{}, i2))
+	check.False(r1.HasCompatibleTrackerInfo(f33, []string{}, i1).Accepted())
+	check.False(r1.HasCompatibleTrackerInfo(f33, []string{"that_guy"}, i1).Accepted())
+	check.False(r1.HasCompatibleTrackerInfo(f33, []string{"another_one"}, i1).Accepted())
+	check.True(r1.HasCompatibleTrackerInfo(f33, []string{}, i2).Accepted())
+
+	// structured verdicts
+	v := r1.Satisfies(f5)
+	check.False(v.Accepted())
+	check.Equal("f5", v.Filter)
+	check.Equal(CriterionFormat, v.Criterion)
+	check.Equal("MP3", v.Expected)
+	check.Equal("FLAC", v.Actual)
+	v = r5.HasCompatibleTrackerInfo(f21, []string{}, i4)
+	check.False(v.Accepted())
+	check.Equal(CriterionSize, v.Criterion)
+	check.Equal("<= 100MB", v.Expected)
+	check.Equal("117MB", v.Actual)
+	v = r1.HasCompatibleTrackerInfo(f33, []string{}, i1)
+	check.Equal(CriterionUploader, v.Criterion)
+	check.Equal("that_guy", v.Actual)
+	v = r1.HasCompatibleTrackerInfo(f33, []string{}, i2)
+	check.True(v.Accepted())
+	check.Equal("", v.Criterion)
 }
@@ -0,0 +1,74 @@
+package varroa
+
+import (
+	"fmt"
+)
+
+// Criteria a filter can reject a release on.
+const (
+	CriterionYear          = "year"
+	CriterionFormat        = "format"
+	CriterionSource        = "source"
+	CriterionQuality       = "quality"
+	CriterionLog           = "log"
+	CriterionLogScore      = "log score"
+	CriterionCue           = "cue"
+	CriterionScene         = "scene"
+	CriterionReleaseType   = "release type"
+	CriterionTags          = "tags"
+	CriterionEditionYear   = "edition year"
+	CriterionSize          = "size"
+	CriterionRecordLabel   = "record label"
+	CriterionArtist        = "artist"
+	CriterionUploader      = "uploader"
+	CriterionEdition       = "edition"
+	CriterionTitle         = "title"
+	CriterionTrumpable     = "trumpable"
+	CriterionExpression    = "expression"
+	CriterionDuplicate     = "duplicate"
+	CriterionUniqueInGroup = "unique in group"
+	CriterionQuota         = "quota"
+)
+
+// FilterVerdict explains why a filter accepted or rejected a release.
+// An empty Criterion means the release was accepted.
+// If several criteria failed, only the first is described, but all are counted.
+type FilterVerdict struct {
+	Filter         string
+	Criterion      string
+	Reason         string
+	Expected       string
+	Actual         string
+	FailedCriteria int
+}
+
+// Accepted returns true if the filter did not reject the release.
+func (v *FilterVerdict) Accepted() bool {
+	return v.Criterion == ""
+}
+
+// NearMiss returns true if the release was rejected because of a single criterion, among those that could be checked.
+// Releases rejected only because they were already snatched, or because the filter reached its quota, are not near-misses.
+func (v *FilterVerdict) NearMiss() bool {
+	return v.FailedCriteria == 1 && v.Criterion != CriterionDuplicate && v.Criterion != CriterionUniqueInGroup && v.Criterion != CriterionQuota
+}
+
+func (v *FilterVerdict) reject(criterion, reason, expected, actual string) *FilterVerdict {
+	v.FailedCriteria++
+	if !v.Accepted() {
+		// keeping the first failed criterion
+		return v
+	}
+	v.Criterion = criterion
+	v.Reason = reason
+	v.Expected = expected
+	v.Actual = actual
+	return v
+}
+
+func (v *FilterVerdict) String() string {
+	if v.Accepted() {
+		return v.Filter + ": accepted"
+	}
+	return fmt.Sprintf("%s: %s (expected: %s; actual: %s)", v.Filter, v.Reason, v.Expected, v.Actual)
+}
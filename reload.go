@@ -0,0 +1,295 @@
+package varroa
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
+	"reflect"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"gitlab.com/catastrophic/assistance/logthis"
+	"gitlab.com/passelecasque/obstruction/tracker"
+)
+
+const (
+	configurationWatchPeriod = 5 * time.Second
+	webServerShutdownTimeout = 5 * time.Second
+)
+
+// startAnnounceSources connects to the announce channel of a tracker and polls its feed, if autosnatching is configured for it.
+func (e *Environment) startAnnounceSources(label string) {
+	conf := e.Config()
+	t, ok := e.trackers()[label]
+	if !ok || !conf.autosnatchConfigured {
+		return
+	}
+	autosnatchConfig, err := conf.GetAutosnatch(label)
+	if err != nil {
+		return
+	}
+	var sources []AnnounceSource
+	if autosnatchConfig.usesIRC() {
+		sources = append(sources, newIRCSupervisor(e, t, autosnatchConfig))
+	}
+	if autosnatchConfig.Feed != nil {
+		sources = append(sources, newFeedPoller(e, t, autosnatchConfig))
+	}
+	e.mutex.Lock()
+	e.announceSources[label] = sources
+	e.mutex.Unlock()
+	for _, s := range sources {
+		s.Start()
+	}
+}
+
+// stopAnnounceSources disconnects from the announce channel of a tracker and stops polling its feed.
+func (e *Environment) stopAnnounceSources(label string) {
+	e.mutex.Lock()
+	sources := e.announceSources[label]
+	delete(e.announceSources, label)
+	e.mutex.Unlock()
+	if len(sources) != 0 {
+		logthis.Info("No longer following announces for tracker "+label+".", logthis.NORMAL)
+	}
+	for _, s := range sources {
+		s.Stop()
+	}
+}
+
+// startSnatchQueue starts the workers downloading the releases accepted by the filters.
+func (e *Environment) startSnatchQueue() {
+	conf := e.Config()
+	if !conf.autosnatchConfigured {
+		return
+	}
+	queue, err := NewSnatchQueue(e.paths.SnatchQueueDB())
+	if err != nil {
+		logthis.Error(err, logthis.NORMAL)
+		return
+	}
+	queue.Start(e, conf.General.SnatchWorkers)
+}
+
+// stopSnatchQueue waits for the current downloads to end; the rest of the queue is kept for later.
+func (e *Environment) stopSnatchQueue() {
+	if snatchQueue != nil {
+		snatchQueue.Stop()
+	}
+}
+
+func (e *Environment) startStatsMonitoring() {
+	if !e.Config().statsConfigured {
+		return
+	}
+	e.mutex.Lock()
+	e.stopStats = make(chan struct{})
+	stop := e.stopStats
+	e.mutex.Unlock()
+	go monitorAllStats(e, stop)
+}
+
+func (e *Environment) stopStatsMonitoring() {
+	e.mutex.Lock()
+	if e.stopStats != nil {
+		close(e.stopStats)
+		e.stopStats = nil
+	}
+	e.mutex.Unlock()
+}
+
+// startCompletionWatcher checks regularly if the releases sent to the torrent client have been downloaded, and processes them.
+// Without a torrent client, the downloads directory is watched instead.
+func (e *Environment) startCompletionWatcher() {
+	conf := e.Config()
+	period := downloadFolderPollPeriod
+	switch {
+	case conf.torrentClientConfigured:
+		period = time.Duration(conf.TorrentClient.PollMinutes) * time.Minute
+	case !conf.DownloadFolderConfigured:
+		return
+	}
+	e.mutex.Lock()
+	e.stopCompletions = make(chan struct{})
+	stop := e.stopCompletions
+	e.mutex.Unlock()
+	go watchCompletions(e, period, stop)
+}
+
+func (e *Environment) stopCompletionWatcher() {
+	e.mutex.Lock()
+	if e.stopCompletions != nil {
+		close(e.stopCompletions)
+		e.stopCompletions = nil
+	}
+	e.mutex.Unlock()
+}
+
+func (e *Environment) startWebServer() {
+	if conf := e.Config(); conf.webserverConfigured {
+		go webServer(e, conf)
+	}
+}
+
+func (e *Environment) addWebServer(s *http.Server) {
+	e.mutex.Lock()
+	e.webServers = append(e.webServers, s)
+	e.mutex.Unlock()
+}
+
+func (e *Environment) stopWebServer() {
+	e.mutex.Lock()
+	servers := e.webServers
+	e.webServers = nil
+	e.mutex.Unlock()
+	for _, s := range servers {
+		ctx, cancel := context.WithTimeout(context.Background(), webServerShutdownTimeout)
+		if err := s.Shutdown(ctx); err != nil {
+			logthis.Error(errors.Wrap(err, "Error shutting down web server"), logthis.NORMAL)
+		}
+		cancel()
+	}
+}
+
+// ReloadConfiguration reads the configuration file again and swaps it in, restarting the services whose configuration has changed.
+// If the new configuration is not valid, the current configuration is kept.
+func (e *Environment) ReloadConfiguration() error {
+	e.reloading.Lock()
+	defer e.reloading.Unlock()
+
+	newConf, err := readConfiguration(e.paths.ConfigurationFile)
+	if err != nil {
+		return errors.Wrap(err, errorReloadingConfig)
+	}
+	oldConf := e.Config()
+
+	// setting up the trackers that have changed first, so that the new configuration is not applied without them
+	newTrackers := make(map[string]*tracker.Gazelle)
+	for _, label := range newConf.TrackerLabels() {
+		oldTrackerConfig, _ := oldConf.GetTracker(label)
+		newTrackerConfig, _ := newConf.GetTracker(label)
+		if reflect.DeepEqual(oldTrackerConfig, newTrackerConfig) {
+			continue
+		}
+		t, err := newTracker(newTrackerConfig)
+		if err != nil {
+			return errors.Wrap(err, errorReloadingConfig)
+		}
+		if err := loginTracker(t, label); err != nil {
+			return errors.Wrap(err, errorReloadingConfig)
+		}
+		newTrackers[label] = t
+	}
+	var removedTrackers []string
+	for _, label := range oldConf.TrackerLabels() {
+		if _, err := newConf.GetTracker(label); err != nil {
+			removedTrackers = append(removedTrackers, label)
+		}
+	}
+
+	e.mutex.Lock()
+	e.config = newConf
+	for _, label := range removedTrackers {
+		delete(e.Trackers, label)
+	}
+	for label, t := range newTrackers {
+		e.Trackers[label] = t
+	}
+	e.mutex.Unlock()
+	setCurrentConfig(newConf)
+	if err := e.applyConfiguration(); err != nil {
+		logthis.Error(errors.Wrap(err, errorReloadingConfig), logthis.NORMAL)
+	}
+
+	// announce sources
+	for _, label := range removedTrackers {
+		e.stopAnnounceSources(label)
+	}
+	for _, label := range newConf.TrackerLabels() {
+		_, trackerChanged := newTrackers[label]
+		if trackerChanged || oldConf.autosnatchConfigured != newConf.autosnatchConfigured || autosnatchChanged(oldConf, newConf, label) {
+			e.stopAnnounceSources(label)
+			e.startAnnounceSources(label)
+		}
+	}
+	// snatch queue
+	if oldConf.autosnatchConfigured != newConf.autosnatchConfigured || oldConf.General.SnatchWorkers != newConf.General.SnatchWorkers {
+		e.stopSnatchQueue()
+		e.startSnatchQueue()
+	}
+	// stats
+	if len(newTrackers) != 0 || len(removedTrackers) != 0 || !reflect.DeepEqual(oldConf.Stats, newConf.Stats) || !reflect.DeepEqual(oldConf.GitlabPages, newConf.GitlabPages) {
+		e.stopStatsMonitoring()
+		e.startStatsMonitoring()
+	}
+	// torrent client & completed downloads
+	if !reflect.DeepEqual(oldConf.TorrentClient, newConf.TorrentClient) || oldConf.General.DownloadDir != newConf.General.DownloadDir {
+		e.stopCompletionWatcher()
+		e.startCompletionWatcher()
+	}
+	// web server
+	if !reflect.DeepEqual(oldConf.WebServer, newConf.WebServer) || !reflect.DeepEqual(oldConf.Library, newConf.Library) {
+		e.stopWebServer()
+		e.startWebServer()
+	}
+	logthis.Info(infoConfigurationReloaded, logthis.NORMAL)
+	return nil
+}
+
+// autosnatchChanged returns true if the autosnatch configuration of a tracker has changed.
+func autosnatchChanged(oldConf, newConf *Config, label string) bool {
+	oldAutosnatch, oldErr := oldConf.GetAutosnatch(label)
+	newAutosnatch, newErr := newConf.GetAutosnatch(label)
+	if oldErr != nil || newErr != nil {
+		return (oldErr == nil) != (newErr == nil)
+	}
+	oldCopy, newCopy := *oldAutosnatch, *newAutosnatch
+	// the filters and the snatch queue read these settings for each release
+	oldCopy.SnatchDelaySeconds, newCopy.SnatchDelaySeconds = 0, 0
+	oldCopy.SnatchIntervalSeconds, newCopy.SnatchIntervalSeconds = 0, 0
+	oldCopy.SnatchAttempts, newCopy.SnatchAttempts = 0, 0
+	oldCopy.SnatchRetrySeconds, newCopy.SnatchRetrySeconds = 0, 0
+	oldCopy.FLTokens, newCopy.FLTokens = 0, 0
+	return !reflect.DeepEqual(oldCopy, newCopy)
+}
+
+// configurationFile currently in use, encrypted or not.
+func configurationFile(paths *Paths) string {
+	if _, err := os.Stat(paths.ConfigurationFile); err != nil {
+		return paths.EncryptedConfigurationFile()
+	}
+	return paths.ConfigurationFile
+}
+
+// watchConfiguration reloads the configuration on SIGHUP, or when the configuration file is modified.
+func watchConfiguration(e *Environment) {
+	hangUp := make(chan os.Signal, 1)
+	signal.Notify(hangUp, syscall.SIGHUP)
+	ticker := time.NewTicker(configurationWatchPeriod)
+	defer ticker.Stop()
+
+	modTime := func() time.Time {
+		if info, err := os.Stat(configurationFile(e.paths)); err == nil {
+			return info.ModTime()
+		}
+		return time.Time{}
+	}
+	lastModified := modTime()
+	for {
+		select {
+		case <-hangUp:
+			logthis.Info("Received SIGHUP, reloading configuration.", logthis.NORMAL)
+		case <-ticker.C:
+			if !modTime().After(lastModified) {
+				continue
+			}
+			logthis.Info("Configuration file modified, reloading.", logthis.NORMAL)
+		}
+		lastModified = modTime()
+		if err := e.ReloadConfiguration(); err != nil {
+			logthis.Error(err, logthis.NORMAL)
+		}
+	}
+}
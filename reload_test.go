@@ -0,0 +1,69 @@
+package varroa
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReloadConfiguration(t *testing.T) {
+	fmt.Println("+ Testing Environment/reload...")
+	check := assert.New(t)
+
+	// setting up
+	check.Nil(os.Mkdir("library", 0777))
+	defer os.Remove("library")
+	previousConfig := config
+	defer setCurrentConfig(previousConfig)
+	original, err := ioutil.ReadFile("test/test_complete.yaml")
+	check.Nil(err)
+	dataDir, err := ioutil.TempDir("", "varroa")
+	check.Nil(err)
+	defer os.RemoveAll(dataDir)
+	configurationFile := filepath.Join(dataDir, DefaultConfigurationFile)
+	check.Nil(ioutil.WriteFile(configurationFile, original, 0600))
+
+	e := NewEnvironment(NewPaths(configurationFile, dataDir, ""))
+	e.config, err = readConfiguration(configurationFile)
+	check.Nil(err)
+	check.Nil(e.DisableAutosnatching(reasonManualToggle, "blue"))
+	oldConfig := e.config
+
+	// valid modification
+	modified := strings.Replace(string(original), "max_snatches_per_day: 5", "max_snatches_per_day: 7", 1)
+	check.Nil(ioutil.WriteFile(configurationFile, []byte(modified), 0600))
+	check.Nil(e.ReloadConfiguration())
+	check.NotEqual(oldConfig, e.config)
+	check.True(e.config == config)
+	check.Equal(7, e.config.Filters[len(e.config.Filters)-1].MaxSnatchesPerDay)
+	// the state of autosnatching survives the reload, and can still be changed
+	check.False(e.autosnatchingEnabled("blue"))
+	check.Nil(e.EnableAutosnatching(reasonManualToggle, "blue"))
+	check.True(e.autosnatchingEnabled("blue"))
+	// nothing to restart
+	check.False(autosnatchChanged(oldConfig, e.config, "blue"))
+	check.Nil(e.stopStats)
+	check.Equal(0, len(e.webServers))
+
+	// invalid modification: the current configuration is kept
+	currentConfig := e.config
+	invalid := strings.Replace(modified, "max_snatches_per_day: 7", "max_snatches_per_day: -7", 1)
+	check.Nil(ioutil.WriteFile(configurationFile, []byte(invalid), 0600))
+	check.NotNil(e.ReloadConfiguration())
+	check.True(currentConfig == e.config)
+	check.True(currentConfig == config)
+	check.Nil(ioutil.WriteFile(configurationFile, []byte("not: [valid"), 0600))
+	check.NotNil(e.ReloadConfiguration())
+	check.True(currentConfig == e.config)
+	// a tracker that cannot be set up: nothing is applied
+	unreachable := strings.Replace(modified, "https://blue.ch", "http://127.0.0.1:1", 1)
+	check.Nil(ioutil.WriteFile(configurationFile, []byte(unreachable), 0600))
+	check.NotNil(e.ReloadConfiguration())
+	check.True(currentConfig == e.config)
+	check.Empty(e.trackers())
+}
@@ -1,10 +1,12 @@
 package varroa
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -12,7 +14,6 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
 	"github.com/pkg/errors"
-	"github.com/sevlyar/go-daemon"
 	"gitlab.com/catastrophic/assistance/fs"
 	"gitlab.com/catastrophic/assistance/logthis"
 	"gitlab.com/passelecasque/obstruction/tracker"
@@ -52,8 +53,8 @@ type OutgoingJSON struct {
 }
 
 // TODO: see if this could also be used by irc
-func manualSnatchFromID(e *Environment, t *tracker.Gazelle, id string, useFLToken bool) (*Release, error) {
-	stats, err := NewStatsDB(filepath.Join(StatsDir, DefaultHistoryDB))
+func manualSnatchFromID(e *Environment, conf *Config, t *tracker.Gazelle, id string, useFLToken bool) (*Release, error) {
+	stats, err := NewStatsDB(e.paths.StatsDir(), conf)
 	if err != nil {
 		return nil, errors.Wrap(err, "could not access the stats database")
 	}
@@ -74,7 +75,8 @@ func manualSnatchFromID(e *Environment, t *tracker.Gazelle, id string, useFLToke
 	} else {
 		logthis.Info("Downloading torrent "+release.ShortString(), logthis.NORMAL)
 	}
-	if err := t.Download(info.ID, useFLToken, e.config.General.WatchDir, ""); err != nil {
+	hash, err := e.sendTorrent(t, info.ID, useFLToken, conf.General.WatchDir, "")
+	if err != nil {
 		logthis.Error(errors.Wrap(err, errorDownloadingTorrent+id), logthis.NORMAL)
 		return release, err
 	}
@@ -82,17 +84,13 @@ func manualSnatchFromID(e *Environment, t *tracker.Gazelle, id string, useFLToke
 	if release.IsMusicRelease() {
 		// add to history
 		release.Filter = manualSnatchFilterName
+		release.FLToken = useFLToken
+		release.InfoHash = hash
 		if err := stats.AddSnatch(*release); err != nil {
 			logthis.Info(errorAddingToHistory, logthis.NORMAL)
 		}
-		// save metadata
-		if e.config.General.AutomaticMetadataRetrieval {
-			if daemon.WasReborn() {
-				go info.SaveFromTracker(filepath.Join(e.config.General.DownloadDir, info.FolderName), t)
-			} else {
-				info.SaveFromTracker(filepath.Join(e.config.General.DownloadDir, info.FolderName), t)
-			}
-		}
+		// without the daemon, nothing waits for the download to complete
+		saveMetadataAtSnatch(e, t, info)
 	}
 	return release, nil
 }
@@ -142,28 +140,30 @@ func validateGet(r *http.Request, config *Config) (string, string, bool, error)
 	return trackerLabel, id, useFLToken, nil
 }
 
-func webServer(e *Environment) {
-	if !e.config.webserverConfigured {
+// webServer for a configuration. Requests are answered with the configuration in use when they arrive.
+func webServer(e *Environment, conf *Config) {
+	if !conf.webserverConfigured {
 		logthis.Info(webServerNotConfigured, logthis.NORMAL)
 		return
 	}
 	var additionalSources []string
-	if e.config.LibraryConfigured {
-		additionalSources = e.config.Library.AdditionalSources
+	if conf.LibraryConfigured {
+		additionalSources = conf.Library.AdditionalSources
 	}
-	downloads, err := NewDownloadsDB(DefaultDownloadsDB, e.config.General.DownloadDir, additionalSources)
+	downloads, err := NewDownloadsDB(e.paths.DownloadsDB(), conf.General.DownloadDir, additionalSources)
 	if err != nil {
 		logthis.Error(errors.Wrap(err, "Error loading downloads database"), logthis.VERBOSE)
 	}
-	if e.config.WebServer.ServeMetadata {
+	if conf.WebServer.ServeMetadata {
 		// scan on startup in goroutine
 		go downloads.Scan()
 	}
 
 	rtr := mux.NewRouter()
 	var mutex = &sync.Mutex{}
-	if e.config.WebServer.AllowDownloads {
+	if conf.WebServer.AllowDownloads {
 		getStats := func(w http.ResponseWriter, r *http.Request) {
+			conf := e.Config()
 			// checking token
 			token, ok := r.URL.Query()["token"]
 			if !ok {
@@ -171,7 +171,7 @@ func webServer(e *Environment) {
 				w.WriteHeader(http.StatusNotFound)
 				return
 			}
-			if token[0] != e.config.WebServer.Token {
+			if token[0] != conf.WebServer.Token {
 				logthis.Info(errorWrongToken, logthis.NORMAL)
 				w.WriteHeader(http.StatusNotFound)
 				return
@@ -195,7 +195,7 @@ func webServer(e *Environment) {
 				w.WriteHeader(http.StatusNotFound)
 				return
 			}
-			file, err := ioutil.ReadFile(filepath.Join(StatsDir, trackerLabel+"_"+filename))
+			file, err := ioutil.ReadFile(filepath.Join(e.paths.StatsDir(), trackerLabel+"_"+filename))
 			if err != nil {
 				logthis.Error(errors.Wrap(err, errorNoStatsFilename), logthis.NORMAL)
 				w.WriteHeader(http.StatusNotFound)
@@ -209,7 +209,8 @@ func webServer(e *Environment) {
 			w.Write(file)
 		}
 		getTorrent := func(w http.ResponseWriter, r *http.Request) {
-			trackerLabel, id, useFLToken, err := validateGet(r, e.config)
+			conf := e.Config()
+			trackerLabel, id, useFLToken, err := validateGet(r, conf)
 			if err != nil {
 				logthis.Error(errors.Wrap(err, "Error parsing request"), logthis.NORMAL)
 				w.WriteHeader(http.StatusUnauthorized)
@@ -222,7 +223,7 @@ func webServer(e *Environment) {
 				w.WriteHeader(http.StatusUnauthorized)
 				return
 			}
-			release, err := manualSnatchFromID(e, tracker, id, useFLToken)
+			release, err := manualSnatchFromID(e, conf, tracker, id, useFLToken)
 			if err != nil {
 				logthis.Error(errors.Wrap(err, ErrorSnatchingTorrent), logthis.NORMAL)
 				w.WriteHeader(http.StatusUnauthorized)
@@ -234,7 +235,7 @@ func webServer(e *Environment) {
 		}
 		getMetadata := func(w http.ResponseWriter, r *http.Request) {
 			// if not configured, return error
-			if !e.config.WebServer.ServeMetadata {
+			if !e.Config().WebServer.ServeMetadata {
 				logthis.Error(errors.New("Error, not configured to serve metadata"), logthis.NORMAL)
 				w.WriteHeader(http.StatusUnauthorized)
 				return
@@ -243,7 +244,7 @@ func webServer(e *Environment) {
 			var response []byte
 			id, ok := mux.Vars(r)["id"]
 			if !ok {
-				list, err := e.serverData.DownloadsList(downloads)
+				list, err := e.serverData.DownloadsList(e, downloads)
 				if err != nil {
 					logthis.Error(errors.Wrap(err, "Error loading downloads list"), logthis.NORMAL)
 					w.WriteHeader(http.StatusUnauthorized)
@@ -263,6 +264,101 @@ func webServer(e *Environment) {
 			w.WriteHeader(http.StatusOK)
 			w.Write(response)
 		}
+		getAnnounces := func(w http.ResponseWriter, r *http.Request) {
+			conf := e.Config()
+			// checking token
+			token, ok := r.URL.Query()["token"]
+			if !ok {
+				logthis.Info(errorNoToken, logthis.NORMAL)
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if token[0] != conf.WebServer.Token {
+				logthis.Info(errorWrongToken, logthis.NORMAL)
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			// building the query from parameters
+			query := AnnounceQuery{
+				Artist:   r.URL.Query().Get("artist"),
+				Tag:      r.URL.Query().Get("tag"),
+				Filter:   r.URL.Query().Get("filter"),
+				NearMiss: r.URL.Query().Get("near_miss") == "true",
+				Limit:    defaultAnnounceSearchLimit,
+			}
+			if limit, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && limit > 0 {
+				query.Limit = limit
+			}
+			announces, err := NewAnnouncesDB(e.paths.AnnouncesDB())
+			if err != nil {
+				logthis.Error(errors.Wrap(err, ErrorSearchingAnnounces), logthis.NORMAL)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			hits, err := announces.Search(query)
+			if err != nil {
+				logthis.Error(errors.Wrap(err, ErrorSearchingAnnounces), logthis.NORMAL)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			response, err := json.Marshal(hits)
+			if err != nil {
+				logthis.Error(errors.Wrap(err, ErrorSearchingAnnounces), logthis.NORMAL)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			// write response
+			w.Header().Set("Content-type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			w.Write(response)
+		}
+		getSnatchQueue := func(w http.ResponseWriter, r *http.Request) {
+			conf := e.Config()
+			// checking token
+			token, ok := r.URL.Query()["token"]
+			if !ok {
+				logthis.Info(errorNoToken, logthis.NORMAL)
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if token[0] != conf.WebServer.Token {
+				logthis.Info(errorWrongToken, logthis.NORMAL)
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			queue, err := NewSnatchQueue(e.paths.SnatchQueueDB())
+			if err != nil {
+				logthis.Error(errors.Wrap(err, ErrorListingSnatchQueue), logthis.NORMAL)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			entries, err := queue.List()
+			if err != nil {
+				logthis.Error(errors.Wrap(err, ErrorListingSnatchQueue), logthis.NORMAL)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			// only pending or only failed snatches
+			if status := r.URL.Query().Get("status"); status == "pending" || status == "failed" {
+				var selected []QueuedSnatch
+				for _, entry := range entries {
+					if entry.Failed == (status == "failed") {
+						selected = append(selected, entry)
+					}
+				}
+				entries = selected
+			}
+			response, err := json.Marshal(entries)
+			if err != nil {
+				logthis.Error(errors.Wrap(err, ErrorListingSnatchQueue), logthis.NORMAL)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			// write response
+			w.Header().Set("Content-type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			w.Write(response)
+		}
 		upgrader := websocket.Upgrader{
 			// allows connection to websocket from anywhere
 			CheckOrigin: func(r *http.Request) bool { return true },
@@ -321,8 +417,9 @@ func webServer(e *Environment) {
 					break
 				}
 
+				conf := e.Config()
 				var answer OutgoingJSON
-				if incoming.Token != e.config.WebServer.Token {
+				if incoming.Token != conf.WebServer.Token {
 					logthis.Info(errorIncorrectWebServerToken, logthis.NORMAL)
 					answer = OutgoingJSON{Status: responseError, Target: notificationArea, Message: "Bad token!"}
 				} else {
@@ -339,7 +436,7 @@ func webServer(e *Environment) {
 						} else {
 							// snatching
 							for _, id := range incoming.Args {
-								release, err := manualSnatchFromID(e, tracker, id, incoming.FLToken)
+								release, err := manualSnatchFromID(e, conf, tracker, id, incoming.FLToken)
 								if err != nil {
 									logthis.Info("Error snatching torrent: "+err.Error(), logthis.NORMAL)
 									answer = OutgoingJSON{Status: responseError, Target: notificationArea, Message: "Error snatching torrent."}
@@ -349,6 +446,17 @@ func webServer(e *Environment) {
 								// TODO send responses for all IDs (only 1 from GM Script for now anyway)
 							}
 						}
+					case autosnatchEnableCommand, autosnatchDisableCommand:
+						toggle := e.EnableAutosnatching
+						if incoming.Command == autosnatchDisableCommand {
+							toggle = e.DisableAutosnatching
+						}
+						if err := toggle(reasonManualToggle, incoming.Args...); err != nil {
+							logthis.Error(err, logthis.NORMAL)
+							answer = OutgoingJSON{Status: responseError, Target: notificationArea, Message: err.Error()}
+						} else {
+							answer = OutgoingJSON{Status: responseInfo, Target: statsArea, Message: statusString(e)}
+						}
 					case statsCommand:
 						// TODO gather stats and send text (ie snatched today, this week, etc...)
 						answer = OutgoingJSON{Status: responseInfo, Target: statsArea, Message: statusString(e)}
@@ -372,13 +480,15 @@ func webServer(e *Environment) {
 		rtr.HandleFunc("/get/{id:[0-9]+}", getTorrent).Methods("GET")
 		rtr.HandleFunc("/downloads", getMetadata).Methods("GET")
 		rtr.HandleFunc("/downloads/{id:[0-9]+}", getMetadata).Methods("GET")
+		rtr.HandleFunc("/announces", getAnnounces).Methods("GET")
+		rtr.HandleFunc("/queue", getSnatchQueue).Methods("GET")
 		rtr.HandleFunc("/getStats/{name:[\\w]+.svg}", getStats).Methods("GET")
 		rtr.HandleFunc("/getStats/{name:[\\w]+.png}", getStats).Methods("GET")
 		rtr.HandleFunc("/dl.pywa", getTorrent).Methods("GET")
 		rtr.HandleFunc("/ws", socket)
 	}
 
-	if e.config.WebServer.ServeStats {
+	if conf.WebServer.ServeStats {
 		getLocalStats := func(w http.ResponseWriter, r *http.Request) {
 			// get filename
 			filename, ok := mux.Vars(r)["name"]
@@ -387,10 +497,10 @@ func webServer(e *Environment) {
 				w.WriteHeader(http.StatusNotFound)
 				return
 			}
-			http.ServeFile(w, r, filepath.Join(StatsDir, filename))
+			http.ServeFile(w, r, filepath.Join(e.paths.StatsDir(), filename))
 		}
 		getIndex := func(w http.ResponseWriter, r *http.Request) {
-			response, err := e.serverData.Index(downloads)
+			response, err := e.serverData.Index(e, downloads)
 			if err != nil {
 				logthis.Error(errors.Wrap(err, "Error loading downloads list"), logthis.NORMAL)
 				w.WriteHeader(http.StatusUnauthorized)
@@ -400,10 +510,10 @@ func webServer(e *Environment) {
 			w.WriteHeader(http.StatusOK)
 			w.Write(response)
 		}
-		if e.config.WebServer.Password != "" {
-			rtr.Handle("/", httpauth.SimpleBasicAuth(e.config.WebServer.User, e.config.WebServer.Password)(http.HandlerFunc(getIndex)))
-			rtr.Handle("/{name:[\\w]+.svg}", httpauth.SimpleBasicAuth(e.config.WebServer.User, e.config.WebServer.Password)(http.HandlerFunc(getLocalStats)))
-			rtr.Handle("/{name:[\\w]+.png}", httpauth.SimpleBasicAuth(e.config.WebServer.User, e.config.WebServer.Password)(http.HandlerFunc(getLocalStats)))
+		if conf.WebServer.Password != "" {
+			rtr.Handle("/", httpauth.SimpleBasicAuth(conf.WebServer.User, conf.WebServer.Password)(http.HandlerFunc(getIndex)))
+			rtr.Handle("/{name:[\\w]+.svg}", httpauth.SimpleBasicAuth(conf.WebServer.User, conf.WebServer.Password)(http.HandlerFunc(getLocalStats)))
+			rtr.Handle("/{name:[\\w]+.png}", httpauth.SimpleBasicAuth(conf.WebServer.User, conf.WebServer.Password)(http.HandlerFunc(getLocalStats)))
 		} else {
 			rtr.HandleFunc("/", getIndex)
 			rtr.HandleFunc("/{name:[\\w]+.svg}", getLocalStats)
@@ -411,10 +521,11 @@ func webServer(e *Environment) {
 		}
 	}
 	// serve
-	if e.config.webserverHTTP {
+	if conf.webserverHTTP {
 		go func() {
 			logthis.Info(webServerUpHTTP, logthis.NORMAL)
-			httpServer := &http.Server{Addr: fmt.Sprintf(":%d", e.config.WebServer.PortHTTP), Handler: rtr}
+			httpServer := &http.Server{Addr: fmt.Sprintf(":%d", conf.WebServer.PortHTTP), Handler: rtr}
+			e.addWebServer(httpServer)
 			if err := httpServer.ListenAndServe(); err != nil {
 				if err == http.ErrServerClosed {
 					logthis.Info(webServerShutDown, logthis.NORMAL)
@@ -424,10 +535,10 @@ func webServer(e *Environment) {
 			}
 		}()
 	}
-	if e.config.webserverHTTPS {
+	if conf.webserverHTTPS {
 		// if not there yet, generate the self-signed certificate
 		if !fs.FileExists(filepath.Join(certificatesDir, certificateKey)) || !fs.FileExists(filepath.Join(certificatesDir, certificate)) {
-			if err := generateCertificates(e); err != nil {
+			if err := generateCertificates(conf); err != nil {
 				logthis.Error(errors.Wrap(err, errorGeneratingCertificate+provideCertificate), logthis.NORMAL)
 				logthis.Info(infoBackupScript, logthis.NORMAL)
 				return
@@ -438,7 +549,8 @@ func webServer(e *Environment) {
 
 		go func() {
 			logthis.Info(webServerUpHTTPS, logthis.NORMAL)
-			httpsServer := &http.Server{Addr: fmt.Sprintf(":%d", e.config.WebServer.PortHTTPS), Handler: rtr}
+			httpsServer := &http.Server{Addr: fmt.Sprintf(":%d", conf.WebServer.PortHTTPS), Handler: rtr}
+			e.addWebServer(httpsServer)
 			if err := httpsServer.ListenAndServeTLS(filepath.Join(certificatesDir, certificate), filepath.Join(certificatesDir, certificateKey)); err != nil {
 				if err == http.ErrServerClosed {
 					logthis.Info(webServerShutDown, logthis.NORMAL)
@@ -130,8 +130,8 @@ var (
 	generateSignCommand   = []string{"ca", "-batch", "-config", openSSLCAConfFile, "-policy", "signing_policy", "-extensions", "signing_req", "-out", certificate, "-infiles", "servercert.csr"}
 )
 
-func generateCertificates(e *Environment) error {
-	if !e.config.webserverConfigured {
+func generateCertificates(conf *Config) error {
+	if !conf.webserverConfigured {
 		return errors.New(webServerNotConfigured)
 	}
 
@@ -139,17 +139,17 @@ func generateCertificates(e *Environment) error {
 		return errors.Wrap(err, errorCreatingCertDir)
 	}
 	// create the necessary files
-	subj := fmt.Sprintf(subjTemplate, e.config.WebServer.Hostname)
+	subj := fmt.Sprintf(subjTemplate, conf.WebServer.Hostname)
 	if err := ioutil.WriteFile(filepath.Join(certificatesDir, "index.txt"), []byte(""), 0644); err != nil {
 		return errors.Wrap(err, errorCreatingFile)
 	}
 	if err := ioutil.WriteFile(filepath.Join(certificatesDir, "serial.txt"), []byte("01"), 0644); err != nil {
 		return errors.Wrap(err, errorCreatingFile)
 	}
-	if err := ioutil.WriteFile(filepath.Join(certificatesDir, openSSLCAConfFile), []byte(fmt.Sprintf(openSSLCA, e.config.WebServer.Hostname)), 0644); err != nil {
+	if err := ioutil.WriteFile(filepath.Join(certificatesDir, openSSLCAConfFile), []byte(fmt.Sprintf(openSSLCA, conf.WebServer.Hostname)), 0644); err != nil {
 		return errors.Wrap(err, errorCreatingFile)
 	}
-	if err := ioutil.WriteFile(filepath.Join(certificatesDir, openSSLServerConfFile), []byte(fmt.Sprintf(openSSLServer, certificateKey, e.config.WebServer.Hostname, e.config.WebServer.Hostname)), 0644); err != nil {
+	if err := ioutil.WriteFile(filepath.Join(certificatesDir, openSSLServerConfFile), []byte(fmt.Sprintf(openSSLServer, certificateKey, conf.WebServer.Hostname, conf.WebServer.Hostname)), 0644); err != nil {
 		return errors.Wrap(err, errorCreatingFile)
 	}
 	if err := ioutil.WriteFile(filepath.Join(certificatesDir, opensSLBackupScriptFile), []byte(fmt.Sprintf(openSSLshTemplate, openSSLCAConfFile, subj, openSSLServerConfFile, subj, openSSLCAConfFile, certificate)), 0644); err != nil {
@@ -3,7 +3,6 @@ package varroa
 import (
 	"html/template"
 	"io/ioutil"
-	"path/filepath"
 	"strconv"
 
 	"github.com/asdine/storm"
@@ -124,13 +123,8 @@ type ServerPage struct {
 	theme HistoryTheme
 }
 
-func (sc *ServerPage) update(downloads *DownloadsDB) {
-	conf, err := NewConfig(DefaultConfigurationFile)
-	if err != nil {
-		logthis.Error(err, logthis.NORMAL)
-		return
-	}
-
+func (sc *ServerPage) update(e *Environment, downloads *DownloadsDB) {
+	conf := e.Config()
 	// rebuilding
 	sc.index.Stats = []HTMLStats{}
 	if conf.webserverMetadata && downloads != nil {
@@ -157,6 +151,7 @@ func (sc *ServerPage) update(downloads *DownloadsDB) {
 			{Name: "Ratio/day", Label: label + "_" + overallPrefix + "_" + perDay + ratioStatsFile},
 			{Name: "Number Snatched/day", Label: label + "_" + numberSnatchedPerDayFile},
 			{Name: "Size Snatched/day", Label: label + "_" + sizeSnatchedPerDayFile},
+			{Name: "FL tokens/day", Label: label + "_" + flTokensPerDayFile},
 		}
 		// add graphs + links
 		var graphLinks []HTMLLink
@@ -168,7 +163,11 @@ func (sc *ServerPage) update(downloads *DownloadsDB) {
 		// add previous stats (progress)
 		// access to statsDB
 		var lastStatsStrings [][]string
-		stats, err := NewStatsDB(filepath.Join(StatsDir, DefaultHistoryDB))
+		var targetRatio float64
+		if statsConfig, err := conf.GetStats(label); err == nil {
+			targetRatio = statsConfig.TargetRatio
+		}
+		stats, err := NewStatsDB(e.paths.StatsDir(), conf)
 		if err != nil {
 			logthis.Error(errors.Wrap(err, "Error, could not access the stats database"), logthis.NORMAL)
 		} else {
@@ -181,7 +180,7 @@ func (sc *ServerPage) update(downloads *DownloadsDB) {
 				if i == 0 {
 					continue
 				}
-				lastStatsStrings = append(lastStatsStrings, knownPreviousStats[i-1].ProgressParts(&s))
+				lastStatsStrings = append(lastStatsStrings, knownPreviousStats[i-1].ProgressParts(&s, targetRatio))
 			}
 		}
 
@@ -191,9 +190,9 @@ func (sc *ServerPage) update(downloads *DownloadsDB) {
 	}
 }
 
-func (sc *ServerPage) Index(downloads *DownloadsDB) ([]byte, error) {
+func (sc *ServerPage) Index(e *Environment, downloads *DownloadsDB) ([]byte, error) {
 	// updating
-	sc.update(downloads)
+	sc.update(e, downloads)
 	if err := sc.index.SetMainContentStats(); err != nil {
 		return []byte{}, errors.Wrap(err, "Error generating stats page")
 	}
@@ -203,24 +202,25 @@ func (sc *ServerPage) Index(downloads *DownloadsDB) ([]byte, error) {
 
 // SaveIndex is only used for Gitlab pages, so it never shows Downloads and will need to know the repository name (ie Pages subfolder).
 func (sc *ServerPage) SaveIndex(e *Environment, file string) error {
+	conf := e.Config()
 	// building index
-	if e.config.gitlabPagesConfigured {
-		e.serverData.index.URLFolder = e.config.GitlabPages.Folder + "/"
+	if conf.gitlabPagesConfigured {
+		e.serverData.index.URLFolder = conf.GitlabPages.Folder + "/"
 	}
-	data, err := sc.Index(nil)
+	data, err := sc.Index(e, nil)
 	if err != nil {
 		return err
 	}
-	if e.config.gitlabPagesConfigured {
+	if conf.gitlabPagesConfigured {
 		e.serverData.index.URLFolder = ""
 	}
 	// write to file
 	return ioutil.WriteFile(file, data, 0666)
 }
 
-func (sc *ServerPage) DownloadsList(downloads *DownloadsDB) ([]byte, error) {
+func (sc *ServerPage) DownloadsList(e *Environment, downloads *DownloadsDB) ([]byte, error) {
 	// updating
-	sc.update(downloads)
+	sc.update(e, downloads)
 	// getting downloads
 	if err := sc.index.SetMainContentDownloadsList(); err != nil {
 		return []byte{}, errors.Wrap(err, "Error generating downloads list page")
@@ -230,8 +230,9 @@ func (sc *ServerPage) DownloadsList(downloads *DownloadsDB) ([]byte, error) {
 }
 
 func (sc *ServerPage) DownloadsInfo(e *Environment, downloads *DownloadsDB, id string) ([]byte, error) {
+	conf := e.Config()
 	// updating
-	sc.update(nil)
+	sc.update(e, nil)
 
 	// display individual download metadata
 	downloadID, err := strconv.Atoi(id)
@@ -248,7 +249,7 @@ func (sc *ServerPage) DownloadsInfo(e *Environment, downloads *DownloadsDB, id s
 	if dl.HasTrackerMetadata {
 		// TODO if more than 1 tracker, make things prettier
 		for _, t := range dl.Tracker {
-			sc.index.DownloadInfo += template.HTML(blackfriday.Run(dl.getDescription(e.config.General.DownloadDir, t, true)))
+			sc.index.DownloadInfo += template.HTML(blackfriday.Run(dl.getDescription(conf.General.DownloadDir, t, true)))
 		}
 	} else {
 		sc.index.DownloadInfo = template.HTML(dl.RawShortString())
@@ -0,0 +1,98 @@
+package varroa
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gitlab.com/passelecasque/obstruction/tracker"
+)
+
+// newSimulatedEnvironment prepares an environment in a temporary data directory, with "downloads" and "watch"
+// directories, its own databases, and all configured trackers logged in to the simulator.
+// In the configuration, $DOWNLOADS and $WATCH are replaced by these directories, $URL by the address of the
+// simulated tracker, and $IRC by its IRC server.
+// It returns the data directory, and a function restoring the databases used before and removing everything.
+func newSimulatedEnvironment(t *testing.T, sim *Simulator, config string) (*Environment, string, func()) {
+	dataDir, err := ioutil.TempDir("", "varroa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var teardown []func()
+	cleanUp := func() {
+		for i := len(teardown) - 1; i >= 0; i-- {
+			teardown[i]()
+		}
+		os.RemoveAll(dataDir)
+	}
+	fail := func(err error) {
+		if err != nil {
+			cleanUp()
+			t.Fatal(err)
+		}
+	}
+
+	downloadDir := filepath.Join(dataDir, "downloads")
+	watchDir := filepath.Join(dataDir, "watch")
+	fail(os.Mkdir(downloadDir, 0777))
+	fail(os.Mkdir(watchDir, 0777))
+	config = os.Expand(config, func(variable string) string {
+		switch variable {
+		case "DOWNLOADS":
+			return downloadDir
+		case "WATCH":
+			return watchDir
+		case "URL":
+			return sim.URL()
+		case "IRC":
+			return sim.IRCServer()
+		}
+		return "$" + variable
+	})
+	configurationFile := filepath.Join(dataDir, DefaultConfigurationFile)
+	fail(ioutil.WriteFile(configurationFile, []byte(config), 0600))
+	e := NewEnvironment(NewPaths(configurationFile, dataDir, ""))
+	e.config, err = readConfiguration(configurationFile)
+	fail(err)
+
+	openDatabase := func(name string) *Database {
+		db, err := NewDatabase(filepath.Join(dataDir, name))
+		fail(err)
+		teardown = append(teardown, func() { db.Close() })
+		return db
+	}
+	stats := &StatsDB{db: openDatabase(DefaultHistoryDB), dir: dataDir}
+	fail(stats.init())
+	previousStatsDB := useStatsDB(stats)
+	teardown = append(teardown, func() { useStatsDB(previousStatsDB) })
+	announces := &AnnouncesDB{db: openDatabase(DefaultAnnouncesDB)}
+	fail(announces.init())
+	previousAnnouncesDB := useAnnouncesDB(announces)
+	teardown = append(teardown, func() { useAnnouncesDB(previousAnnouncesDB) })
+	queue := &SnatchQueue{db: openDatabase(DefaultSnatchQueueDB)}
+	fail(queue.init())
+	previousSnatchQueue := useSnatchQueue(queue)
+	teardown = append(teardown, func() { useSnatchQueue(previousSnatchQueue) })
+	downloads := &DownloadsDB{db: openDatabase(DefaultDownloadsDB), root: downloadDir}
+	fail(downloads.init())
+	previousDownloadsDB := useDownloadsDB(downloads)
+	teardown = append(teardown, func() { useDownloadsDB(previousDownloadsDB) })
+
+	for _, label := range e.config.TrackerLabels() {
+		e.Trackers[label], err = simulatedTracker(sim, label)
+		fail(err)
+	}
+	return e, dataDir, cleanUp
+}
+
+// simulatedTracker returns a tracker logged in to the simulator, without the default rate limit.
+func simulatedTracker(sim *Simulator, label string) (*tracker.Gazelle, error) {
+	tr, err := tracker.NewGazelle(label, sim.URL(), sim.User, "", "session", "", "simkey", userAgent())
+	if err != nil {
+		return nil, err
+	}
+	tr.SetRateLimiter(100, 1000)
+	tr.StartRateLimiter()
+	return tr, tr.Login()
+}
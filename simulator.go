@@ -0,0 +1,615 @@
+package varroa
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"gitlab.com/catastrophic/assistance/fs"
+	"gitlab.com/catastrophic/assistance/logthis"
+	"gitlab.com/catastrophic/assistance/strslice"
+)
+
+const (
+	simulatorHost             = "simulator"
+	simulatorAnnounceInterval = 2 * time.Second
+	simulatorJoinTimeout      = 5 * time.Minute
+	simulatorInvitation       = "You have been invited to %s."
+	torrentExt                = ".torrent"
+)
+
+// Simulator plays the part of a tracker, so that autosnatching can be tested end-to-end without network access.
+// It is an IRC server where it acts as NickServ and as the announcer bot, and a minimal Gazelle API
+// serving <TORRENT_ID>.json and <TORRENT_ID>.torrent files from a fixtures directory.
+// Tracker credentials are not checked. If NickServPassword is set, clients must identify with it, with NickServ
+// or SASL, before the announcer invites them. SASL EXTERNAL is always rejected, the simulator does not use TLS.
+type Simulator struct {
+	User             string
+	IRCKey           string
+	NickServPassword string
+	Announcer        string
+	AnnounceChannel  string
+
+	fixturesDir  string
+	ircListener  net.Listener
+	httpListener net.Listener
+	httpServer   *http.Server
+
+	mutex     sync.Mutex
+	clients   map[*simulatedIRCClient]bool
+	joined    chan struct{}
+	downloads []int
+}
+
+type simulatedIRCClient struct {
+	conn       net.Conn
+	mutex      sync.Mutex
+	nick       string
+	identified bool
+	invited    bool
+	inChannel  bool
+}
+
+func (c *simulatedIRCClient) send(format string, a ...interface{}) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, err := fmt.Fprintf(c.conn, format+"\r\n", a...); err != nil {
+		logthis.Error(errors.Wrap(err, "error writing to simulated IRC client"), logthis.VERBOSEST)
+	}
+}
+
+// NewSimulator listening on the given IRC and HTTP addresses, using port 0 to pick available ports.
+func NewSimulator(ircAddress, httpAddress, fixturesDir string) (*Simulator, error) {
+	s := &Simulator{fixturesDir: fixturesDir, clients: make(map[*simulatedIRCClient]bool), joined: make(chan struct{})}
+	var err error
+	s.ircListener, err = net.Listen("tcp", ircAddress)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not start the simulated IRC server")
+	}
+	s.httpListener, err = net.Listen("tcp", httpAddress)
+	if err != nil {
+		s.ircListener.Close()
+		return nil, errors.Wrap(err, "could not start the simulated tracker")
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ajax.php", s.serveAPI)
+	mux.HandleFunc("/torrents.php", s.serveAPI)
+	mux.HandleFunc("/login.php", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/index.php", http.StatusFound)
+	})
+	mux.HandleFunc("/index.php", func(w http.ResponseWriter, r *http.Request) {})
+	s.httpServer = &http.Server{Handler: mux}
+	return s, nil
+}
+
+// NewSimulatorForTracker plays the tracker and announce channel described in the configuration.
+func NewSimulatorForTracker(conf *Config, label, fixturesDir string) (*Simulator, error) {
+	trackerConfig, err := conf.GetTracker(label)
+	if err != nil {
+		return nil, err
+	}
+	autosnatchConfig, err := conf.GetAutosnatch(label)
+	if err != nil {
+		return nil, err
+	}
+	httpAddress := strings.TrimPrefix(strings.TrimPrefix(trackerConfig.URL, "http://"), "https://")
+	if strings.HasPrefix(trackerConfig.URL, "https://") || autosnatchConfig.IRCSSL {
+		return nil, errors.New("the simulator does not support TLS, use http:// and irc_ssl: false")
+	}
+	s, err := NewSimulator(autosnatchConfig.IRCServer, httpAddress, fixturesDir)
+	if err != nil {
+		return nil, err
+	}
+	s.User = trackerConfig.User
+	s.IRCKey = autosnatchConfig.IRCKey
+	s.NickServPassword = autosnatchConfig.NickservPassword
+	s.Announcer = autosnatchConfig.Announcer
+	s.AnnounceChannel = autosnatchConfig.AnnounceChannel
+	return s, nil
+}
+
+// Simulate a configured tracker: once a bot has joined the announce channel, the announces of a file are replayed.
+// The file's directory contains the fixtures. The simulator keeps serving until interrupted.
+func Simulate(conf *Config, trackerLabel, announceFile string) error {
+	s, err := NewSimulatorForTracker(conf, trackerLabel, filepath.Dir(announceFile))
+	if err != nil {
+		return err
+	}
+	s.Start()
+	defer s.Stop()
+	logthis.Info(fmt.Sprintf("Simulating %s: IRC server on %s, tracker on %s. Waiting for a bot to join %s.", trackerLabel, s.IRCServer(), s.URL(), s.AnnounceChannel), logthis.NORMAL)
+	if err := s.WaitForJoin(simulatorJoinTimeout); err != nil {
+		return err
+	}
+	if err := s.Replay(announceFile, simulatorAnnounceInterval); err != nil {
+		return err
+	}
+	logthis.Info(fmt.Sprintf("All announces replayed, %d torrent(s) downloaded so far. Ctrl+C to stop.", len(s.Downloads())), logthis.NORMAL)
+	interrupted := make(chan os.Signal, 1)
+	signal.Notify(interrupted, os.Interrupt, syscall.SIGTERM)
+	<-interrupted
+	return nil
+}
+
+// IRCServer address, as expected in the autosnatch configuration.
+func (s *Simulator) IRCServer() string {
+	return s.ircListener.Addr().String()
+}
+
+// URL of the simulated tracker.
+func (s *Simulator) URL() string {
+	return "http://" + s.httpListener.Addr().String()
+}
+
+// Start serving IRC clients and API calls.
+func (s *Simulator) Start() {
+	go func() {
+		if err := s.httpServer.Serve(s.httpListener); err != nil && err != http.ErrServerClosed {
+			logthis.Error(errors.Wrap(err, "simulated tracker stopped"), logthis.NORMAL)
+		}
+	}()
+	go func() {
+		for {
+			conn, err := s.ircListener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serveIRC(conn)
+		}
+	}()
+}
+
+// Stop the simulator, disconnecting all IRC clients.
+func (s *Simulator) Stop() {
+	s.ircListener.Close()
+	s.httpServer.Close()
+	s.mutex.Lock()
+	for c := range s.clients {
+		c.conn.Close()
+	}
+	s.mutex.Unlock()
+}
+
+// WaitForJoin returns once a client has joined the announce channel.
+func (s *Simulator) WaitForJoin(timeout time.Duration) error {
+	select {
+	case <-s.joined:
+		return nil
+	case <-time.After(timeout):
+		return errors.New("nobody joined " + s.AnnounceChannel)
+	}
+}
+
+// Announce a release to all clients in the announce channel.
+func (s *Simulator) Announce(announce string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for c := range s.clients {
+		if c.inChannel {
+			c.send(":%s!%s@%s PRIVMSG %s :%s", s.Announcer, s.Announcer, simulatorHost, s.AnnounceChannel, announce)
+		}
+	}
+}
+
+// Replay the announces of a file, one per line, waiting between each one.
+func (s *Simulator) Replay(announceFile string, interval time.Duration) error {
+	data, err := ioutil.ReadFile(announceFile)
+	if err != nil {
+		return errors.Wrap(err, "could not read announce file")
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		announced := strings.TrimSpace(line)
+		if announced == "" {
+			continue
+		}
+		logthis.Info("Announcing: "+announced, logthis.NORMAL)
+		s.Announce(announced)
+		time.Sleep(interval)
+	}
+	return nil
+}
+
+// Downloads returns the IDs of the .torrent files served so far.
+func (s *Simulator) Downloads() []int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]int{}, s.downloads...)
+}
+
+func (s *Simulator) serveIRC(conn net.Conn) {
+	c := &simulatedIRCClient{conn: conn}
+	s.mutex.Lock()
+	s.clients[c] = true
+	s.mutex.Unlock()
+	defer func() {
+		s.mutex.Lock()
+		delete(s.clients, c)
+		s.mutex.Unlock()
+		conn.Close()
+	}()
+
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		command, params := parseIRCLine(line)
+		switch command {
+		case "NICK":
+			if len(params) != 0 {
+				c.nick = params[0]
+			}
+		case "USER":
+			c.send(":%s 001 %s :Welcome to the simulated network, %s", simulatorHost, c.nick, c.nick)
+		case "CAP":
+			s.capability(c, params)
+		case "AUTHENTICATE":
+			if len(params) != 0 {
+				s.authenticate(c, params[0])
+			}
+		case "PING":
+			c.send(":%s PONG %s :%s", simulatorHost, simulatorHost, strings.Join(params, " "))
+		case "PRIVMSG":
+			if len(params) < 2 {
+				continue
+			}
+			s.privateMessage(c, params[0], params[1])
+		case "JOIN":
+			if len(params) == 0 || !strings.EqualFold(params[0], s.AnnounceChannel) {
+				continue
+			}
+			s.mutex.Lock()
+			invited := c.invited
+			s.mutex.Unlock()
+			if !invited {
+				c.send(":%s 473 %s %s :Cannot join channel (+i)", simulatorHost, c.nick, s.AnnounceChannel)
+				continue
+			}
+			c.send(":%s!%s@%s JOIN %s", c.nick, c.nick, simulatorHost, s.AnnounceChannel)
+			s.mutex.Lock()
+			c.inChannel = true
+			select {
+			case <-s.joined:
+			default:
+				close(s.joined)
+			}
+			s.mutex.Unlock()
+		case "QUIT":
+			return
+		}
+	}
+}
+
+// privateMessage plays NickServ and the announcer bot.
+func (s *Simulator) privateMessage(c *simulatedIRCClient, target, message string) {
+	switch {
+	case strings.EqualFold(target, "NickServ"):
+		parts := strings.Fields(message)
+		if len(parts) != 2 || !strings.EqualFold(parts[0], "IDENTIFY") || !s.validPassword(parts[1]) {
+			c.send(":NickServ!NickServ@%s NOTICE %s :Invalid password for %s.", simulatorHost, c.nick, c.nick)
+			return
+		}
+		s.identify(c)
+		c.send(":NickServ!NickServ@%s NOTICE %s :You are now identified for %s.", simulatorHost, c.nick, c.nick)
+	case strings.EqualFold(target, s.Announcer):
+		parts := strings.Fields(message)
+		if len(parts) != 4 || parts[0] != "enter" {
+			return
+		}
+		s.mutex.Lock()
+		identified := c.identified
+		s.mutex.Unlock()
+		if s.NickServPassword != "" && !identified {
+			c.send(":%s!%s@%s PRIVMSG %s :You must identify with NickServ first.", s.Announcer, s.Announcer, simulatorHost, c.nick)
+			return
+		}
+		if !strings.EqualFold(parts[1], s.AnnounceChannel) || parts[2] != s.User || parts[3] != s.IRCKey {
+			c.send(":%s!%s@%s PRIVMSG %s :%s", s.Announcer, s.Announcer, simulatorHost, c.nick, announcerBadCredentials)
+			return
+		}
+		s.mutex.Lock()
+		c.invited = true
+		s.mutex.Unlock()
+		c.send(":%s!%s@%s PRIVMSG %s :"+simulatorInvitation, s.Announcer, s.Announcer, simulatorHost, c.nick, s.AnnounceChannel)
+	}
+}
+
+// capability offers SASL to clients negotiating capabilities before registering.
+func (s *Simulator) capability(c *simulatedIRCClient, params []string) {
+	if len(params) == 0 {
+		return
+	}
+	switch strings.ToUpper(params[0]) {
+	case "LS":
+		c.send(":%s CAP * LS :sasl", simulatorHost)
+	case "REQ":
+		if len(params) > 1 && params[1] == "sasl" {
+			c.send(":%s CAP * ACK :sasl", simulatorHost)
+		} else {
+			c.send(":%s CAP * NAK :%s", simulatorHost, strings.Join(params[1:], " "))
+		}
+	}
+}
+
+// authenticate plays the SASL exchange, accepting PLAIN with the NickServ password.
+func (s *Simulator) authenticate(c *simulatedIRCClient, payload string) {
+	nick := c.nick
+	if nick == "" {
+		nick = "*"
+	}
+	switch payload {
+	case "PLAIN":
+		c.send("AUTHENTICATE +")
+	case "EXTERNAL":
+		c.send(":%s 904 %s :SASL EXTERNAL requires a TLS client certificate", simulatorHost, nick)
+	default:
+		credentials, err := base64.StdEncoding.DecodeString(payload)
+		parts := strings.Split(string(credentials), "\x00")
+		if err != nil || len(parts) != 3 || !s.validPassword(parts[2]) {
+			c.send(":%s 904 %s :SASL authentication failed", simulatorHost, nick)
+			return
+		}
+		s.identify(c)
+		c.send(":%s 900 %s %s!%s@%s %s :You are now logged in as %s", simulatorHost, nick, nick, nick, simulatorHost, parts[1], parts[1])
+		c.send(":%s 903 %s :SASL authentication successful", simulatorHost, nick)
+	}
+}
+
+func (s *Simulator) validPassword(password string) bool {
+	return s.NickServPassword == "" || password == s.NickServPassword
+}
+
+func (s *Simulator) identify(c *simulatedIRCClient) {
+	s.mutex.Lock()
+	c.identified = true
+	s.mutex.Unlock()
+}
+
+// parseIRCLine returns the command and parameters of a line sent by a client, the trailing parameter last.
+func parseIRCLine(line string) (string, []string) {
+	line = strings.TrimRight(line, "\r\n")
+	if strings.HasPrefix(line, ":") {
+		if i := strings.Index(line, " "); i != -1 {
+			line = line[i+1:]
+		}
+	}
+	var trailing string
+	hasTrailing := false
+	if i := strings.Index(line, " :"); i != -1 {
+		trailing = line[i+2:]
+		line = line[:i]
+		hasTrailing = true
+	}
+	parts := strings.Fields(line)
+	if len(parts) == 0 {
+		return "", nil
+	}
+	params := parts[1:]
+	if hasTrailing {
+		params = append(params, trailing)
+	}
+	return strings.ToUpper(parts[0]), params
+}
+
+func (s *Simulator) serveAPI(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	id, _ := strconv.Atoi(query.Get("id"))
+	switch query.Get("action") {
+	case "index":
+		writeSimulatedResponse(w, map[string]interface{}{"username": s.User, "id": 1, "authkey": "simulated", "passkey": "simulated"})
+	case "torrent":
+		data, err := ioutil.ReadFile(filepath.Join(s.fixturesDir, strconv.Itoa(id)+jsonExt))
+		if err != nil {
+			writeSimulatedFailure(w, "bad id parameter")
+			return
+		}
+		writeSimulatedResponse(w, json.RawMessage(data))
+	case "torrentgroup":
+		group, err := s.torrentGroup(id)
+		if err != nil {
+			writeSimulatedFailure(w, err.Error())
+			return
+		}
+		writeSimulatedResponse(w, group)
+	case "artist":
+		artist, err := s.artist(query.Get("artistname"))
+		if err != nil {
+			writeSimulatedFailure(w, err.Error())
+			return
+		}
+		writeSimulatedResponse(w, artist)
+	case "browse":
+		results, err := s.browse(query.Get("taglist"), query.Get("recordlabel"))
+		if err != nil {
+			writeSimulatedFailure(w, err.Error())
+			return
+		}
+		writeSimulatedResponse(w, results)
+	case "download":
+		data, err := s.torrentFile(id)
+		if err != nil {
+			writeSimulatedFailure(w, err.Error())
+			return
+		}
+		s.mutex.Lock()
+		s.downloads = append(s.downloads, id)
+		s.mutex.Unlock()
+		w.Header().Set("Content-Type", "application/x-bittorrent")
+		w.Write(data)
+	default:
+		writeSimulatedFailure(w, "unsupported action")
+	}
+}
+
+// torrentGroup gathers the torrent fixtures belonging to a group.
+func (s *Simulator) torrentGroup(groupID int) (map[string]interface{}, error) {
+	files, err := filepath.Glob(filepath.Join(s.fixturesDir, "*"+jsonExt))
+	if err != nil {
+		return nil, err
+	}
+	var group json.RawMessage
+	torrents := []json.RawMessage{}
+	for _, f := range files {
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		var fixture struct {
+			Group   json.RawMessage `json:"group"`
+			Torrent json.RawMessage `json:"torrent"`
+		}
+		var ids struct {
+			Group struct {
+				ID int `json:"id"`
+			} `json:"group"`
+		}
+		if json.Unmarshal(data, &fixture) != nil || json.Unmarshal(data, &ids) != nil || ids.Group.ID != groupID {
+			continue
+		}
+		group = fixture.Group
+		torrents = append(torrents, fixture.Torrent)
+	}
+	if group == nil {
+		return nil, errors.New("bad id parameter")
+	}
+	return map[string]interface{}{"group": group, "torrents": torrents}, nil
+}
+
+// simulatedTorrent is what the search actions need from a torrent fixture.
+type simulatedTorrent struct {
+	Group struct {
+		ID          int      `json:"id"`
+		Name        string   `json:"name"`
+		RecordLabel string   `json:"recordLabel"`
+		Tags        []string `json:"tags"`
+		MusicInfo   struct {
+			Artists []struct {
+				Name string `json:"name"`
+			} `json:"artists"`
+		} `json:"musicInfo"`
+	} `json:"group"`
+	Torrent struct {
+		ID int `json:"id"`
+	} `json:"torrent"`
+}
+
+// torrents returns the torrent fixtures, sorted by ID.
+func (s *Simulator) torrents() ([]simulatedTorrent, error) {
+	files, err := filepath.Glob(filepath.Join(s.fixturesDir, "*"+jsonExt))
+	if err != nil {
+		return nil, err
+	}
+	var torrents []simulatedTorrent
+	for _, f := range files {
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		var torrent simulatedTorrent
+		if json.Unmarshal(data, &torrent) != nil || torrent.Torrent.ID == 0 {
+			continue
+		}
+		torrents = append(torrents, torrent)
+	}
+	sort.Slice(torrents, func(i, j int) bool {
+		return torrents[i].Torrent.ID < torrents[j].Torrent.ID
+	})
+	return torrents, nil
+}
+
+// artist lists the torrents of an artist, by group.
+func (s *Simulator) artist(name string) (map[string]interface{}, error) {
+	torrents, err := s.torrents()
+	if err != nil {
+		return nil, err
+	}
+	var groups []map[string]interface{}
+	byGroup := make(map[int]map[string]interface{})
+	for _, t := range torrents {
+		var found bool
+		for _, a := range t.Group.MusicInfo.Artists {
+			found = found || strings.EqualFold(a.Name, name)
+		}
+		if !found {
+			continue
+		}
+		group, ok := byGroup[t.Group.ID]
+		if !ok {
+			group = map[string]interface{}{"groupId": t.Group.ID, "groupName": t.Group.Name, "torrent": []map[string]interface{}{}}
+			byGroup[t.Group.ID] = group
+			groups = append(groups, group)
+		}
+		group["torrent"] = append(group["torrent"].([]map[string]interface{}), map[string]interface{}{"id": t.Torrent.ID, "groupId": t.Group.ID})
+	}
+	if len(groups) == 0 {
+		return nil, errors.New("no artist found")
+	}
+	return map[string]interface{}{"id": 1, "name": name, "torrentgroup": groups}, nil
+}
+
+// browse lists the torrents with a tag or from a record label, by group, on a single page.
+func (s *Simulator) browse(tag, label string) (map[string]interface{}, error) {
+	torrents, err := s.torrents()
+	if err != nil {
+		return nil, err
+	}
+	results := []map[string]interface{}{}
+	byGroup := make(map[int]map[string]interface{})
+	for _, t := range torrents {
+		if (tag != "" && !strslice.Contains(t.Group.Tags, tag)) || (label != "" && !strings.EqualFold(t.Group.RecordLabel, label)) {
+			continue
+		}
+		group, ok := byGroup[t.Group.ID]
+		if !ok {
+			group = map[string]interface{}{"groupId": t.Group.ID, "groupName": t.Group.Name, "torrents": []map[string]interface{}{}}
+			byGroup[t.Group.ID] = group
+			results = append(results, group)
+		}
+		group["torrents"] = append(group["torrents"].([]map[string]interface{}), map[string]interface{}{"torrentId": t.Torrent.ID})
+	}
+	return map[string]interface{}{"currentPage": 1, "pages": 1, "results": results}, nil
+}
+
+// torrentFile returns the <TORRENT_ID>.torrent fixture, or generates a small torrent if there is none.
+func (s *Simulator) torrentFile(id int) ([]byte, error) {
+	fixture := filepath.Join(s.fixturesDir, strconv.Itoa(id)+torrentExt)
+	if fs.FileExists(fixture) {
+		return ioutil.ReadFile(fixture)
+	}
+	if !fs.FileExists(filepath.Join(s.fixturesDir, strconv.Itoa(id)+jsonExt)) {
+		return nil, errors.New("bad id parameter")
+	}
+	announceURL := s.URL() + "/announce"
+	name := "simulated_" + strconv.Itoa(id)
+	torrent := fmt.Sprintf("d8:announce%d:%s4:infod6:lengthi1024e4:name%d:%s12:piece lengthi16384e6:pieces20:%see", len(announceURL), announceURL, len(name), name, strings.Repeat("0", 20))
+	return []byte(torrent), nil
+}
+
+func writeSimulatedResponse(w http.ResponseWriter, response interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"status": "success", "response": response}); err != nil {
+		logthis.Error(errors.Wrap(err, "error writing simulated response"), logthis.VERBOSEST)
+	}
+}
+
+func writeSimulatedFailure(w http.ResponseWriter, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"status": "failure", "error": message}); err != nil {
+		logthis.Error(errors.Wrap(err, "error writing simulated response"), logthis.VERBOSEST)
+	}
+}
@@ -0,0 +1,122 @@
+package varroa
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const simulatorTestConfig = `general:
+  watch_directory: $WATCH
+  log_level: 2
+
+trackers:
+  - name: sim
+    user: simuser
+    api_key: simkey
+    url: $URL
+
+autosnatch:
+  - tracker: sim
+    irc_server: $IRC
+    irc_key: simircKey
+    nickserv_password: something
+    bot_name: simbot
+    announcer: SimBot
+    announce_channel: "#sim-announce"
+
+filters:
+  - name: electronic
+    format:
+    - FLAC
+    - MP3
+    included_tags:
+    - electronic
+    unique_in_group: true
+`
+
+func TestSimulatorAutosnatch(t *testing.T) {
+	fmt.Println("+ Testing Simulator/autosnatch...")
+	check := assert.New(t)
+
+	fixturesDir := filepath.Join("test", "simulator")
+	sim, err := NewSimulator("127.0.0.1:0", "127.0.0.1:0", fixturesDir)
+	check.Nil(err)
+	sim.User = "simuser"
+	sim.IRCKey = "simircKey"
+	sim.Announcer = "SimBot"
+	sim.AnnounceChannel = "#sim-announce"
+	sim.Start()
+	defer sim.Stop()
+
+	e, dataDir, cleanUp := newSimulatedEnvironment(t, sim, simulatorTestConfig)
+	defer cleanUp()
+	watchDir := filepath.Join(dataDir, "watch")
+	snatchQueue.Start(e, 2)
+	defer snatchQueue.Stop()
+
+	e.startAnnounceSources("sim")
+	defer e.stopAnnounceSources("sim")
+	check.Nil(sim.WaitForJoin(10 * time.Second))
+	check.Nil(sim.Replay(filepath.Join(fixturesDir, "announces.txt"), 0))
+
+	// waiting for all announces to be analyzed
+	var announces []Announce
+	for i := 0; i < 100 && len(announces) < 4; i++ {
+		time.Sleep(50 * time.Millisecond)
+		announces, err = announcesDB.Search(AnnounceQuery{})
+		check.Nil(err)
+	}
+	check.Equal(4, len(announces))
+	// waiting for the snatch queue
+	for i := 0; i < 100; i++ {
+		if pending, _, err := snatchQueue.Counts(); err == nil && pending == 0 {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	rejections := make(map[string]string)
+	for _, a := range announces {
+		for _, v := range a.Release.Verdicts {
+			if !v.Accepted() {
+				rejections[a.Release.TorrentID] = v.Criterion
+			}
+		}
+	}
+	// 101 is snatched, 102 is a duplicate, 103 is from the same group, another release from 201's group was snatched on the tracker
+	check.Equal([]int{101}, sim.Downloads())
+	check.Equal(map[string]string{"102": CriterionDuplicate, "103": CriterionUniqueInGroup, "201": CriterionUniqueInGroup}, rejections)
+	files, err := ioutil.ReadDir(watchDir)
+	check.Nil(err)
+	check.Equal(1, len(files))
+	check.True(statsDB.AlreadySnatchedFromGroup(&Release{Tracker: "sim", GroupID: "10"}))
+
+	// after a reload, announces are filtered with the new configuration, without reconnecting
+	previousConfig := config
+	defer setCurrentConfig(previousConfig)
+	configurationFile := filepath.Join(dataDir, DefaultConfigurationFile)
+	original, err := ioutil.ReadFile(configurationFile)
+	check.Nil(err)
+	modified := strings.Replace(string(original), "unique_in_group: true", "allow_duplicates: true", 1)
+	modified = strings.Replace(modified, `announce_channel: "#sim-announce"`, `announce_channel: "#sim-announce"`+"\n    snatch_delay_seconds: 3600", 1)
+	check.Nil(ioutil.WriteFile(configurationFile, []byte(modified), 0600))
+	check.Nil(e.ReloadConfiguration())
+	announced, err := ioutil.ReadFile(filepath.Join(fixturesDir, "announces.txt"))
+	check.Nil(err)
+	replay := filepath.Join(dataDir, "announces.txt")
+	check.Nil(ioutil.WriteFile(replay, []byte(strings.Split(string(announced), "\n")[1]), 0600))
+	check.Nil(sim.Replay(replay, 0))
+	var queued *QueuedSnatch
+	for i := 0; i < 100 && queued == nil; i++ {
+		time.Sleep(50 * time.Millisecond)
+		queued, _ = snatchQueue.get("sim", "102")
+	}
+	if check.NotNil(queued) {
+		check.True(queued.NotBefore.After(time.Now().Add(59 * time.Minute)))
+	}
+}
@@ -0,0 +1,445 @@
+package varroa
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/asdine/storm"
+	"github.com/asdine/storm/q"
+	"github.com/pkg/errors"
+	"gitlab.com/catastrophic/assistance/logthis"
+	"gitlab.com/catastrophic/assistance/strslice"
+)
+
+const (
+	// snatchQueueIdleCheck is how often workers look at the queue when nothing is due.
+	snatchQueueIdleCheck = time.Minute
+	// maxSnatchRetryDelay caps the exponential backoff between attempts.
+	maxSnatchRetryDelay = time.Hour
+)
+
+var snatchQueue *SnatchQueue
+var onceSnatchQueue sync.Once
+
+// SnatchQueue keeps the releases accepted by a filter until their .torrent files are downloaded.
+// Workers snatch them in the background, respecting the delay and rate limit of each tracker, and retry on errors.
+type SnatchQueue struct {
+	db *Database
+
+	mutex      sync.Mutex
+	inProgress map[uint32]bool
+	lastSnatch map[string]time.Time
+	wake       chan struct{}
+	stop       chan struct{}
+	workers    sync.WaitGroup
+	// tokens makes sure workers do not spend the same freeleech token twice
+	tokens sync.Mutex
+}
+
+func NewSnatchQueue(path string) (*SnatchQueue, error) {
+	var returnErr error
+	onceSnatchQueue.Do(func() {
+		db, err := NewDatabase(path)
+		if err != nil {
+			returnErr = errors.Wrap(err, "Error opening snatch queue database")
+			return
+		}
+		snatchQueue = &SnatchQueue{db: db}
+		returnErr = snatchQueue.init()
+	})
+	return snatchQueue, returnErr
+}
+
+// useSnatchQueue makes NewSnatchQueue return sq instead of opening the database, and returns the queue it replaces.
+func useSnatchQueue(sq *SnatchQueue) *SnatchQueue {
+	onceSnatchQueue.Do(func() {})
+	previous := snatchQueue
+	snatchQueue = sq
+	return previous
+}
+
+func (sq *SnatchQueue) init() error {
+	sq.inProgress = make(map[uint32]bool)
+	sq.lastSnatch = make(map[string]time.Time)
+	return sq.db.DB.Init(&QueuedSnatch{})
+}
+
+func (sq *SnatchQueue) Close() error {
+	return sq.db.Close()
+}
+
+// QueuedSnatch is a release waiting to be snatched, or that could not be snatched.
+type QueuedSnatch struct {
+	ID        uint32 `storm:"id,increment"`
+	Key       string `storm:"unique"`
+	Tracker   string `storm:"index"`
+	TorrentID string
+	Filter    string
+	WatchDir  string
+	Release   Release
+	Added     time.Time
+	NotBefore time.Time
+	Attempts  int
+	LastError string
+	Failed    bool `storm:"index"`
+}
+
+func queueKey(tracker, torrentID string) string {
+	return tracker + "|" + torrentID
+}
+
+func (qs *QueuedSnatch) String() string {
+	txt := fmt.Sprintf("#%d %s [%s] %s, accepted by filter %s: ", qs.ID, qs.Added.Format("2006.01.02 15h04"), qs.Tracker, qs.Release.ShortString(), qs.Filter)
+	switch {
+	case qs.Failed:
+		txt += fmt.Sprintf("failed after %d attempts", qs.Attempts)
+	case qs.Attempts != 0:
+		txt += fmt.Sprintf("pending, attempt %d at %s", qs.Attempts+1, qs.NotBefore.Format("15h04m05s"))
+	default:
+		txt += "pending, snatching at " + qs.NotBefore.Format("15h04m05s")
+	}
+	if qs.LastError != "" {
+		txt += " (" + qs.LastError + ")"
+	}
+	return txt
+}
+
+// Add a release to the queue, to be snatched after a delay. It returns false if the release was already waiting to
+// be snatched. A release that could not be snatched before is queued again.
+func (sq *SnatchQueue) Add(release *Release, filter, watchDir string, delay time.Duration) (bool, error) {
+	entry := &QueuedSnatch{
+		Key:       queueKey(release.Tracker, release.TorrentID),
+		Tracker:   release.Tracker,
+		TorrentID: release.TorrentID,
+		Filter:    filter,
+		WatchDir:  watchDir,
+		Release:   *release,
+		Added:     time.Now(),
+		NotBefore: time.Now().Add(delay),
+	}
+	if err := sq.db.DB.Save(entry); err != nil {
+		if err != storm.ErrAlreadyExists {
+			return false, errors.Wrap(err, errorAddingToSnatchQueue)
+		}
+		previous, err := sq.get(release.Tracker, release.TorrentID)
+		if err != nil {
+			return false, errors.Wrap(err, errorAddingToSnatchQueue)
+		}
+		if !previous.Failed {
+			return false, nil
+		}
+		// starting over, with the same ID
+		entry.ID = previous.ID
+		if err := sq.db.DB.Save(entry); err != nil {
+			return false, errors.Wrap(err, errorAddingToSnatchQueue)
+		}
+	}
+	sq.wakeUp()
+	return true, nil
+}
+
+// pending releases for a tracker.
+func (sq *SnatchQueue) pending(tracker string) []QueuedSnatch {
+	var entries []QueuedSnatch
+	if err := sq.db.DB.Select(q.Eq("Tracker", tracker), q.Eq("Failed", false)).Find(&entries); err != nil && err != storm.ErrNotFound {
+		logthis.Error(errors.Wrap(err, "error looking for queued releases"), logthis.NORMAL)
+	}
+	return entries
+}
+
+// QueuedDuplicate returns true if a duplicate of the release is waiting to be snatched.
+func (sq *SnatchQueue) QueuedDuplicate(release *Release) bool {
+	for _, entry := range sq.pending(release.Tracker) {
+		if entry.Release.isDuplicate(release) {
+			return true
+		}
+	}
+	return false
+}
+
+// isDuplicate returns true if both releases are the same edition of the same album, in the same format.
+func (r *Release) isDuplicate(other *Release) bool {
+	return r.Title == other.Title && r.Year == other.Year && r.ReleaseType == other.ReleaseType && r.Quality == other.Quality &&
+		r.Source == other.Source && r.Format == other.Format && r.IsScene == other.IsScene && strslice.Contains(r.Artists, other.Artists[0])
+}
+
+// PendingForFilter returns the releases accepted by a filter and waiting to be snatched, except cross-seeds.
+func (sq *SnatchQueue) PendingForFilter(filter string) []Release {
+	var entries []QueuedSnatch
+	if err := sq.db.DB.Select(q.Eq("Filter", filter), q.Eq("Failed", false)).Find(&entries); err != nil && err != storm.ErrNotFound {
+		logthis.Error(errors.Wrap(err, "error looking for queued releases"), logthis.NORMAL)
+	}
+	var releases []Release
+	for _, entry := range entries {
+		if !entry.Release.CrossSeed {
+			releases = append(releases, entry.Release)
+		}
+	}
+	return releases
+}
+
+// QueuedFromGroup returns true if a release from the same torrent group is waiting to be snatched.
+func (sq *SnatchQueue) QueuedFromGroup(release *Release) bool {
+	for _, entry := range sq.pending(release.Tracker) {
+		if entry.Release.GroupID == release.GroupID {
+			return true
+		}
+	}
+	return false
+}
+
+// QueuedCrossTrackerDuplicate returns a release waiting to be snatched from another tracker with the same contents, or nil.
+func (sq *SnatchQueue) QueuedCrossTrackerDuplicate(release *Release, matchSize, matchFiles bool) *Release {
+	var entries []QueuedSnatch
+	if err := sq.db.DB.Select(q.Not(q.Eq("Tracker", release.Tracker)), q.Eq("Failed", false)).Find(&entries); err != nil {
+		if err != storm.ErrNotFound {
+			logthis.Error(errors.Wrap(err, "error looking for queued releases"), logthis.NORMAL)
+		}
+		return nil
+	}
+	for i := range entries {
+		if release.isCrossTrackerDuplicate(&entries[i].Release, matchSize, matchFiles) {
+			return &entries[i].Release
+		}
+	}
+	return nil
+}
+
+// get the queue entry of a torrent.
+func (sq *SnatchQueue) get(tracker, torrentID string) (*QueuedSnatch, error) {
+	var entry QueuedSnatch
+	if err := sq.db.DB.One("Key", queueKey(tracker, torrentID), &entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// List all releases in the queue, oldest first.
+func (sq *SnatchQueue) List() ([]QueuedSnatch, error) {
+	var entries []QueuedSnatch
+	if err := sq.db.DB.All(&entries); err != nil && err != storm.ErrNotFound {
+		return nil, errors.Wrap(err, ErrorListingSnatchQueue)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Added.Before(entries[j].Added)
+	})
+	return entries, nil
+}
+
+// Counts of the pending and failed releases.
+func (sq *SnatchQueue) Counts() (int, int, error) {
+	entries, err := sq.List()
+	if err != nil {
+		return 0, 0, err
+	}
+	var failed int
+	for _, entry := range entries {
+		if entry.Failed {
+			failed++
+		}
+	}
+	return len(entries) - failed, failed, nil
+}
+
+// Purge the releases that could not be snatched, once they are older than the retention period.
+func (sq *SnatchQueue) Purge(retentionDays int) error {
+	oldest := time.Now().AddDate(0, 0, -retentionDays)
+	if err := sq.db.DB.Select(q.Eq("Failed", true), q.Lt("Added", oldest)).Delete(&QueuedSnatch{}); err != nil && err != storm.ErrNotFound {
+		return errors.Wrap(err, "could not remove old failed snatches")
+	}
+	return nil
+}
+
+// Start the workers.
+func (sq *SnatchQueue) Start(e *Environment, workers int) {
+	sq.mutex.Lock()
+	sq.stop = make(chan struct{})
+	sq.wake = make(chan struct{}, workers)
+	stop, wake := sq.stop, sq.wake
+	sq.mutex.Unlock()
+	for i := 0; i < workers; i++ {
+		sq.workers.Add(1)
+		go sq.work(e, stop, wake)
+	}
+}
+
+// Stop the workers, waiting for the current downloads to end. Releases still in the queue are snatched once started again.
+func (sq *SnatchQueue) Stop() {
+	sq.mutex.Lock()
+	if sq.stop != nil {
+		close(sq.stop)
+		sq.stop = nil
+	}
+	sq.mutex.Unlock()
+	sq.workers.Wait()
+}
+
+func (sq *SnatchQueue) wakeUp() {
+	sq.mutex.Lock()
+	defer sq.mutex.Unlock()
+	select {
+	case sq.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (sq *SnatchQueue) work(e *Environment, stop, wake chan struct{}) {
+	defer sq.workers.Done()
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		entry, wait := sq.next(e.Config())
+		if entry != nil {
+			sq.snatch(e, entry)
+			continue
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-wake:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// next release that can be snatched now, or how long to wait before looking again.
+func (sq *SnatchQueue) next(conf *Config) (*QueuedSnatch, time.Duration) {
+	var entries []QueuedSnatch
+	if err := sq.db.DB.Select(q.Eq("Failed", false)).Find(&entries); err != nil {
+		if err != storm.ErrNotFound {
+			logthis.Error(errors.Wrap(err, "error reading snatch queue"), logthis.NORMAL)
+		}
+		return nil, snatchQueueIdleCheck
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].NotBefore.Before(entries[j].NotBefore)
+	})
+
+	sq.mutex.Lock()
+	defer sq.mutex.Unlock()
+	now := time.Now()
+	wait := snatchQueueIdleCheck
+	for i := range entries {
+		entry := &entries[i]
+		if sq.inProgress[entry.ID] {
+			continue
+		}
+		due := entry.NotBefore
+		if autosnatchConfig, err := conf.GetAutosnatch(entry.Tracker); err == nil && autosnatchConfig.SnatchIntervalSeconds != 0 {
+			if allowed := sq.lastSnatch[entry.Tracker].Add(time.Duration(autosnatchConfig.SnatchIntervalSeconds) * time.Second); allowed.After(due) {
+				due = allowed
+			}
+		}
+		if !due.After(now) {
+			sq.inProgress[entry.ID] = true
+			sq.lastSnatch[entry.Tracker] = now
+			return entry, 0
+		}
+		if due.Sub(now) < wait {
+			wait = due.Sub(now)
+		}
+	}
+	return nil, wait
+}
+
+// snatch a queued release, removing it from the queue if successful, or scheduling another attempt.
+func (sq *SnatchQueue) snatch(e *Environment, entry *QueuedSnatch) {
+	if err := sq.download(e, entry); err != nil {
+		sq.retry(e, entry, err)
+	}
+	// only once the entry is saved with its new attempt, so that other workers do not see it due again
+	sq.mutex.Lock()
+	delete(sq.inProgress, entry.ID)
+	sq.mutex.Unlock()
+}
+
+func (sq *SnatchQueue) download(e *Environment, entry *QueuedSnatch) error {
+	conf := e.Config()
+	t, err := e.Tracker(entry.Tracker)
+	if err != nil {
+		return err
+	}
+	// getting up-to-date metadata, once the tracker has had time to settle
+	info := &TrackerMetadata{}
+	if err := info.LoadFromID(t, entry.TorrentID); err != nil {
+		return errors.Wrap(err, errorCouldNotGetTorrentInfo)
+	}
+	stats, err := NewStatsDB(e.paths.StatsDir(), conf)
+	if err != nil {
+		return errors.Wrap(err, "could not access the stats database")
+	}
+	sq.tokens.Lock()
+	// cross-seeds are not downloaded
+	entry.Release.FLToken = !entry.Release.CrossSeed && useFLToken(conf, stats, entry, info)
+	entry.Release.InfoHash, err = e.sendTorrent(t, info.ID, entry.Release.FLToken, entry.WatchDir, entry.Release.TorrentFile())
+	if err != nil && entry.Release.FLToken {
+		// the tracker may refuse the token, for instance if there are none left
+		logthis.Error(errors.Wrap(err, entry.Filter+": could not snatch with a freeleech token, trying without"), logthis.NORMAL)
+		entry.Release.FLToken = false
+		entry.Release.InfoHash, err = e.sendTorrent(t, info.ID, false, entry.WatchDir, entry.Release.TorrentFile())
+	}
+	if err != nil {
+		sq.tokens.Unlock()
+		return errors.Wrap(err, errorDownloadingTorrent)
+	}
+	// adding to history before leaving the queue, so that duplicates and tokens are always counted
+	if err := stats.AddSnatch(entry.Release); err != nil {
+		logthis.Error(errors.Wrap(err, errorAddingToHistory), logthis.NORMAL)
+	}
+	sq.tokens.Unlock()
+	switch {
+	case entry.Release.CrossSeed:
+		logthis.Info(entry.Filter+": snatched "+entry.Release.ShortString()+" to cross-seed it", logthis.NORMAL)
+	case entry.Release.FLToken:
+		logthis.Info(entry.Filter+": snatched "+entry.Release.ShortString()+" with a freeleech token", logthis.NORMAL)
+	default:
+		logthis.Info(entry.Filter+": snatched "+entry.Release.ShortString(), logthis.NORMAL)
+	}
+	if err := sq.db.DB.DeleteStruct(entry); err != nil {
+		logthis.Error(errors.Wrap(err, "could not remove snatched release from the queue"), logthis.NORMAL)
+	}
+	// send notification
+	if err := Notify(entry.Filter+": Snatched "+entry.Release.ShortString(), entry.Tracker, "info", e); err != nil {
+		logthis.Error(err, logthis.NORMAL)
+	}
+	// without the daemon, for backfills snatched in the foreground, nothing waits for the download to complete
+	saveMetadataAtSnatch(e, t, info)
+	return nil
+}
+
+// retry later, with an exponential backoff, until the tracker's number of attempts is reached.
+func (sq *SnatchQueue) retry(e *Environment, entry *QueuedSnatch, err error) {
+	attempts, retryDelay := defaultSnatchAttempts, defaultSnatchRetrySeconds*time.Second
+	if autosnatchConfig, configErr := e.Config().GetAutosnatch(entry.Tracker); configErr == nil {
+		attempts, retryDelay = autosnatchConfig.SnatchAttempts, time.Duration(autosnatchConfig.SnatchRetrySeconds)*time.Second
+	}
+	entry.Attempts++
+	entry.LastError = err.Error()
+	if entry.Attempts >= attempts {
+		entry.Failed = true
+		msg := fmt.Sprintf("%s: could not snatch %s after %d attempts", entry.Filter, entry.Release.ShortString(), entry.Attempts)
+		logthis.Error(errors.Wrap(err, msg), logthis.NORMAL)
+		if err := Notify(msg, entry.Tracker, "error", e); err != nil {
+			logthis.Error(err, logthis.NORMAL)
+		}
+	} else {
+		delay := retryDelay << uint(entry.Attempts-1)
+		if delay > maxSnatchRetryDelay || delay <= 0 {
+			delay = maxSnatchRetryDelay
+		}
+		entry.NotBefore = time.Now().Add(delay)
+		logthis.Error(errors.Wrap(err, fmt.Sprintf("%s: could not snatch %s, trying again in %s", entry.Filter, entry.Release.ShortString(), delay)), logthis.NORMAL)
+	}
+	if err := sq.db.DB.Save(entry); err != nil {
+		logthis.Error(errors.Wrap(err, "could not update the snatch queue"), logthis.NORMAL)
+	}
+	sq.wakeUp()
+}
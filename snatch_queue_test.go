@@ -0,0 +1,116 @@
+package varroa
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnatchQueue(t *testing.T) {
+	fmt.Println("+ Testing SnatchQueue...")
+	check := assert.New(t)
+
+	dataDir, err := ioutil.TempDir("", "varroa")
+	check.Nil(err)
+	defer os.RemoveAll(dataDir)
+	db, err := NewDatabase(filepath.Join(dataDir, DefaultSnatchQueueDB))
+	check.Nil(err)
+	defer db.Close()
+	sq := &SnatchQueue{db: db}
+	check.Nil(sq.init())
+
+	conf := &Config{Autosnatch: []*ConfigAutosnatch{{Tracker: "sim", SnatchIntervalSeconds: 60, SnatchAttempts: 2, SnatchRetrySeconds: 10}}}
+	r1 := &Release{Tracker: "sim", TorrentID: "101", GroupID: "10", Artists: []string{"Artist A"}, Title: "First Album", Year: 2018, ReleaseType: "Album", Format: "FLAC", Quality: "Lossless", Source: "WEB"}
+	r2 := &Release{Tracker: "sim", TorrentID: "999", GroupID: "20", Artists: []string{"Artist B"}, Title: "Missing", Year: 2018, ReleaseType: "Album", Format: "FLAC", Quality: "Lossless", Source: "WEB"}
+
+	// adding and deduplicating
+	added, err := sq.Add(r1, "electronic", dataDir, time.Hour)
+	check.Nil(err)
+	check.True(added)
+	added, err = sq.Add(r1, "other", dataDir, 0)
+	check.Nil(err)
+	check.False(added)
+	added, err = sq.Add(r2, "electronic", dataDir, 0)
+	check.Nil(err)
+	check.True(added)
+	check.True(sq.QueuedFromGroup(&Release{Tracker: "sim", GroupID: "10"}))
+	check.False(sq.QueuedFromGroup(&Release{Tracker: "other", GroupID: "10"}))
+	duplicate := *r1
+	duplicate.TorrentID = "104"
+	check.True(sq.QueuedDuplicate(&duplicate))
+	duplicate.Format = "MP3"
+	check.False(sq.QueuedDuplicate(&duplicate))
+
+	// the delayed release waits, then the tracker's rate limit applies
+	entry, _ := sq.next(conf)
+	check.NotNil(entry)
+	check.Equal("999", entry.TorrentID)
+	other, wait := sq.next(conf)
+	check.Nil(other)
+	check.True(wait > 0 && wait <= snatchQueueIdleCheck)
+	sq.inProgress = make(map[uint32]bool)
+	sq.lastSnatch = make(map[string]time.Time)
+
+	// failing downloads are retried with a backoff, then kept as failed
+	sim, err := NewSimulator("127.0.0.1:0", "127.0.0.1:0", filepath.Join("test", "simulator"))
+	check.Nil(err)
+	sim.User = "simuser"
+	sim.Start()
+	defer sim.Stop()
+	tr, err := simulatedTracker(sim, "sim")
+	check.Nil(err)
+	e := NewEnvironment(NewPaths("", dataDir, ""))
+	e.config = conf
+	e.Trackers["sim"] = tr
+
+	sq.snatch(e, entry)
+	entries, err := sq.List()
+	check.Nil(err)
+	check.Equal(2, len(entries))
+	check.Equal(1, entries[1].Attempts)
+	check.False(entries[1].Failed)
+	check.NotEqual("", entries[1].LastError)
+	check.True(entries[1].NotBefore.After(time.Now().Add(9 * time.Second)))
+	check.Empty(sq.inProgress)
+	sq.snatch(e, &entries[1])
+	pending, failed, err := sq.Counts()
+	check.Nil(err)
+	check.Equal(1, pending)
+	check.Equal(1, failed)
+	check.False(sq.QueuedFromGroup(r2))
+	check.Empty(sim.Downloads())
+
+	// a failed release announced again is queued again, from scratch
+	added, err = sq.Add(r2, "other", dataDir, 0)
+	check.Nil(err)
+	check.True(added)
+	retried, err := sq.get("sim", "999")
+	check.Nil(err)
+	check.Equal(entries[1].ID, retried.ID)
+	check.False(retried.Failed)
+	check.Equal(0, retried.Attempts)
+	check.Equal("", retried.LastError)
+	check.Equal("other", retried.Filter)
+	check.True(sq.QueuedFromGroup(r2))
+	entries, err = sq.List()
+	check.Nil(err)
+	entries[1].Attempts = 1
+	sq.retry(e, &entries[1], errors.New("failing again"))
+
+	// failed snatches are forgotten after the retention period
+	check.Nil(sq.Purge(1))
+	_, failed, err = sq.Counts()
+	check.Nil(err)
+	check.Equal(1, failed)
+	check.Nil(sq.Purge(-1))
+	pending, failed, err = sq.Counts()
+	check.Nil(err)
+	check.Equal(1, pending)
+	check.Equal(0, failed)
+}
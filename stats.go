@@ -1,7 +1,6 @@
 package varroa
 
 import (
-	"path/filepath"
 	"reflect"
 	"time"
 
@@ -11,8 +10,9 @@ import (
 )
 
 func updateStats(e *Environment, tracker string, stats *StatsDB) error {
+	conf := e.Config()
 	// read configuration for this tracker
-	statsConfig, err := e.config.GetStats(tracker)
+	statsConfig, err := conf.GetStats(tracker)
 	if err != nil {
 		return errors.Wrap(err, "Error loading stats config for "+tracker)
 	}
@@ -51,14 +51,14 @@ func updateStats(e *Environment, tracker string, stats *StatsDB) error {
 	}
 
 	// compare with new stats
-	logthis.Info(newStats.Progress(&previousStats), logthis.NORMAL)
+	logthis.Info(newStats.Progress(&previousStats, statsConfig.TargetRatio), logthis.NORMAL)
 	// send notification
-	if notifyErr := Notify("stats: "+newStats.Progress(&previousStats), tracker, "info", e); notifyErr != nil {
+	if notifyErr := Notify("stats: "+newStats.Progress(&previousStats, statsConfig.TargetRatio), tracker, "info", e); notifyErr != nil {
 		logthis.Error(notifyErr, logthis.NORMAL)
 	}
 
 	// if something is wrong, send notification and stop
-	if !newStats.IsProgressAcceptable(&previousStats, statsConfig.MaxBufferDecreaseMB, statsConfig.MinimumRatio) {
+	if !newStats.IsProgressAcceptable(&previousStats, statsConfig.MaxBufferDecreaseMB, statsConfig.MinimumRatio, statsConfig.TargetRatio) {
 		if newStats.Ratio <= statsConfig.MinimumRatio {
 			// unacceptable because of low ratio
 			logthis.Info(tracker+": "+errorBelowWarningRatio, logthis.NORMAL)
@@ -75,26 +75,25 @@ func updateStats(e *Environment, tracker string, stats *StatsDB) error {
 			}
 		}
 		// stopping things
-		autosnatchConfig, err := e.config.GetAutosnatch(tracker)
-		if err != nil {
+		buffer, _ := newStats.getBufferValues(statsConfig.TargetRatio)
+		if err := e.disableAutosnatchingAfterIncident(tracker, buffer); err != nil {
 			logthis.Error(errors.Wrap(err, "Cannot find autosnatch configuration for tracker "+tracker), logthis.NORMAL)
-		} else {
-			e.mutex.Lock()
-			autosnatchConfig.disabledAutosnatching = true
-			e.mutex.Unlock()
 		}
+	} else if err := e.reenableAutosnatchingAfterRecovery(tracker, statsConfig, newStats); err != nil {
+		logthis.Error(err, logthis.NORMAL)
 	}
 
 	// generate graphs
-	return stats.GenerateAllGraphsForTracker(tracker)
+	return stats.GenerateAllGraphsForTracker(statsConfig)
 }
 
-func monitorAllStats(e *Environment) {
-	if !e.config.statsConfigured {
+func monitorAllStats(e *Environment, stop <-chan struct{}) {
+	conf := e.Config()
+	if !conf.statsConfigured {
 		return
 	}
 	// access to statsDB
-	stats, err := NewStatsDB(filepath.Join(StatsDir, DefaultHistoryDB))
+	stats, err := NewStatsDB(e.paths.StatsDir(), conf)
 	if err != nil {
 		logthis.Error(errors.Wrap(err, "Error, could not access the stats database"), logthis.NORMAL)
 		return
@@ -102,8 +101,8 @@ func monitorAllStats(e *Environment) {
 
 	// track all different periods
 	tickers := map[int][]string{}
-	for label, t := range e.Trackers {
-		if statsConfig, err := e.config.GetStats(t.Name); err == nil {
+	for label, t := range e.trackers() {
+		if statsConfig, err := conf.GetStats(t.Name); err == nil {
 			// initial stats
 			if err := updateStats(e, label, stats); err != nil {
 				logthis.Error(errors.Wrap(err, ErrorGeneratingGraphs), logthis.NORMAL)
@@ -126,17 +125,25 @@ func monitorAllStats(e *Environment) {
 	tickerPeriods := make([]int, len(tickers))
 	cpt := 0
 	for p := range tickers {
-		tickerChans[cpt] = time.NewTicker(time.Hour * time.Duration(p)).C
+		ticker := time.NewTicker(time.Hour * time.Duration(p))
+		defer ticker.Stop()
+		tickerChans[cpt] = ticker.C
 		tickerPeriods[cpt] = p
 		cpt++
 	}
-	cases := make([]reflect.SelectCase, len(tickerChans))
+	cases := make([]reflect.SelectCase, len(tickerChans)+1)
 	for i, ch := range tickerChans {
 		cases[i] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ch)}
 	}
+	// the last case stops monitoring, when the configuration is reloaded
+	cases[len(tickerChans)] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(stop)}
 	// wait for ticks
 	for {
 		triggered, _, ok := reflect.Select(cases)
+		if triggered == len(tickerChans) {
+			logthis.Info("Stopped monitoring stats.", logthis.VERBOSE)
+			return
+		}
 		if !ok {
 			// The triggered channel has been closed, so zero out the channel to disable the case
 			cases[triggered].Chan = reflect.ValueOf(nil)
@@ -9,6 +9,7 @@ import (
 
 	"github.com/asdine/storm"
 	"github.com/asdine/storm/q"
+	"github.com/dustin/go-humanize"
 	"github.com/jinzhu/now"
 	"github.com/pkg/errors"
 	"github.com/wcharczuk/go-chart"
@@ -20,49 +21,53 @@ var statsDB *StatsDB
 var onceStatsDB sync.Once
 
 type StatsDB struct {
-	db *Database
+	db  *Database
+	dir string
 }
 
-func NewStatsDB(path string) (*StatsDB, error) {
+// NewStatsDB opens the stats database in the stats directory, migrating the entries of the configured trackers if necessary.
+// The graphs are generated in the same directory.
+func NewStatsDB(statsDir string, conf *Config) (*StatsDB, error) {
 	var returnErr error
 	onceStatsDB.Do(func() {
 		// db should be opened already
-		db, err := NewDatabase(path)
+		db, err := NewDatabase(filepath.Join(statsDir, DefaultHistoryDB))
 		if err != nil {
 			returnErr = errors.Wrap(err, "Error opening stats database")
 			return
 		}
-		statsDB = &StatsDB{db: db}
+		statsDB = &StatsDB{db: db, dir: statsDir}
 		if returnErr = statsDB.init(); returnErr != nil {
 			return
 		}
 
-		conf, err := NewConfig(DefaultConfigurationFile)
-		if err != nil {
-			logthis.Error(err, logthis.NORMAL)
-			returnErr = err
-			return
-		} else {
-			// try to import <v19
-			migratedSomething := false
-			for _, label := range conf.TrackerLabels() {
-				migrated, err := statsDB.migrate(label)
-				if err != nil && err != storm.ErrNotFound {
-					logthis.Error(errors.Wrap(err, "Error migrating database to a new schema, for tracker "+label), logthis.VERBOSEST)
-				} else if migrated {
-					migratedSomething = migrated
-				}
-			}
-			if migratedSomething {
-				logthis.Info("Updating stats after migration", logthis.NORMAL)
-				returnErr = statsDB.Update()
-				return
+		// try to import <v19
+		migratedSomething := false
+		for _, label := range conf.TrackerLabels() {
+			migrated, err := statsDB.migrate(label)
+			if err != nil && err != storm.ErrNotFound {
+				logthis.Error(errors.Wrap(err, "Error migrating database to a new schema, for tracker "+label), logthis.VERBOSEST)
+			} else if migrated {
+				migratedSomething = migrated
 			}
 		}
+		if migratedSomething {
+			logthis.Info("Updating stats after migration", logthis.NORMAL)
+			returnErr = statsDB.Update(conf.TrackerLabels())
+			return
+		}
 	})
 	return statsDB, returnErr
 }
 
+// useStatsDB makes NewStatsDB return sdb instead of opening the database, and returns the database it replaces.
+func useStatsDB(sdb *StatsDB) *StatsDB {
+	onceStatsDB.Do(func() {})
+	previous := statsDB
+	statsDB = sdb
+	return previous
+}
+
 func (sdb *StatsDB) init() error {
 	if err := sdb.db.DB.Init(&StatsEntry{}); err != nil {
 		return err
@@ -70,9 +75,16 @@ func (sdb *StatsDB) init() error {
 	if err := sdb.db.DB.Init(&SnatchStatsEntry{}); err != nil {
 		return err
 	}
+	if err := sdb.db.DB.Init(&CompletedDownload{}); err != nil {
+		return err
+	}
 	return sdb.db.DB.Init(&Release{})
 }
 
+func (sdb *StatsDB) Close() error {
+	return sdb.db.Close()
+}
+
 func (sdb *StatsDB) migrate(tracker string) (bool, error) {
 	var migratedSchema bool
 	var err error
@@ -111,17 +123,10 @@ func (sdb *StatsDB) migrate(tracker string) (bool, error) {
 // Update needs to be called everyday at midnight (add cron job)
 // It creates StatsEntries for each start of day (which might also be start of week/month)
 // That way, it'll be quicker to create stats and recalculate StatsDeltas.
-func (sdb *StatsDB) Update() error {
+func (sdb *StatsDB) Update(allTrackers []string) error {
 	defer TimeTrack(time.Now(), "UPDATE")
 	// TODO: add cron job
 
-	// get tracker labels from config.
-	conf, err := NewConfig(DefaultConfigurationFile)
-	if err != nil {
-		return err
-	}
-	allTrackers := conf.TrackerLabels()
-
 	// transaction for quicker results
 	tx, err := sdb.db.DB.Begin(true)
 	if err != nil {
@@ -234,6 +239,9 @@ func (sdb *StatsDB) Update() error {
 						snatchEntryForThisDay.Number = len(newSnatches)
 						for _, s := range newSnatches {
 							snatchEntryForThisDay.Size += s.Size
+							if s.FLToken {
+								snatchEntryForThisDay.FLTokens++
+							}
 						}
 					}
 					// if the new day stats is the start of an iso week, StartOfWeek = true
@@ -288,8 +296,9 @@ func (sdb *StatsDB) GetLastCollected(tracker string, limit int) ([]StatsEntry, e
 	return lastEntries, err
 }
 
-func (sdb *StatsDB) GenerateAllGraphsForTracker(tracker string) error {
+func (sdb *StatsDB) GenerateAllGraphsForTracker(statsConfig *ConfigStats) error {
 	atLeastOneFailed := false
+	tracker := statsConfig.Tracker
 
 	firstStats, err := sdb.getFirstStatsForTracker(tracker)
 	if err != nil {
@@ -301,7 +310,7 @@ func (sdb *StatsDB) GenerateAllGraphsForTracker(tracker string) error {
 	if err != nil {
 		return errors.New("could not get all collected stats for " + tracker)
 	}
-	if err := generateGraphs(tracker, overallPrefix, allStatsEntries, firstStats.Timestamp); err != nil {
+	if err := sdb.generateGraphs(statsConfig, overallPrefix, allStatsEntries, firstStats.Timestamp); err != nil {
 		return err
 	}
 	// 2. collect stats since last week
@@ -315,7 +324,7 @@ func (sdb *StatsDB) GenerateAllGraphsForTracker(tracker string) error {
 		}
 	}
 	if len(lastWeekStatsEntries) != 0 {
-		if err := generateGraphs(tracker, lastWeekPrefix, lastWeekStatsEntries, lastWeekStatsEntries[0].Timestamp); err != nil {
+		if err := sdb.generateGraphs(statsConfig, lastWeekPrefix, lastWeekStatsEntries, lastWeekStatsEntries[0].Timestamp); err != nil {
 			logthis.Error(err, logthis.NORMAL)
 			atLeastOneFailed = true
 		}
@@ -332,7 +341,7 @@ func (sdb *StatsDB) GenerateAllGraphsForTracker(tracker string) error {
 		}
 	}
 	if len(lastMonthStatsEntries) != 0 {
-		if err := generateGraphs(tracker, lastMonthPrefix, lastMonthStatsEntries, lastMonthStatsEntries[0].Timestamp); err != nil {
+		if err := sdb.generateGraphs(statsConfig, lastMonthPrefix, lastMonthStatsEntries, lastMonthStatsEntries[0].Timestamp); err != nil {
 			logthis.Error(err, logthis.NORMAL)
 			atLeastOneFailed = true
 		}
@@ -347,10 +356,10 @@ func (sdb *StatsDB) GenerateAllGraphsForTracker(tracker string) error {
 			return errors.Wrap(err, "error querying database")
 		}
 	}
-	allDailyDeltas := CalculateDeltas(allDailyStats)
+	allDailyDeltas := CalculateDeltas(allDailyStats, statsConfig.TargetRatio)
 	// generate graphs
 	if len(allDailyDeltas) != 0 {
-		if err := generateDeltaGraphs(tracker, overallPrefix+"_per_day", allDailyDeltas, allDailyDeltas[0].Timestamp); err != nil {
+		if err := sdb.generateDeltaGraphs(tracker, overallPrefix+"_per_day", allDailyDeltas, allDailyDeltas[0].Timestamp); err != nil {
 			logthis.Error(err, logthis.NORMAL)
 			atLeastOneFailed = true
 		}
@@ -365,10 +374,10 @@ func (sdb *StatsDB) GenerateAllGraphsForTracker(tracker string) error {
 			return errors.Wrap(err, "error querying database")
 		}
 	}
-	allWeeklyDeltas := CalculateDeltas(allWeeklyStats)
+	allWeeklyDeltas := CalculateDeltas(allWeeklyStats, statsConfig.TargetRatio)
 	// generate graphs
 	if len(allWeeklyDeltas) != 0 {
-		if err := generateDeltaGraphs(tracker, overallPrefix+"_per_week", allWeeklyDeltas, allWeeklyDeltas[0].Timestamp); err != nil {
+		if err := sdb.generateDeltaGraphs(tracker, overallPrefix+"_per_week", allWeeklyDeltas, allWeeklyDeltas[0].Timestamp); err != nil {
 			logthis.Error(err, logthis.NORMAL)
 			atLeastOneFailed = true
 		}
@@ -383,10 +392,10 @@ func (sdb *StatsDB) GenerateAllGraphsForTracker(tracker string) error {
 			return errors.Wrap(err, "error querying database")
 		}
 	}
-	allMonthlyDeltas := CalculateDeltas(allMonthlyStats)
+	allMonthlyDeltas := CalculateDeltas(allMonthlyStats, statsConfig.TargetRatio)
 	// generate graphs
 	if len(allMonthlyDeltas) != 0 {
-		if err := generateDeltaGraphs(tracker, overallPrefix+"_per_month", allMonthlyDeltas, allMonthlyDeltas[0].Timestamp); err != nil {
+		if err := sdb.generateDeltaGraphs(tracker, overallPrefix+"_per_month", allMonthlyDeltas, allMonthlyDeltas[0].Timestamp); err != nil {
 			logthis.Error(err, logthis.NORMAL)
 			atLeastOneFailed = true
 		}
@@ -416,7 +425,7 @@ func (sdb *StatsDB) GenerateAllGraphsForTracker(tracker string) error {
 		if len(top10tags) > 10 {
 			top10tags = top10tags[:10]
 		}
-		if err := writePieChart(top10tags, "Top tags", filepath.Join(StatsDir, tracker+"_"+toptagsFile)); err != nil {
+		if err := writePieChart(top10tags, "Top tags", filepath.Join(sdb.dir, tracker+"_"+toptagsFile)); err != nil {
 			logthis.Error(err, logthis.NORMAL)
 			atLeastOneFailed = true
 		}
@@ -431,7 +440,7 @@ func (sdb *StatsDB) GenerateAllGraphsForTracker(tracker string) error {
 		for k, v := range filterHits {
 			pieSlices = append(pieSlices, chart.Value{Value: v, Label: fmt.Sprintf("%s (%d)", k, int(v))})
 		}
-		if err := writePieChart(pieSlices, "Total snatches by filter", filepath.Join(StatsDir, tracker+"_"+totalSnatchesByFilterFile)); err != nil {
+		if err := writePieChart(pieSlices, "Total snatches by filter", filepath.Join(sdb.dir, tracker+"_"+totalSnatchesByFilterFile)); err != nil {
 			logthis.Error(err, logthis.NORMAL)
 			atLeastOneFailed = true
 		}
@@ -446,23 +455,23 @@ func (sdb *StatsDB) GenerateAllGraphsForTracker(tracker string) error {
 	snatchStatsSeries := SnatchStatsSeries{}
 	snatchStatsSeries.AddStats(allSnatchStats...)
 	// generate graphs
-	if err := snatchStatsSeries.GenerateGraphs(StatsDir, tracker+"_", firstStats.Timestamp, true); err != nil {
+	if err := snatchStatsSeries.GenerateGraphs(sdb.dir, tracker+"_", firstStats.Timestamp, true); err != nil {
 		logthis.Error(err, logthis.NORMAL)
 		atLeastOneFailed = true
 	}
 
 	// combine graphs into overallStatsFile
-	if err := combineAllPNGs(filepath.Join(StatsDir, tracker+"_"+overallStatsFile),
-		filepath.Join(StatsDir, tracker+"_overall_"+uploadStatsFile),
-		filepath.Join(StatsDir, tracker+"_overall_per_day_"+uploadStatsFile),
-		filepath.Join(StatsDir, tracker+"_overall_"+downloadStatsFile),
-		filepath.Join(StatsDir, tracker+"_overall_per_day_"+downloadStatsFile),
-		filepath.Join(StatsDir, tracker+"_overall_"+bufferStatsFile),
-		filepath.Join(StatsDir, tracker+"_overall_per_day_"+bufferStatsFile),
-		filepath.Join(StatsDir, tracker+"_overall_"+ratioStatsFile),
-		filepath.Join(StatsDir, tracker+"_overall_per_day_"+ratioStatsFile),
-		filepath.Join(StatsDir, tracker+"_"+totalSnatchesByFilterFile),
-		filepath.Join(StatsDir, tracker+"_"+toptagsFile)); err != nil {
+	if err := combineAllPNGs(filepath.Join(sdb.dir, tracker+"_"+overallStatsFile),
+		filepath.Join(sdb.dir, tracker+"_overall_"+uploadStatsFile),
+		filepath.Join(sdb.dir, tracker+"_overall_per_day_"+uploadStatsFile),
+		filepath.Join(sdb.dir, tracker+"_overall_"+downloadStatsFile),
+		filepath.Join(sdb.dir, tracker+"_overall_per_day_"+downloadStatsFile),
+		filepath.Join(sdb.dir, tracker+"_overall_"+bufferStatsFile),
+		filepath.Join(sdb.dir, tracker+"_overall_per_day_"+bufferStatsFile),
+		filepath.Join(sdb.dir, tracker+"_overall_"+ratioStatsFile),
+		filepath.Join(sdb.dir, tracker+"_overall_per_day_"+ratioStatsFile),
+		filepath.Join(sdb.dir, tracker+"_"+totalSnatchesByFilterFile),
+		filepath.Join(sdb.dir, tracker+"_"+toptagsFile)); err != nil {
 		return err
 	}
 	// return
@@ -474,24 +483,25 @@ func (sdb *StatsDB) GenerateAllGraphsForTracker(tracker string) error {
 
 // generateGraphs for data points
 // graphType == lastweek, lastmonth, overall, etc
-func generateGraphs(tracker, graphType string, entries []StatsEntry, firstTimestamp time.Time) error {
+func (sdb *StatsDB) generateGraphs(statsConfig *ConfigStats, graphType string, entries []StatsEntry, firstTimestamp time.Time) error {
+	tracker := statsConfig.Tracker
 	logthis.Info("Generating "+graphType+" graphs for tracker "+tracker, logthis.VERBOSEST)
-	overallStats := StatsSeries{Tracker: tracker}
+	overallStats := StatsSeries{Tracker: tracker, TargetRatio: statsConfig.TargetRatio}
 	if err := overallStats.AddStats(entries...); err != nil {
 		return err
 	}
-	return overallStats.GenerateGraphs(StatsDir, tracker+"_"+graphType+"_", firstTimestamp, false)
+	return overallStats.GenerateGraphs(sdb.dir, tracker+"_"+graphType+"_", firstTimestamp, false)
 }
 
 // generateDeltaGraphs for data deltas
 // graphType == daily, weekly, monthly, etc
-func generateDeltaGraphs(tracker, graphType string, entries []StatsDelta, firstTimestamp time.Time) error {
+func (sdb *StatsDB) generateDeltaGraphs(tracker, graphType string, entries []StatsDelta, firstTimestamp time.Time) error {
 	logthis.Info("Generating "+graphType+" delta graphs for tracker "+tracker, logthis.VERBOSEST)
 	overallStats := StatsSeries{Tracker: tracker}
 	if err := overallStats.AddDeltas(entries...); err != nil {
 		return err
 	}
-	return overallStats.GenerateGraphs(StatsDir, tracker+"_"+graphType+"_", firstTimestamp, true)
+	return overallStats.GenerateGraphs(sdb.dir, tracker+"_"+graphType+"_", firstTimestamp, true)
 }
 
 func (sdb *StatsDB) AddSnatch(release Release) error {
@@ -499,6 +509,49 @@ func (sdb *StatsDB) AddSnatch(release Release) error {
 	return sdb.db.DB.Save(&release)
 }
 
+// UpdateSnatch saves changes to a release of the history.
+func (sdb *StatsDB) UpdateSnatch(release Release) error {
+	return sdb.db.DB.Update(&release)
+}
+
+// Downloading returns the releases snatched since a given time, sent to a torrent client, and not yet complete.
+func (sdb *StatsDB) Downloading(since time.Time) ([]Release, error) {
+	var releases []Release
+	if err := sdb.db.DB.Select(q.Gte("Timestamp", since), q.Not(q.Eq("InfoHash", "")), q.Eq("Completed", false)).Find(&releases); err != nil {
+		if err == storm.ErrNotFound {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "error looking for releases being downloaded")
+	}
+	return releases, nil
+}
+
+// SaveCompletedDownload and the progress of its pipeline.
+func (sdb *StatsDB) SaveCompletedDownload(cd *CompletedDownload) error {
+	return sdb.db.DB.Save(cd)
+}
+
+// FailedCompletedDownloads returns the completed downloads whose pipeline has not gone through all stages.
+func (sdb *StatsDB) FailedCompletedDownloads() ([]CompletedDownload, error) {
+	var downloads []CompletedDownload
+	if err := sdb.db.DB.Select(q.Eq("Done", false)).Find(&downloads); err != nil {
+		if err == storm.ErrNotFound {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "error looking for completed downloads")
+	}
+	return downloads, nil
+}
+
+// FLTokensUsed returns the number of freeleech tokens used to snatch releases from a tracker.
+func (sdb *StatsDB) FLTokensUsed(tracker string) (int, error) {
+	n, err := sdb.db.DB.Select(q.Eq("Tracker", tracker), q.Eq("FLToken", true)).Count(&Release{})
+	if err != nil && err != storm.ErrNotFound {
+		return 0, errors.Wrap(err, "error counting freeleech tokens used")
+	}
+	return n, nil
+}
+
 func (sdb *StatsDB) AlreadySnatchedDuplicate(release *Release) bool {
 	duplicateQuery := q.And(
 		q.Eq("Tracker", release.Tracker),
@@ -535,3 +588,78 @@ func (sdb *StatsDB) AlreadySnatchedFromGroup(release *Release) bool {
 	}
 	return true
 }
+
+// CrossTrackerDuplicate returns a release snatched from another tracker with the same contents, or nil.
+func (sdb *StatsDB) CrossTrackerDuplicate(release *Release, matchSize, matchFiles bool) (*Release, error) {
+	var candidates []Release
+	if err := sdb.db.DB.Select(q.Not(q.Eq("Tracker", release.Tracker)), q.Eq("Format", release.Format), q.Eq("Quality", release.Quality)).Find(&candidates); err != nil {
+		if err == storm.ErrNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	for i := range candidates {
+		if release.isCrossTrackerDuplicate(&candidates[i], matchSize, matchFiles) {
+			return &candidates[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// SnatchedByFilter returns the number and total size of the releases snatched by a filter since a given time.
+// Cross-seeds are not downloaded, and do not count.
+func (sdb *StatsDB) SnatchedByFilter(filter string, since time.Time) (int, uint64, error) {
+	var releases []Release
+	if err := sdb.db.DB.Select(q.Eq("Filter", filter), q.Gte("Timestamp", since), q.Eq("CrossSeed", false)).Find(&releases); err != nil {
+		if err == storm.ErrNotFound {
+			return 0, 0, nil
+		}
+		return 0, 0, errors.Wrap(err, "error looking for releases snatched by filter "+filter)
+	}
+	var size uint64
+	for _, r := range releases {
+		size += r.Size
+	}
+	return len(releases), size, nil
+}
+
+// CheckQuotas rejects the release if snatching it would exceed one of the quotas of the filter.
+// Pending releases, accepted by the filter but not snatched yet, count as if they had just been snatched.
+// Quotas per day and per week are sliding windows.
+func (sdb *StatsDB) CheckQuotas(filter *ConfigFilter, release *Release, pending []Release, verdict *FilterVerdict) (*FilterVerdict, error) {
+	var pendingSize uint64
+	for _, r := range pending {
+		pendingSize += r.Size
+	}
+	if filter.MaxSnatchesPerDay != 0 {
+		number, _, err := sdb.SnatchedByFilter(filter.Name, time.Now().Add(-24*time.Hour))
+		if err != nil {
+			return verdict, err
+		}
+		number += len(pending)
+		if number >= filter.MaxSnatchesPerDay {
+			verdict.reject(CriterionQuota, "Daily snatch quota reached", fmt.Sprintf("< %d snatches in 24h", filter.MaxSnatchesPerDay), fmt.Sprintf("%d snatches in 24h", number))
+		}
+	}
+	if filter.MaxSizePerWeekGB != 0 {
+		_, size, err := sdb.SnatchedByFilter(filter.Name, time.Now().AddDate(0, 0, -7))
+		if err != nil {
+			return verdict, err
+		}
+		size += pendingSize
+		if size+release.Size > uint64(filter.MaxSizePerWeekGB)*1024*1024*1024 {
+			verdict.reject(CriterionQuota, "Weekly size quota reached", fmt.Sprintf("<= %dGB in 7 days", filter.MaxSizePerWeekGB), fmt.Sprintf("%s + %s in 7 days", humanize.IBytes(size), humanize.IBytes(release.Size)))
+		}
+	}
+	if filter.MaxTotalSnatches != 0 {
+		number, _, err := sdb.SnatchedByFilter(filter.Name, time.Time{})
+		if err != nil {
+			return verdict, err
+		}
+		number += len(pending)
+		if number >= filter.MaxTotalSnatches {
+			verdict.reject(CriterionQuota, "Snatch quota reached", fmt.Sprintf("< %d snatches", filter.MaxTotalSnatches), fmt.Sprintf("%d snatches", number))
+		}
+	}
+	return verdict, nil
+}
@@ -0,0 +1,85 @@
+package varroa
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterQuotas(t *testing.T) {
+	fmt.Println("+ Testing StatsDB/quotas...")
+	check := assert.New(t)
+
+	// setting up, without NewStatsDB which only opens one database
+	dbPath := filepath.Join("test", "test_quotas.db")
+	defer os.Remove(dbPath)
+	db, err := NewDatabase(dbPath)
+	check.Nil(err)
+	defer db.Close()
+	stats := &StatsDB{db: db}
+	check.Nil(stats.init())
+
+	gb := uint64(1024 * 1024 * 1024)
+	check.Nil(stats.AddSnatch(Release{Filter: "f", Timestamp: time.Now().Add(-2 * time.Hour), Size: 2 * gb}))
+	check.Nil(stats.AddSnatch(Release{Filter: "f", Timestamp: time.Now().AddDate(0, 0, -3), Size: 3 * gb}))
+	check.Nil(stats.AddSnatch(Release{Filter: "f", Timestamp: time.Now().AddDate(0, 0, -20), Size: 10 * gb}))
+	check.Nil(stats.AddSnatch(Release{Filter: "other", Timestamp: time.Now(), Size: gb}))
+
+	number, size, err := stats.SnatchedByFilter("f", time.Now().AddDate(0, 0, -7))
+	check.Nil(err)
+	check.Equal(2, number)
+	check.Equal(5*gb, size)
+
+	r := &Release{Size: gb}
+	quotas := []struct {
+		filter   *ConfigFilter
+		accepted bool
+	}{
+		{&ConfigFilter{Name: "f"}, true},
+		{&ConfigFilter{Name: "f", MaxSnatchesPerDay: 2}, true},
+		{&ConfigFilter{Name: "f", MaxSnatchesPerDay: 1}, false},
+		{&ConfigFilter{Name: "f", MaxSizePerWeekGB: 6}, true},
+		{&ConfigFilter{Name: "f", MaxSizePerWeekGB: 5}, false},
+		{&ConfigFilter{Name: "f", MaxTotalSnatches: 4}, true},
+		{&ConfigFilter{Name: "f", MaxTotalSnatches: 3}, false},
+		{&ConfigFilter{Name: "other", MaxSnatchesPerDay: 2, MaxSizePerWeekGB: 2, MaxTotalSnatches: 2}, true},
+	}
+	for _, q := range quotas {
+		v, err := stats.CheckQuotas(q.filter, r, nil, &FilterVerdict{Filter: q.filter.Name})
+		check.Nil(err)
+		check.Equal(q.accepted, v.Accepted(), q.filter.String())
+		if !q.accepted {
+			check.Equal(CriterionQuota, v.Criterion)
+			check.False(v.NearMiss())
+		}
+	}
+	// releases waiting to be snatched count against the quotas
+	pending := []Release{{Filter: "f", Size: gb}}
+	v, err := stats.CheckQuotas(&ConfigFilter{Name: "f", MaxSnatchesPerDay: 2}, r, pending, &FilterVerdict{Filter: "f"})
+	check.Nil(err)
+	check.False(v.Accepted())
+	v, err = stats.CheckQuotas(&ConfigFilter{Name: "f", MaxSizePerWeekGB: 6}, r, pending, &FilterVerdict{Filter: "f"})
+	check.Nil(err)
+	check.False(v.Accepted())
+	v, err = stats.CheckQuotas(&ConfigFilter{Name: "f", MaxTotalSnatches: 5}, r, pending, &FilterVerdict{Filter: "f"})
+	check.Nil(err)
+	check.True(v.Accepted())
+	check.NotNil((&ConfigFilter{Name: "f", Format: []string{"FLAC"}, MaxTotalSnatches: -1}).check())
+
+	// releases sent to a torrent client, until they complete
+	check.Nil(stats.AddSnatch(Release{Filter: "f", Timestamp: time.Now(), InfoHash: "hash"}))
+	check.Nil(stats.AddSnatch(Release{Filter: "f", Timestamp: time.Now().AddDate(0, 0, -40), InfoHash: "old"}))
+	downloading, err := stats.Downloading(time.Now().AddDate(0, 0, -completionWatchDays))
+	check.Nil(err)
+	check.Equal(1, len(downloading))
+	check.Equal("hash", downloading[0].InfoHash)
+	downloading[0].Completed = true
+	check.Nil(stats.UpdateSnatch(downloading[0]))
+	downloading, err = stats.Downloading(time.Now().AddDate(0, 0, -completionWatchDays))
+	check.Nil(err)
+	check.Empty(downloading)
+}
@@ -50,51 +50,45 @@ func NewStatsEntry(gazelleTracker *tracker.Gazelle, gzStats *tracker.GazelleUser
 	return stats, nil
 }
 
-func (se *StatsEntry) String() string {
-	buffer, warningBuffer := se.getBufferValues()
+// Summary of the stats, with buffers calculated for a given target ratio.
+func (se *StatsEntry) Summary(targetRatio float64) string {
+	buffer, warningBuffer := se.getBufferValues(targetRatio)
 	return fmt.Sprintf(firstProgress, fs.FileSizeDelta(buffer), se.Ratio, fs.FileSize(se.Up), fs.FileSize(se.Down), fs.FileSizeDelta(warningBuffer))
 }
 
-func (se *StatsEntry) getBufferValues() (int64, int64) {
-	conf, err := NewConfig(DefaultConfigurationFile)
-	if err != nil {
-		logthis.Error(err, logthis.VERBOSEST)
+func (se *StatsEntry) getBufferValues(targetRatio float64) (int64, int64) {
+	if targetRatio == 0 {
 		return 0, 0
 	}
-	statsConfig, err := conf.GetStats(se.Tracker)
-	if err != nil {
-		logthis.Error(err, logthis.VERBOSEST)
-		return 0, 0
-	}
-	return int64(float64(se.Up)/statsConfig.TargetRatio) - int64(se.Down), int64(float64(se.Up)/warningRatio) - int64(se.Down)
+	return int64(float64(se.Up)/targetRatio) - int64(se.Down), int64(float64(se.Up)/warningRatio) - int64(se.Down)
 }
 
 // TODO REPLACE BY A DELTA
-func (se *StatsEntry) Diff(previous *StatsEntry) (int64, int64, int64, int64, float64) {
-	buffer, warningBuffer := se.getBufferValues()
-	prevBuffer, prevWarningBuffer := previous.getBufferValues()
+func (se *StatsEntry) Diff(previous *StatsEntry, targetRatio float64) (int64, int64, int64, int64, float64) {
+	buffer, warningBuffer := se.getBufferValues(targetRatio)
+	prevBuffer, prevWarningBuffer := previous.getBufferValues(targetRatio)
 	return int64(se.Up - previous.Up), int64(se.Down - previous.Down), buffer - prevBuffer,
 		warningBuffer - prevWarningBuffer, se.Ratio - previous.Ratio
 }
 
-func (se *StatsEntry) Progress(previous *StatsEntry) string {
+func (se *StatsEntry) Progress(previous *StatsEntry, targetRatio float64) string {
 	if previous.Ratio == 0 {
-		return se.String()
+		return se.Summary(targetRatio)
 	}
-	buffer, warningBuffer := se.getBufferValues()
-	dup, ddown, dbuff, dwbuff, dratio := se.Diff(previous)
+	buffer, warningBuffer := se.getBufferValues(targetRatio)
+	dup, ddown, dbuff, dwbuff, dratio := se.Diff(previous, targetRatio)
 	return fmt.Sprintf(progress, fs.FileSizeDelta(buffer), fs.FileSizeDelta(dbuff), se.Ratio, dratio, fs.FileSize(se.Up),
 		fs.FileSizeDelta(dup), fs.FileSize(se.Down), fs.FileSizeDelta(ddown), fs.FileSizeDelta(warningBuffer),
 		fs.FileSizeDelta(dwbuff))
 }
 
 // TODO do something about this awful thing
-func (se *StatsEntry) ProgressParts(previous *StatsEntry) []string {
-	buffer, warningBuffer := se.getBufferValues()
+func (se *StatsEntry) ProgressParts(previous *StatsEntry, targetRatio float64) []string {
+	buffer, warningBuffer := se.getBufferValues(targetRatio)
 	if previous.Ratio == 0 {
 		return []string{"+", se.Timestamp.Format("2006-01-02 15:04"), fs.FileSize(se.Up), fs.FileSize(se.Down), fs.FileSizeDelta(buffer), fs.FileSizeDelta(warningBuffer), fmt.Sprintf("%.3f", se.Ratio)}
 	}
-	dup, ddown, dbuff, dwbuff, dratio := se.Diff(previous)
+	dup, ddown, dbuff, dwbuff, dratio := se.Diff(previous, targetRatio)
 	return []string{
 		fs.Sign(dbuff),
 		se.Timestamp.Format("2006-01-02 15:04"),
@@ -106,7 +100,7 @@ func (se *StatsEntry) ProgressParts(previous *StatsEntry) []string {
 	}
 }
 
-func (se *StatsEntry) IsProgressAcceptable(previous *StatsEntry, maxDecrease int, minimumRatio float64) bool {
+func (se *StatsEntry) IsProgressAcceptable(previous *StatsEntry, maxDecrease int, minimumRatio, targetRatio float64) bool {
 	if se.Ratio <= minimumRatio {
 		logthis.Info("Ratio has dropped below minimum authorized, unacceptable.", logthis.NORMAL)
 		return false
@@ -115,7 +109,7 @@ func (se *StatsEntry) IsProgressAcceptable(previous *StatsEntry, maxDecrease int
 		// first pass
 		return true
 	}
-	_, _, bufferChange, _, _ := se.Diff(previous)
+	_, _, bufferChange, _, _ := se.Diff(previous, targetRatio)
 	// if maxDecrease is unset (=0), always return true
 	if maxDecrease == 0 || bufferChange >= 0 || -bufferChange <= int64(maxDecrease*1024*1024) {
 		return true
@@ -165,14 +159,14 @@ type StatsDelta struct {
 	WarningBuffer int64
 }
 
-func CalculateDelta(first, second StatsEntry) (*StatsDelta, error) {
+func CalculateDelta(first, second StatsEntry, targetRatio float64) (*StatsDelta, error) {
 	// check second after first
 	if !second.Timestamp.After(first.Timestamp) {
 		return nil, errors.New("cannot calculate delta for out of order entries")
 	}
 
-	firstBuffer, firstWarningBuffer := first.getBufferValues()
-	secondBuffer, secondWarningBuffer := second.getBufferValues()
+	firstBuffer, firstWarningBuffer := first.getBufferValues(targetRatio)
+	secondBuffer, secondWarningBuffer := second.getBufferValues(targetRatio)
 	d := &StatsDelta{
 		Tracker:       second.Tracker,
 		Timestamp:     second.Timestamp,
@@ -185,13 +179,13 @@ func CalculateDelta(first, second StatsEntry) (*StatsDelta, error) {
 	return d, nil
 }
 
-func CalculateDeltas(entries []StatsEntry) []StatsDelta {
+func CalculateDeltas(entries []StatsEntry, targetRatio float64) []StatsDelta {
 	var deltas []StatsDelta
 	for i, e := range entries {
 		if i == 0 {
 			deltas = append(deltas, StatsDelta{Timestamp: e.Timestamp})
 		} else {
-			delta, err := CalculateDelta(entries[i-1], e)
+			delta, err := CalculateDelta(entries[i-1], e, targetRatio)
 			if err != nil {
 				logthis.Error(err, logthis.VERBOSEST)
 				deltas = append(deltas, StatsDelta{Timestamp: e.Timestamp})
@@ -210,6 +204,7 @@ type SnatchStatsEntry struct {
 	Tracker      string `storm:"index"`
 	Size         uint64
 	Number       int
+	FLTokens     int
 	Timestamp    time.Time `storm:"index"`
 	Collected    bool      `storm:"index"`
 	StartOfDay   bool      `storm:"index"`
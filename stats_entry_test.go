@@ -13,9 +13,14 @@ func TestStats(t *testing.T) {
 	// setting up
 	verify := assert.New(t)
 
-	// force config with dummy file
-	_, err := NewConfig("test/test_complete.yaml")
+	// target ratios from the dummy configuration file
+	conf, err := NewConfig("test/test_complete.yaml")
 	verify.Nil(err)
+	purpleStats, err := conf.GetStats("purple")
+	verify.Nil(err)
+	blueStats, err := conf.GetStats("blue")
+	verify.Nil(err)
+	purple := purpleStats.TargetRatio
 
 	// test data
 	s1 := &StatsEntry{Tracker: "purple"}
@@ -27,25 +32,25 @@ func TestStats(t *testing.T) {
 	s7 := &StatsEntry{Tracker: "blue", Up: 1000 * 1024 * 1024, Down: 1000 * 1024 * 1024, Ratio: float64(1.0)}
 
 	// check buffers
-	buf2, wbuf2 := s2.getBufferValues()
+	buf2, wbuf2 := s2.getBufferValues(purple)
 	verify.Equal(int64(0), buf2)
 	verify.Equal(int64(699050666), wbuf2)
-	buf3, wbuf3 := s3.getBufferValues()
+	buf3, wbuf3 := s3.getBufferValues(purple)
 	verify.Equal(int64(-950*1024*1024), buf3)
 	verify.Equal(int64(-262144000), wbuf3)
-	buf7, wbuf7 := s7.getBufferValues()
+	buf7, wbuf7 := s7.getBufferValues(blueStats.TargetRatio)
 	verify.Equal(int64(250*1024*1024), buf7) // min ratio 0.8 in config
 	verify.Equal(int64(699050666), wbuf7)
 
 	// check first diff
-	dup, ddown, dbuf, dwbuf, dratio := s2.Diff(s1)
+	dup, ddown, dbuf, dwbuf, dratio := s2.Diff(s1, purple)
 	verify.Equal(int64(s2.Up), dup)
 	verify.Equal(int64(s2.Down), ddown)
 	verify.Equal(buf2, dbuf)
 	verify.Equal(wbuf2, dwbuf)
 	verify.Equal(s2.Ratio, dratio)
 	// check diff
-	dup, ddown, dbuf, dwbuf, dratio = s3.Diff(s2)
+	dup, ddown, dbuf, dwbuf, dratio = s3.Diff(s2, purple)
 	verify.Equal(int64(50*1024*1024), dup)
 	verify.Equal(int64(1000*1024*1024), ddown)
 	verify.Equal(buf3-buf2, dbuf)
@@ -53,39 +58,39 @@ func TestStats(t *testing.T) {
 	verify.InDelta(float64(-0.05), dratio, 0.001)
 
 	// testing acceptability
-	acceptable := s1.IsProgressAcceptable(s2, 100, 0.6)
-	fmt.Println(s1.Progress(s2) + fmt.Sprintf(" | %v", acceptable))
+	acceptable := s1.IsProgressAcceptable(s2, 100, 0.6, purple)
+	fmt.Println(s1.Progress(s2, purple) + fmt.Sprintf(" | %v", acceptable))
 	verify.False(acceptable)
 
-	acceptable = s2.IsProgressAcceptable(s1, 100, 0.6)
-	fmt.Println(s2.Progress(s1) + fmt.Sprintf(" | %v", acceptable))
+	acceptable = s2.IsProgressAcceptable(s1, 100, 0.6, purple)
+	fmt.Println(s2.Progress(s1, purple) + fmt.Sprintf(" | %v", acceptable))
 	verify.True(acceptable)
 
-	acceptable = s2.IsProgressAcceptable(s1, 100, 1.2)
-	fmt.Println(s2.Progress(s1) + fmt.Sprintf(" | %v", acceptable))
+	acceptable = s2.IsProgressAcceptable(s1, 100, 1.2, purple)
+	fmt.Println(s2.Progress(s1, purple) + fmt.Sprintf(" | %v", acceptable))
 	verify.False(acceptable)
 
-	acceptable = s3.IsProgressAcceptable(s2, 100, 0.6)
-	fmt.Println(s3.Progress(s2) + fmt.Sprintf(" | %v", acceptable))
+	acceptable = s3.IsProgressAcceptable(s2, 100, 0.6, purple)
+	fmt.Println(s3.Progress(s2, purple) + fmt.Sprintf(" | %v", acceptable))
 	verify.False(acceptable)
 
-	acceptable = s5.IsProgressAcceptable(s4, 5, 0.6)
-	fmt.Println(s5.Progress(s4) + fmt.Sprintf(" | %v", acceptable))
+	acceptable = s5.IsProgressAcceptable(s4, 5, 0.6, purple)
+	fmt.Println(s5.Progress(s4, purple) + fmt.Sprintf(" | %v", acceptable))
 	verify.False(acceptable)
 
-	acceptable = s5.IsProgressAcceptable(s4, 100, 0.6)
-	fmt.Println(s5.Progress(s4) + fmt.Sprintf(" | %v", acceptable))
+	acceptable = s5.IsProgressAcceptable(s4, 100, 0.6, purple)
+	fmt.Println(s5.Progress(s4, purple) + fmt.Sprintf(" | %v", acceptable))
 	verify.True(acceptable)
 
-	acceptable = s5.IsProgressAcceptable(s4, 100, 0.7)
-	fmt.Println(s5.Progress(s4) + fmt.Sprintf(" | %v", acceptable))
+	acceptable = s5.IsProgressAcceptable(s4, 100, 0.7, purple)
+	fmt.Println(s5.Progress(s4, purple) + fmt.Sprintf(" | %v", acceptable))
 	verify.False(acceptable)
 
-	acceptable = s6.IsProgressAcceptable(s5, 5, 0.6)
-	fmt.Println(s6.Progress(s5) + fmt.Sprintf(" | %v", acceptable))
+	acceptable = s6.IsProgressAcceptable(s5, 5, 0.6, purple)
+	fmt.Println(s6.Progress(s5, purple) + fmt.Sprintf(" | %v", acceptable))
 	verify.False(acceptable)
 
-	acceptable = s6.IsProgressAcceptable(s5, 100, 0.6)
-	fmt.Println(s6.Progress(s5) + fmt.Sprintf(" | %v", acceptable))
+	acceptable = s6.IsProgressAcceptable(s5, 100, 0.6, purple)
+	fmt.Println(s6.Progress(s5, purple) + fmt.Sprintf(" | %v", acceptable))
 	verify.False(acceptable)
 }
@@ -13,6 +13,7 @@ import (
 // It can then draw and save the graphs (for raw stats or stats/time unit)
 type StatsSeries struct {
 	Tracker       string
+	TargetRatio   float64
 	Time          []time.Time
 	Up            []float64
 	Down          []float64
@@ -23,13 +24,8 @@ type StatsSeries struct {
 
 // AddStats for all entries or a selection to get the correct timeseries
 func (ss *StatsSeries) AddStats(entries ...StatsEntry) error {
-	conf, err := NewConfig(DefaultConfigurationFile)
-	if err != nil {
-		return err
-	}
-	statsConfig, err := conf.GetStats(ss.Tracker)
-	if err != nil {
-		return err
+	if ss.TargetRatio == 0 {
+		return errors.New("missing target ratio for " + ss.Tracker)
 	}
 	// accumulate entries, converting to GiB directly
 	for _, e := range entries {
@@ -37,7 +33,7 @@ func (ss *StatsSeries) AddStats(entries ...StatsEntry) error {
 		ss.Up = append(ss.Up, float64(e.Up)/(1024*1024*1024))
 		ss.Down = append(ss.Down, float64(e.Down)/(1024*1024*1024))
 		ss.Ratio = append(ss.Ratio, e.Ratio)
-		ss.Buffer = append(ss.Buffer, (float64(e.Up)/statsConfig.TargetRatio-float64(e.Down))/(1024*1024*1024))
+		ss.Buffer = append(ss.Buffer, (float64(e.Up)/ss.TargetRatio-float64(e.Down))/(1024*1024*1024))
 		ss.WarningBuffer = append(ss.WarningBuffer, (float64(e.Up)/warningRatio-float64(e.Down))/(1024*1024*1024))
 	}
 	return nil
@@ -137,10 +133,11 @@ func (ss *StatsSeries) GenerateGraphs(directory, prefix string, firstTimestamp t
 // SnatchStatsSeries is a struct that holds the SnatchStats data needed to generate time series graphs.
 // It can then draw and save the graphs (for raw stats or stats/time unit)
 type SnatchStatsSeries struct {
-	Tracker string
-	Time    []time.Time
-	Number  []float64
-	Size    []float64
+	Tracker  string
+	Time     []time.Time
+	Number   []float64
+	Size     []float64
+	FLTokens []float64
 }
 
 // AddStats for all entries or a selection to get the correct timeseries
@@ -150,6 +147,7 @@ func (sss *SnatchStatsSeries) AddStats(entries ...SnatchStatsEntry) {
 		sss.Time = append(sss.Time, e.Timestamp)
 		sss.Number = append(sss.Number, float64(e.Number))
 		sss.Size = append(sss.Size, float64(e.Size)/(1024*1024*1024))
+		sss.FLTokens = append(sss.FLTokens, float64(e.FLTokens))
 	}
 }
 
@@ -167,6 +165,7 @@ func (sss *SnatchStatsSeries) GenerateGraphs(directory, prefix string, firstTime
 		sss.Time = append([]time.Time{firstTimestamp, sss.Time[0].Add(-1 * time.Hour)}, sss.Time...)
 		sss.Number = append([]float64{0, 0}, sss.Number...)
 		sss.Size = append([]float64{0, 0}, sss.Size...)
+		sss.FLTokens = append([]float64{0, 0}, sss.FLTokens...)
 	}
 
 	numberSeries := chart.TimeSeries{
@@ -179,6 +178,11 @@ func (sss *SnatchStatsSeries) GenerateGraphs(directory, prefix string, firstTime
 		XValues: sss.Time,
 		YValues: sss.Size,
 	}
+	flTokensSeries := chart.TimeSeries{
+		Style:   commonStyle,
+		XValues: sss.Time,
+		YValues: sss.FLTokens,
+	}
 
 	// write individual graphs
 	atLeastOneFailed := false
@@ -190,6 +194,10 @@ func (sss *SnatchStatsSeries) GenerateGraphs(directory, prefix string, firstTime
 		logthis.Error(errors.Wrap(err, errorGeneratingGraph+" for size snatched/day"), logthis.NORMAL)
 		atLeastOneFailed = true
 	}
+	if err := writeTimeSeriesChart(flTokensSeries, "Freeleech tokens used/day", filepath.Join(directory, prefix+flTokensPerDayFile), addSMA); err != nil {
+		logthis.Error(errors.Wrap(err, errorGeneratingGraph+" for freeleech tokens/day"), logthis.NORMAL)
+		atLeastOneFailed = true
+	}
 	if atLeastOneFailed {
 		return errors.New(errorGeneratingGraph)
 	}
@@ -0,0 +1,212 @@
+package varroa
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/pkg/errors"
+	"gitlab.com/catastrophic/assistance/fs"
+	"gitlab.com/catastrophic/assistance/strslice"
+)
+
+// TorrentCheck compares the contents of a torrent with local files.
+type TorrentCheck struct {
+	info          *metainfo.Info
+	root          string
+	Missing       []string
+	WrongSize     []string
+	Extra         []string
+	CheckedPieces bool
+	BadPieces     int
+	BadFiles      []string
+}
+
+// NewTorrentCheck of the files in root, the local equivalent of the top folder of the torrent.
+func NewTorrentCheck(torrent []byte, root string) (*TorrentCheck, error) {
+	m, err := metainfo.Load(bytes.NewReader(torrent))
+	if err != nil {
+		return nil, errors.Wrap(err, "could not parse torrent file")
+	}
+	info, err := m.UnmarshalInfo()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not parse torrent info")
+	}
+	return &TorrentCheck{info: &info, root: root}, nil
+}
+
+// files of the torrent, relative to the top folder for multi-file torrents.
+func (tc *TorrentCheck) files() []string {
+	if !tc.info.IsDir() {
+		return []string{tc.info.Name}
+	}
+	var files []string
+	for _, f := range tc.info.Files {
+		files = append(files, filepath.Join(f.Path...))
+	}
+	return files
+}
+
+// Run the comparison of names and sizes, and piece hashes if required and if the names and sizes match.
+func (tc *TorrentCheck) Run(checkPieces bool) error {
+	torrentFiles := tc.files()
+	for i, f := range tc.info.UpvertedFiles() {
+		stat, err := os.Stat(filepath.Join(tc.root, torrentFiles[i]))
+		if err != nil {
+			if !os.IsNotExist(err) {
+				return err
+			}
+			tc.Missing = append(tc.Missing, torrentFiles[i])
+			continue
+		}
+		if stat.Size() != f.Length {
+			tc.WrongSize = append(tc.WrongSize, fmt.Sprintf("%s (expected %d bytes, found %d)", torrentFiles[i], f.Length, stat.Size()))
+		}
+	}
+	// extra files do not prevent seeding, but are not part of the torrent
+	if tc.info.IsDir() {
+		err := filepath.Walk(tc.root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(tc.root, path)
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				if rel == MetadataDir {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !strslice.Contains(torrentFiles, rel) {
+				tc.Extra = append(tc.Extra, rel)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if !checkPieces || len(tc.Missing) != 0 || len(tc.WrongSize) != 0 {
+		return nil
+	}
+	return tc.checkPieces()
+}
+
+// checkPieces reads the files in the order of the torrent, and compares each piece with its SHA-1 hash.
+func (tc *TorrentCheck) checkPieces() error {
+	tc.CheckedPieces = true
+	hasher := sha1.New()
+	var piece int
+	var filled int64
+	// files overlapping the current piece
+	var current []string
+	endPiece := func() {
+		if !bytes.Equal(hasher.Sum(nil), tc.info.Pieces[piece*sha1.Size:(piece+1)*sha1.Size]) {
+			tc.BadPieces++
+			for _, f := range current {
+				if !strslice.Contains(tc.BadFiles, f) {
+					tc.BadFiles = append(tc.BadFiles, f)
+				}
+			}
+		}
+		hasher.Reset()
+		piece++
+		filled = 0
+		current = current[:0]
+	}
+	torrentFiles := tc.files()
+	for i, f := range tc.info.UpvertedFiles() {
+		file, err := os.Open(filepath.Join(tc.root, torrentFiles[i]))
+		if err != nil {
+			return err
+		}
+		for remaining := f.Length; remaining > 0; {
+			current = append(current, torrentFiles[i])
+			toRead := tc.info.PieceLength - filled
+			if remaining < toRead {
+				toRead = remaining
+			}
+			if _, err := io.CopyN(hasher, file, toRead); err != nil {
+				file.Close()
+				return errors.Wrap(err, "could not read "+torrentFiles[i])
+			}
+			remaining -= toRead
+			filled += toRead
+			if filled == tc.info.PieceLength {
+				endPiece()
+			}
+		}
+		file.Close()
+	}
+	if filled != 0 {
+		endPiece()
+	}
+	return nil
+}
+
+// Match is true if the local files can be seeded with the torrent.
+func (tc *TorrentCheck) Match() bool {
+	return len(tc.Missing) == 0 && len(tc.WrongSize) == 0 && tc.BadPieces == 0
+}
+
+// String is the report of the comparison.
+func (tc *TorrentCheck) String() string {
+	txt := "Comparing torrent " + tc.info.Name + " with " + tc.root + ":\n"
+	for _, f := range tc.Missing {
+		txt += "\tMissing file: " + f + "\n"
+	}
+	for _, f := range tc.WrongSize {
+		txt += "\tWrong size: " + f + "\n"
+	}
+	for _, f := range tc.Extra {
+		txt += "\tNot in torrent: " + f + "\n"
+	}
+	if tc.CheckedPieces {
+		if tc.BadPieces != 0 {
+			txt += fmt.Sprintf("\t%d of %d pieces do not match, in: %s\n", tc.BadPieces, tc.info.NumPieces(), strings.Join(tc.BadFiles, ", "))
+		} else {
+			txt += fmt.Sprintf("\tAll %d pieces match.\n", tc.info.NumPieces())
+		}
+	}
+	if tc.Match() {
+		txt += "\tLocal files match the torrent."
+	} else {
+		txt += "\tLocal files do not match the torrent."
+	}
+	return txt
+}
+
+// Destination of the files of the torrent, for a torrent client saving them in a directory.
+func (tc *TorrentCheck) Destination(dir string) string {
+	if tc.info.IsDir() {
+		return filepath.Join(dir, tc.info.Name)
+	}
+	return dir
+}
+
+// CopyTo places the files of the torrent where a torrent client saving them in a directory expects them, reflinking,
+// hard linking or copying them. The metadata saved by varroa is copied too, without hard links since it is updated.
+func (tc *TorrentCheck) CopyTo(dir string, options LinkOptions) (*LinkReport, error) {
+	destination := tc.Destination(dir)
+	report, err := LinkFiles(tc.root, destination, tc.files(), options)
+	if err != nil {
+		return report, err
+	}
+	metadata := filepath.Join(tc.root, MetadataDir)
+	if tc.info.IsDir() && fs.DirExists(metadata) && !fs.DirExists(filepath.Join(destination, MetadataDir)) {
+		options.HardLinks = false
+		metadataReport, err := LinkDir(metadata, filepath.Join(destination, MetadataDir), options)
+		if err != nil {
+			return report, err
+		}
+		report.Files = append(report.Files, metadataReport.Files...)
+	}
+	return report, nil
+}
@@ -0,0 +1,98 @@
+package varroa
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTorrentCheck(t *testing.T) {
+	fmt.Println("+ Testing TorrentCheck...")
+	check := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "varroa")
+	check.Nil(err)
+	defer os.RemoveAll(dir)
+	root := filepath.Join(dir, "Artist - Album")
+	check.Nil(os.MkdirAll(filepath.Join(root, "CD1"), 0777))
+	// pieces overlap files
+	data := bytes.Repeat([]byte("varroa musica "), 3000)
+	check.Nil(ioutil.WriteFile(filepath.Join(root, "CD1", "01.flac"), data[:30000], 0666))
+	check.Nil(ioutil.WriteFile(filepath.Join(root, "CD1", "02.flac"), data[:20000], 0666))
+	check.Nil(ioutil.WriteFile(filepath.Join(root, "cover.jpg"), data[:1000], 0666))
+
+	// building the torrent
+	info := metainfo.Info{PieceLength: 16384}
+	check.Nil(info.BuildFromFilePath(root))
+	infoBytes, err := bencode.Marshal(info)
+	check.Nil(err)
+	var buf bytes.Buffer
+	check.Nil((&metainfo.MetaInfo{InfoBytes: infoBytes}).Write(&buf))
+	torrent := buf.Bytes()
+
+	_, err = NewTorrentCheck([]byte("not a torrent"), root)
+	check.NotNil(err)
+
+	// varroa metadata and other files are not part of the torrent
+	check.Nil(os.MkdirAll(filepath.Join(root, MetadataDir), 0777))
+	check.Nil(ioutil.WriteFile(filepath.Join(root, MetadataDir, OriginJSONFile), []byte("{}"), 0666))
+	check.Nil(ioutil.WriteFile(filepath.Join(root, "extra.txt"), []byte("extra"), 0666))
+	tc, err := NewTorrentCheck(torrent, root)
+	check.Nil(err)
+	check.Nil(tc.Run(true))
+	check.True(tc.CheckedPieces)
+	check.True(tc.Match())
+	check.Equal([]string{"extra.txt"}, tc.Extra)
+
+	// same size, different contents
+	check.Nil(ioutil.WriteFile(filepath.Join(root, "CD1", "02.flac"), bytes.Repeat([]byte("x"), 20000), 0666))
+	tc, err = NewTorrentCheck(torrent, root)
+	check.Nil(err)
+	check.Nil(tc.Run(false))
+	check.False(tc.CheckedPieces)
+	check.True(tc.Match())
+	tc, err = NewTorrentCheck(torrent, root)
+	check.Nil(err)
+	check.Nil(tc.Run(true))
+	check.False(tc.Match())
+	// 02.flac spans three pieces, which it shares with the other files
+	check.Equal(3, tc.BadPieces)
+	check.Equal([]string{filepath.Join("CD1", "01.flac"), filepath.Join("CD1", "02.flac"), "cover.jpg"}, tc.BadFiles)
+
+	// missing file and wrong size
+	check.Nil(os.Remove(filepath.Join(root, "cover.jpg")))
+	check.Nil(ioutil.WriteFile(filepath.Join(root, "CD1", "02.flac"), data[:100], 0666))
+	tc, err = NewTorrentCheck(torrent, root)
+	check.Nil(err)
+	check.Nil(tc.Run(true))
+	check.False(tc.Match())
+	check.False(tc.CheckedPieces)
+	check.Equal([]string{"cover.jpg"}, tc.Missing)
+	check.Equal([]string{filepath.Join("CD1", "02.flac") + " (expected 20000 bytes, found 100)"}, tc.WrongSize)
+	fmt.Println(tc.String())
+
+	// copying to another directory, where the torrent client expects the files
+	check.Nil(ioutil.WriteFile(filepath.Join(root, "cover.jpg"), data[:1000], 0666))
+	check.Nil(ioutil.WriteFile(filepath.Join(root, "CD1", "02.flac"), data[:20000], 0666))
+	downloads := filepath.Join(dir, "downloads")
+	tc, err = NewTorrentCheck(torrent, root)
+	check.Nil(err)
+	check.Equal(filepath.Join(downloads, "Artist - Album"), tc.Destination(downloads))
+	report, err := tc.CopyTo(downloads, LinkOptions{HardLinks: true, Verify: true})
+	check.Nil(err)
+	check.Equal(4, len(report.Files))
+	tc, err = NewTorrentCheck(torrent, tc.Destination(downloads))
+	check.Nil(err)
+	check.Nil(tc.Run(true))
+	check.True(tc.Match())
+	check.Empty(tc.Extra)
+	_, err = os.Stat(filepath.Join(downloads, "Artist - Album", MetadataDir, OriginJSONFile))
+	check.Nil(err)
+}
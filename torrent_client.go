@@ -0,0 +1,379 @@
+package varroa
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/pkg/errors"
+	"gitlab.com/catastrophic/assistance/fs"
+	"gitlab.com/passelecasque/obstruction/tracker"
+)
+
+const (
+	torrentClientTransmission = "transmission"
+	torrentClientQBittorrent  = "qbittorrent"
+
+	torrentClientTimeout = 30 * time.Second
+	// completionWatchDays after snatching a release, varroa stops waiting for it to complete.
+	completionWatchDays = 30
+
+	transmissionSessionHeader = "X-Transmission-Session-Id"
+)
+
+var errCompletionUnknown = errors.New("the watch directory does not report completion")
+
+// TorrentClient receives the torrents snatched by varroa.
+type TorrentClient interface {
+	// Add a torrent, with a label and a save path. Empty values use the defaults of the client.
+	Add(torrent []byte, filename, label, savePath string) error
+	// Status of a torrent, identified by its info hash.
+	Status(hash string) (*TorrentStatus, error)
+	String() string
+}
+
+// TorrentStatus describes a torrent known by the torrent client.
+type TorrentStatus struct {
+	Name      string
+	SavePath  string
+	Progress  float64
+	Completed bool
+}
+
+// newTorrentClient from its configuration.
+func newTorrentClient(conf *ConfigTorrentClient) TorrentClient {
+	client := &http.Client{Timeout: torrentClientTimeout}
+	if conf.Type == torrentClientQBittorrent {
+		jar, _ := cookiejar.New(nil)
+		client.Jar = jar
+		return &qBittorrentClient{conf: conf, client: client}
+	}
+	return &transmissionClient{conf: conf, client: client}
+}
+
+// torrentInfoHash of a .torrent file.
+func torrentInfoHash(torrent []byte) (string, error) {
+	m, err := metainfo.Load(bytes.NewReader(torrent))
+	if err != nil {
+		return "", errors.Wrap(err, "could not parse torrent file")
+	}
+	return m.HashInfoBytes().HexString(), nil
+}
+
+// watchDirClient drops .torrent files in a directory watched by the torrent client. It cannot know what happens next.
+type watchDirClient struct {
+	dir string
+}
+
+func (w *watchDirClient) Add(torrent []byte, filename, label, savePath string) error {
+	return ioutil.WriteFile(filepath.Join(w.dir, filename), torrent, 0666)
+}
+
+func (w *watchDirClient) Status(hash string) (*TorrentStatus, error) {
+	return nil, errCompletionUnknown
+}
+
+func (w *watchDirClient) String() string {
+	return "watch directory " + w.dir
+}
+
+// transmissionClient uses the Transmission RPC protocol.
+type transmissionClient struct {
+	conf      *ConfigTorrentClient
+	client    *http.Client
+	mutex     sync.Mutex
+	sessionID string
+}
+
+// call a method, getting a new session ID if Transmission asks for it.
+func (tc *transmissionClient) call(method string, arguments, result interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{"method": method, "arguments": arguments})
+	if err != nil {
+		return err
+	}
+	for attempt := 0; attempt < 2; attempt++ {
+		req, err := http.NewRequest(http.MethodPost, tc.conf.URL, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if tc.conf.User != "" {
+			req.SetBasicAuth(tc.conf.User, tc.conf.Password)
+		}
+		tc.mutex.Lock()
+		req.Header.Set(transmissionSessionHeader, tc.sessionID)
+		tc.mutex.Unlock()
+		resp, err := tc.client.Do(req)
+		if err != nil {
+			return err
+		}
+		data, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode == http.StatusConflict {
+			tc.mutex.Lock()
+			tc.sessionID = resp.Header.Get(transmissionSessionHeader)
+			tc.mutex.Unlock()
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("transmission returned status %d", resp.StatusCode)
+		}
+		var response struct {
+			Result    string          `json:"result"`
+			Arguments json.RawMessage `json:"arguments"`
+		}
+		if err := json.Unmarshal(data, &response); err != nil {
+			return errors.Wrap(err, "could not parse transmission response")
+		}
+		if response.Result != "success" {
+			return errors.New("transmission: " + response.Result)
+		}
+		if result == nil {
+			return nil
+		}
+		return json.Unmarshal(response.Arguments, result)
+	}
+	return errors.New("transmission did not accept the session ID")
+}
+
+func (tc *transmissionClient) Add(torrent []byte, filename, label, savePath string) error {
+	arguments := map[string]interface{}{"metainfo": base64.StdEncoding.EncodeToString(torrent)}
+	if savePath != "" {
+		arguments["download-dir"] = savePath
+	}
+	if label != "" {
+		arguments["labels"] = []string{label}
+	}
+	return tc.call("torrent-add", arguments, nil)
+}
+
+func (tc *transmissionClient) Status(hash string) (*TorrentStatus, error) {
+	var result struct {
+		Torrents []struct {
+			Name        string  `json:"name"`
+			DownloadDir string  `json:"downloadDir"`
+			PercentDone float64 `json:"percentDone"`
+		} `json:"torrents"`
+	}
+	arguments := map[string]interface{}{"ids": []string{hash}, "fields": []string{"name", "downloadDir", "percentDone"}}
+	if err := tc.call("torrent-get", arguments, &result); err != nil {
+		return nil, err
+	}
+	if len(result.Torrents) == 0 {
+		return nil, errors.New("torrent not found in transmission")
+	}
+	t := result.Torrents[0]
+	return &TorrentStatus{Name: t.Name, SavePath: t.DownloadDir, Progress: t.PercentDone, Completed: t.PercentDone >= 1}, nil
+}
+
+func (tc *transmissionClient) String() string {
+	return "transmission at " + tc.conf.URL
+}
+
+// qBittorrentClient uses the qBittorrent Web API.
+type qBittorrentClient struct {
+	conf   *ConfigTorrentClient
+	client *http.Client
+}
+
+func (qc *qBittorrentClient) login() error {
+	form := url.Values{}
+	form.Set("username", qc.conf.User)
+	form.Set("password", qc.conf.Password)
+	resp, err := qc.client.PostForm(strings.TrimSuffix(qc.conf.URL, "/")+"/api/v2/auth/login", form)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK || strings.TrimSpace(string(data)) != "Ok." {
+		return errors.New("could not log in qBittorrent")
+	}
+	return nil
+}
+
+// do a request, logging in again if the session has expired.
+func (qc *qBittorrentClient) do(newRequest func() (*http.Request, error)) ([]byte, error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		req, err := newRequest()
+		if err != nil {
+			return nil, err
+		}
+		resp, err := qc.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		data, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == http.StatusForbidden && attempt == 0 {
+			if err := qc.login(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("qBittorrent returned status %d", resp.StatusCode)
+		}
+		return data, nil
+	}
+	return nil, errors.New("qBittorrent refused the session")
+}
+
+func (qc *qBittorrentClient) Add(torrent []byte, filename, label, savePath string) error {
+	data, err := qc.do(func() (*http.Request, error) {
+		var body bytes.Buffer
+		w := multipart.NewWriter(&body)
+		part, err := w.CreateFormFile("torrents", filename)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := part.Write(torrent); err != nil {
+			return nil, err
+		}
+		if savePath != "" {
+			if err := w.WriteField("savepath", savePath); err != nil {
+				return nil, err
+			}
+		}
+		if label != "" {
+			if err := w.WriteField("category", label); err != nil {
+				return nil, err
+			}
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(qc.conf.URL, "/")+"/api/v2/torrents/add", &body)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", w.FormDataContentType())
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(string(data)) != "Ok." {
+		return errors.New("qBittorrent refused the torrent")
+	}
+	return nil
+}
+
+func (qc *qBittorrentClient) Status(hash string) (*TorrentStatus, error) {
+	data, err := qc.do(func() (*http.Request, error) {
+		return http.NewRequest(http.MethodGet, strings.TrimSuffix(qc.conf.URL, "/")+"/api/v2/torrents/info?hashes="+url.QueryEscape(hash), nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+	var torrents []struct {
+		Name     string  `json:"name"`
+		SavePath string  `json:"save_path"`
+		Progress float64 `json:"progress"`
+	}
+	if err := json.Unmarshal(data, &torrents); err != nil {
+		return nil, errors.Wrap(err, "could not parse qBittorrent response")
+	}
+	if len(torrents) == 0 {
+		return nil, errors.New("torrent not found in qBittorrent")
+	}
+	t := torrents[0]
+	return &TorrentStatus{Name: t.Name, SavePath: t.SavePath, Progress: t.Progress, Completed: t.Progress >= 1}, nil
+}
+
+func (qc *qBittorrentClient) String() string {
+	return "qBittorrent at " + qc.conf.URL
+}
+
+// TorrentClient that torrents are sent to: the configured client, or the given watch directory.
+func (e *Environment) TorrentClient(watchDir string) TorrentClient {
+	conf := e.Config()
+	if !conf.torrentClientConfigured {
+		return &watchDirClient{dir: watchDir}
+	}
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	// the client keeps its session, as long as its configuration does not change
+	if e.torrentClient == nil || e.torrentClientConfig != *conf.TorrentClient {
+		e.torrentClient = newTorrentClient(conf.TorrentClient)
+		e.torrentClientConfig = *conf.TorrentClient
+	}
+	return e.torrentClient
+}
+
+// sendTorrent downloads a torrent from the tracker and adds it to the torrent client, returning its info hash.
+// The watch directory is only used if no torrent client is configured.
+func (e *Environment) sendTorrent(t *tracker.Gazelle, id int, useFLToken bool, watchDir, filename string) (string, error) {
+	torrent, filename, err := downloadTorrent(t, id, useFLToken, filename)
+	if err != nil {
+		return "", err
+	}
+	return e.addTorrent(torrent, filename, watchDir, "")
+}
+
+// downloadTorrent from the tracker without handing it to the torrent client, returning its contents and filename.
+func downloadTorrent(t *tracker.Gazelle, id int, useFLToken bool, filename string) ([]byte, string, error) {
+	if filename == "" {
+		filename = fs.SanitizePath(t.Name) + "_id" + strconv.Itoa(id) + torrentExt
+	}
+	tempDir, err := ioutil.TempDir("", "varroa")
+	if err != nil {
+		return nil, "", err
+	}
+	defer os.RemoveAll(tempDir)
+	if err := t.Download(id, useFLToken, tempDir, filename); err != nil {
+		return nil, "", err
+	}
+	torrent, err := ioutil.ReadFile(filepath.Join(tempDir, filename))
+	if err != nil {
+		return nil, "", err
+	}
+	return torrent, filename, nil
+}
+
+// addTorrent to the torrent client, returning its info hash.
+// Without a save path, the torrent client saves files where it is configured to.
+func (e *Environment) addTorrent(torrent []byte, filename, watchDir, savePath string) (string, error) {
+	hash, err := torrentInfoHash(torrent)
+	if err != nil {
+		return "", err
+	}
+	conf := e.Config()
+	var label string
+	if conf.torrentClientConfigured {
+		label = conf.TorrentClient.Label
+		if savePath == "" {
+			savePath = conf.TorrentClient.SavePath
+		}
+		if savePath == "" {
+			savePath = conf.General.DownloadDir
+		}
+	}
+	client := e.TorrentClient(watchDir)
+	if err := client.Add(torrent, filename, label, savePath); err != nil {
+		return "", errors.Wrap(err, "could not add torrent to "+client.String())
+	}
+	return hash, nil
+}
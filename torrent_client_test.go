@@ -0,0 +1,193 @@
+package varroa
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testTorrentInfo = "d6:lengthi1024e4:name4:test12:piece lengthi16384e6:pieces20:00000000000000000000e"
+	testTorrent     = "d8:announce22:http://localhost/a/b/c4:info" + testTorrentInfo + "e"
+)
+
+func testTorrentHash() string {
+	h := sha1.Sum([]byte(testTorrentInfo))
+	return hex.EncodeToString(h[:])
+}
+
+func TestTorrentClientWatchDir(t *testing.T) {
+	fmt.Println("+ Testing TorrentClient/watch directory...")
+	check := assert.New(t)
+
+	hash, err := torrentInfoHash([]byte(testTorrent))
+	check.Nil(err)
+	check.Equal(testTorrentHash(), hash)
+	_, err = torrentInfoHash([]byte("not a torrent"))
+	check.NotNil(err)
+
+	dir, err := ioutil.TempDir("", "varroa")
+	check.Nil(err)
+	defer os.RemoveAll(dir)
+	client := &watchDirClient{dir: dir}
+	check.Nil(client.Add([]byte(testTorrent), "test.torrent", "label", "save"))
+	content, err := ioutil.ReadFile(filepath.Join(dir, "test.torrent"))
+	check.Nil(err)
+	check.Equal(testTorrent, string(content))
+	_, err = client.Status(hash)
+	check.Equal(errCompletionUnknown, err)
+}
+
+func TestTorrentClientTransmission(t *testing.T) {
+	fmt.Println("+ Testing TorrentClient/transmission...")
+	check := assert.New(t)
+
+	var added map[string]interface{}
+	var percentDone float64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, ok := r.BasicAuth(); !ok || user != "user" || password != "password" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Header.Get(transmissionSessionHeader) != "session" {
+			w.Header().Set(transmissionSessionHeader, "session")
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		var request struct {
+			Method    string                 `json:"method"`
+			Arguments map[string]interface{} `json:"arguments"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		switch request.Method {
+		case "torrent-add":
+			added = request.Arguments
+			fmt.Fprint(w, `{"result": "success", "arguments": {"torrent-added": {"id": 1}}}`)
+		case "torrent-get":
+			ids := request.Arguments["ids"].([]interface{})
+			if len(ids) != 1 || ids[0] != testTorrentHash() {
+				fmt.Fprint(w, `{"result": "success", "arguments": {"torrents": []}}`)
+				return
+			}
+			fmt.Fprintf(w, `{"result": "success", "arguments": {"torrents": [{"name": "test", "downloadDir": "/downloads", "percentDone": %f}]}}`, percentDone)
+		default:
+			fmt.Fprint(w, `{"result": "method name not recognized"}`)
+		}
+	}))
+	defer server.Close()
+
+	conf := &ConfigTorrentClient{Type: torrentClientTransmission, URL: server.URL, User: "user", Password: "password"}
+	check.Nil(conf.check())
+	client := newTorrentClient(conf)
+	check.Nil(client.Add([]byte(testTorrent), "test.torrent", "varroa", "/downloads"))
+	check.Equal(base64.StdEncoding.EncodeToString([]byte(testTorrent)), added["metainfo"])
+	check.Equal("/downloads", added["download-dir"])
+	check.Equal([]interface{}{"varroa"}, added["labels"])
+
+	percentDone = 0.5
+	status, err := client.Status(testTorrentHash())
+	check.Nil(err)
+	check.Equal("test", status.Name)
+	check.Equal("/downloads", status.SavePath)
+	check.False(status.Completed)
+	percentDone = 1
+	status, err = client.Status(testTorrentHash())
+	check.Nil(err)
+	check.True(status.Completed)
+	_, err = client.Status("unknown")
+	check.NotNil(err)
+
+	conf.Password = "wrong"
+	check.NotNil(newTorrentClient(conf).Add([]byte(testTorrent), "test.torrent", "", ""))
+}
+
+func TestTorrentClientQBittorrent(t *testing.T) {
+	fmt.Println("+ Testing TorrentClient/qBittorrent...")
+	check := assert.New(t)
+
+	var logins int
+	var category, savePath string
+	var torrent []byte
+	var progress float64
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v2/auth/login", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("username") != "user" || r.FormValue("password") != "password" {
+			fmt.Fprint(w, "Fails.")
+			return
+		}
+		logins++
+		http.SetCookie(w, &http.Cookie{Name: "SID", Value: "session", Path: "/"})
+		fmt.Fprint(w, "Ok.")
+	})
+	loggedIn := func(r *http.Request) bool {
+		cookie, err := r.Cookie("SID")
+		return err == nil && cookie.Value == "session"
+	}
+	mux.HandleFunc("/api/v2/torrents/add", func(w http.ResponseWriter, r *http.Request) {
+		if !loggedIn(r) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		file, _, err := r.FormFile("torrents")
+		if err != nil {
+			fmt.Fprint(w, "Fails.")
+			return
+		}
+		torrent, _ = ioutil.ReadAll(file)
+		category, savePath = r.FormValue("category"), r.FormValue("savepath")
+		fmt.Fprint(w, "Ok.")
+	})
+	mux.HandleFunc("/api/v2/torrents/info", func(w http.ResponseWriter, r *http.Request) {
+		if !loggedIn(r) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if r.URL.Query().Get("hashes") != testTorrentHash() {
+			fmt.Fprint(w, "[]")
+			return
+		}
+		fmt.Fprintf(w, `[{"name": "test", "save_path": "/downloads", "progress": %f}]`, progress)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	conf := &ConfigTorrentClient{Type: torrentClientQBittorrent, URL: server.URL + "/", User: "user", Password: "password"}
+	check.Nil(conf.check())
+	client := newTorrentClient(conf)
+	check.Nil(client.Add([]byte(testTorrent), "test.torrent", "varroa", "/downloads"))
+	check.Equal(1, logins)
+	check.Equal(testTorrent, string(torrent))
+	check.Equal("varroa", category)
+	check.Equal("/downloads", savePath)
+
+	progress = 0.2
+	status, err := client.Status(testTorrentHash())
+	check.Nil(err)
+	check.Equal("test", status.Name)
+	check.Equal("/downloads", status.SavePath)
+	check.False(status.Completed)
+	progress = 1
+	status, err = client.Status(testTorrentHash())
+	check.Nil(err)
+	check.True(status.Completed)
+	// the session is kept
+	check.Equal(1, logins)
+	_, err = client.Status("unknown")
+	check.NotNil(err)
+
+	conf.Password = "wrong"
+	check.NotNil(newTorrentClient(conf).Add([]byte(testTorrent), "test.torrent", "", ""))
+}
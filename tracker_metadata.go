@@ -176,6 +176,7 @@ type TrackerMetadata struct {
 	TotalTime   string
 	Lineage     []TrackerMetadataLineage
 	Description string
+	FilesHash   string `json:"-"`
 	// current tracker state
 	CurrentSeeders int  `json:"-"`
 	Reported       bool `json:"-"`
@@ -261,6 +262,28 @@ func (tm *TrackerMetadata) LoadFromID(t *tracker.Gazelle, id string) error {
 	return tm.Load(t, gzTorrent)
 }
 
+// LoadFromCache a JSON file containing the tracker API response for a torrent, such as a saved Release.json.
+func (tm *TrackerMetadata) LoadFromCache(trackerName, path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.Wrap(err, "Error loading JSON file "+path)
+	}
+	var gt tracker.GazelleTorrent
+	if err := json.Unmarshal(data, &gt); err != nil {
+		return errors.Wrap(err, "Error parsing torrent info JSON "+path)
+	}
+	tm.Tracker = trackerName
+	return tm.loadFromGazelle(&gt)
+}
+
+// saveToCache the anonymized tracker API response, so that it can be used later without reaching the tracker.
+func (tm *TrackerMetadata) saveToCache(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0775); err != nil {
+		return errors.Wrap(err, errorCreatingMetadataDir)
+	}
+	return ioutil.WriteFile(path, tm.ReleaseJSON, 0666)
+}
+
 func (tm *TrackerMetadata) loadReleaseJSONFromBytes(parentFolder string, responseOnly bool) error {
 	var gt tracker.GazelleTorrent
 	var unmarshalErr error
@@ -288,8 +311,7 @@ func (tm *TrackerMetadata) loadReleaseJSONFromBytes(parentFolder string, respons
 			return err
 		}
 	}
-	// try to find if the configuration has overriding artist aliases/categories
-	return tm.checkAliasAndCategory(parentFolder)
+	return nil
 }
 
 func (tm *TrackerMetadata) loadFromGazelle(info *tracker.GazelleTorrent) error {
@@ -306,6 +328,7 @@ func (tm *TrackerMetadata) loadFromGazelle(info *tracker.GazelleTorrent) error {
 	tm.Reported = info.Torrent.Reported
 	tm.Trumpable = info.Torrent.Trumpable
 	tm.ApprovedLossy = info.Torrent.LossyMasterApproved || info.Torrent.LossyWebApproved
+	tm.FilesHash = filesHash(info.Torrent.FileList)
 
 	// release related metadata
 	// for now, using artists, composers, "with" categories
@@ -420,11 +443,8 @@ func (tm *TrackerMetadata) loadFromGazelle(info *tracker.GazelleTorrent) error {
 	return nil
 }
 
-func (tm *TrackerMetadata) checkAliasAndCategory(parentFolder string) error {
-	conf, configErr := NewConfig(DefaultConfigurationFile)
-	if configErr != nil {
-		return configErr
-	}
+// checkAliasAndCategory finds if the configuration has overriding artist aliases/categories.
+func (tm *TrackerMetadata) checkAliasAndCategory(parentFolder string, conf *Config) error {
 	if conf.LibraryConfigured {
 		var changed bool
 		// try to find main artist alias
@@ -462,12 +482,7 @@ func artistInSlice(artist, title string, list []string) bool {
 }
 
 // SaveFromTracker all of the relevant metadata.
-func (tm *TrackerMetadata) SaveFromTracker(parentFolder string, t *tracker.Gazelle) error {
-	c, err := NewConfig(DefaultConfigurationFile)
-	if err != nil {
-		return err
-	}
-
+func (tm *TrackerMetadata) SaveFromTracker(parentFolder string, t *tracker.Gazelle, conf *Config) error {
 	destination := filepath.Join(parentFolder, MetadataDir)
 	// create metadata dir if necessary
 	if err := os.MkdirAll(destination, 0775); err != nil {
@@ -508,7 +523,7 @@ func (tm *TrackerMetadata) SaveFromTracker(parentFolder string, t *tracker.Gazel
 			}
 		}
 
-		if c.General.FullMetadataRetrieval {
+		if conf.General.FullMetadataRetrieval {
 			// getting collages
 			var allCollages []tracker.CollageInfo
 			allCollages = append(allCollages, gzTorrentGroup.Group.Collages...)
@@ -538,7 +553,7 @@ func (tm *TrackerMetadata) SaveFromTracker(parentFolder string, t *tracker.Gazel
 
 	// get artist info
 	for _, a := range tm.Artists {
-		if a.Role == "Main" || c.General.FullMetadataRetrieval {
+		if a.Role == "Main" || conf.General.FullMetadataRetrieval {
 			gzArtist, err := t.GetArtist(a.ID)
 			if err != nil {
 				logthis.Info(fmt.Sprintf(errorRetrievingArtistInfo+": %s", a.ID, err.Error()), logthis.NORMAL)
@@ -948,6 +963,8 @@ func (tm *TrackerMetadata) Release() *Release {
 	} else {
 		r.Year = tm.OriginalYear
 	}
+	r.EditionName = tm.EditionName
+	r.EditionYear = tm.EditionYear
 	r.ReleaseType = tm.ReleaseType
 	r.Format = tm.Format
 	r.Quality = tm.Quality
@@ -963,6 +980,7 @@ func (tm *TrackerMetadata) Release() *Release {
 	// r.TorrentFile =
 	r.Size = tm.Size
 	r.Folder = tm.FolderName
+	r.FilesHash = tm.FilesHash
 	r.LogScore = tm.LogScore
 	return r
 }
@@ -13,9 +13,6 @@ func TestGeneratePath(t *testing.T) {
 	fmt.Println("+ Testing TrackerMetadata/generatePath...")
 	check := assert.New(t)
 
-	_, configErr := NewConfig("test/test_complete.yaml")
-	check.Nil(configErr)
-
 	// setup logger
 	logthis.SetLevel(2)
 
@@ -4,7 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"path/filepath"
-	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -23,65 +23,23 @@ func MatchAllInSlice(a []string, b []string) bool {
 	return true
 }
 
-// MatchInSlice checks if a string regexp-matches a slice of patterns, returns bool
-func MatchInSlice(a string, b []string) bool {
-	// if no slice, no match by default
-	if len(b) == 0 {
-		return false
-	}
-
-	// finding the nature of the contents in b
-	var hasIncludes, hasExcludes bool
-	for _, p := range b {
-		if strings.HasPrefix(p, filterExcludeRegExpPrefix) {
-			hasExcludes = true
-		} else {
-			hasIncludes = true
-		}
+// intsToString joins a slice of ints with commas.
+func intsToString(a []int) string {
+	s := make([]string, len(a))
+	for i, el := range a {
+		s[i] = strconv.Itoa(el)
 	}
+	return strings.Join(s, ", ")
+}
 
-	// match if we only have excludes and no source string
-	if a == "" {
-		return !hasIncludes
-	}
-	var matchFound bool
-	for _, pattern := range b {
-		if strings.HasPrefix(pattern, filterRegExpPrefix) {
-			pattern = strings.Replace(pattern, filterRegExpPrefix, "", 1)
-			// try to match
-			match, err := regexp.MatchString(pattern, a)
-			if err != nil {
-				logthis.Error(err, logthis.VERBOSE)
-			}
-			if match {
-				if !hasExcludes {
-					return true // if only includes, one match is enough
-				}
-				matchFound = true // found match, but wait to see if it should be excluded
-			}
-		} else if strings.HasPrefix(pattern, filterExcludeRegExpPrefix) {
-			pattern = strings.Replace(pattern, filterExcludeRegExpPrefix, "", 1)
-			// try to match
-			match, err := regexp.MatchString(pattern, a)
-			if err != nil {
-				logthis.Error(err, logthis.VERBOSE)
-			}
-			if match {
-				return false // a is excluded
-			}
-		} else if pattern == a {
-			if !hasExcludes {
-				return true // if only includes, one match is enough
-			} else {
-				matchFound = true // found match, but wait to see if it should be excluded
-			}
-		}
-	}
-	if hasExcludes && !hasIncludes {
-		// if we're here, no excludes were triggered and that's the only thing that counts
-		return true
+// MatchInSlice checks if a string regexp-matches a slice of patterns, returns bool.
+// The patterns are compiled on every call: filters use the matchers compiled by ConfigFilter.prepare() instead.
+func MatchInSlice(a string, b []string) bool {
+	fm, err := newFilterMatcher(b)
+	if err != nil {
+		logthis.Error(err, logthis.VERBOSE)
 	}
-	return matchFound
+	return fm.Match(a)
 }
 
 // -----------------------------------------------------------------------------
@@ -27,6 +27,17 @@ var matchTestData = []matchTestStructs{
 	{[]string{"r/test$"}, "greatests", false},
 	{[]string{"r/^test"}, "greatests", false},
 	{[]string{}, "greatests", false},
+	{[]string{"re:^TEST"}, "Tests", true},
+	{[]string{"re:^beyonce$"}, "Beyoncé", true},
+	{[]string{"r/^beyonce$"}, "Beyoncé", false},
+	{[]string{"re:^test", "xr/s$"}, "Tests", false},
+	{[]string{"fuzzy:The Beatles"}, "beatles", true},
+	{[]string{"fuzzy:Beatles"}, "Beatles, The", true},
+	{[]string{"fuzzy:Sigur Ros"}, "Sigur Rós", true},
+	{[]string{"fuzzy:Simon & Garfunkel"}, "Simon and Garfunkel", true},
+	{[]string{"fuzzy:Blur"}, "Blue", false},
+	{[]string{"Björk"}, "Bjo\u0308rk", true},
+	{[]string{"re:("}, "(", false},
 }
 
 func TestSliceHelpers(t *testing.T) {
@@ -44,6 +55,6 @@ func TestSliceHelpers(t *testing.T) {
 
 	for _, data := range matchTestData {
 		result := MatchInSlice(data.candidate, data.patterns)
-		check.Equal(data.expected, result)
+		check.Equal(data.expected, result, data.candidate)
 	}
 }